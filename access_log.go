@@ -0,0 +1,97 @@
+package gohttpclient
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// accessLogLine is a line of NewJSONAccessLogger, its field names are stable.
+type accessLogLine struct {
+	Time                 string     `json:"time"`
+	Method               string     `json:"method"`
+	URL                  string     `json:"url"`
+	StatusCode           int        `json:"statusCode"`
+	RequestHeader        HTTPHeader `json:"requestHeader,omitempty"`
+	RequestBody          string     `json:"requestBody,omitempty"`
+	RequestBodyEncoding  string     `json:"requestBodyEncoding,omitempty"`
+	ResponseHeader       HTTPHeader `json:"responseHeader,omitempty"`
+	ResponseBody         string     `json:"responseBody,omitempty"`
+	ResponseBodyEncoding string     `json:"responseBodyEncoding,omitempty"`
+	Fingerprint          string     `json:"fingerprint,omitempty"`
+	ExecuteTimeMs        int64      `json:"executeTimeMs"`
+	WallTimeMs           int64      `json:"wallTimeMs"`
+	UpstreamTimeMs       int64      `json:"upstreamTimeMs"`
+	Attempts             int        `json:"attempts"`
+	RemoteAddr           string     `json:"remoteAddr,omitempty"`
+	FromCache            bool       `json:"fromCache,omitempty"`
+	FromCircuitBreaker   bool       `json:"fromCircuitBreaker,omitempty"`
+	RetriesExhausted     bool       `json:"retriesExhausted,omitempty"`
+	FaultInjected        bool       `json:"faultInjected,omitempty"`
+	Slow                 bool       `json:"slow,omitempty"`
+	PolicyDenied         bool       `json:"policyDenied,omitempty"`
+	Error                string     `json:"error,omitempty"`
+	ErrorCategory        string     `json:"errorCategory,omitempty"`
+}
+
+// NewJSONAccessLogger creates a LoggerFunc that writes each entry to w as a line of a JSON object,
+// independent of the Logger of the LoggerOption. The field names are the same as the ones of the default LoggerFunc,
+// the time is the start time of the request in RFC 3339, and the error is the text of LoggerEntry.Error.
+// The lines are written by a single Write each, serialized by a mutex, so w can be shared by the clients,
+// and it can be a rotating writer, the file is never opened nor closed here.
+func NewJSONAccessLogger(w io.Writer) LoggerFunc {
+	var mu sync.Mutex
+	return func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		line := accessLogLine{
+			Method:             e.Method,
+			URL:                e.URL,
+			StatusCode:         e.StatusCode,
+			RequestHeader:      copyHTTPHeader(e.RequestHeader),
+			ResponseHeader:     copyHTTPHeader(e.ResponseHeader),
+			Fingerprint:        string(e.Fingerprint),
+			ExecuteTimeMs:      e.ExecuteTime.Milliseconds(),
+			WallTimeMs:         e.WallTime.Milliseconds(),
+			UpstreamTimeMs:     e.UpstreamTime.Milliseconds(),
+			Attempts:           e.Attempts,
+			RemoteAddr:         e.RemoteAddr,
+			FromCache:          e.FromCache,
+			FromCircuitBreaker: e.FromCircuitBreaker,
+			RetriesExhausted:   e.RetriesExhausted,
+			FaultInjected:      e.FaultInjected,
+			Slow:               e.Slow,
+			PolicyDenied:       e.PolicyDenied,
+		}
+		if !e.StartTime.IsZero() {
+			line.Time = e.StartTime.Format(time.RFC3339Nano)
+		}
+		var encoded bool
+		if line.RequestBody, encoded = option.BinaryBodyEncoding.encode(e.RequestBody); encoded {
+			line.RequestBodyEncoding = option.BinaryBodyEncoding.String()
+		}
+		if line.ResponseBody, encoded = option.BinaryBodyEncoding.encode(e.ResponseBody); encoded {
+			line.ResponseBodyEncoding = option.BinaryBodyEncoding.String()
+		}
+		if e.Error != nil {
+			line.Error = e.Error.Error()
+		}
+		if e.ErrorCategory != ErrorCategoryNone {
+			line.ErrorCategory = e.ErrorCategory.String()
+		}
+
+		data, err := json.Marshal(line)
+		if err != nil {
+			logrus.WithError(err).Warn("gohttpclient encode access log")
+			return
+		}
+		data = append(data, '\n')
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := w.Write(data); err != nil {
+			logrus.WithError(err).Warn("gohttpclient write access log")
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gohttpclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readTestAccessLog(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestNewJSONAccessLogger(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/ok": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("pong"))
+		},
+		"/binary": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte{0xff, 0xfe})
+		},
+	})
+	var buf bytes.Buffer
+	option := NewLoggerOption()
+	option.LogFingerprint = false
+	option.LoggerFunc = NewJSONAccessLogger(&buf)
+	c := NewClient(WithLoggerOption(option), WithCacheOption(NewMemoryCacheOption()))
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Post(ts.URL("/ok"), "text/plain", strings.NewReader("ping"))
+		require.Nil(t, err)
+		resp.Body.Close()
+		resp, err = c.Get(ts.URL("/ok"))
+		require.Nil(t, err)
+		resp.Body.Close()
+	}
+	resp, err := c.Get(ts.URL("/binary"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	_, err = c.Get("http://127.0.0.1:1/refused")
+	require.NotNil(t, err)
+
+	lines := readTestAccessLog(t, &buf)
+	require.Len(t, lines, 6)
+
+	post := lines[0]
+	require.Equal(t, "POST", post["method"])
+	require.Equal(t, ts.URL("/ok"), post["url"])
+	require.Equal(t, float64(200), post["statusCode"])
+	require.Equal(t, "pong", post["responseBody"])
+	require.Equal(t, "text/plain", post["responseHeader"].(map[string]interface{})["Content-Type"])
+	require.Equal(t, float64(1), post["attempts"])
+	_, err = time.Parse(time.RFC3339Nano, post["time"].(string))
+	require.Nil(t, err)
+	require.Nil(t, post["fromCache"])
+	require.Nil(t, post["error"])
+
+	// The second GET is served from the cache.
+	cached := lines[3]
+	require.Equal(t, "GET", cached["method"])
+	require.Equal(t, true, cached["fromCache"])
+	require.Equal(t, float64(0), cached["attempts"])
+	require.Equal(t, "pong", cached["responseBody"])
+
+	binary := lines[4]
+	require.Equal(t, "//4=", binary["responseBody"])
+	require.Equal(t, "base64", binary["responseBodyEncoding"])
+
+	// The failed request has no response.
+	failed := lines[5]
+	require.Equal(t, float64(0), failed["statusCode"])
+	require.Contains(t, failed["error"], "connection refused")
+	require.Equal(t, "network", failed["errorCategory"])
+	require.Nil(t, failed["responseHeader"])
+	require.Nil(t, failed["responseBody"])
+}
+
+func TestNewJSONAccessLogger_Concurrent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONAccessLogger(&buf)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	entry, err := BuildLoggerEntry(req, nil, NewLoggerOption(), time.Now())
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger(req, entry, NewLoggerOption())
+		}()
+	}
+	wg.Wait()
+
+	lines := readTestAccessLog(t, &buf)
+	require.Len(t, lines, 50)
+	for _, line := range lines {
+		require.Equal(t, "https://example.com/", line["url"])
+		require.Equal(t, float64(0), line["statusCode"])
+	}
+}
@@ -0,0 +1,208 @@
+package gohttpclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrThrottled is returned when the concurrency limit of the host is reached and its queue is full.
+var ErrThrottled = errors.New("The request is throttled")
+
+// AdaptiveOption defines an adaptive concurrency limit of each host,
+// which is adjusted by AIMD, additive increase and multiplicative decrease, based on the latency and the errors.
+type AdaptiveOption struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// LatencyTarget is the expected latency, the limit grows slowly while the requests are faster than it,
+	// and is cut when they are more than twice slower, or fail.
+	LatencyTarget time.Duration
+	// BackoffRatio is the ratio the limit is multiplied by when it is cut.
+	BackoffRatio float64
+	// QueueSize is the maximum number of requests of a host waiting for the limit,
+	// the requests beyond it fail with ErrThrottled.
+	QueueSize int
+	// Limiters stores the limiter of each host, the copies of the option share them.
+	Limiters *sync.Map
+	// Clock is the source of time for the latency, RealClock is used when it is nil.
+	Clock Clock
+}
+
+// NewAdaptiveOption creates an adaptive throttle option configuration,
+// the limit of each host starts at initialLimit and stays between minLimit and maxLimit.
+// At most maxLimit requests of a host wait for the limit.
+func NewAdaptiveOption(initialLimit, minLimit, maxLimit int, latencyTarget time.Duration) AdaptiveOption {
+	return AdaptiveOption{
+		InitialLimit:  initialLimit,
+		MinLimit:      minLimit,
+		MaxLimit:      maxLimit,
+		LatencyTarget: latencyTarget,
+		BackoffRatio:  0.9,
+		QueueSize:     maxLimit,
+		Limiters:      &sync.Map{},
+	}
+}
+
+func (o AdaptiveOption) isEnabled() bool {
+	return o.Limiters != nil && o.MaxLimit > 0 && o.LatencyTarget > 0
+}
+
+// Limit returns the current concurrency limit of the host, which is useful for dashboards.
+func (o AdaptiveOption) Limit(host string) (int, bool) {
+	if o.Limiters == nil {
+		return 0, false
+	}
+	val, ok := o.Limiters.Load(strings.ToLower(host))
+	if !ok {
+		return 0, false
+	}
+	return val.(*adaptiveLimiter).currentLimit(), true
+}
+
+// Limits returns the current concurrency limits of all the hosts.
+func (o AdaptiveOption) Limits() map[string]int {
+	limits := make(map[string]int)
+	if o.Limiters == nil {
+		return limits
+	}
+	o.Limiters.Range(func(key, val interface{}) bool {
+		limits[key.(string)] = val.(*adaptiveLimiter).currentLimit()
+		return true
+	})
+	return limits
+}
+
+// AdaptiveHandler creates an interceptor that limits the concurrent requests of each host by an adaptive limit.
+// The body of a request that does not get a slot is closed like http.Client does for the failed requests.
+func AdaptiveHandler(option AdaptiveOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		host := ""
+		if req != nil && req.URL != nil {
+			host = strings.ToLower(req.URL.Host)
+		}
+		val, ok := option.Limiters.Load(host)
+		if !ok {
+			val, _ = option.Limiters.LoadOrStore(host, newAdaptiveLimiter(option))
+		}
+		l := val.(*adaptiveLimiter)
+
+		if err := l.acquire(getRequestContext(req)); err != nil {
+			if e := explainRequest(req); e != nil && err == ErrThrottled {
+				e.add("adaptive", "reject", 0, "limit %d reached for host %s", l.currentLimit(), host)
+			}
+			closeRequestBody(req)
+			return nil, err
+		}
+
+		clock := getClock(option.Clock)
+		start := clock.Now()
+		resp, err := handlerFunc(req)
+		failed := err != nil || (resp != nil && (resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests))
+		l.release(clock.Now().Sub(start), failed)
+		return resp, err
+	}
+}
+
+// adaptiveLimiter is the limiter of a host, the waiting requests are granted in order.
+type adaptiveLimiter struct {
+	option AdaptiveOption
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	waiters  []chan struct{}
+}
+
+func newAdaptiveLimiter(option AdaptiveOption) *adaptiveLimiter {
+	l := &adaptiveLimiter{option: option, limit: float64(option.InitialLimit)}
+	l.limit = l.clamp(l.limit)
+	return l
+}
+
+func (l *adaptiveLimiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *adaptiveLimiter) clamp(limit float64) float64 {
+	minLimit := float64(l.option.MinLimit)
+	if minLimit < 1 {
+		minLimit = 1
+	}
+	if limit < minLimit {
+		return minLimit
+	}
+	if maxLimit := float64(l.option.MaxLimit); limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
+func (l *adaptiveLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inflight < int(l.limit) && len(l.waiters) == 0 {
+		l.inflight++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.option.QueueSize {
+		l.mu.Unlock()
+		return ErrThrottled
+	}
+	ch := make(chan struct{})
+	l.waiters = append(l.waiters, ch)
+	l.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range l.waiters {
+			if w == ch {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// The slot has been granted, give it to the next one.
+		l.inflight--
+		l.grant()
+		return ctx.Err()
+	}
+}
+
+// release adjusts the limit by the result of a request and grants its slot to the waiting requests.
+func (l *adaptiveLimiter) release(rtt time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ratio := l.option.BackoffRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = 0.9
+	}
+	switch {
+	case failed || rtt > 2*l.option.LatencyTarget:
+		l.limit = l.clamp(l.limit * ratio)
+	case rtt <= l.option.LatencyTarget && float64(l.inflight)*2 >= l.limit:
+		// The limit only grows while it is used, by about 1 for every limit successful requests.
+		l.limit = l.clamp(l.limit + 1/l.limit)
+	}
+	l.inflight--
+	l.grant()
+}
+
+func (l *adaptiveLimiter) grant() {
+	for len(l.waiters) > 0 && l.inflight < int(l.limit) {
+		ch := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.inflight++
+		close(ch)
+	}
+}
@@ -0,0 +1,194 @@
+package gohttpclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveHandler_Converges(t *testing.T) {
+	option := NewAdaptiveOption(5, 1, 100, 4*time.Millisecond)
+	handler := AdaptiveHandler(option)
+
+	// The latency grows with the concurrency, it meets the target below about 8 concurrent requests.
+	var inflight int32
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		time.Sleep(time.Duration(n) * 500 * time.Microsecond)
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+
+	var (
+		mu     sync.Mutex
+		limits []int
+	)
+	var wg sync.WaitGroup
+	deadline := time.Now().Add(time.Second)
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				req, _ := http.NewRequest(http.MethodGet, "https://Example.com/path", nil)
+				_, err := handler(req, handlerFunc)
+				if err == ErrThrottled {
+					time.Sleep(time.Millisecond)
+					continue
+				}
+				limit, _ := option.Limit("example.com")
+				mu.Lock()
+				limits = append(limits, limit)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.NotEmpty(t, limits)
+	// The limit settles around the capacity in the second half instead of oscillating between the bounds.
+	for _, limit := range limits[len(limits)/2:] {
+		require.GreaterOrEqual(t, limit, 2)
+		require.LessOrEqual(t, limit, 20)
+	}
+	require.Equal(t, map[string]int{"example.com": limits[len(limits)-1]}, option.Limits())
+}
+
+func TestAdaptiveHandler_Throttled(t *testing.T) {
+	option := NewAdaptiveOption(1, 1, 1, time.Second)
+	option.QueueSize = 1
+	handler := AdaptiveHandler(option)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		started <- struct{}{}
+		<-release
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	errs := make(chan error, 2)
+	go func() {
+		_, err := handler(req, handlerFunc)
+		errs <- err
+	}()
+	<-started
+
+	// The second request waits in the queue, and the third one is rejected.
+	go func() {
+		_, err := handler(req, handlerFunc)
+		errs <- err
+	}()
+	require.Eventually(t, func() bool {
+		val, _ := option.Limiters.Load("example.com")
+		l := val.(*adaptiveLimiter)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.waiters) == 1
+	}, time.Second, time.Millisecond)
+	_, err := handler(req, handlerFunc)
+	require.Equal(t, ErrThrottled, err)
+
+	// A waiting request gives up when its context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = handler(req.WithContext(ctx), handlerFunc)
+	require.Equal(t, ErrThrottled, err)
+
+	close(release)
+	require.Nil(t, <-errs)
+	require.Nil(t, <-errs)
+}
+
+func TestAdaptiveHandler_ContextCanceled(t *testing.T) {
+	option := NewAdaptiveOption(1, 1, 1, time.Second)
+	handler := AdaptiveHandler(option)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		_, _ = handler(req, func(req *http.Request) (*http.Response, error) {
+			close(started)
+			<-release
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	body := &testTrackingBody{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://example.com", body)
+	_, err := handler(req, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, body.closed)
+	close(release)
+}
+
+func TestAdaptiveLimiter_AIMD(t *testing.T) {
+	option := NewAdaptiveOption(10, 2, 11, 10*time.Millisecond)
+	l := newAdaptiveLimiter(option)
+
+	for i := 0; i < 10; i++ {
+		require.Nil(t, l.acquire(context.Background()))
+	}
+	// The successful requests grow the limit by about 1 for every limit of them while it is used.
+	for i := 0; i < 10; i++ {
+		l.release(time.Millisecond, false)
+		require.Nil(t, l.acquire(context.Background()))
+	}
+	require.Equal(t, 10, l.currentLimit())
+	require.InDelta(t, 11, l.limit, 0.1)
+	// The latencies between the target and twice of it keep the limit.
+	for i := 0; i < 10; i++ {
+		l.release(15*time.Millisecond, false)
+	}
+	require.InDelta(t, 11, l.limit, 0.1)
+
+	// The errors and the slow requests cut the limit.
+	require.Nil(t, l.acquire(context.Background()))
+	l.release(time.Millisecond, true)
+	require.InDelta(t, 9.9, l.limit, 0.1)
+	require.Nil(t, l.acquire(context.Background()))
+	l.release(30*time.Millisecond, false)
+	require.InDelta(t, 8.9, l.limit, 0.1)
+
+	// The successful requests do not grow the limit while it is not used.
+	require.Nil(t, l.acquire(context.Background()))
+	l.release(time.Millisecond, false)
+	require.InDelta(t, 8.9, l.limit, 0.1)
+
+	for i := 0; i < 100; i++ {
+		require.Nil(t, l.acquire(context.Background()))
+		l.release(time.Millisecond, true)
+	}
+	require.Equal(t, 2, l.currentLimit())
+}
+
+func TestAdaptiveHandler_Explain(t *testing.T) {
+	option := NewAdaptiveOption(1, 1, 1, time.Second)
+	option.QueueSize = 0
+	handler := AdaptiveHandler(option)
+
+	val, _ := option.Limiters.LoadOrStore("example.com", newAdaptiveLimiter(option))
+	require.Nil(t, val.(*adaptiveLimiter).acquire(context.Background()))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req = req.WithContext(WithExplain(req.Context()))
+	_, err := handler(req, nil)
+	require.True(t, errors.Is(err, ErrThrottled))
+	records := ExplainFromContext(req.Context())
+	require.Len(t, records, 1)
+	require.Equal(t, "limit 1 reached for host example.com", records[0].Reason)
+}
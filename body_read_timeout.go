@@ -0,0 +1,157 @@
+package gohttpclient
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBodyReadTimeout is returned by the reads of a response body when no bytes arrive within
+// the interval of WithBodyReadTimeout.
+var ErrBodyReadTimeout = errors.New("No bytes of the response body arrived within the read timeout")
+
+// BodyReadTimeoutOption defines the configuration of the watchdog of the response body reads.
+type BodyReadTimeoutOption struct {
+	// Interval is the maximum time a read of the response body waits for bytes to arrive.
+	Interval time.Duration
+	// Clock is the source of time for the watchdog, RealClock is used when it is nil.
+	Clock Clock
+}
+
+// NewBodyReadTimeoutOption creates a body read timeout option configuration,
+// each read of the response body fails with ErrBodyReadTimeout when no bytes arrive within interval.
+func NewBodyReadTimeoutOption(interval time.Duration) BodyReadTimeoutOption {
+	return BodyReadTimeoutOption{
+		Interval: interval,
+	}
+}
+
+func (o BodyReadTimeoutOption) isEnabled() bool {
+	return o.Interval > 0
+}
+
+// BodyReadTimeoutHandler creates an interceptor that guards the reads of the response body by a watchdog,
+// a read that waits longer than the interval for bytes closes the body and fails with ErrBodyReadTimeout.
+// Unlike WithRequestTimeout, it only bounds the time between the bytes, so a large body of a server that
+// keeps sending is never cut off, while a server that stops sending after the headers is detected.
+// The time the caller spends between the reads is not counted.
+func BodyReadTimeoutHandler(option BodyReadTimeoutOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		resp, err := handlerFunc(req)
+		if err != nil || resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+			return resp, err
+		}
+		resp.Body = &watchdogReadCloser{rc: resp.Body, interval: option.Interval, clock: getClock(option.Clock)}
+		return resp, err
+	}
+}
+
+// watchdogReadCloser closes the body when a read waits longer than the interval.
+// Its timer and the goroutine watching it are created by the first read, the timer is reset by each read
+// and stopped when the read returns.
+type watchdogReadCloser struct {
+	rc       io.ReadCloser
+	interval time.Duration
+	clock    Clock
+
+	mu       sync.Mutex
+	timer    Timer
+	reading  bool
+	deadline time.Time
+	timedOut bool
+	// rearm tells the watching goroutine that the timer is replaced, for the timers that can not be reset.
+	rearm chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (w *watchdogReadCloser) Read(p []byte) (int, error) {
+	w.mu.Lock()
+	if w.timedOut {
+		w.mu.Unlock()
+		return 0, ErrBodyReadTimeout
+	}
+	w.reading = true
+	w.deadline = w.clock.Now().Add(w.interval)
+	w.arm()
+	w.mu.Unlock()
+
+	n, err := w.rc.Read(p)
+
+	w.mu.Lock()
+	w.reading = false
+	w.timer.Stop()
+	timedOut := w.timedOut
+	w.mu.Unlock()
+	if err != nil {
+		w.stop()
+	}
+	if err != nil && timedOut {
+		return n, ErrBodyReadTimeout
+	}
+	return n, err
+}
+
+// arm starts the timer of the interval, it must be called with the lock held.
+func (w *watchdogReadCloser) arm() {
+	if w.timer == nil {
+		w.timer = w.clock.NewTimer(w.interval)
+		w.rearm = make(chan struct{}, 1)
+		w.done = make(chan struct{})
+		go w.watch()
+		return
+	}
+	if r, ok := w.timer.(timerResetter); ok {
+		r.Reset(w.interval)
+		return
+	}
+	w.timer = w.clock.NewTimer(w.interval)
+	select {
+	case w.rearm <- struct{}{}:
+	default:
+	}
+}
+
+// watch closes the body when the timer fires during a read that has passed its deadline,
+// the fires between the reads are ignored.
+func (w *watchdogReadCloser) watch() {
+	for {
+		w.mu.Lock()
+		c := w.timer.C()
+		w.mu.Unlock()
+		select {
+		case <-w.done:
+			return
+		case <-w.rearm:
+		case <-c:
+			w.mu.Lock()
+			expired := w.reading && !w.clock.Now().Before(w.deadline)
+			if expired {
+				w.timedOut = true
+			}
+			w.mu.Unlock()
+			if expired {
+				_ = w.rc.Close()
+				return
+			}
+		}
+	}
+}
+
+// stop ends the goroutine watching the timer, the body is no longer read.
+func (w *watchdogReadCloser) stop() {
+	w.mu.Lock()
+	done := w.done
+	w.mu.Unlock()
+	if done != nil {
+		w.once.Do(func() { close(done) })
+	}
+}
+
+func (w *watchdogReadCloser) Close() error {
+	w.stop()
+	return w.rc.Close()
+}
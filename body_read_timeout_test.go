@@ -0,0 +1,138 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newStallingServer(stall <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func TestBodyReadTimeoutHandler(t *testing.T) {
+	stall := make(chan struct{})
+	ts := newStallingServer(stall)
+	defer ts.Close()
+	defer close(stall)
+
+	clock := NewFakeClock(time.Now())
+	option := NewBodyReadTimeoutOption(time.Second)
+	option.Clock = clock
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := BodyReadTimeoutHandler(option)(req, http.DefaultClient.Do)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(resp.Body, buf)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(buf))
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := resp.Body.Read(buf)
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	require.Equal(t, ErrBodyReadTimeout, <-errc)
+
+	_, err = resp.Body.Read(buf)
+	require.Equal(t, ErrBodyReadTimeout, err)
+}
+
+func TestWithBodyReadTimeout(t *testing.T) {
+	stall := make(chan struct{})
+	ts := newStallingServer(stall)
+	defer ts.Close()
+	defer close(stall)
+
+	c := NewClient(WithBodyReadTimeout(50 * time.Millisecond))
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Equal(t, ErrBodyReadTimeout, err)
+	require.Equal(t, "hello", string(body))
+
+	// The body that keeps arriving is read in full.
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err = BodyReadTimeoutHandler(NewBodyReadTimeoutOption(time.Second))(req, handlerFunc)
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "hello world", string(body))
+}
+
+// countingClock counts the timers of the fake clock, and hides their Reset when resettable is false.
+type countingClock struct {
+	*FakeClock
+	resettable bool
+	timers     int32
+}
+
+func (c *countingClock) NewTimer(d time.Duration) Timer {
+	atomic.AddInt32(&c.timers, 1)
+	t := c.FakeClock.NewTimer(d)
+	if c.resettable {
+		return t
+	}
+	return struct{ Timer }{t}
+}
+
+func TestBodyReadTimeoutHandler_Timer(t *testing.T) {
+	for _, resettable := range []bool{true, false} {
+		clock := &countingClock{FakeClock: NewFakeClock(time.Now()), resettable: resettable}
+		option := NewBodyReadTimeoutOption(time.Second)
+		option.Clock = clock
+		pr, pw := io.Pipe()
+		handlerFunc := func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: pr}, nil
+		}
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		resp, err := BodyReadTimeoutHandler(option)(req, handlerFunc)
+		require.Nil(t, err)
+
+		// The body read in small chunks resets the same timer.
+		go func() {
+			_, _ = pw.Write([]byte("hello world"))
+		}()
+		buf := make([]byte, 1)
+		for i := 0; i < len("hello world"); i++ {
+			_, err = io.ReadFull(resp.Body, buf)
+			require.Nil(t, err)
+		}
+		if resettable {
+			require.Equal(t, int32(1), atomic.LoadInt32(&clock.timers))
+		}
+
+		// The time between the reads is not counted.
+		clock.Advance(time.Hour)
+		errc := make(chan error, 1)
+		go func() {
+			_, err := resp.Body.Read(buf)
+			errc <- err
+		}()
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		require.Equal(t, ErrBodyReadTimeout, <-errc)
+		require.Nil(t, resp.Body.Close())
+	}
+}
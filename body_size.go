@@ -7,6 +7,9 @@ import (
 	"github.com/pkg/errors"
 )
 
+// ErrResponseBodyTooLarge is returned when the response body exceeds the maximum size.
+var ErrResponseBodyTooLarge = errors.New("The server response data is too large")
+
 // BodySizeOption is used to set the maximum size of the server response data.
 type BodySizeOption struct {
 	MaxBodySize uint64
@@ -17,6 +20,8 @@ type BodySizeOption struct {
 // In detail, the restriction is implemented through
 // the Content-Length field of the HTTP response header returned by the server.
 // The limit can only limit honest servers.
+// For streaming requests, see MarkStreaming, the body is also wrapped by a limiting reader,
+// so that a missing or dishonest Content-Length fails while reading.
 func NewBodySizeOption(maxBodySize uint64) BodySizeOption {
 	return BodySizeOption{MaxBodySize: maxBodySize}
 }
@@ -33,15 +38,24 @@ func BodySizeHandler(option BodySizeOption) RequestHandler {
 			return
 		}
 
+		streaming := isStreamingRequest(req)
+
 		contentLengthStr := resp.Header.Get("Content-Length")
 		contentLength, err := strconv.ParseUint(contentLengthStr, 10, 64)
-		if err != nil {
+		if err != nil && !(streaming && contentLengthStr == "") {
 			return nil, errors.Wrap(err, "Parse the data size of the response content")
 		}
 
 		if contentLength > option.MaxBodySize {
-			return nil, errors.New("The server response data is too large")
+			if e := explainRequest(req); e != nil {
+				e.add("bodysize", "reject", 0, "content length %d exceeds %d bytes", contentLength, option.MaxBodySize)
+			}
+			return nil, ErrResponseBodyTooLarge
+		}
+
+		if streaming && resp.Body != nil {
+			resp.Body = &limitedReadCloser{rc: resp.Body, n: option.MaxBodySize}
 		}
-		return
+		return resp, nil
 	}
 }
@@ -3,6 +3,7 @@ package gohttpclient
 import (
 	"bytes"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -55,6 +56,25 @@ func TestBodySizeHandler_BodySizeIsOK(t *testing.T) {
 	require.NotNil(t, resp)
 }
 
+func TestBodySizeHandler_MaxUint64(t *testing.T) {
+	option := NewBodySizeOption(math.MaxUint64)
+	handler := BodySizeHandler(option)
+
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	// The body of a streaming response without a Content-Length is limited while it is read.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req = req.WithContext(MarkStreaming(req.Context()))
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.IsType(t, &limitedReadCloser{}, resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "hello world", string(body))
+}
+
 func TestBodySizeHandler_InvalidContentLengthString(t *testing.T) {
 	option := NewBodySizeOption(10)
 	handler := BodySizeHandler(option)
@@ -0,0 +1,50 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ResponseBodyTransformFunc transforms the body of a response, such as stripping a prefix or decrypting the payload.
+type ResponseBodyTransformFunc func(resp *http.Response, body []byte) ([]byte, error)
+
+// StripResponseBodyPrefix creates a ResponseBodyTransformFunc that removes the prefix from the body if present,
+// such as the ")]}'\n" that some APIs prepend to JSON to prevent JSON hijacking.
+func StripResponseBodyPrefix(prefix string) ResponseBodyTransformFunc {
+	return func(resp *http.Response, body []byte) ([]byte, error) {
+		return bytes.TrimPrefix(body, []byte(prefix)), nil
+	}
+}
+
+// ResponseBodyTransformHandler creates an interceptor that reads the response body,
+// and replaces it with the result of the transform before the caller reads it.
+// The bodies of streaming requests are not transformed, see MarkStreaming.
+func ResponseBodyTransformHandler(transform ResponseBodyTransformFunc) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		resp, err := handlerFunc(req)
+		if err != nil || resp == nil || resp.Body == nil || isStreamingRequest(req) {
+			return resp, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Read the response body")
+		}
+		body, err = transform(resp, body)
+		if err != nil {
+			return nil, errors.Wrap(err, "Transform the response body")
+		}
+
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		if resp.Header != nil && resp.Header.Get("Content-Length") != "" {
+			resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		return resp, nil
+	}
+}
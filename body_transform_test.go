@@ -0,0 +1,80 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseBodyTransformHandler(t *testing.T) {
+	handler := ResponseBodyTransformHandler(StripResponseBodyPrefix(")]}'\n"))
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Length": {"17"}},
+			ContentLength: 17,
+			Body:          io.NopCloser(bytes.NewBufferString(")]}'\n{\"a\":\"b\"}\n")),
+		}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, "{\"a\":\"b\"}\n", string(body))
+	require.Equal(t, int64(10), resp.ContentLength)
+	require.Equal(t, "10", resp.Header.Get("Content-Length"))
+
+	// The bodies of streaming requests are not transformed.
+	req = req.WithContext(MarkStreaming(req.Context()))
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	require.Equal(t, ")]}'\n{\"a\":\"b\"}\n", string(body))
+}
+
+func TestResponseBodyTransformHandler_WithError(t *testing.T) {
+	transformErr := errors.New("transform error")
+	handler := ResponseBodyTransformHandler(func(resp *http.Response, body []byte) ([]byte, error) {
+		return nil, transformErr
+	})
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	body := &testTrackingBody{Reader: bytes.NewBufferString("hello world")}
+	resp, err := handler(req, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: body}, nil
+	})
+	require.Nil(t, resp)
+	require.Equal(t, transformErr, errors.Cause(err))
+	require.True(t, body.closed)
+
+	resp, err = handler(req, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(&testErrReader{})}, nil
+	})
+	require.Nil(t, resp)
+	require.NotNil(t, err)
+
+	requestErr := errors.New("request error")
+	resp, err = handler(req, func(req *http.Request) (*http.Response, error) {
+		return nil, requestErr
+	})
+	require.Nil(t, resp)
+	require.Equal(t, requestErr, err)
+}
+
+func TestWithResponseBodyTransform(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(")]}'\n[1,2,3]"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithResponseBodyTransform(StripResponseBodyPrefix(")]}'\n")), WithMaxBodySize(1024))
+	body, err := c.GetBytes(srv.URL)
+	require.Nil(t, err)
+	require.Equal(t, "[1,2,3]", string(body))
+}
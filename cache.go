@@ -2,10 +2,17 @@ package gohttpclient
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/sha1"
 	"encoding/base64"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -23,12 +30,55 @@ type RequestHashFunc func(*http.Request, *http.Response, error) []byte
 
 // DefaultShouldCacheFunc is a function implemented by default to determine whether a request needs to be cached.
 // By default, only successful requests with HTTP method GET
-// and status code 200 will be cached for 5 minutes.
+// and status code 200, or 206 for the range requests, will be cached for 5 minutes.
+// The requests with HTTP method HEAD or OPTIONS, which only reach it when they are in CacheOption.CacheableMethods,
+// are cached with status code 200 or 204.
 // The same complete request link will be treated as the same request and may be cached.
 var DefaultShouldCacheFunc ShouldCacheFunc = func(req *http.Request, resp *http.Response, err error) bool {
-	ok := req != nil && req.URL != nil && req.Method == http.MethodGet &&
-		resp != nil && resp.StatusCode == http.StatusOK && err == nil
-	return ok
+	if req == nil || req.URL == nil || resp == nil || err != nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet:
+		return resp.StatusCode == cacheableStatusCode(req)
+	case http.MethodHead, http.MethodOptions:
+		return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNoContent
+	}
+	return false
+}
+
+// cacheableStatusCode returns the status code of the responses cached for the request,
+// which is 206 for a range request and 200 otherwise.
+func cacheableStatusCode(req *http.Request) int {
+	if isRangeRequest(req) {
+		return http.StatusPartialContent
+	}
+	return http.StatusOK
+}
+
+func isRangeRequest(req *http.Request) bool {
+	return req != nil && req.Header.Get("Range") != ""
+}
+
+// CacheContentTypes creates a ShouldCacheFunc that combines with DefaultShouldCacheFunc
+// and only caches responses whose Content-Type is one of the given media types,
+// such as CacheContentTypes("application/json", "text/html").
+// The parameters of the Content-Type, such as charset, are ignored when matching.
+func CacheContentTypes(contentTypes ...string) ShouldCacheFunc {
+	allowed := make(map[string]bool, len(contentTypes))
+	for _, contentType := range contentTypes {
+		allowed[strings.ToLower(strings.TrimSpace(contentType))] = true
+	}
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		if !DefaultShouldCacheFunc(req, resp, err) {
+			return false
+		}
+		mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if err != nil {
+			return false
+		}
+		return allowed[mediaType]
+	}
 }
 
 // DefaultRequestHashFunc is a function implemented by default to generate different hash values as cache keys according to different requests.
@@ -38,11 +88,168 @@ var DefaultRequestHashFunc RequestHashFunc = func(req *http.Request, resp *http.
 		return nil
 	}
 
-	bv := []byte(req.URL.String())
+	return hashBytes([]byte(req.URL.String()))
+}
+
+// HashByURLIgnoringParams creates a RequestHashFunc that works like DefaultRequestHashFunc,
+// but the named query params, such as timestamps and cache-busters, are removed from the URL before hashing.
+// The remaining params are sorted, so that their order does not change the cache key.
+func HashByURLIgnoringParams(params ...string) RequestHashFunc {
+	ignored := make(map[string]bool, len(params))
+	for _, param := range params {
+		ignored[param] = true
+	}
+	return hashByURLParams(func(param string) bool {
+		return !ignored[param]
+	})
+}
+
+// HashByURLWithParams creates a RequestHashFunc that works like DefaultRequestHashFunc,
+// but only the named query params are kept in the URL before hashing, for example,
+// HashByURLWithParams("q") caches /search?q=x&_=123456 by q only.
+// The kept params are sorted, so that their order does not change the cache key.
+func HashByURLWithParams(params ...string) RequestHashFunc {
+	kept := make(map[string]bool, len(params))
+	for _, param := range params {
+		kept[param] = true
+	}
+	return hashByURLParams(func(param string) bool {
+		return kept[param]
+	})
+}
+
+// HashByURLAndHeaders creates a RequestHashFunc that works like DefaultRequestHashFunc,
+// but the values of the named request headers are part of the key too, so that the responses
+// that vary by them, such as by Accept-Language, are cached separately.
+// The values are normalized, the comma separated elements are trimmed and lowercased,
+// so that "Text/HTML, application/json" and "text/html,application/json" share the key.
+func HashByURLAndHeaders(headers ...string) RequestHashFunc {
+	names := make([]string, len(headers))
+	for i, header := range headers {
+		names[i] = http.CanonicalHeaderKey(header)
+	}
+	return func(req *http.Request, resp *http.Response, err error) []byte {
+		ok := req != nil && req.URL != nil && req.Method == http.MethodGet
+		if !ok {
+			return nil
+		}
+
+		parts := make([][]byte, 0, len(names)+1)
+		parts = append(parts, []byte(req.URL.String()))
+		for _, name := range names {
+			parts = append(parts, []byte(name+": "+normalizeHeaderValues(req.Header.Values(name))))
+		}
+		return hashBytes(parts...)
+	}
+}
+
+// HashByURLAndAccept creates a RequestHashFunc that caches the representations of a URL
+// negotiated by the Accept and Accept-Encoding headers separately, see HashByURLAndHeaders.
+func HashByURLAndAccept() RequestHashFunc {
+	return HashByURLAndHeaders("Accept", "Accept-Encoding")
+}
+
+// HashByURLAndCookie creates a RequestHashFunc that works like DefaultRequestHashFunc,
+// but the named cookies, such as the session cookie, are part of the key too,
+// and the whole Cookie header is when no names are given.
+//
+// It matters for security: the key of DefaultRequestHashFunc is the URL only,
+// so the response of an authenticated GET cached for one user is served to any other user of the URL.
+// The cookies are hashed into the key, so they are not stored in the Cacher in clear.
+// The requests authenticated by other headers, such as Authorization, need HashByURLAndHeaders instead.
+func HashByURLAndCookie(names ...string) RequestHashFunc {
+	return func(req *http.Request, resp *http.Response, err error) []byte {
+		ok := req != nil && req.URL != nil && req.Method == http.MethodGet
+		if !ok {
+			return nil
+		}
+
+		parts := [][]byte{[]byte(req.URL.String())}
+		if len(names) == 0 {
+			return hashBytes(append(parts, []byte(strings.Join(req.Header.Values("Cookie"), "; ")))...)
+		}
+		for _, name := range names {
+			value := ""
+			if cookie, err := req.Cookie(name); err == nil {
+				value = cookie.Value
+			}
+			parts = append(parts, []byte(name+"="+value))
+		}
+		return hashBytes(parts...)
+	}
+}
+
+func normalizeHeaderValues(values []string) string {
+	var elements []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			element = strings.ToLower(strings.TrimSpace(element))
+			if element != "" {
+				elements = append(elements, element)
+			}
+		}
+	}
+	return strings.Join(elements, ",")
+}
+
+func hashByURLParams(keep func(param string) bool) RequestHashFunc {
+	return func(req *http.Request, resp *http.Response, err error) []byte {
+		ok := req != nil && req.URL != nil && req.Method == http.MethodGet
+		if !ok {
+			return nil
+		}
+
+		query := req.URL.Query()
+		for param := range query {
+			if !keep(param) {
+				delete(query, param)
+			}
+		}
+		u := *req.URL
+		u.RawQuery = query.Encode()
+		return hashBytes([]byte(u.String()))
+	}
+}
+
+// RequestFingerprint generates a stable hash value of the request, which is useful to find repeated identical requests.
+// For a GET request without body, the fingerprint is the same as the cache key of DefaultRequestHashFunc,
+// otherwise the method and the body of the request are also included.
+// The body is read from a copy returned by req.GetBody, the request itself is never changed.
+// The body is not included for streaming requests or requests without GetBody.
+func RequestFingerprint(req *http.Request) ([]byte, error) {
+	if req == nil || req.URL == nil {
+		return nil, errors.New("Request or URL is nil")
+	}
+
+	var body []byte
+	if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody && !isStreamingRequest(req) {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Method == http.MethodGet && len(body) == 0 {
+		return hashBytes([]byte(req.URL.String())), nil
+	}
+	return hashBytes([]byte(req.Method), []byte(req.URL.String()), body), nil
+}
+
+// hashBytes generates the URL-safe base64 encoded sha1 hash value of the parts.
+func hashBytes(parts ...[]byte) []byte {
 	hasher := sha1.New()
-	hasher.Write(bv)
+	for i, part := range parts {
+		if i > 0 {
+			hasher.Write([]byte{0})
+		}
+		hasher.Write(part)
+	}
 	sha := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
-
 	return []byte(sha)
 }
 
@@ -59,6 +266,64 @@ type CacheOption struct {
 	CacheTTLFunc    CacheTTLFunc
 	Cacher          Cacher
 	EncoderDecoder  RequestEntryEncoderDecoder
+	// MaxCacheableBodySize is the maximum size of the response body that will be cached.
+	// Larger responses are returned to the caller as usual, but are not stored.
+	// The default value of 0 means there is no limit.
+	MaxCacheableBodySize uint64
+	// StaleTTL keeps a copy of each cached response for this long after it expires,
+	// and the copy is only used by the fallback of the circuit breaker, see HystrixOption.FallbackCacheOption.
+	// When the Cacher implements CacherTTL, a single entry is stored for ttl+StaleTTL instead of two copies.
+	StaleTTL time.Duration
+	// AgeHeader sets whether to add an Age header to the responses served from the cache,
+	// which is the number of seconds since the response was stored.
+	AgeHeader bool
+	// Clock is the source of time for the cache entries, RealClock is used when it is nil.
+	Clock Clock
+	// OnError is called with a CacheDecodeError when a cached entry can not be decoded,
+	// the request is still made as a cache miss, and the entry is deleted if the Cacher implements CacherDeleter.
+	OnError func(err error)
+	// PartitionFunc returns the partition of a request, such as the tenant, which is part of its cache key,
+	// so that the requests of different partitions never share a cached response.
+	// The requests of the empty partition use the key of RequestHashFunc as is. See PartitionFromContext.
+	PartitionFunc func(req *http.Request) string
+	// CacheStatusHeader sets the CacheStatusHeader header of the responses served from the cache to HIT,
+	// the hits are always marked in LoggerEntry.FromCache.
+	CacheStatusHeader bool
+	// CompressCachedBodies stores the response bodies of at least CompressionMinBytes compressed by gzip,
+	// the responses are always served with the plain body, the right Content-Length and no Content-Encoding,
+	// and a body that the server encoded by gzip is stored and served decoded too.
+	// The entries stored without it are still decoded. It needs the default EncoderDecoder, or one wrapping it.
+	CompressCachedBodies bool
+	// CompressionMinBytes is the minimum size of the bodies compressed by CompressCachedBodies,
+	// smaller bodies are stored as they are. 0 compresses all the bodies.
+	CompressionMinBytes int
+	// LookupMethods are the methods of the requests whose responses are looked up in the cache,
+	// the default is GET. The requests of the methods in neither LookupMethods nor StoreMethods
+	// are passed through without hashing them or calling the Cacher.
+	LookupMethods []string
+	// StoreMethods are the methods of the requests whose responses may be stored, if ShouldCacheFunc allows it,
+	// the default is LookupMethods.
+	StoreMethods []string
+	// InMemoryBodyLimit is the maximum size of the response bodies buffered in memory to be stored, 0 means no limit.
+	// A larger body is spilled to a temporary file in SpillDir, the caller reads it from the file,
+	// which is removed when the body is closed, and it is streamed from the file to the Cacher
+	// when the Cacher implements CacherStream, such as FileCache, and the EncoderDecoder implements
+	// RequestEntryStreamEncoder, such as the default one. The spilled bodies are not compressed by CompressCachedBodies.
+	InMemoryBodyLimit int64
+	// SpillDir is the directory of the temporary files of InMemoryBodyLimit, the default is os.TempDir.
+	SpillDir string
+	// CacheableMethods are the methods other than GET, such as OPTIONS and HEAD, whose responses are looked up
+	// and stored too, if ShouldCacheFunc allows it. DefaultShouldCacheFunc allows the status code 200 or 204 of them.
+	// Their cache keys are the ones of RequestHashFunc for GET with the method mixed in,
+	// so they never collide with the key of a GET request of the same URL.
+	CacheableMethods []string
+	// TTLByMethod is the TTL of the responses by the method of their requests, such as OPTIONS for an hour,
+	// the methods that are not in it fall back to CacheTTLFunc. WithCacheTTL still takes precedence.
+	TTLByMethod map[string]time.Duration
+	// RequestCacheControl honors the Cache-Control directives of the requests, or Pragma: no-cache without it:
+	// a request with no-cache is not looked up and is sent to the upstream, and its response may still be stored,
+	// and a request with no-store is neither looked up nor stored.
+	RequestCacheControl bool
 }
 
 // NewCacheOption creates a new cache option and passes in a cache method.
@@ -81,58 +346,553 @@ func NewMemoryCacheOption() CacheOption {
 	return NewCacheOption(NewMemoryCache())
 }
 
+// defaultCacheLookupMethods is the default of CacheOption.LookupMethods.
+var defaultCacheLookupMethods = []string{http.MethodGet}
+
+func (o CacheOption) lookupsMethod(req *http.Request) bool {
+	methods := o.LookupMethods
+	if methods == nil {
+		methods = defaultCacheLookupMethods
+	}
+	return containsMethod(methods, req) || o.isCacheableMethod(req)
+}
+
+func (o CacheOption) storesMethod(req *http.Request) bool {
+	if o.StoreMethods == nil {
+		return o.lookupsMethod(req)
+	}
+	return containsMethod(o.StoreMethods, req) || o.isCacheableMethod(req)
+}
+
+// isCacheableMethod reports whether the method of the request is one of CacheableMethods other than GET.
+func (o CacheOption) isCacheableMethod(req *http.Request) bool {
+	return req != nil && req.Method != "" && req.Method != http.MethodGet && containsMethod(o.CacheableMethods, req)
+}
+
+// requestDirectives returns whether the request has the no-cache and no-store directives of Cache-Control,
+// they are always false without RequestCacheControl.
+func (o CacheOption) requestDirectives(req *http.Request) (noCache, noStore bool) {
+	if !o.RequestCacheControl || req == nil {
+		return false, false
+	}
+	values := req.Header.Values("Cache-Control")
+	if len(values) == 0 {
+		values = req.Header.Values("Pragma")
+	}
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name := strings.TrimSpace(directive)
+			if i := strings.IndexByte(name, '='); i >= 0 {
+				name = strings.TrimSpace(name[:i])
+			}
+			switch strings.ToLower(name) {
+			case "no-cache":
+				noCache = true
+			case "no-store":
+				noStore = true
+			}
+		}
+	}
+	return noCache, noStore
+}
+
+func containsMethod(methods []string, req *http.Request) bool {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheStatusHeader is the header set to HIT on the responses served from the cache, see CacheOption.CacheStatusHeader.
+const CacheStatusHeader = "X-Gohttpclient-Cache"
+
+// markCacheHit marks the response of the request as served from the cache.
+func markCacheHit(req *http.Request, resp *http.Response, option CacheOption) {
+	getResponseSource(req).markFromCache()
+	if option.CacheStatusHeader && resp != nil {
+		if resp.Header == nil {
+			resp.Header = http.Header{}
+		}
+		resp.Header.Set(CacheStatusHeader, "HIT")
+	}
+}
+
 func (o CacheOption) isEnabled() bool {
 	return o.ShouldCacheFunc != nil && o.RequestHashFunc != nil &&
 		o.CacheTTLFunc != nil && o.Cacher != nil && o.EncoderDecoder != nil
 }
 
 // CacheHandler is a cache interceptor that caches request content and server-side response content.
+// Only the responses of the methods of CacheOption.LookupMethods and StoreMethods are looked up and stored.
+// The responses of streaming requests are never stored, see MarkStreaming.
+// The cache operations are bounded by the context of the request, see CacherContext.
+// The cached bodies encoded by gzip are served decoded, unless the request asks for gzip by its Accept-Encoding.
 func CacheHandler(option CacheOption) RequestHandler {
 	return func(req *http.Request, handlerFunc RequestHandlerFunc) (resp *http.Response, returnErr error) {
-		hash := option.RequestHashFunc(req, nil, nil)
+		e := explainRequest(req)
+		lookup, store := option.lookupsMethod(req), option.storesMethod(req)
+		if noCache, noStore := option.requestDirectives(req); noStore && (lookup || store) {
+			if e != nil {
+				e.add("cache", "skip", 0, "request Cache-Control: no-store")
+			}
+			return handlerFunc(req)
+		} else if noCache && lookup {
+			lookup = false
+			if e != nil {
+				e.add("cache", "miss", 0, "request Cache-Control: no-cache")
+			}
+		}
+		if !lookup && !store {
+			if e != nil {
+				e.add("cache", "skip", 0, "method %s is not cached", req.Method)
+			}
+			return handlerFunc(req)
+		}
+
+		var hash []byte
+		if lookup {
+			hash = option.cacheKey(req, nil, nil)
+		}
 		if hash != nil {
-			cacheValue, err := option.Cacher.Get(hash)
+			cacheValue, err := getFreshCacheValue(getRequestContext(req), option, hash)
 			if err == nil {
 				re, err := option.EncoderDecoder.Decode(cacheValue)
-				if err == nil {
+				if err == nil && isFreshEnough(req, re, option) {
+					if option.AgeHeader && re.Response != nil && !re.StoredAt.IsZero() {
+						age := getClock(option.Clock).Now().Sub(re.StoredAt)
+						re.Response.Header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+					}
+					decodeCachedGzipBody(req, re.Response)
+					markCacheHit(req, re.Response, option)
+					if e != nil {
+						e.add("cache", "hit", 0, "key=%s", hash)
+						if re.Response != nil && re.Response.Request != nil {
+							re.Response.Request = re.Response.Request.WithContext(req.Context())
+						}
+					}
 					return re.Response, re.Error
 				}
+				if err != nil {
+					handleCacheDecodeError(option, hash, err)
+				}
+				if e != nil && err != nil {
+					e.add("cache", "miss", 0, "key=%s decode error: %v", hash, err)
+				} else if e != nil {
+					e.add("cache", "miss", 0, "key=%s older than the max age", hash)
+				}
+			} else if e != nil && errors.Cause(err) == ErrCacheKeyNotFound {
+				e.add("cache", "miss", 0, "key=%s not found", hash)
+			} else if e != nil {
+				e.add("cache", "miss", 0, "key=%s: %v", hash, err)
 			}
 		}
 
 		resp, returnErr = handlerFunc(req)
 
+		if isStreamingRequest(req) {
+			if e != nil {
+				e.add("cache", "skip", 0, "streaming request")
+			}
+			return
+		}
+
+		if !store {
+			if e != nil {
+				e.add("cache", "skip", 0, "method %s is not stored", req.Method)
+			}
+			return
+		}
+
+		if isDryRunRequest(req) {
+			if e != nil {
+				e.add("cache", "skip", 0, "dry-run request")
+			}
+			return
+		}
+
+		if isRangeRequest(req) && (resp == nil || resp.StatusCode != http.StatusPartialContent) {
+			if e != nil {
+				e.add("cache", "skip", 0, "range request not answered with 206: %s", explainOutcome(resp, returnErr))
+			}
+			return
+		}
+
 		shouldCache := option.ShouldCacheFunc(req, resp, returnErr)
 		if !shouldCache {
+			if e != nil {
+				e.add("cache", "skip", 0, "not cacheable: %s", explainOutcome(resp, returnErr))
+			}
 			return
 		}
 
-		hash = option.RequestHashFunc(req, resp, returnErr)
+		hash = option.cacheKey(req, resp, returnErr)
 		if hash == nil {
 			return
 		}
 
+		if option.MaxCacheableBodySize > 0 {
+			exceeded, err := responseBodyExceeds(resp, option.MaxCacheableBodySize)
+			if err != nil {
+				if e != nil {
+					e.add("cache", "skip", 0, "check the size of the body: %v", err)
+				}
+				return
+			}
+			if exceeded {
+				if e != nil {
+					e.add("cache", "skip", 0, "body larger than %d bytes", option.MaxCacheableBodySize)
+				}
+				return
+			}
+		}
+
 		re := RequestEntry{
 			Request:  req,
 			Response: resp,
 			Error:    returnErr,
+			StoredAt: getClock(option.Clock).Now(),
+
+			compressBody:         option.CompressCachedBodies,
+			compressBodyMinBytes: option.CompressionMinBytes,
 		}
+
+		if option.InMemoryBodyLimit > 0 {
+			spillName, err := spillResponseBody(resp, option.InMemoryBodyLimit, option.SpillDir)
+			if err != nil {
+				closeResponse(resp)
+				return nil, err
+			}
+			if spillName != "" {
+				ttl := option.cacheTTL(req, resp, returnErr)
+				err = storeSpilledEntry(getRequestContext(req), option, hash, re, spillName, ttl)
+				if e != nil && err != nil {
+					e.add("cache", "skip", 0, "store the spilled body: %v", err)
+				} else if e != nil {
+					e.add("cache", "store", 0, "key=%s ttl=%s spilled %d bytes", hash, ttl, resp.ContentLength)
+				}
+				return
+			}
+		}
+
 		cacheValue, err := option.EncoderDecoder.Encode(re)
 		if err != nil {
 			return nil, errors.Wrap(err, "Serialization request")
 		}
 
-		ttl := option.CacheTTLFunc(req, resp, returnErr)
-		_ = option.Cacher.Set(hash, cacheValue, ttl)
+		ttl := option.cacheTTL(req, resp, returnErr)
+		setCacheValue(getRequestContext(req), option, hash, cacheValue, ttl)
+		if e != nil {
+			e.add("cache", "store", 0, "key=%s ttl=%s", hash, ttl)
+		}
 		return
 	}
 }
 
+// ErrCacheDecodeFailed is the error that matches, by errors.Is, the errors of the cached entries that can not be decoded.
+var ErrCacheDecodeFailed = errors.New("Failed to decode the cache entry")
+
+// CacheDecodeError is passed to CacheOption.OnError when the cached entry of Key can not be decoded.
+type CacheDecodeError struct {
+	Key []byte
+	Err error
+}
+
+func (e *CacheDecodeError) Error() string {
+	return fmt.Sprintf("Failed to decode the cache entry, cache key '%s': %v", string(e.Key), e.Err)
+}
+
+// Unwrap returns the error of the decoder.
+func (e *CacheDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrCacheDecodeFailed.
+func (e *CacheDecodeError) Is(target error) bool {
+	return target == ErrCacheDecodeFailed
+}
+
+// handleCacheDecodeError deletes the corrupt entry so that it does not keep failing, and reports the error.
+func handleCacheDecodeError(option CacheOption, key []byte, err error) {
+	if d, ok := option.Cacher.(CacherDeleter); ok {
+		_ = d.Delete(key)
+	}
+	if option.OnError != nil {
+		option.OnError(&CacheDecodeError{Key: key, Err: err})
+	}
+}
+
+// getFreshCacheValue gets the cached value that has not expired,
+// when the Cacher implements CacherTTL, the part of the TTL kept for StaleTTL is treated as expired.
+func getFreshCacheValue(ctx context.Context, option CacheOption, hash []byte) ([]byte, error) {
+	c, ok := option.Cacher.(CacherTTL)
+	if !ok || option.StaleTTL <= 0 {
+		return cacheGet(ctx, option.Cacher, hash)
+	}
+	value, remaining, err := cacheGetWithTTL(ctx, c, hash)
+	if err != nil {
+		return nil, err
+	}
+	if remaining != 0 && remaining <= option.StaleTTL {
+		return nil, ErrCacheKeyNotFound
+	}
+	return value, nil
+}
+
+func setCacheValue(ctx context.Context, option CacheOption, hash, cacheValue []byte, ttl time.Duration) {
+	if option.StaleTTL <= 0 {
+		_ = cacheSet(ctx, option.Cacher, hash, cacheValue, ttl)
+		return
+	}
+	if _, ok := option.Cacher.(CacherTTL); ok {
+		_ = cacheSet(ctx, option.Cacher, hash, cacheValue, ttl+option.StaleTTL)
+		return
+	}
+	_ = cacheSet(ctx, option.Cacher, hash, cacheValue, ttl)
+	_ = cacheSet(ctx, option.Cacher, staleCacheKey(hash), cacheValue, ttl+option.StaleTTL)
+}
+
+func staleCacheKey(hash []byte) []byte {
+	return append([]byte("stale-"), hash...)
+}
+
+// decodeCachedGzipBody decodes the body of a cached response encoded by gzip, which the transport decodes
+// transparently for the live responses but not for the cached ones, so the caller reads the plain body with
+// the right Content-Length and no Content-Encoding. The body is served encoded when the request asked for gzip
+// by its own Accept-Encoding header, like the transport does, or when it can not be decoded.
+func decodeCachedGzipBody(req *http.Request, resp *http.Response) {
+	if resp == nil || resp.Body == nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return
+	}
+	if req != nil && strings.Contains(strings.ToLower(req.Header.Get("Accept-Encoding")), "gzip") {
+		return
+	}
+	encoded, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	body, gunzipErr := gunzipBytes(encoded)
+	if err != nil || gunzipErr != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(encoded))
+		return
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Uncompressed = true
+}
+
+// getStaleCacheEntry gets the cached entry of the request, including the stale one kept by CacheOption.StaleTTL.
+func getStaleCacheEntry(option CacheOption, req *http.Request) (RequestEntry, bool) {
+	if !option.isEnabled() || !option.lookupsMethod(req) {
+		return RequestEntry{}, false
+	}
+	if _, noStore := option.requestDirectives(req); noStore {
+		return RequestEntry{}, false
+	}
+	hash := option.cacheKey(req, nil, nil)
+	if hash == nil {
+		return RequestEntry{}, false
+	}
+	for _, key := range [][]byte{hash, staleCacheKey(hash)} {
+		cacheValue, err := cacheGet(getRequestContext(req), option.Cacher, key)
+		if err != nil {
+			continue
+		}
+		re, err := option.EncoderDecoder.Decode(cacheValue)
+		if err == nil {
+			decodeCachedGzipBody(req, re.Response)
+			return re, true
+		}
+		handleCacheDecodeError(option, key, err)
+	}
+	return RequestEntry{}, false
+}
+
+// cacheKey returns the cache key of the request, which is the key of RequestHashFunc,
+// or the one set by WithCacheKey, combined with the partition.
+func (o CacheOption) cacheKey(req *http.Request, resp *http.Response, err error) []byte {
+	var hash []byte
+	if key, ok := getRequestContext(req).Value(cacheKeyContextKey).(string); ok && key != "" {
+		hash = []byte(key)
+	} else if o.isCacheableMethod(req) {
+		get := *req
+		get.Method = http.MethodGet
+		if hash = o.RequestHashFunc(&get, resp, err); hash != nil {
+			hash = hashBytes([]byte(req.Method), hash)
+		}
+	} else {
+		hash = o.RequestHashFunc(req, resp, err)
+	}
+	if hash != nil && isRangeRequest(req) {
+		hash = hashBytes(hash, []byte(req.Header.Get("Range")))
+	}
+	if hash == nil || o.PartitionFunc == nil {
+		return hash
+	}
+	partition := o.PartitionFunc(req)
+	if partition == "" {
+		return hash
+	}
+	return hashBytes([]byte(partition), hash)
+}
+
+// Invalidate deletes the cached response of the request, including the stale copy kept by StaleTTL,
+// the partition of the request is applied, such as the one set by WithCachePartition on its context.
+// The Cacher must implement CacherDeleter.
+func (o CacheOption) Invalidate(req *http.Request) error {
+	d, ok := o.Cacher.(CacherDeleter)
+	if !ok {
+		return errors.New("The cacher does not implement CacherDeleter")
+	}
+	hash := o.cacheKey(req, nil, nil)
+	if hash == nil {
+		return nil
+	}
+	if err := d.Delete(hash); err != nil {
+		return err
+	}
+	return d.Delete(staleCacheKey(hash))
+}
+
+// WithCachePartition returns a context that puts the requests made with it in the cache partition,
+// such as the ID of a tenant, it is used when CacheOption.PartitionFunc is PartitionFromContext.
+func WithCachePartition(ctx context.Context, partition string) context.Context {
+	return context.WithValue(ctx, cachePartitionContextKey, partition)
+}
+
+// PartitionFromContext is a CacheOption.PartitionFunc that returns the partition set by WithCachePartition,
+// the requests without one are in the empty partition.
+func PartitionFromContext(req *http.Request) string {
+	partition, _ := getRequestContext(req).Value(cachePartitionContextKey).(string)
+	return partition
+}
+
+// cacheTTL returns the TTL set by WithCacheTTL, the one of TTLByMethod, or the one of CacheTTLFunc.
+func (o CacheOption) cacheTTL(req *http.Request, resp *http.Response, err error) time.Duration {
+	if ttl, ok := getRequestContext(req).Value(cacheTTLContextKey).(time.Duration); ok && ttl > 0 {
+		return ttl
+	}
+	if req != nil {
+		method := req.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		if ttl, ok := o.TTLByMethod[method]; ok {
+			return ttl
+		}
+	}
+	return o.CacheTTLFunc(req, resp, err)
+}
+
+// WithCacheTTL returns a context that makes CacheHandler store the responses of the requests made with it for d,
+// which takes precedence over CacheOption.CacheTTLFunc. A d that is not positive is ignored.
+// It does not make a response cacheable, that is still decided by CacheOption.ShouldCacheFunc.
+func WithCacheTTL(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, cacheTTLContextKey, d)
+}
+
+// WithCacheKey returns a context that makes CacheHandler use the key for the requests made with it,
+// which takes precedence over CacheOption.RequestHashFunc, so that different requests can share a response.
+// The partition of CacheOption.PartitionFunc is still applied to the key. An empty key is ignored.
+func WithCacheKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, cacheKeyContextKey, key)
+}
+
+// WithMaxCacheAge returns a context that makes CacheHandler treat the cached responses
+// stored more than d ago as a miss, even though their TTL has not expired.
+func WithMaxCacheAge(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, maxCacheAgeContextKey, d)
+}
+
+func isFreshEnough(req *http.Request, re RequestEntry, option CacheOption) bool {
+	maxAge, ok := getRequestContext(req).Value(maxCacheAgeContextKey).(time.Duration)
+	if !ok {
+		return true
+	}
+	if re.StoredAt.IsZero() {
+		return false
+	}
+	return getClock(option.Clock).Now().Sub(re.StoredAt) <= maxAge
+}
+
+// responseBodyExceeds reports whether the response body is larger than n bytes.
+// The Content-Length is checked first, and when it is unknown,
+// at most n+1 bytes are read and put back in front of the remaining body,
+// so that a large body is never fully buffered. When the read fails, the bytes read are put back
+// in front of the error, which is returned by the reads of the body too.
+func responseBodyExceeds(resp *http.Response, n uint64) (bool, error) {
+	if resp == nil || resp.Body == nil {
+		return false, nil
+	}
+	if resp.ContentLength > 0 {
+		return uint64(resp.ContentLength) > n, nil
+	}
+	contentLength, err := strconv.ParseUint(resp.Header.Get("Content-Length"), 10, 64)
+	if err == nil {
+		return contentLength > n, nil
+	}
+
+	prefix, err := io.ReadAll(io.LimitReader(resp.Body, int64(n)+1))
+	if err != nil {
+		resp.Body = readCloser{
+			Reader: io.MultiReader(bytes.NewReader(prefix), errorReader{err}),
+			Closer: resp.Body,
+		}
+		return false, err
+	}
+	resp.Body = readCloser{
+		Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+		Closer: resp.Body,
+	}
+	return uint64(len(prefix)) > n, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// errorReader is a reader that always fails with the error.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// ErrCorruptCacheEntry is the error that matches, by errors.Is, the errors returned when a cached entry is invalid.
+var ErrCorruptCacheEntry = errors.New("The cache entry is corrupt")
+
+// CorruptCacheEntryError is returned by Decode when a cached entry is invalid, such as an out of range status code.
+type CorruptCacheEntryError struct {
+	Reason string
+}
+
+func (e *CorruptCacheEntryError) Error() string {
+	return "The cache entry is corrupt: " + e.Reason
+}
+
+// Is reports whether the target is ErrCorruptCacheEntry.
+func (e *CorruptCacheEntryError) Is(target error) bool {
+	return target == ErrCorruptCacheEntry
+}
+
 // RequestEntry is a structure that stores the request context.
 type RequestEntry struct {
 	Request  *http.Request
 	Response *http.Response
 	Error    error
+	StoredAt time.Time
+
+	// compressBody and compressBodyMinBytes are set by CacheHandler from CacheOption.CompressCachedBodies.
+	compressBody         bool
+	compressBodyMinBytes int
 }
 
 // RequestEntryEncoderDecoder is an interface to serialize and deserialize the request context.
@@ -155,33 +915,55 @@ type HTTPRequestResponse struct {
 	ResponseHeader map[string]string
 	ResponseBody   []byte
 	Error          []byte
+	// StoredAt is the time in Unix nanoseconds when the entry was stored, 0 means unknown.
+	StoredAt int64
+	// ResponseBodyCompressed reports whether ResponseBody is compressed by gzip, see CacheOption.CompressCachedBodies.
+	ResponseBodyCompressed bool
 }
 
 type requestEntryEncoderDecoder struct {
 }
 
 // Encode serializes the request context into a byte array.
+// The protocol fields and the status of the response are always stored, the missing ones are synthesized.
 func (m requestEntryEncoderDecoder) Encode(entry RequestEntry) ([]byte, error) {
+	e, err := newHTTPRequestResponse(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	w := entry.Response
+	if w != nil && w.Body != nil {
+		e.ResponseBody, err = copyHTTPResponseBody(w)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if w != nil && entry.compressBody {
+		compressResponseBody(&e, entry.compressBodyMinBytes)
+	}
+
+	return msgpack.Marshal(&e)
+}
+
+// newHTTPRequestResponse converts the entry to the structure that is serialized, except the response body.
+func newHTTPRequestResponse(entry RequestEntry) (HTTPRequestResponse, error) {
 	r := entry.Request
 	w := entry.Response
 
 	if r == nil {
-		return nil, errors.New("Request not found in RequestEntry")
+		return HTTPRequestResponse{}, errors.New("Request not found in RequestEntry")
 	}
 	if r.URL == nil {
-		return nil, errors.New("URL not found in RequestEntry")
+		return HTTPRequestResponse{}, errors.New("URL not found in RequestEntry")
 	}
 
-	var (
-		requestBody  []byte
-		responseBody []byte
-		err          error
-	)
-
+	var requestBody []byte
 	if r.Body != nil {
+		var err error
 		requestBody, err = copyHTTPRequestBody(r)
 		if err != nil {
-			return nil, err
+			return HTTPRequestResponse{}, err
 		}
 	}
 
@@ -192,31 +974,30 @@ func (m requestEntryEncoderDecoder) Encode(entry RequestEntry) ([]byte, error) {
 		RequestBody:   requestBody,
 	}
 
-	if w != nil && w.Body != nil {
-		responseBody, err = copyHTTPResponseBody(w)
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	if w != nil {
 		e.Status = w.Status
+		if e.Status == "" {
+			e.Status = statusLine(w.StatusCode)
+		}
 		e.StatusCode = w.StatusCode
-		e.Proto = w.Proto
-		e.ProtoMajor = w.ProtoMajor
-		e.ProtoMinor = w.ProtoMinor
+		e.Proto, e.ProtoMajor, e.ProtoMinor = normalizeProto(w.Proto, w.ProtoMajor, w.ProtoMinor)
 		e.ResponseHeader = httpHeaderToMap(w.Header)
-		e.ResponseBody = responseBody
 	}
 
 	if entry.Error != nil {
 		e.Error = []byte(entry.Error.Error())
 	}
 
-	return msgpack.Marshal(&e)
+	if !entry.StoredAt.IsZero() {
+		e.StoredAt = entry.StoredAt.UnixNano()
+	}
+
+	return e, nil
 }
 
 // Decode deserializes the byte array into the request context.
+// The missing protocol fields of the response default to HTTP/1.1,
+// and a CorruptCacheEntryError is returned when the status code is out of the range 100-599.
 func (m requestEntryEncoderDecoder) Decode(value []byte) (re RequestEntry, err error) {
 	var e HTTPRequestResponse
 	err = msgpack.Unmarshal(value, &e)
@@ -231,13 +1012,36 @@ func (m requestEntryEncoderDecoder) Decode(value []byte) (re RequestEntry, err e
 
 	var resp *http.Response
 
+	if e.StatusCode != 0 && (e.StatusCode < 100 || e.StatusCode > 599) {
+		err = &CorruptCacheEntryError{Reason: fmt.Sprintf("status code %d out of range", e.StatusCode)}
+		return
+	}
+
+	if e.ResponseBodyCompressed {
+		e.ResponseBody, err = gunzipBytes(e.ResponseBody)
+		if err != nil {
+			err = &CorruptCacheEntryError{Reason: fmt.Sprintf("decompress the response body: %v", err)}
+			return
+		}
+		if e.ResponseHeader == nil {
+			e.ResponseHeader = make(map[string]string)
+		}
+		delete(e.ResponseHeader, "Content-Encoding")
+		e.ResponseHeader["Content-Length"] = strconv.Itoa(len(e.ResponseBody))
+	}
+
 	if e.StatusCode > 0 {
+		status := e.Status
+		if status == "" {
+			status = statusLine(e.StatusCode)
+		}
+		proto, protoMajor, protoMinor := normalizeProto(e.Proto, e.ProtoMajor, e.ProtoMinor)
 		resp = &http.Response{
-			Status:        e.Proto,
+			Status:        status,
 			StatusCode:    e.StatusCode,
-			Proto:         e.Proto,
-			ProtoMajor:    e.ProtoMajor,
-			ProtoMinor:    e.ProtoMinor,
+			Proto:         proto,
+			ProtoMajor:    protoMajor,
+			ProtoMinor:    protoMinor,
 			Body:          ioutil.NopCloser(bytes.NewBuffer(e.ResponseBody)),
 			ContentLength: int64(len(e.ResponseBody)),
 			Request:       req,
@@ -250,13 +1054,83 @@ func (m requestEntryEncoderDecoder) Decode(value []byte) (re RequestEntry, err e
 		entryError = errors.New(string(e.Error))
 	}
 
+	var storedAt time.Time
+	if e.StoredAt > 0 {
+		storedAt = time.Unix(0, e.StoredAt)
+	}
+
 	return RequestEntry{
 		Request:  req,
 		Response: resp,
 		Error:    entryError,
+		StoredAt: storedAt,
 	}, nil
 }
 
+// compressResponseBody compresses the response body of the entry by gzip when it is at least minBytes,
+// a body encoded by gzip by the server is decoded first, so that the entry always holds the plain body.
+// The body is stored as it is when compressing it does not make it smaller.
+func compressResponseBody(e *HTTPRequestResponse, minBytes int) {
+	body := e.ResponseBody
+	encoded := strings.EqualFold(e.ResponseHeader["Content-Encoding"], "gzip")
+	if encoded {
+		plain, err := gunzipBytes(body)
+		if err != nil {
+			return
+		}
+		body = plain
+	}
+	if len(body) == 0 || len(body) < minBytes {
+		if encoded {
+			e.ResponseBody = body
+			delete(e.ResponseHeader, "Content-Encoding")
+			e.ResponseHeader["Content-Length"] = strconv.Itoa(len(body))
+		}
+		return
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return
+	}
+	if err := zw.Close(); err != nil {
+		return
+	}
+	if buf.Len() >= len(body) && !encoded {
+		return
+	}
+	e.ResponseBody = buf.Bytes()
+	e.ResponseBodyCompressed = true
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// normalizeProto fills in the missing protocol fields of a response,
+// they are parsed from each other when possible, and default to HTTP/1.1.
+func normalizeProto(proto string, major, minor int) (string, int, int) {
+	if major == 0 && minor == 0 {
+		if major, minor, ok := http.ParseHTTPVersion(proto); ok {
+			return proto, major, minor
+		}
+		return "HTTP/1.1", 1, 1
+	}
+	if proto == "" {
+		proto = fmt.Sprintf("HTTP/%d.%d", major, minor)
+	}
+	return proto, major, minor
+}
+
+func statusLine(statusCode int) string {
+	return strings.TrimSpace(fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)))
+}
+
 func httpHeaderToMap(header http.Header) map[string]string {
 	m := make(map[string]string)
 	for key := range header {
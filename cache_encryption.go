@@ -0,0 +1,82 @@
+package gohttpclient
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCacheDecryptFailed is returned by the encrypted encoder decoder when an entry can not be decrypted,
+// such as a tampered entry or one encrypted by an unknown key, CacheHandler treats it as a cache miss.
+var ErrCacheDecryptFailed = errors.New("Failed to decrypt the cache entry")
+
+// encryptedFormatVersion is the first byte of the encrypted entries, it is also authenticated.
+const encryptedFormatVersion byte = 1
+
+type encryptedEncoderDecoder struct {
+	inner RequestEntryEncoderDecoder
+	aeads []cipher.AEAD
+}
+
+// NewEncryptedEncoderDecoder creates an encoder decoder that encrypts the entries of inner by AES-GCM at rest,
+// with a random nonce for each entry. The key must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+// To rotate the keys, pass the new key as key and the old ones as oldKeys,
+// the entries are always encrypted by key, and decrypted by trying the keys in order.
+// Use it as CacheOption.EncoderDecoder.
+func NewEncryptedEncoderDecoder(inner RequestEntryEncoderDecoder, key []byte, oldKeys ...[]byte) (RequestEntryEncoderDecoder, error) {
+	if inner == nil {
+		return nil, errors.New("The inner encoder decoder is nil")
+	}
+	m := encryptedEncoderDecoder{inner: inner}
+	for _, k := range append([][]byte{key}, oldKeys...) {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "Create the cipher of the cache encryption key")
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrap(err, "Create the GCM of the cache encryption key")
+		}
+		m.aeads = append(m.aeads, aead)
+	}
+	return m, nil
+}
+
+// Encode serializes the request context by inner, and encrypts it by the first key.
+func (m encryptedEncoderDecoder) Encode(entry RequestEntry) ([]byte, error) {
+	plaintext, err := m.inner.Encode(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	aead := m.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "Generate the nonce of the cache entry")
+	}
+
+	header := append([]byte{encryptedFormatVersion}, nonce...)
+	return aead.Seal(header, nonce, plaintext, header[:1]), nil
+}
+
+// Decode decrypts the value by trying the keys in order, and deserializes it by inner.
+func (m encryptedEncoderDecoder) Decode(value []byte) (RequestEntry, error) {
+	if len(value) < 1 || value[0] != encryptedFormatVersion {
+		return RequestEntry{}, ErrCacheDecryptFailed
+	}
+	for _, aead := range m.aeads {
+		nonceSize := aead.NonceSize()
+		if len(value) < 1+nonceSize+aead.Overhead() {
+			return RequestEntry{}, ErrCacheDecryptFailed
+		}
+		nonce, ciphertext := value[1:1+nonceSize], value[1+nonceSize:]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, value[:1])
+		if err == nil {
+			return m.inner.Decode(plaintext)
+		}
+	}
+	return RequestEntry{}, ErrCacheDecryptFailed
+}
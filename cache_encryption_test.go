@@ -0,0 +1,136 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func getTestEncryptedEntry() RequestEntry {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/pii", nil)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(`{"email":"someone@example.com"}`)),
+	}
+	return RequestEntry{Request: req, Response: resp}
+}
+
+func TestEncryptedEncoderDecoder(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	m, err := NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, key)
+	require.Nil(t, err)
+
+	value, err := m.Encode(getTestEncryptedEntry())
+	require.Nil(t, err)
+	require.False(t, bytes.Contains(value, []byte("someone@example.com")))
+
+	value2, err := m.Encode(getTestEncryptedEntry())
+	require.Nil(t, err)
+	require.NotEqual(t, value, value2)
+
+	re, err := m.Decode(value)
+	require.Nil(t, err)
+	body, _ := io.ReadAll(re.Response.Body)
+	require.Equal(t, `{"email":"someone@example.com"}`, string(body))
+	require.Equal(t, "application/json", re.Response.Header.Get("Content-Type"))
+
+	// A wrong key fails.
+	m2, err := NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, bytes.Repeat([]byte("x"), 32))
+	require.Nil(t, err)
+	_, err = m2.Decode(value)
+	require.Equal(t, ErrCacheDecryptFailed, err)
+
+	// A flipped byte, a garbage value and a truncated value fail.
+	for i := 0; i < len(value); i += 7 {
+		tampered := append([]byte(nil), value...)
+		tampered[i] ^= 0x01
+		_, err = m.Decode(tampered)
+		require.Equal(t, ErrCacheDecryptFailed, err, i)
+	}
+	for _, v := range [][]byte{nil, []byte("garbage"), value[:10]} {
+		_, err = m.Decode(v)
+		require.Equal(t, ErrCacheDecryptFailed, err)
+	}
+}
+
+func TestEncryptedEncoderDecoder_KeyRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), 16)
+	newKey := bytes.Repeat([]byte("n"), 16)
+
+	old, err := NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, oldKey)
+	require.Nil(t, err)
+	oldValue, err := old.Encode(getTestEncryptedEntry())
+	require.Nil(t, err)
+
+	rotated, err := NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, newKey, oldKey)
+	require.Nil(t, err)
+	re, err := rotated.Decode(oldValue)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, re.Response.StatusCode)
+
+	// The new entries are encrypted by the new key.
+	newValue, err := rotated.Encode(getTestEncryptedEntry())
+	require.Nil(t, err)
+	_, err = old.Decode(newValue)
+	require.Equal(t, ErrCacheDecryptFailed, err)
+}
+
+func TestEncryptedEncoderDecoder_InvalidInput(t *testing.T) {
+	_, err := NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, []byte("short"))
+	require.NotNil(t, err)
+	_, err = NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, bytes.Repeat([]byte("k"), 32), []byte("short"))
+	require.NotNil(t, err)
+	_, err = NewEncryptedEncoderDecoder(nil, bytes.Repeat([]byte("k"), 32))
+	require.NotNil(t, err)
+
+	m, err := NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, bytes.Repeat([]byte("k"), 32))
+	require.Nil(t, err)
+	_, err = m.Encode(RequestEntry{})
+	require.NotNil(t, err)
+}
+
+func TestCacheHandler_EncryptedEncoderDecoder(t *testing.T) {
+	m, err := NewEncryptedEncoderDecoder(requestEntryEncoderDecoder{}, bytes.Repeat([]byte("k"), 32))
+	require.Nil(t, err)
+	var errs []error
+	option := NewMemoryCacheOption()
+	option.EncoderDecoder = m
+	option.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+	handler := CacheHandler(option)
+
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/encrypted", nil)
+	for i := 0; i < 2; i++ {
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		require.Equal(t, "hello world", string(body))
+	}
+	require.Equal(t, 1, realRequestTimes)
+
+	// A tampered entry is a miss.
+	hash := option.RequestHashFunc(req, nil, nil)
+	value, err := option.Cacher.Get(hash)
+	require.Nil(t, err)
+	value[len(value)-1] ^= 0x01
+	require.Nil(t, option.Cacher.Set(hash, value, DefaultCacheTTLFunc(nil, nil, nil)))
+
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, 2, realRequestTimes)
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], ErrCacheDecryptFailed))
+}
@@ -0,0 +1,172 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// RequestEntryStreamEncoder is an optional interface of a RequestEntryEncoderDecoder, which writes
+// the encoding of an entry to w, and streams the response body instead of holding it in memory
+// when the ContentLength of the response is known. The encoding is the same as the one of Encode.
+type RequestEntryStreamEncoder interface {
+	EncodeTo(w io.Writer, entry RequestEntry) error
+}
+
+// EncodeTo writes the same encoding as Encode to w, the response body of a known ContentLength is streamed
+// and it is never compressed, the others are encoded by Encode.
+func (m requestEntryEncoderDecoder) EncodeTo(w io.Writer, entry RequestEntry) error {
+	resp := entry.Response
+	if resp == nil || resp.Body == nil || resp.ContentLength < 0 {
+		value, err := m.Encode(entry)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(value)
+		return err
+	}
+
+	e, err := newHTTPRequestResponse(entry)
+	if err != nil {
+		return err
+	}
+	// The fields are in the order of HTTPRequestResponse, which is the order of msgpack.Marshal.
+	fields := []struct {
+		name  string
+		value interface{}
+	}{
+		{"Method", e.Method},
+		{"URL", e.URL},
+		{"RequestHeader", e.RequestHeader},
+		{"RequestBody", e.RequestBody},
+		{"Status", e.Status},
+		{"StatusCode", e.StatusCode},
+		{"Proto", e.Proto},
+		{"ProtoMajor", e.ProtoMajor},
+		{"ProtoMinor", e.ProtoMinor},
+		{"ResponseHeader", e.ResponseHeader},
+		{"ResponseBody", nil},
+		{"Error", e.Error},
+		{"StoredAt", e.StoredAt},
+		{"ResponseBodyCompressed", e.ResponseBodyCompressed},
+	}
+
+	enc := msgpack.NewEncoder(w)
+	if err := enc.EncodeMapLen(len(fields)); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := enc.EncodeString(f.name); err != nil {
+			return err
+		}
+		if f.name != "ResponseBody" {
+			if err := enc.Encode(f.value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := enc.EncodeBytesLen(int(resp.ContentLength)); err != nil {
+			return err
+		}
+		n, err := io.CopyN(w, resp.Body, resp.ContentLength)
+		if err == io.EOF {
+			return errors.Errorf("The response body is %d bytes, shorter than its Content-Length %d", n, resp.ContentLength)
+		}
+		if err != nil {
+			return errors.Wrap(err, "Read the response body")
+		}
+	}
+	return nil
+}
+
+// spillBody is a response body backed by a temporary file, which is removed when the body is closed.
+type spillBody struct {
+	*os.File
+}
+
+func (b spillBody) Close() error {
+	err := b.File.Close()
+	_ = os.Remove(b.Name())
+	return err
+}
+
+// spillResponseBody moves the response body to a temporary file in dir when it is larger than limit bytes,
+// and replaces it with a spillBody of the file. It returns the name of the file, or "" when the body is not larger.
+func spillResponseBody(resp *http.Response, limit int64, dir string) (string, error) {
+	exceeded, err := responseBodyExceeds(resp, uint64(limit))
+	if err != nil || !exceeded {
+		return "", err
+	}
+
+	f, err := os.CreateTemp(dir, "gohttpclient-spill-*")
+	if err != nil {
+		return "", errors.Wrap(err, "Create the spill file")
+	}
+	size, err := io.Copy(f, resp.Body)
+	_ = resp.Body.Close()
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", errors.Wrap(err, "Spill the response body")
+	}
+
+	resp.Body = spillBody{f}
+	resp.ContentLength = size
+	return f.Name(), nil
+}
+
+// storeSpilledEntry stores the entry whose response body is spilled to the file of the name.
+// The body is streamed from the file to the Cacher when it implements CacherStream and the EncoderDecoder
+// implements RequestEntryStreamEncoder, otherwise the entry is encoded in memory as usual.
+func storeSpilledEntry(ctx context.Context, option CacheOption, hash []byte, re RequestEntry, name string, ttl time.Duration) error {
+	withBody := func(fn func(re RequestEntry) error) error {
+		f, err := os.Open(name)
+		if err != nil {
+			return errors.Wrap(err, "Open the spill file")
+		}
+		defer f.Close()
+		resp := *re.Response
+		resp.Body = f
+		entry := re
+		entry.Response = &resp
+		return fn(entry)
+	}
+
+	encoder, okEncoder := option.EncoderDecoder.(RequestEntryStreamEncoder)
+	cacher, okCacher := option.Cacher.(CacherStream)
+	if !okEncoder || !okCacher {
+		return withBody(func(entry RequestEntry) error {
+			cacheValue, err := option.EncoderDecoder.Encode(entry)
+			if err != nil {
+				return errors.Wrap(err, "Serialization request")
+			}
+			setCacheValue(ctx, option, hash, cacheValue, ttl)
+			return nil
+		})
+	}
+
+	write := func(w io.Writer) error {
+		return withBody(func(entry RequestEntry) error {
+			entry.compressBody = false
+			return encoder.EncodeTo(w, entry)
+		})
+	}
+	if option.StaleTTL <= 0 {
+		return cacher.SetStream(ctx, hash, ttl, write)
+	}
+	if _, ok := option.Cacher.(CacherTTL); ok {
+		return cacher.SetStream(ctx, hash, ttl+option.StaleTTL, write)
+	}
+	if err := cacher.SetStream(ctx, hash, ttl, write); err != nil {
+		return err
+	}
+	return cacher.SetStream(ctx, staleCacheKey(hash), ttl+option.StaleTTL, write)
+}
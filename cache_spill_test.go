@@ -0,0 +1,133 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestEntryEncoderDecoder_EncodeTo(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 100)
+	newEntry := func() RequestEntry {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/report", nil)
+		req.Header.Set("Accept", "text/csv")
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": []string{"text/csv"}},
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+		}
+		return RequestEntry{Request: req, Response: resp, StoredAt: time.Unix(1700000000, 0)}
+	}
+	encoder := requestEntryEncoderDecoder{}
+
+	expected, err := encoder.Encode(newEntry())
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	require.Nil(t, encoder.EncodeTo(&buf, newEntry()))
+	require.Equal(t, expected, buf.Bytes())
+
+	re, err := encoder.Decode(buf.Bytes())
+	require.Nil(t, err)
+	decoded, err := io.ReadAll(re.Response.Body)
+	require.Nil(t, err)
+	require.Equal(t, body, decoded)
+
+	// A body shorter than its Content-Length is an error.
+	entry := newEntry()
+	entry.Response.ContentLength++
+	require.NotNil(t, encoder.EncodeTo(io.Discard, entry))
+}
+
+func TestCacheHandler_InMemoryBodyLimit(t *testing.T) {
+	const size = 64 << 20
+	chunk := make([]byte, 64<<10)
+	for i := range chunk {
+		chunk[i] = byte(i % 251)
+	}
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/report": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+			for n := 0; n < size; n += len(chunk) {
+				_, _ = w.Write(chunk)
+			}
+		},
+	})
+	expected := sha256.New()
+	for n := 0; n < size; n += len(chunk) {
+		expected.Write(chunk)
+	}
+
+	spillDir := t.TempDir()
+	option := NewCacheOption(NewFileCache(t.TempDir()))
+	option.InMemoryBodyLimit = 1 << 20
+	option.SpillDir = spillDir
+	c := NewClient(WithCacheOption(option))
+
+	read := func() (int64, []byte) {
+		resp, err := c.Get(ts.URL("/report"))
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		h := sha256.New()
+		n, err := io.Copy(h, resp.Body)
+		require.Nil(t, err)
+		return n, h.Sum(nil)
+	}
+
+	// The body is neither buffered to be stored, nor to be served.
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	n, sum := read()
+	runtime.ReadMemStats(&after)
+	require.Equal(t, int64(size), n)
+	require.Equal(t, expected.Sum(nil), sum)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(8<<20))
+
+	// The spill file is removed when the body is closed.
+	files, err := os.ReadDir(spillDir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+
+	// The entry streamed to the file is a regular one.
+	n, sum = read()
+	require.Equal(t, int64(size), n)
+	require.Equal(t, expected.Sum(nil), sum)
+	require.Equal(t, 1, ts.RequestCount("/report"))
+}
+
+func TestCacheHandler_InMemoryBodyLimitWithoutStream(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 2048)
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(body)
+		},
+	})
+	spillDir := t.TempDir()
+	option := NewMemoryCacheOption()
+	option.InMemoryBodyLimit = 1024
+	option.SpillDir = spillDir
+	c := NewClient(WithCacheOption(option))
+
+	// A Cacher without CacherStream stores the spilled body encoded in memory.
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(ts.URL("/"))
+		require.Nil(t, err)
+		got, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		resp.Body.Close()
+		require.Equal(t, body, got)
+	}
+	require.Equal(t, 1, ts.RequestCount("/"))
+	files, err := os.ReadDir(spillDir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+}
@@ -2,8 +2,12 @@ package gohttpclient
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -142,3 +146,944 @@ func TestRequestEntryEncoderDecoder_DecodeWithInvalidInput(t *testing.T) {
 	require.NotNil(t, err)
 	require.Nil(t, re.Request)
 }
+
+func TestCacheHandler_MaxCacheableBodySize(t *testing.T) {
+	option := NewMemoryCacheOption()
+	option.MaxCacheableBodySize = 5
+	handler := CacheHandler(option)
+
+	cases := []struct {
+		URL           string
+		Body          string
+		ContentLength string
+		Cached        bool
+	}{
+		{"https://example.com/small", "hello", "", true},
+		{"https://example.com/large", "hello world", "", false},
+		{"https://example.com/small-with-length", "hello", "5", true},
+		{"https://example.com/large-with-length", "hello world", "11", false},
+	}
+
+	for _, c := range cases {
+		realRequestTimes := 0
+		handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+			realRequestTimes++
+			header := http.Header{}
+			if c.ContentLength != "" {
+				header.Set("Content-Length", c.ContentLength)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(bytes.NewBufferString(c.Body)),
+			}, nil
+		}
+
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest(http.MethodGet, c.URL, nil)
+			resp, err := handler(req, handlerFunc)
+			require.Nil(t, err)
+			require.NotNil(t, resp)
+			respBody, err := io.ReadAll(resp.Body)
+			require.Nil(t, err)
+			require.Equal(t, c.Body, string(respBody))
+		}
+
+		if c.Cached {
+			require.Equalf(t, 1, realRequestTimes, c.URL)
+		} else {
+			require.Equalf(t, 2, realRequestTimes, c.URL)
+		}
+	}
+}
+
+func TestCacheHandler_MaxCacheableBodySizeReadError(t *testing.T) {
+	option := NewMemoryCacheOption()
+	option.MaxCacheableBodySize = 100
+	handler := CacheHandler(option)
+
+	realRequestTimes := 0
+	var body *testTrackingBody
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		body = &testTrackingBody{Reader: &testFailingBody{r: bytes.NewBufferString("hello"), fail: true}}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, ContentLength: -1, Body: body}, nil
+	}
+
+	// A body that fails to be read is not cached, and the response is returned with the bytes read and the error.
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/reset", nil)
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		require.NotNil(t, resp)
+		respBody, err := io.ReadAll(resp.Body)
+		require.EqualError(t, err, "connection reset by peer")
+		require.Equal(t, "hello", string(respBody))
+		require.False(t, body.closed)
+		require.Nil(t, resp.Body.Close())
+		require.True(t, body.closed)
+	}
+	require.Equal(t, 2, realRequestTimes)
+}
+
+func TestCacheContentTypes(t *testing.T) {
+	fn := CacheContentTypes("application/json", "Text/HTML")
+	getReq, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	postReq, _ := http.NewRequest(http.MethodPost, "https://example.com", nil)
+
+	cases := []struct {
+		Request     *http.Request
+		StatusCode  int
+		ContentType string
+		ShouldCache bool
+	}{
+		{getReq, http.StatusOK, "application/json", true},
+		{getReq, http.StatusOK, "application/json; charset=utf-8", true},
+		{getReq, http.StatusOK, "text/html; charset=ISO-8859-1", true},
+		{getReq, http.StatusOK, "application/octet-stream", false},
+		{getReq, http.StatusOK, "", false},
+		{getReq, http.StatusNotFound, "application/json", false},
+		{postReq, http.StatusOK, "application/json", false},
+	}
+	for _, c := range cases {
+		resp := &http.Response{
+			StatusCode: c.StatusCode,
+			Header:     http.Header{"Content-Type": []string{c.ContentType}},
+		}
+		require.Equalf(t, c.ShouldCache, fn(c.Request, resp, nil), "%s %d %s", c.Request.Method, c.StatusCode, c.ContentType)
+	}
+}
+
+func TestCacheHandler_MaxCacheAge(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	option := NewMemoryCacheOption()
+	option.Clock = clock
+	option.AgeHeader = true
+	handler := CacheHandler(option)
+
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		realRequestTimes++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(bytes.NewBufferString("hello world")),
+		}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/max-age", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, 1, realRequestTimes)
+	require.Empty(t, resp.Header.Get("Age"))
+
+	clock.Advance(10 * time.Second)
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/max-age", nil)
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, 1, realRequestTimes)
+	require.Equal(t, "10", resp.Header.Get("Age"))
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/max-age", nil)
+	req = req.WithContext(WithMaxCacheAge(req.Context(), 5*time.Second))
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, 2, realRequestTimes)
+	require.Empty(t, resp.Header.Get("Age"))
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/max-age", nil)
+	req = req.WithContext(WithMaxCacheAge(req.Context(), 5*time.Second))
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, 2, realRequestTimes)
+	require.Equal(t, "0", resp.Header.Get("Age"))
+}
+
+func TestRequestEntryEncoderDecoder_StoredAt(t *testing.T) {
+	m := requestEntryEncoderDecoder{}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	storedAt := time.Unix(1600000000, 123)
+
+	value, err := m.Encode(RequestEntry{Request: req, StoredAt: storedAt})
+	require.Nil(t, err)
+	re, err := m.Decode(value)
+	require.Nil(t, err)
+	require.True(t, storedAt.Equal(re.StoredAt))
+
+	value, err = m.Encode(RequestEntry{Request: req})
+	require.Nil(t, err)
+	re, err = m.Decode(value)
+	require.Nil(t, err)
+	require.True(t, re.StoredAt.IsZero())
+}
+
+type testRecordingCacher struct {
+	MemoryCache
+	keys []string
+}
+
+func (c *testRecordingCacher) Set(key, value []byte, ttl time.Duration) error {
+	c.keys = append(c.keys, string(key))
+	return c.MemoryCache.Set(key, value, ttl)
+}
+
+func (c *testRecordingCacher) SetContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	c.keys = append(c.keys, string(key))
+	return c.MemoryCache.SetContext(ctx, key, value, ttl)
+}
+
+func TestCacheHandler_StaleTTL(t *testing.T) {
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+	ttlFunc := func(*http.Request, *http.Response, error) time.Duration {
+		return 20 * time.Millisecond
+	}
+
+	// MemoryCache implements CacherTTL, a single entry is stored.
+	option := NewMemoryCacheOption()
+	option.CacheTTLFunc = ttlFunc
+	option.StaleTTL = time.Minute
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/stale", nil)
+	_, err := CacheHandler(option)(req, handlerFunc)
+	require.Nil(t, err)
+
+	hash := option.RequestHashFunc(req, nil, nil)
+	_, remaining, err := option.Cacher.(CacherTTL).GetWithTTL(hash)
+	require.Nil(t, err)
+	require.True(t, remaining > time.Minute)
+	_, err = option.Cacher.Get(staleCacheKey(hash))
+	require.Equal(t, ErrCacheKeyNotFound, err)
+
+	realRequestTimes := 0
+	countingHandlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		return handlerFunc(req)
+	}
+	_, err = CacheHandler(option)(req, countingHandlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, 0, realRequestTimes)
+
+	time.Sleep(30 * time.Millisecond)
+	_, err = CacheHandler(option)(req, countingHandlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, 1, realRequestTimes)
+
+	// A Cacher without CacherTTL keeps a separate stale copy.
+	cacher := &struct{ Cacher }{&testRecordingCacher{MemoryCache: NewMemoryCache()}}
+	option = NewCacheOption(cacher)
+	option.StaleTTL = time.Minute
+	_, err = CacheHandler(option)(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, []string{string(hash), string(staleCacheKey(hash))}, cacher.Cacher.(*testRecordingCacher).keys)
+}
+
+func TestHashByURLIgnoringParams(t *testing.T) {
+	hashFunc := HashByURLIgnoringParams("_", "ts")
+	hash := func(rawURL string) string {
+		req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+		return string(hashFunc(req, nil, nil))
+	}
+
+	expected := hash("https://example.com/search?q=x")
+	require.Equal(t, expected, hash("https://example.com/search?q=x&_=123456"))
+	require.Equal(t, expected, hash("https://example.com/search?ts=1&q=x&_=2"))
+	require.NotEqual(t, expected, hash("https://example.com/search?q=y&_=123456"))
+	require.Equal(t, hash("https://example.com/search?a=1&b=2"), hash("https://example.com/search?b=2&a=1&_=3"))
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/search?q=x", nil)
+	require.Nil(t, hashFunc(req, nil, nil))
+}
+
+func TestHashByURLWithParams(t *testing.T) {
+	hashFunc := HashByURLWithParams("q", "page")
+	hash := func(rawURL string) string {
+		req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+		return string(hashFunc(req, nil, nil))
+	}
+
+	expected := hash("https://example.com/search?q=x")
+	require.Equal(t, expected, hash("https://example.com/search?q=x&_=123456"))
+	require.NotEqual(t, expected, hash("https://example.com/search?q=x&page=2"))
+	require.Equal(t, hash("https://example.com/search?page=2&q=x"), hash("https://example.com/search?q=x&page=2&_=1"))
+	require.NotEqual(t, expected, hash("https://example.com/other?q=x"))
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/search?q=x", nil)
+	require.Nil(t, hashFunc(req, nil, nil))
+}
+
+func TestHashByURLAndAccept(t *testing.T) {
+	hashFunc := HashByURLAndAccept()
+	hash := func(rawURL, accept, acceptEncoding string) string {
+		req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		return string(hashFunc(req, nil, nil))
+	}
+
+	expected := hash("https://example.com/doc", "application/json", "gzip")
+	require.Equal(t, expected, hash("https://example.com/doc", " Application/JSON ", "GZIP"))
+	require.NotEqual(t, expected, hash("https://example.com/doc", "text/html", "gzip"))
+	require.NotEqual(t, expected, hash("https://example.com/doc", "application/json", "br"))
+	require.NotEqual(t, expected, hash("https://example.com/doc", "application/json", ""))
+	require.NotEqual(t, expected, hash("https://example.com/other", "application/json", "gzip"))
+	require.Equal(t, hash("https://example.com/doc", "text/html,application/json", ""),
+		hash("https://example.com/doc", "Text/HTML, application/json", ""))
+
+	// The values of a header given more than once are combined.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/doc", nil)
+	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept", "application/json")
+	require.Equal(t, hash("https://example.com/doc", "text/html, application/json", ""), string(hashFunc(req, nil, nil)))
+
+	req, _ = http.NewRequest(http.MethodPost, "https://example.com/doc", nil)
+	require.Nil(t, hashFunc(req, nil, nil))
+
+	// The generic builder uses the named headers only.
+	hashFunc = HashByURLAndHeaders("accept-language")
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/doc", nil)
+	req.Header.Set("Accept-Language", "en")
+	en := string(hashFunc(req, nil, nil))
+	req.Header.Set("Accept", "text/html")
+	require.Equal(t, en, string(hashFunc(req, nil, nil)))
+	req.Header.Set("Accept-Language", "fr")
+	require.NotEqual(t, en, string(hashFunc(req, nil, nil)))
+}
+
+func TestHashByURLAndCookie(t *testing.T) {
+	hashFunc := HashByURLAndCookie("session")
+	hash := func(cookies ...*http.Cookie) string {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/me", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return string(hashFunc(req, nil, nil))
+	}
+
+	alice := hash(&http.Cookie{Name: "session", Value: "alice"})
+	require.NotEqual(t, alice, hash(&http.Cookie{Name: "session", Value: "bob"}))
+	require.NotEqual(t, alice, hash())
+	require.Equal(t, alice, hash(&http.Cookie{Name: "theme", Value: "dark"}, &http.Cookie{Name: "session", Value: "alice"}))
+	require.NotContains(t, alice, "alice")
+
+	// The whole Cookie header is part of the key without names.
+	hashFunc = HashByURLAndCookie()
+	require.NotEqual(t, hash(&http.Cookie{Name: "session", Value: "alice"}),
+		hash(&http.Cookie{Name: "session", Value: "alice"}, &http.Cookie{Name: "theme", Value: "dark"}))
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/me", nil)
+	require.Nil(t, hashFunc(req, nil, nil))
+}
+
+func TestRequestEntryEncoderDecoder_Proto(t *testing.T) {
+	m := requestEntryEncoderDecoder{}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	tests := []struct {
+		resp       *http.Response
+		proto      string
+		protoMajor int
+		protoMinor int
+	}{
+		{&http.Response{StatusCode: http.StatusOK}, "HTTP/1.1", 1, 1},
+		{&http.Response{StatusCode: http.StatusOK, Proto: "HTTP/1.0"}, "HTTP/1.0", 1, 0},
+		{&http.Response{StatusCode: http.StatusOK, ProtoMajor: 2}, "HTTP/2.0", 2, 0},
+		{&http.Response{StatusCode: http.StatusOK, Proto: "HTTP/1.0", ProtoMajor: 1}, "HTTP/1.0", 1, 0},
+	}
+	for _, test := range tests {
+		value, err := m.Encode(RequestEntry{Request: req, Response: test.resp})
+		require.Nil(t, err)
+
+		var e HTTPRequestResponse
+		require.Nil(t, msgpack.Unmarshal(value, &e))
+		require.Equal(t, test.proto, e.Proto)
+		require.Equal(t, test.protoMajor, e.ProtoMajor)
+		require.Equal(t, test.protoMinor, e.ProtoMinor)
+		require.Equal(t, "200 OK", e.Status)
+
+		re, err := m.Decode(value)
+		require.Nil(t, err)
+		require.Equal(t, test.proto, re.Response.Proto)
+		require.Equal(t, test.protoMajor, re.Response.ProtoMajor)
+		require.Equal(t, test.protoMinor, re.Response.ProtoMinor)
+		require.Equal(t, "200 OK", re.Response.Status)
+	}
+
+	// An entry stored without the protocol fields.
+	value, err := msgpack.Marshal(&HTTPRequestResponse{Method: http.MethodGet, URL: "https://example.com", StatusCode: http.StatusNotFound})
+	require.Nil(t, err)
+	re, err := m.Decode(value)
+	require.Nil(t, err)
+	require.Equal(t, "HTTP/1.1", re.Response.Proto)
+	require.True(t, re.Response.ProtoAtLeast(1, 1))
+	require.Equal(t, "404 Not Found", re.Response.Status)
+}
+
+func TestRequestEntryEncoderDecoder_CorruptEntry(t *testing.T) {
+	m := requestEntryEncoderDecoder{}
+	for _, statusCode := range []int{-1, 1, 99, 600, 1000} {
+		value, err := msgpack.Marshal(&HTTPRequestResponse{Method: http.MethodGet, URL: "https://example.com", StatusCode: statusCode})
+		require.Nil(t, err)
+		_, err = m.Decode(value)
+		require.True(t, errors.Is(err, ErrCorruptCacheEntry), statusCode)
+	}
+
+	for _, statusCode := range []int{100, 599} {
+		value, err := msgpack.Marshal(&HTTPRequestResponse{Method: http.MethodGet, URL: "https://example.com", StatusCode: statusCode})
+		require.Nil(t, err)
+		re, err := m.Decode(value)
+		require.Nil(t, err)
+		require.Equal(t, statusCode, re.Response.StatusCode)
+	}
+
+	// An entry of an error has no response.
+	value, err := msgpack.Marshal(&HTTPRequestResponse{Method: http.MethodGet, URL: "https://example.com", Error: []byte("error")})
+	require.Nil(t, err)
+	re, err := m.Decode(value)
+	require.Nil(t, err)
+	require.Nil(t, re.Response)
+	require.NotNil(t, re.Error)
+}
+
+func TestCacheHandler_DecodeError(t *testing.T) {
+	var errs []error
+	option := NewMemoryCacheOption()
+	option.OnError = func(err error) {
+		errs = append(errs, err)
+	}
+	handler := CacheHandler(option)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/corrupt", nil)
+	hash := option.RequestHashFunc(req, nil, nil)
+	require.Nil(t, option.Cacher.Set(hash, []byte("garbage"), time.Minute))
+
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, 1, realRequestTimes)
+
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], ErrCacheDecodeFailed))
+	var e *CacheDecodeError
+	require.True(t, errors.As(errs[0], &e))
+	require.Equal(t, hash, e.Key)
+	require.NotNil(t, errors.Unwrap(errs[0]))
+
+	// The corrupt entry is deleted, so it is reported only once.
+	_, err = option.Cacher.Get(hash)
+	require.Equal(t, ErrCacheKeyNotFound, err)
+	_, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, 2, realRequestTimes)
+	require.Len(t, errs, 1)
+}
+
+type testContextCacher struct {
+	MemoryCache
+	values []interface{}
+}
+
+type testCacheContextKey struct{}
+
+func (c *testContextCacher) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	c.values = append(c.values, ctx.Value(testCacheContextKey{}))
+	return c.MemoryCache.GetContext(ctx, key)
+}
+
+func (c *testContextCacher) SetContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	c.values = append(c.values, ctx.Value(testCacheContextKey{}))
+	return c.MemoryCache.SetContext(ctx, key, value, ttl)
+}
+
+func TestCacheHandler_RequestContext(t *testing.T) {
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	cacher := &testContextCacher{MemoryCache: NewMemoryCache()}
+	option := NewCacheOption(cacher)
+	ctx := context.WithValue(context.Background(), testCacheContextKey{}, "request")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/context", nil)
+	_, err := CacheHandler(option)(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{"request", "request"}, cacher.values)
+
+	// A slow cache backend does not exceed the deadline of the request.
+	slow := &struct{ Cacher }{testSlowCacher{MemoryCache: NewMemoryCache(), delay: time.Second}}
+	option = NewCacheOption(slow)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/slow", nil)
+	start := time.Now()
+	resp, err := CacheHandler(option)(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestCacheHandler_Partition(t *testing.T) {
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		body := "hello " + PartitionFromContext(req)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+	}
+
+	cacher := &testRecordingCacher{MemoryCache: NewMemoryCache()}
+	option := NewCacheOption(cacher)
+	option.PartitionFunc = PartitionFromContext
+	handler := CacheHandler(option)
+
+	get := func(tenant string) string {
+		ctx := WithCachePartition(context.Background(), tenant)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/tenant", nil)
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return string(body)
+	}
+
+	require.Equal(t, "hello a", get("a"))
+	require.Equal(t, "hello b", get("b"))
+	require.Equal(t, 2, realRequestTimes)
+	require.Len(t, cacher.keys, 2)
+	require.NotEqual(t, cacher.keys[0], cacher.keys[1])
+
+	require.Equal(t, "hello a", get("a"))
+	require.Equal(t, "hello b", get("b"))
+	require.Equal(t, 2, realRequestTimes)
+
+	// The empty partition uses the key of RequestHashFunc.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/tenant", nil)
+	require.Equal(t, option.RequestHashFunc(req, nil, nil), option.cacheKey(req, nil, nil))
+
+	// Only the entry of the partition is invalidated.
+	ctx := WithCachePartition(context.Background(), "a")
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/tenant", nil)
+	require.Nil(t, option.Invalidate(req))
+	require.Equal(t, "hello a", get("a"))
+	require.Equal(t, "hello b", get("b"))
+	require.Equal(t, 3, realRequestTimes)
+
+	require.NotNil(t, NewCacheOption(&struct{ Cacher }{NewMemoryCache()}).Invalidate(req))
+}
+
+func TestCacheHandler_TTLAndKeyOverride(t *testing.T) {
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(req.URL.Path))}, nil
+	}
+
+	cache := NewMemoryCache()
+	option := NewCacheOption(cache)
+	handler := CacheHandler(option)
+	get := func(ctx context.Context, url string) string {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return string(body)
+	}
+
+	// WithCacheTTL takes precedence over CacheTTLFunc.
+	require.Equal(t, "/ttl", get(WithCacheTTL(context.Background(), time.Hour), "https://example.com/ttl"))
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/ttl", nil)
+	_, remaining, err := cache.GetWithTTL(option.cacheKey(req, nil, nil))
+	require.Nil(t, err)
+	require.True(t, remaining > 5*time.Minute && remaining <= time.Hour)
+
+	require.Equal(t, "/default", get(WithCacheTTL(context.Background(), 0), "https://example.com/default"))
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/default", nil)
+	_, remaining, err = cache.GetWithTTL(option.cacheKey(req, nil, nil))
+	require.Nil(t, err)
+	require.True(t, remaining <= 5*time.Minute)
+
+	// Different requests with the same key share the response.
+	ctx := WithCacheKey(context.Background(), "shared")
+	require.Equal(t, "/a", get(ctx, "https://example.com/a"))
+	require.Equal(t, "/a", get(ctx, "https://example.com/b"))
+	require.Equal(t, 3, realRequestTimes)
+	_, err = cache.Get([]byte("shared"))
+	require.Nil(t, err)
+
+	// The partition is applied to the forced key.
+	option.PartitionFunc = PartitionFromContext
+	handler = CacheHandler(option)
+	require.Equal(t, "/b", get(WithCachePartition(ctx, "tenant"), "https://example.com/b"))
+	require.Equal(t, 4, realRequestTimes)
+}
+
+func TestCacheHandler_CacheableMethodsAndTTLByMethod(t *testing.T) {
+	realRequestTimes := map[string]int{}
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes[req.Method]++
+		status := http.StatusOK
+		if req.Method == http.MethodOptions {
+			status = http.StatusNoContent
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Allow": []string{"GET, HEAD, OPTIONS"}},
+			Body:       io.NopCloser(bytes.NewBufferString(req.Method)),
+		}, nil
+	}
+
+	cache := NewMemoryCache()
+	option := NewCacheOption(cache)
+	option.CacheableMethods = []string{http.MethodOptions, http.MethodHead}
+	option.TTLByMethod = map[string]time.Duration{
+		http.MethodOptions: time.Hour,
+		http.MethodHead:    5 * time.Minute,
+		http.MethodGet:     time.Minute,
+	}
+	handler := CacheHandler(option)
+	do := func(method string) (int, string) {
+		req, _ := http.NewRequest(method, "https://example.com/resource", nil)
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// Each method is cached separately, the responses of the same URL never collide.
+	for i := 0; i < 2; i++ {
+		for _, method := range []string{http.MethodOptions, http.MethodHead, http.MethodGet} {
+			status, body := do(method)
+			require.Equal(t, method, body)
+			if method == http.MethodOptions {
+				require.Equal(t, http.StatusNoContent, status)
+			}
+		}
+	}
+	require.Equal(t, map[string]int{http.MethodOptions: 1, http.MethodHead: 1, http.MethodGet: 1}, realRequestTimes)
+
+	keys := map[string]bool{}
+	for method, ttl := range option.TTLByMethod {
+		req, _ := http.NewRequest(method, "https://example.com/resource", nil)
+		key := option.cacheKey(req, nil, nil)
+		keys[string(key)] = true
+		_, remaining, err := cache.GetWithTTL(key)
+		require.Nil(t, err)
+		require.True(t, remaining > ttl-time.Minute && remaining <= ttl, method)
+	}
+	require.Len(t, keys, 3)
+
+	// The other methods are still not cached, and CacheTTLFunc is used without a TTL of the method.
+	do(http.MethodDelete)
+	do(http.MethodDelete)
+	require.Equal(t, 2, realRequestTimes[http.MethodDelete])
+	option.TTLByMethod = nil
+	req, _ := http.NewRequest(http.MethodOptions, "https://example.com/resource", nil)
+	require.Equal(t, 5*time.Minute, option.cacheTTL(req, nil, nil))
+
+	// ShouldCacheFunc still decides whether the responses of CacheableMethods are stored.
+	option = NewCacheOption(NewMemoryCache())
+	option.CacheableMethods = []string{http.MethodOptions, http.MethodHead}
+	option.ShouldCacheFunc = func(req *http.Request, resp *http.Response, err error) bool {
+		return req.Method != http.MethodOptions && DefaultShouldCacheFunc(req, resp, err)
+	}
+	handler = CacheHandler(option)
+	realRequestTimes = map[string]int{}
+	for i := 0; i < 2; i++ {
+		do(http.MethodOptions)
+		do(http.MethodHead)
+	}
+	require.Equal(t, map[string]int{http.MethodOptions: 2, http.MethodHead: 1}, realRequestTimes)
+}
+
+func TestCacheHandler_RequestCacheControl(t *testing.T) {
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		body := fmt.Sprintf("response %d", realRequestTimes)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(body))}, nil
+	}
+
+	option := NewMemoryCacheOption()
+	get := func(handler RequestHandler, header, value string) string {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return string(body)
+	}
+
+	// The directives are ignored by default.
+	handler := CacheHandler(option)
+	require.Equal(t, "response 1", get(handler, "", ""))
+	require.Equal(t, "response 1", get(handler, "Cache-Control", "no-cache"))
+
+	option.RequestCacheControl = true
+	handler = CacheHandler(option)
+	// no-cache skips the lookup, and the fresh response is stored.
+	require.Equal(t, "response 2", get(handler, "Cache-Control", "No-Cache, max-age=0"))
+	require.Equal(t, "response 2", get(handler, "", ""))
+	require.Equal(t, "response 3", get(handler, "Pragma", "no-cache"))
+	require.Equal(t, "response 3", get(handler, "", ""))
+
+	// no-store neither reads nor writes the cache.
+	require.Equal(t, "response 4", get(handler, "Cache-Control", "no-store"))
+	require.Equal(t, "response 3", get(handler, "", ""))
+	require.Equal(t, 4, realRequestTimes)
+}
+
+func TestCacheHandler_CompressCachedBodies(t *testing.T) {
+	large := bytes.Repeat([]byte(`{"name":"gohttpclient","tags":["retry","cache"]},`), 200)
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	_, _ = zw.Write(large)
+	_ = zw.Close()
+
+	bodies := map[string][]byte{"/small": []byte("hello world"), "/large": large, "/gzip": gzipped.Bytes()}
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		if req.URL.Path == "/gzip" {
+			header.Set("Content-Encoding", "gzip")
+		}
+		body := bodies[req.URL.Path]
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(body))}, nil
+	}
+
+	cache := NewMemoryCache()
+	option := NewCacheOption(cache)
+	option.CompressCachedBodies = true
+	option.CompressionMinBytes = 100
+	handler := CacheHandler(option)
+
+	tests := []struct {
+		path       string
+		compressed bool
+	}{
+		{"/small", false},
+		{"/large", true},
+		{"/gzip", true},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com"+tt.path, nil)
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		resp.Body.Close()
+
+		value, err := cache.Get(option.cacheKey(req, nil, nil))
+		require.Nil(t, err)
+		var e HTTPRequestResponse
+		require.Nil(t, msgpack.Unmarshal(value, &e))
+		require.Equal(t, tt.compressed, e.ResponseBodyCompressed, tt.path)
+		if tt.compressed {
+			require.Less(t, len(value), len(large)/10)
+		}
+
+		resp, err = handler(req, func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("not cached")
+		})
+		require.Nil(t, err, tt.path)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		want := bodies[tt.path]
+		if tt.path == "/gzip" {
+			want = large
+		}
+		require.Equal(t, want, body, tt.path)
+		require.Empty(t, resp.Header.Get("Content-Encoding"))
+		require.Equal(t, strconv.Itoa(len(want)), resp.Header.Get("Content-Length"))
+		require.Equal(t, int64(len(want)), resp.ContentLength)
+	}
+}
+
+func TestRequestEntryEncoderDecoder_LegacyUncompressed(t *testing.T) {
+	// An entry stored before ResponseBodyCompressed is decoded as it is.
+	legacy := struct {
+		Method         string
+		URL            string
+		StatusCode     int
+		ResponseHeader map[string]string
+		ResponseBody   []byte
+	}{
+		Method:         http.MethodGet,
+		URL:            "https://example.com",
+		StatusCode:     http.StatusOK,
+		ResponseHeader: map[string]string{"Content-Type": "application/json"},
+		ResponseBody:   []byte(`{"legacy":true}`),
+	}
+	value, err := msgpack.Marshal(&legacy)
+	require.Nil(t, err)
+
+	re, err := requestEntryEncoderDecoder{}.Decode(value)
+	require.Nil(t, err)
+	body, err := io.ReadAll(re.Response.Body)
+	require.Nil(t, err)
+	require.Equal(t, legacy.ResponseBody, body)
+	require.Equal(t, "application/json", re.Response.Header.Get("Content-Type"))
+
+	// A compressed body that can not be inflated is corrupt.
+	value, err = msgpack.Marshal(&HTTPRequestResponse{
+		Method:                 http.MethodGet,
+		URL:                    "https://example.com",
+		StatusCode:             http.StatusOK,
+		ResponseBody:           []byte("not gzip"),
+		ResponseBodyCompressed: true,
+	})
+	require.Nil(t, err)
+	_, err = requestEntryEncoderDecoder{}.Decode(value)
+	require.True(t, errors.Is(err, ErrCorruptCacheEntry))
+}
+
+type testCountingCacher struct {
+	MemoryCache
+	gets, sets int
+}
+
+func (c *testCountingCacher) Get(key []byte) ([]byte, error) {
+	c.gets++
+	return c.MemoryCache.Get(key)
+}
+
+func (c *testCountingCacher) Set(key, value []byte, ttl time.Duration) error {
+	c.sets++
+	return c.MemoryCache.Set(key, value, ttl)
+}
+
+func TestCacheHandler_Methods(t *testing.T) {
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		realRequestTimes++
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	newOption := func() (CacheOption, *testCountingCacher, *int) {
+		cacher := &testCountingCacher{MemoryCache: NewMemoryCache()}
+		// Wrapped so that the context methods of MemoryCache are not used.
+		option := NewCacheOption(&struct{ Cacher }{cacher})
+		hashes := 0
+		option.RequestHashFunc = func(req *http.Request, resp *http.Response, err error) []byte {
+			hashes++
+			return []byte(req.Method + " " + req.URL.String())
+		}
+		option.ShouldCacheFunc = func(req *http.Request, resp *http.Response, err error) bool {
+			return err == nil && resp.StatusCode == http.StatusOK
+		}
+		return option, cacher, &hashes
+	}
+	do := func(handler RequestHandler, method string) {
+		req, _ := http.NewRequest(method, "https://example.com/methods", bytes.NewBufferString("body"))
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.Nil(t, err)
+	}
+
+	// POST is passed through by default.
+	option, cacher, hashes := newOption()
+	handler := CacheHandler(option)
+	do(handler, http.MethodPost)
+	do(handler, http.MethodPost)
+	require.Equal(t, 2, realRequestTimes)
+	require.Equal(t, 0, cacher.gets)
+	require.Equal(t, 0, cacher.sets)
+	require.Equal(t, 0, *hashes)
+
+	do(handler, http.MethodGet)
+	do(handler, http.MethodGet)
+	require.Equal(t, 3, realRequestTimes)
+	require.Equal(t, 2, cacher.gets)
+	require.Equal(t, 1, cacher.sets)
+
+	// POST is looked up and stored when it is added to LookupMethods.
+	realRequestTimes = 0
+	option, cacher, _ = newOption()
+	option.LookupMethods = []string{http.MethodGet, http.MethodPost}
+	handler = CacheHandler(option)
+	do(handler, http.MethodPost)
+	do(handler, http.MethodPost)
+	require.Equal(t, 1, realRequestTimes)
+	require.Equal(t, 2, cacher.gets)
+	require.Equal(t, 1, cacher.sets)
+
+	// The responses are looked up but never stored with empty StoreMethods.
+	realRequestTimes = 0
+	option, cacher, _ = newOption()
+	option.StoreMethods = []string{}
+	handler = CacheHandler(option)
+	do(handler, http.MethodGet)
+	do(handler, http.MethodGet)
+	require.Equal(t, 2, realRequestTimes)
+	require.Equal(t, 2, cacher.gets)
+	require.Equal(t, 0, cacher.sets)
+
+	// POST is stored but never looked up when it is only in StoreMethods.
+	realRequestTimes = 0
+	option, cacher, _ = newOption()
+	option.StoreMethods = []string{http.MethodPost}
+	handler = CacheHandler(option)
+	do(handler, http.MethodPost)
+	require.Equal(t, 1, realRequestTimes)
+	require.Equal(t, 0, cacher.gets)
+	require.Equal(t, 1, cacher.sets)
+}
+
+func TestCacheHandler_GzipEncodedBody(t *testing.T) {
+	plain := []byte("hello gzip")
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	_, _ = zw.Write(plain)
+	_ = zw.Close()
+
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipped.Bytes())
+		},
+	})
+	c := NewClient(WithCacheOption(NewMemoryCacheOption()))
+
+	// The transport does not decode the body of a request that asks for gzip itself, so it is cached encoded.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL("/"), nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, gzipped.Bytes(), body)
+
+	// A cache hit is decoded like the transport decodes a live response.
+	resp, err = c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, plain, body)
+	require.Empty(t, resp.Header.Get("Content-Encoding"))
+	require.Equal(t, strconv.Itoa(len(plain)), resp.Header.Get("Content-Length"))
+	require.Equal(t, int64(len(plain)), resp.ContentLength)
+	require.True(t, resp.Uncompressed)
+
+	// Unless the request asks for gzip itself.
+	resp, err = c.Do(req)
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, gzipped.Bytes(), body)
+	require.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	require.Equal(t, 1, ts.RequestCount("/"))
+}
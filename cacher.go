@@ -1,14 +1,24 @@
 package gohttpclient
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
 	"os"
 	"path"
+	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/go-redis/redis"
 	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
 )
 
 // ErrCacheKeyNotFound is a cached key does not exist error.
@@ -20,9 +30,225 @@ type Cacher interface {
 	Set(key, value []byte, ttl time.Duration) error
 }
 
+// CacherTTL is an optional interface of a Cacher, which also returns the remaining TTL of a key.
+// A remaining TTL of 0 means the key never expires.
+// CacheHandler uses it to keep a single entry for both the fresh and the stale response, see CacheOption.StaleTTL.
+type CacherTTL interface {
+	GetWithTTL(key []byte) (value []byte, remaining time.Duration, err error)
+}
+
+// CacherGetOrSet is an optional interface of a Cacher, which gets the value of a key,
+// or sets it to the value returned by fill when it does not exist.
+// The returned bool reports whether the value was loaded from the cache.
+// Concurrent calls for the same key call fill only once, and the others get its value.
+type CacherGetOrSet interface {
+	GetOrSet(key []byte, ttl time.Duration, fill func() ([]byte, error)) ([]byte, bool, error)
+}
+
+// CacherDeleter is an optional interface of a Cacher, which deletes a key,
+// CacheHandler uses it to delete the entries that can not be decoded.
+type CacherDeleter interface {
+	Delete(key []byte) error
+}
+
+// CacherContext is an optional interface of a Cacher, whose operations return when the context is done.
+// CacheHandler passes the context of the request to it, so that a slow cache backend never exceeds the deadline of the caller.
+// The operations of the Cachers that do not implement it are abandoned when the context is done, see doCacheContext.
+type CacherContext interface {
+	GetContext(ctx context.Context, key []byte) ([]byte, error)
+	SetContext(ctx context.Context, key, value []byte, ttl time.Duration) error
+}
+
+// CacherStream is an optional interface of a Cacher, which sets the value of a key written by write,
+// so that a large value is streamed to the storage instead of being held in memory, see CacheOption.InMemoryBodyLimit.
+type CacherStream interface {
+	SetStream(ctx context.Context, key []byte, ttl time.Duration, write func(w io.Writer) error) error
+}
+
+// CacherTTLContext is the context-aware version of CacherTTL.
+type CacherTTLContext interface {
+	GetWithTTLContext(ctx context.Context, key []byte) (value []byte, remaining time.Duration, err error)
+}
+
+// cacheGet gets the value of a key with the context, see CacherContext.
+func cacheGet(ctx context.Context, c Cacher, key []byte) ([]byte, error) {
+	if cc, ok := c.(CacherContext); ok {
+		return cc.GetContext(ctx, key)
+	}
+	var value []byte
+	err := doCacheContext(ctx, func() (err error) {
+		value, err = c.Get(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// cacheGetWithTTL gets the value of a key and its remaining TTL with the context, see CacherTTLContext.
+func cacheGetWithTTL(ctx context.Context, c CacherTTL, key []byte) ([]byte, time.Duration, error) {
+	if cc, ok := c.(CacherTTLContext); ok {
+		return cc.GetWithTTLContext(ctx, key)
+	}
+	var (
+		value     []byte
+		remaining time.Duration
+	)
+	err := doCacheContext(ctx, func() (err error) {
+		value, remaining, err = c.GetWithTTL(key)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, remaining, nil
+}
+
+// cacheSet sets the value of a key with the context, see CacherContext.
+func cacheSet(ctx context.Context, c Cacher, key, value []byte, ttl time.Duration) error {
+	if cc, ok := c.(CacherContext); ok {
+		return cc.SetContext(ctx, key, value, ttl)
+	}
+	return doCacheContext(ctx, func() error {
+		return c.Set(key, value, ttl)
+	})
+}
+
+// maxAbandonedCacheOperations is the maximum number of the cache operations that are still running
+// after their contexts are done, see doCacheContext.
+var maxAbandonedCacheOperations = 64
+
+// ErrCacheBackendBusy is returned instead of starting another cache operation
+// when too many operations of a slow cache backend are still running after their contexts are done.
+var ErrCacheBackendBusy = errors.New("too many cache operations are still running after their contexts are done")
+
+// cacheOperations counts the cache operations that are running in the background, see doCacheContext.
+var cacheOperations = struct {
+	sync.Mutex
+	abandoned int
+}{}
+
+// doCacheContext calls fn and returns when it finishes or the context is done, whichever comes first.
+// When the context is done first, fn keeps running in the background and its result is discarded,
+// so the variables set by fn must only be read when nil is returned.
+// At most maxAbandonedCacheOperations operations are left running in the background,
+// the operations beyond it fail with ErrCacheBackendBusy until some of them finish,
+// so that a stuck cache backend does not pile up goroutines.
+func doCacheContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		return fn()
+	}
+	cacheOperations.Lock()
+	busy := cacheOperations.abandoned >= maxAbandonedCacheOperations
+	cacheOperations.Unlock()
+	if busy {
+		return ErrCacheBackendBusy
+	}
+
+	var (
+		mu        sync.Mutex
+		finished  bool
+		abandoned bool
+	)
+	done := make(chan error, 1)
+	go func() {
+		err := fn()
+		mu.Lock()
+		finished = true
+		if abandoned {
+			cacheOperations.Lock()
+			cacheOperations.abandoned--
+			cacheOperations.Unlock()
+		}
+		mu.Unlock()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		mu.Lock()
+		if !finished {
+			abandoned = true
+			cacheOperations.Lock()
+			cacheOperations.abandoned++
+			cacheOperations.Unlock()
+		}
+		mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// cacheFillGroup makes sure that concurrent GetOrSet calls for the same key call fill only once.
+type cacheFillGroup struct {
+	mu    sync.Mutex
+	calls map[string]*cacheFillCall
+}
+
+type cacheFillCall struct {
+	wg     sync.WaitGroup
+	value  []byte
+	loaded bool
+	err    error
+}
+
+func newCacheFillGroup() *cacheFillGroup {
+	return &cacheFillGroup{calls: make(map[string]*cacheFillCall)}
+}
+
+// do calls fn for the key, and the callers that arrive while it is running wait for and share its result.
+// The value shared with the waiters is always reported as loaded.
+func (g *cacheFillGroup) do(key string, fn func() ([]byte, bool, error)) ([]byte, bool, error) {
+	if g == nil {
+		return fn()
+	}
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err == nil, call.err
+	}
+	call := &cacheFillCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.value, call.loaded, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return call.value, call.loaded, call.err
+}
+
+// getOrSet implements GetOrSet with the Get and Set methods of a Cacher.
+func getOrSet(c Cacher, key []byte, ttl time.Duration, fill func() ([]byte, error)) ([]byte, bool, error) {
+	value, err := c.Get(key)
+	if err == nil {
+		return value, true, nil
+	}
+	if errors.Cause(err) != ErrCacheKeyNotFound {
+		return nil, false, err
+	}
+	value, err = fill()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := c.Set(key, value, ttl); err != nil {
+		return nil, false, err
+	}
+	return value, false, nil
+}
+
 // MemoryCache stores data in memory and implements the Cacher interface.
 type MemoryCache struct {
-	c *cache.Cache
+	c     *cache.Cache
+	fills *cacheFillGroup
 }
 
 // NewMemoryCache creates an in-memory cache instance.
@@ -30,7 +256,7 @@ type MemoryCache struct {
 func NewMemoryCache() MemoryCache {
 	cleanupInterval := time.Second
 	c := cache.New(cache.NoExpiration, cleanupInterval)
-	return MemoryCache{c: c}
+	return MemoryCache{c: c, fills: newCacheFillGroup()}
 }
 
 // Get gets the value of a key and returns ErrCacheKeyNotFound if it does not exist.
@@ -48,6 +274,55 @@ func (c MemoryCache) Set(key, value []byte, ttl time.Duration) error {
 	return nil
 }
 
+// GetWithTTL gets the value of a key and its remaining TTL, and returns ErrCacheKeyNotFound if it does not exist.
+func (c MemoryCache) GetWithTTL(key []byte) ([]byte, time.Duration, error) {
+	value, expiration, found := c.c.GetWithExpiration(string(key))
+	if !found {
+		return nil, 0, ErrCacheKeyNotFound
+	}
+	if expiration.IsZero() {
+		return value.([]byte), 0, nil
+	}
+	return value.([]byte), time.Until(expiration), nil
+}
+
+// GetContext is the same as Get, and it returns the error of the context when the context is done.
+func (c MemoryCache) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
+// SetContext is the same as Set, and it returns the error of the context when the context is done.
+func (c MemoryCache) SetContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Set(key, value, ttl)
+}
+
+// GetWithTTLContext is the same as GetWithTTL, and it returns the error of the context when the context is done.
+func (c MemoryCache) GetWithTTLContext(ctx context.Context, key []byte) ([]byte, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return c.GetWithTTL(key)
+}
+
+// Delete deletes the key, it is not an error if the key does not exist.
+func (c MemoryCache) Delete(key []byte) error {
+	c.c.Delete(string(key))
+	return nil
+}
+
+// GetOrSet gets the value of a key, or sets it to the value returned by fill when it does not exist.
+func (c MemoryCache) GetOrSet(key []byte, ttl time.Duration, fill func() ([]byte, error)) ([]byte, bool, error) {
+	return c.fills.do(string(key), func() ([]byte, bool, error) {
+		return getOrSet(c, key, ttl, fill)
+	})
+}
+
 // FileCache saves data to the file system and implements the Cacher interface.
 type FileCache struct {
 	RootDir     string
@@ -58,6 +333,8 @@ type FileCache struct {
 // NewFileCache creates an instance of the file system cache,
 // and save the storage data in the rootDir directory in the form of files.
 // Note that files are not removed periodically, only when they are accessed and found to be out of date.
+// The directory is created by the first Set when it does not exist.
+// The files are readable by all the users, use NewFileCacheDir for sensitive responses.
 func NewFileCache(rootDir string) FileCache {
 	return FileCache{
 		RootDir:     rootDir,
@@ -66,46 +343,116 @@ func NewFileCache(rootDir string) FileCache {
 	}
 }
 
+// defaultFileCachePermission is the permission of the files of NewFileCacheDir, which are only accessible by the owner.
+const defaultFileCachePermission os.FileMode = 0600
+
+// NewFileCacheDir creates an instance of the file system cache like NewFileCache,
+// the files are created with perm, which is 0600 when it is 0, and rootDir is created when it does not exist,
+// with the execute bits added to the readable bits of perm, such as 0700 for 0600.
+// It returns an error when the directory can not be created or written.
+func NewFileCacheDir(rootDir string, perm os.FileMode) (FileCache, error) {
+	if perm == 0 {
+		perm = defaultFileCachePermission
+	}
+	c := NewFileCache(rootDir)
+	c.Permission = perm
+
+	if err := os.MkdirAll(rootDir, fileCacheDirPermission(perm)); err != nil {
+		return FileCache{}, errors.Wrapf(err, "Error creating the cache directory '%s'", rootDir)
+	}
+	info, err := os.Stat(rootDir)
+	if err != nil {
+		return FileCache{}, errors.Wrapf(err, "Error checking the cache directory '%s'", rootDir)
+	}
+	if !info.IsDir() {
+		return FileCache{}, errors.Errorf("The cache directory '%s' is not a directory", rootDir)
+	}
+	probe, err := os.CreateTemp(rootDir, ".probe-*")
+	if err != nil {
+		return FileCache{}, errors.Wrapf(err, "The cache directory '%s' is not writable", rootDir)
+	}
+	_ = probe.Close()
+	_ = os.Remove(probe.Name())
+	return c, nil
+}
+
+// fileCacheDirPermission adds the execute bits to the readable bits of the permission of the files,
+// so that the users who can read the files can also list the directory.
+func fileCacheDirPermission(perm os.FileMode) os.FileMode {
+	return perm | (perm&0444)>>2
+}
+
 func (c FileCache) path(key []byte) string {
 	return path.Join(c.RootDir, string(key)+".cache")
 }
 
+// fileCacheFills is shared by all FileCache instances, because they may use the same directory.
+var fileCacheFills = newCacheFillGroup()
+
 // Get gets the value of a key and returns ErrCacheKeyNotFound if it does not exist.
 func (c FileCache) Get(key []byte) ([]byte, error) {
+	value, _, err := c.GetWithTTL(key)
+	return value, err
+}
+
+// GetWithTTL gets the value of a key and its remaining TTL, and returns ErrCacheKeyNotFound if it does not exist.
+func (c FileCache) GetWithTTL(key []byte) ([]byte, time.Duration, error) {
 	path := c.path(key)
 	_, err := os.Stat(path)
 	if err != nil && os.IsNotExist(err) {
-		return nil, ErrCacheKeyNotFound
+		return nil, 0, ErrCacheKeyNotFound
 	} else if err != nil {
-		return nil, errors.Wrapf(err, "Error checking if file exists, cache key '%s'", string(key))
+		return nil, 0, errors.Wrapf(err, "Error checking if file exists, cache key '%s'", string(key))
 	}
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error reading file contents, cache key '%s'", string(key))
+		return nil, 0, errors.Wrapf(err, "Error reading file contents, cache key '%s'", string(key))
 	}
 
 	var e fileCacheEntry
 	err = msgpack.Unmarshal(data, &e)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error deserializing cached data, cache key '%s'", string(key))
+		return nil, 0, errors.Wrapf(err, "Error deserializing cached data, cache key '%s'", string(key))
 	}
 
 	nsec := e.TTL
 	ttl := time.Unix(nsec/1e9, nsec%1e9)
-	if ttl.Sub(c.TimeNowFunc()) >= 0 {
-		return e.Value, nil
+	if remaining := ttl.Sub(c.TimeNowFunc()); remaining >= 0 {
+		return e.Value, remaining, nil
 	}
 
 	err = os.Remove(path)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Error deleting an expired file, cache key '%s'", string(key))
+		return nil, 0, errors.Wrapf(err, "Error deleting an expired file, cache key '%s'", string(key))
 	}
 
-	return nil, ErrCacheKeyNotFound
+	return nil, 0, ErrCacheKeyNotFound
+}
+
+// GetContext is the same as Get, and it returns the error of the context when the context is done.
+func (c FileCache) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	value, _, err := c.GetWithTTLContext(ctx, key)
+	return value, err
+}
+
+// GetWithTTLContext is the same as GetWithTTL, and it returns the error of the context when the context is done.
+func (c FileCache) GetWithTTLContext(ctx context.Context, key []byte) ([]byte, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return c.GetWithTTL(key)
 }
 
 // Set sets the value of the key, and configures the TTL of the cache.
 func (c FileCache) Set(key, value []byte, ttl time.Duration) error {
+	return c.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext is the same as Set, and the write is aborted when the context is done.
+// The data is written to a temporary file which is then renamed,
+// so that a reader never sees a partially written file.
+// The directory is created when it does not exist.
+func (c FileCache) SetContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
 	now := c.TimeNowFunc()
 	e := fileCacheEntry{
 		Key:   key,
@@ -119,10 +466,161 @@ func (c FileCache) Set(key, value []byte, ttl time.Duration) error {
 		return errors.Wrapf(err, "Error serializing cached data, cache key '%s'", string(key))
 	}
 	path := c.path(key)
-	err = os.WriteFile(path, data, c.Permission)
+	err = writeFileAtomic(ctx, path, data, c.Permission)
+	if err != nil && os.IsNotExist(err) {
+		// The directory is created lazily for the caches created by NewFileCache.
+		if err := os.MkdirAll(c.RootDir, fileCacheDirPermission(c.Permission)); err != nil {
+			return errors.Wrapf(err, "Error creating the cache directory '%s', cache key '%s'", c.RootDir, string(key))
+		}
+		err = writeFileAtomic(ctx, path, data, c.Permission)
+	}
+	return errors.Wrapf(err, "Error writing file contents, cache key '%s'", string(key))
+}
+
+// SetStream is the same as SetContext, and the value written by write is streamed to the file
+// instead of being held in memory. The value is stored in the same format, so it is read by Get.
+func (c FileCache) SetStream(ctx context.Context, key []byte, ttl time.Duration, write func(w io.Writer) error) error {
+	now := c.TimeNowFunc()
+	writeEntry := func(f *os.File) error {
+		return writeFileCacheEntry(ctx, f, key, now.UnixNano(), now.Add(ttl).UnixNano(), write)
+	}
+	path := c.path(key)
+	err := writeFileAtomicFunc(path, c.Permission, writeEntry)
+	if err != nil && os.IsNotExist(err) {
+		if err := os.MkdirAll(c.RootDir, fileCacheDirPermission(c.Permission)); err != nil {
+			return errors.Wrapf(err, "Error creating the cache directory '%s', cache key '%s'", c.RootDir, string(key))
+		}
+		err = writeFileAtomicFunc(path, c.Permission, writeEntry)
+	}
 	return errors.Wrapf(err, "Error writing file contents, cache key '%s'", string(key))
 }
 
+// writeFileCacheEntry writes the msgpack encoding of a fileCacheEntry whose value is written by write.
+// The length of the value is not known in advance, so it is written as a bin 32 and filled in afterwards.
+func writeFileCacheEntry(ctx context.Context, f *os.File, key []byte, start, ttl int64, write func(w io.Writer) error) error {
+	enc := msgpack.NewEncoder(f)
+	if err := enc.EncodeMapLen(4); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("Key"); err != nil {
+		return err
+	}
+	if err := enc.EncodeBytes(key); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("Value"); err != nil {
+		return err
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte{msgpcode.Bin32, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	w := &contextWriter{ctx: ctx, w: f}
+	if err := write(w); err != nil {
+		return err
+	}
+	if w.n > math.MaxUint32 {
+		return errors.Errorf("The value of %d bytes is too large", w.n)
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(w.n))
+	if _, err := f.WriteAt(size[:], offset+1); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("Start"); err != nil {
+		return err
+	}
+	if err := enc.EncodeInt(start); err != nil {
+		return err
+	}
+	if err := enc.EncodeString("TTL"); err != nil {
+		return err
+	}
+	return enc.EncodeInt(ttl)
+}
+
+// contextWriter counts the bytes written, and fails the writes once the context is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+	n   int64
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Delete deletes the key, it is not an error if the key does not exist.
+func (c FileCache) Delete(key []byte) error {
+	err := os.Remove(c.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Error deleting file, cache key '%s'", string(key))
+	}
+	return nil
+}
+
+// GetOrSet gets the value of a key, or sets it to the value returned by fill when it does not exist.
+func (c FileCache) GetOrSet(key []byte, ttl time.Duration, fill func() ([]byte, error)) ([]byte, bool, error) {
+	return fileCacheFills.do(c.path(key), func() ([]byte, bool, error) {
+		return getOrSet(c, key, ttl, fill)
+	})
+}
+
+// fileCacheWriteChunkSize is the size of each write, the context is checked between writes.
+const fileCacheWriteChunkSize = 64 * 1024
+
+func writeFileAtomic(ctx context.Context, name string, data []byte, perm os.FileMode) error {
+	return writeFileAtomicFunc(name, perm, func(f *os.File) error {
+		for len(data) > 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n := len(data)
+			if n > fileCacheWriteChunkSize {
+				n = fileCacheWriteChunkSize
+			}
+			if _, err := f.Write(data[:n]); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+		return nil
+	})
+}
+
+// writeFileAtomicFunc writes the file by write to a temporary file which is then renamed to name.
+func writeFileAtomicFunc(name string, perm os.FileMode, write func(f *os.File) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if err = write(f); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
 type fileCacheEntry struct {
 	Key   []byte
 	Value []byte
@@ -134,12 +632,13 @@ type fileCacheEntry struct {
 type RedisCache struct {
 	c      *redis.Client
 	Prefix string
+	fills  *cacheFillGroup
 }
 
 // NewRedisCache creates an instance of the redis server cache,
 // The default key has no prefix, of course you can set one yourself.
 func NewRedisCache(c *redis.Client) RedisCache {
-	return RedisCache{c: c, Prefix: ""}
+	return RedisCache{c: c, Prefix: "", fills: newCacheFillGroup()}
 }
 
 func (c RedisCache) key(key []byte) string {
@@ -163,3 +662,234 @@ func (c RedisCache) Set(key, value []byte, ttl time.Duration) error {
 	_, err := c.c.Set(c.key(key), string(value), ttl).Result()
 	return errors.Wrapf(err, "Set for cache key '%s'", string(key))
 }
+
+// GetWithTTL gets the value of a key and its remaining TTL, and returns ErrCacheKeyNotFound if it does not exist.
+// The value and the TTL are read in a single pipeline.
+func (c RedisCache) GetWithTTL(key []byte) ([]byte, time.Duration, error) {
+	pipe := c.c.Pipeline()
+	get := pipe.Get(c.key(key))
+	pttl := pipe.PTTL(c.key(key))
+	_, err := pipe.Exec()
+	if err == redis.Nil {
+		return nil, 0, ErrCacheKeyNotFound
+	}
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "GetWithTTL for cache key '%s'", string(key))
+	}
+	remaining := pttl.Val()
+	if remaining < 0 {
+		// The key has no expiration.
+		remaining = 0
+	}
+	return []byte(get.Val()), remaining, nil
+}
+
+// GetOrSet gets the value of a key, or sets it to the value returned by fill when it does not exist.
+// The value is set with SET NX, so when another process sets the key first, its value is returned instead.
+func (c RedisCache) GetOrSet(key []byte, ttl time.Duration, fill func() ([]byte, error)) ([]byte, bool, error) {
+	return c.fills.do(c.key(key), func() ([]byte, bool, error) {
+		value, err := c.Get(key)
+		if err == nil {
+			return value, true, nil
+		}
+		if errors.Cause(err) != ErrCacheKeyNotFound {
+			return nil, false, err
+		}
+		value, err = fill()
+		if err != nil {
+			return nil, false, err
+		}
+		ok, err := c.c.SetNX(c.key(key), string(value), ttl).Result()
+		if err != nil {
+			return nil, false, errors.Wrapf(err, "SetNX for cache key '%s'", string(key))
+		}
+		if ok {
+			return value, false, nil
+		}
+		value, err = c.Get(key)
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+	})
+}
+
+// GetContext is the same as Get, and it returns the error of the context when the context is done.
+// The redis client does not cancel a command in flight, so the command is abandoned instead, see doCacheContext.
+func (c RedisCache) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	var value []byte
+	err := doCacheContext(ctx, func() (err error) {
+		value, err = c.Get(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// SetContext is the same as Set, and it returns the error of the context when the context is done.
+func (c RedisCache) SetContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	return doCacheContext(ctx, func() error {
+		return c.Set(key, value, ttl)
+	})
+}
+
+// GetWithTTLContext is the same as GetWithTTL, and it returns the error of the context when the context is done.
+func (c RedisCache) GetWithTTLContext(ctx context.Context, key []byte) ([]byte, time.Duration, error) {
+	var (
+		value     []byte
+		remaining time.Duration
+	)
+	err := doCacheContext(ctx, func() (err error) {
+		value, remaining, err = c.GetWithTTL(key)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, remaining, nil
+}
+
+// Delete deletes the key, it is not an error if the key does not exist.
+func (c RedisCache) Delete(key []byte) error {
+	_, err := c.c.Del(c.key(key)).Result()
+	return errors.Wrapf(err, "Del for cache key '%s'", string(key))
+}
+
+// memcachedMaxKeyLength is the maximum length of a memcached key.
+const memcachedMaxKeyLength = 250
+
+// memcachedMaxRelativeTTL is the longest expiration that memcached takes as relative to now,
+// the longer ones are sent as a Unix time.
+const memcachedMaxRelativeTTL = 30 * 24 * time.Hour
+
+// MemcachedCache stores data in memcached servers and implements the Cacher interface.
+type MemcachedCache struct {
+	c      *memcache.Client
+	Prefix string
+	fills  *cacheFillGroup
+}
+
+// NewMemcachedCache creates an instance of the memcached server cache,
+// The default key has no prefix, of course you can set one yourself.
+// The keys longer than 250 bytes or with the characters memcached does not accept are hashed by SHA-256.
+func NewMemcachedCache(c *memcache.Client) MemcachedCache {
+	return MemcachedCache{c: c, Prefix: "", fills: newCacheFillGroup()}
+}
+
+func (c MemcachedCache) key(key []byte) string {
+	k := c.Prefix + string(key)
+	if isValidMemcachedKey(k) {
+		return k
+	}
+	sum := sha256.Sum256([]byte(k))
+	hashed := hex.EncodeToString(sum[:])
+	if k = c.Prefix + hashed; isValidMemcachedKey(k) {
+		return k
+	}
+	return hashed
+}
+
+func isValidMemcachedKey(key string) bool {
+	if len(key) == 0 || len(key) > memcachedMaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// memcachedExpiration converts the TTL to the expiration of memcached in seconds, 0 means it never expires.
+// The TTLs shorter than a second are rounded up, since 0 would never expire.
+func memcachedExpiration(ttl time.Duration, now time.Time) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if ttl > memcachedMaxRelativeTTL {
+		return int32(now.Unix() + seconds)
+	}
+	return int32(seconds)
+}
+
+// Get gets the value of a key and returns ErrCacheKeyNotFound if it does not exist.
+func (c MemcachedCache) Get(key []byte) ([]byte, error) {
+	item, err := c.c.Get(c.key(key))
+	if err == memcache.ErrCacheMiss {
+		return nil, ErrCacheKeyNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Get for cache key '%s'", string(key))
+	}
+	return item.Value, nil
+}
+
+// Set sets the value of the key, and configures the TTL of the cache.
+func (c MemcachedCache) Set(key, value []byte, ttl time.Duration) error {
+	err := c.c.Set(&memcache.Item{Key: c.key(key), Value: value, Expiration: memcachedExpiration(ttl, time.Now())})
+	return errors.Wrapf(err, "Set for cache key '%s'", string(key))
+}
+
+// GetOrSet gets the value of a key, or sets it to the value returned by fill when it does not exist.
+// The value is set with ADD, so when another process sets the key first, its value is returned instead.
+func (c MemcachedCache) GetOrSet(key []byte, ttl time.Duration, fill func() ([]byte, error)) ([]byte, bool, error) {
+	return c.fills.do(c.key(key), func() ([]byte, bool, error) {
+		value, err := c.Get(key)
+		if err == nil {
+			return value, true, nil
+		}
+		if errors.Cause(err) != ErrCacheKeyNotFound {
+			return nil, false, err
+		}
+		value, err = fill()
+		if err != nil {
+			return nil, false, err
+		}
+		err = c.c.Add(&memcache.Item{Key: c.key(key), Value: value, Expiration: memcachedExpiration(ttl, time.Now())})
+		if err == nil {
+			return value, false, nil
+		}
+		if err != memcache.ErrNotStored {
+			return nil, false, errors.Wrapf(err, "Add for cache key '%s'", string(key))
+		}
+		value, err = c.Get(key)
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+	})
+}
+
+// GetContext is the same as Get, and it returns the error of the context when the context is done.
+// The memcached client does not cancel a command in flight, so the command is abandoned instead, see doCacheContext.
+func (c MemcachedCache) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	var value []byte
+	err := doCacheContext(ctx, func() (err error) {
+		value, err = c.Get(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// SetContext is the same as Set, and it returns the error of the context when the context is done.
+func (c MemcachedCache) SetContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	return doCacheContext(ctx, func() error {
+		return c.Set(key, value, ttl)
+	})
+}
+
+// Delete deletes the key, it is not an error if the key does not exist.
+func (c MemcachedCache) Delete(key []byte) error {
+	err := c.c.Delete(c.key(key))
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return errors.Wrapf(err, "Delete for cache key '%s'", string(key))
+}
@@ -1,11 +1,24 @@
 package gohttpclient
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/go-redis/redis"
+	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
@@ -85,3 +98,460 @@ func getTestRedisClient() *redis.Client {
 	})
 	return c
 }
+
+func TestFileCache_AtomicSet(t *testing.T) {
+	c := NewFileCache(t.TempDir())
+	key := []byte("atomic")
+	values := [][]byte{
+		bytes.Repeat([]byte("a"), 1024*1024),
+		bytes.Repeat([]byte("b"), 3*1024*1024),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			_ = c.Set(key, values[i%2], time.Minute)
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			value, err := c.Get(key)
+			require.Nil(t, err)
+			require.Equal(t, values[1], value)
+			return
+		default:
+		}
+		value, err := c.Get(key)
+		if errors.Cause(err) == ErrCacheKeyNotFound {
+			continue
+		}
+		require.Nil(t, err)
+		require.True(t, bytes.Equal(values[0], value) || bytes.Equal(values[1], value))
+	}
+}
+
+func TestFileCache_SetContextCanceled(t *testing.T) {
+	dir := t.TempDir()
+	c := NewFileCache(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := c.SetContext(ctx, []byte("canceled"), []byte("value"), time.Minute)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+
+	_, err = c.Get([]byte("canceled"))
+	require.Equal(t, ErrCacheKeyNotFound, errors.Cause(err))
+	files, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+}
+
+func TestNewFileCacheDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	c, err := NewFileCacheDir(dir, 0)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), c.Permission)
+
+	info, err := os.Stat(dir)
+	require.Nil(t, err)
+	require.True(t, info.IsDir())
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	files, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Empty(t, files)
+
+	require.Nil(t, c.Set([]byte("key"), []byte("value"), time.Minute))
+	info, err = os.Stat(c.path([]byte("key")))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	c, err = NewFileCacheDir(filepath.Join(t.TempDir(), "shared"), 0640)
+	require.Nil(t, err)
+	info, err = os.Stat(c.RootDir)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.Nil(t, os.WriteFile(file, nil, 0600))
+	_, err = NewFileCacheDir(file, 0)
+	require.NotNil(t, err)
+}
+
+func TestNewFileCacheDir_ReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("the permissions are not enforced for root")
+	}
+	dir := t.TempDir()
+	require.Nil(t, os.Chmod(dir, 0500))
+	defer os.Chmod(dir, 0700)
+
+	_, err := NewFileCacheDir(dir, 0)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "is not writable")
+}
+
+func TestFileCache_SetCreatesDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	c := NewFileCache(dir)
+	require.Nil(t, c.Set([]byte("key"), []byte("value"), time.Minute))
+
+	value, err := c.Get([]byte("key"))
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+	info, err := os.Stat(dir)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
+
+func testCacherGetWithTTL(t *testing.T, c Cacher) {
+	key := []byte("get-with-ttl")
+	err := c.Set(key, []byte("value"), 10*time.Second)
+	require.Nil(t, err)
+
+	value, remaining, err := c.(CacherTTL).GetWithTTL(key)
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+	require.InDelta(t, float64(10*time.Second), float64(remaining), float64(time.Second))
+
+	_, _, err = c.(CacherTTL).GetWithTTL([]byte("get-with-ttl-not-exists"))
+	require.Equal(t, ErrCacheKeyNotFound, errors.Cause(err))
+}
+
+func testCacherGetOrSet(t *testing.T, c Cacher) {
+	key := []byte(fmt.Sprintf("get-or-set-%d", time.Now().UnixNano()))
+	var fills int32
+	fill := func() ([]byte, error) {
+		atomic.AddInt32(&fills, 1)
+		time.Sleep(20 * time.Millisecond)
+		return []byte("filled"), nil
+	}
+
+	var wg sync.WaitGroup
+	values := make([][]byte, 10)
+	loaded := make([]bool, 10)
+	errs := make([]error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], loaded[i], errs[i] = c.(CacherGetOrSet).GetOrSet(key, time.Minute, fill)
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&fills))
+	loadedTimes := 0
+	for i := 0; i < 10; i++ {
+		require.Nil(t, errs[i])
+		require.Equal(t, "filled", string(values[i]))
+		if loaded[i] {
+			loadedTimes++
+		}
+	}
+	require.Equal(t, 9, loadedTimes)
+
+	value, err := c.Get(key)
+	require.Nil(t, err)
+	require.Equal(t, "filled", string(value))
+
+	fillErr := errors.New("fill error")
+	_, _, err = c.(CacherGetOrSet).GetOrSet([]byte("get-or-set-error"), time.Minute, func() ([]byte, error) {
+		return nil, fillErr
+	})
+	require.Equal(t, fillErr, err)
+}
+
+func TestMemoryCache_GetWithTTL(t *testing.T) {
+	testCacherGetWithTTL(t, NewMemoryCache())
+
+	c := NewMemoryCache()
+	_ = c.Set([]byte("no-expiration"), []byte("value"), cache.NoExpiration)
+	_, remaining, err := c.GetWithTTL([]byte("no-expiration"))
+	require.Nil(t, err)
+	require.Equal(t, time.Duration(0), remaining)
+}
+
+func TestMemoryCache_GetOrSet(t *testing.T) {
+	testCacherGetOrSet(t, NewMemoryCache())
+}
+
+func TestFileCache_GetWithTTL(t *testing.T) {
+	testCacherGetWithTTL(t, NewFileCache(t.TempDir()))
+}
+
+func TestFileCache_GetOrSet(t *testing.T) {
+	testCacherGetOrSet(t, NewFileCache(t.TempDir()))
+}
+
+func TestRedisCache_GetWithTTL(t *testing.T) {
+	testCacherGetWithTTL(t, NewRedisCache(getTestRedisClient()))
+}
+
+func TestRedisCache_GetOrSet(t *testing.T) {
+	testCacherGetOrSet(t, NewRedisCache(getTestRedisClient()))
+}
+
+func testCacherDelete(t *testing.T, c Cacher) {
+	key := []byte("delete")
+	require.Nil(t, c.Set(key, []byte("value"), time.Minute))
+	require.Nil(t, c.(CacherDeleter).Delete(key))
+	_, err := c.Get(key)
+	require.Equal(t, ErrCacheKeyNotFound, errors.Cause(err))
+	require.Nil(t, c.(CacherDeleter).Delete(key))
+}
+
+func TestMemoryCache_Delete(t *testing.T) {
+	testCacherDelete(t, NewMemoryCache())
+}
+
+func TestFileCache_Delete(t *testing.T) {
+	testCacherDelete(t, NewFileCache(t.TempDir()))
+}
+
+func TestRedisCache_Delete(t *testing.T) {
+	testCacherDelete(t, NewRedisCache(getTestRedisClient()))
+}
+
+func testCacherContext(t *testing.T, c Cacher) {
+	key := []byte("context")
+	cc := c.(CacherContext)
+	require.Nil(t, cc.SetContext(context.Background(), key, []byte("value"), time.Minute))
+	value, err := cc.GetContext(context.Background(), key)
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+	value, _, err = c.(CacherTTLContext).GetWithTTLContext(context.Background(), key)
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cc.GetContext(ctx, key)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	_, _, err = c.(CacherTTLContext).GetWithTTLContext(ctx, key)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	err = cc.SetContext(ctx, key, []byte("canceled"), time.Minute)
+	require.Equal(t, context.Canceled, errors.Cause(err))
+
+	value, err = c.Get(key)
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+}
+
+func TestMemoryCache_Context(t *testing.T) {
+	testCacherContext(t, NewMemoryCache())
+}
+
+func TestFileCache_Context(t *testing.T) {
+	testCacherContext(t, NewFileCache(t.TempDir()))
+}
+
+func TestRedisCache_Context(t *testing.T) {
+	testCacherContext(t, NewRedisCache(getTestRedisClient()))
+}
+
+type testSlowCacher struct {
+	MemoryCache
+	delay time.Duration
+}
+
+func (c testSlowCacher) Get(key []byte) ([]byte, error) {
+	time.Sleep(c.delay)
+	return c.MemoryCache.Get(key)
+}
+
+func TestCacheGet_NotContextCacher(t *testing.T) {
+	c := &struct{ Cacher }{testSlowCacher{MemoryCache: NewMemoryCache(), delay: time.Second}}
+	require.Nil(t, c.Set([]byte("slow"), []byte("value"), time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := cacheGet(ctx, c, []byte("slow"))
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(start) < 500*time.Millisecond)
+
+	fast := &struct{ Cacher }{NewMemoryCache()}
+	require.Nil(t, fast.Set([]byte("fast"), []byte("value"), time.Minute))
+	value, err := cacheGet(ctx, fast, []byte("fast"))
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Nil(t, value)
+	value, err = cacheGet(context.Background(), fast, []byte("fast"))
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+}
+
+// testBlockingCacher is a Cacher whose Get blocks until release is closed.
+type testBlockingCacher struct {
+	MemoryCache
+	release chan struct{}
+}
+
+func (c testBlockingCacher) Get(key []byte) ([]byte, error) {
+	<-c.release
+	return c.MemoryCache.Get(key)
+}
+
+func TestCacheGet_AbandonedOperationsAreBounded(t *testing.T) {
+	defer func(n int) { maxAbandonedCacheOperations = n }(maxAbandonedCacheOperations)
+	// The operations abandoned by the other tests may still be running.
+	cacheOperations.Lock()
+	maxAbandonedCacheOperations = cacheOperations.abandoned + 2
+	cacheOperations.Unlock()
+
+	blocking := testBlockingCacher{MemoryCache: NewMemoryCache(), release: make(chan struct{})}
+	c := &struct{ Cacher }{blocking}
+	require.Nil(t, c.Set([]byte("key"), []byte("value"), time.Minute))
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := cacheGet(ctx, c, []byte("key"))
+		cancel()
+		require.Equal(t, context.DeadlineExceeded, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := cacheGet(ctx, c, []byte("key"))
+	require.Equal(t, ErrCacheBackendBusy, err)
+
+	close(blocking.release)
+	require.Eventually(t, func() bool {
+		value, err := cacheGet(ctx, c, []byte("key"))
+		return err == nil && string(value) == "value"
+	}, time.Second, 5*time.Millisecond)
+}
+
+// testMemcachedServer is a memcached server of the commands used by MemcachedCache, get, set, add and delete.
+type testMemcachedServer struct {
+	ln          net.Listener
+	mu          sync.Mutex
+	items       map[string][]byte
+	expirations map[string]int64
+}
+
+func newTestMemcachedServer(t *testing.T) *testMemcachedServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := &testMemcachedServer{ln: ln, items: make(map[string][]byte), expirations: make(map[string]int64)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testMemcachedServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+		s.mu.Lock()
+		switch fields[0] {
+		case "gets":
+			for _, key := range fields[1:] {
+				if value, ok := s.items[key]; ok {
+					fmt.Fprintf(conn, "VALUE %s 0 %d 1\r\n%s\r\n", key, len(value), value)
+				}
+			}
+			fmt.Fprint(conn, "END\r\n")
+		case "set", "add":
+			exp, _ := strconv.ParseInt(fields[3], 10, 64)
+			n, _ := strconv.Atoi(fields[4])
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				s.mu.Unlock()
+				return
+			}
+			if _, ok := s.items[fields[1]]; ok && fields[0] == "add" {
+				fmt.Fprint(conn, "NOT_STORED\r\n")
+				break
+			}
+			s.items[fields[1]] = data[:n]
+			s.expirations[fields[1]] = exp
+			fmt.Fprint(conn, "STORED\r\n")
+		case "delete":
+			if _, ok := s.items[fields[1]]; !ok {
+				fmt.Fprint(conn, "NOT_FOUND\r\n")
+				break
+			}
+			delete(s.items, fields[1])
+			fmt.Fprint(conn, "DELETED\r\n")
+		default:
+			fmt.Fprint(conn, "ERROR\r\n")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *testMemcachedServer) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestMemcachedCache(t *testing.T) {
+	server := newTestMemcachedServer(t)
+	c := NewMemcachedCache(memcache.New(server.ln.Addr().String()))
+	c.Prefix = "gohttpclient:"
+
+	_, err := c.Get([]byte("not_exists_key"))
+	require.Equal(t, ErrCacheKeyNotFound, errors.Cause(err))
+
+	require.Nil(t, c.Set([]byte("key"), []byte("value"), 100*time.Millisecond))
+	value, err := c.Get([]byte("key"))
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+	require.Equal(t, []string{"gohttpclient:key"}, server.keys())
+	// The TTLs shorter than a second are rounded up.
+	server.mu.Lock()
+	require.Equal(t, int64(1), server.expirations["gohttpclient:key"])
+	server.mu.Unlock()
+
+	// The long keys and the ones with spaces are hashed.
+	for _, key := range [][]byte{bytes.Repeat([]byte("k"), 300), []byte("with space")} {
+		require.Nil(t, c.Set(key, key, time.Minute))
+		value, err = c.Get(key)
+		require.Nil(t, err)
+		require.Equal(t, key, value)
+		require.True(t, isValidMemcachedKey(c.key(key)))
+		require.True(t, strings.HasPrefix(c.key(key), c.Prefix))
+	}
+
+	testCacherDelete(t, c)
+	testCacherGetOrSet(t, c)
+
+	require.Nil(t, c.SetContext(context.Background(), []byte("context"), []byte("value"), time.Minute))
+	value, err = c.GetContext(context.Background(), []byte("context"))
+	require.Nil(t, err)
+	require.Equal(t, "value", string(value))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.GetContext(ctx, []byte("context"))
+	require.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+func TestMemcachedExpiration(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	require.Equal(t, int32(0), memcachedExpiration(0, now))
+	require.Equal(t, int32(1), memcachedExpiration(time.Millisecond, now))
+	require.Equal(t, int32(300), memcachedExpiration(5*time.Minute, now))
+	require.Equal(t, int32(now.Unix()+60*24*3600), memcachedExpiration(60*24*time.Hour, now))
+}
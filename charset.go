@@ -0,0 +1,76 @@
+package gohttpclient
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// charsetSniffSize is the number of bytes of an HTML body sniffed for a meta tag of the charset.
+const charsetSniffSize = 1024
+
+// CharsetDecodingHandler implements an interceptor that decodes the text bodies of the responses to UTF-8,
+// such as an HTML page in ISO-8859-1 or an XML in Shift_JIS. The charset is the charset parameter of
+// the Content-Type, or the meta tag of an HTML body without it. The decoded body is read as it is streamed,
+// its Content-Type charset is rewritten to utf-8, and its Content-Length is cleared.
+// The binary bodies, the UTF-8 ones, the ones of an unknown charset and the ones of streaming requests
+// are returned untouched.
+func CharsetDecodingHandler() RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		resp, err := handlerFunc(req)
+		if err != nil || resp == nil || resp.Body == nil || resp.Body == http.NoBody || isStreamingRequest(req) {
+			return resp, err
+		}
+
+		contentType := resp.Header.Get("Content-Type")
+		mediaType, params, parseErr := mime.ParseMediaType(contentType)
+		if parseErr != nil || !isTextMediaType(mediaType) {
+			return resp, nil
+		}
+
+		var enc encoding.Encoding
+		var name string
+		if label, ok := params["charset"]; ok {
+			enc, name = charset.Lookup(label)
+		} else if mediaType == "text/html" {
+			r := bufio.NewReaderSize(resp.Body, charsetSniffSize)
+			resp.Body = readCloser{r, resp.Body}
+			preview, _ := r.Peek(charsetSniffSize)
+			enc, name = sniffHTMLCharset(preview, contentType)
+		}
+		if enc == nil || name == "utf-8" {
+			return resp, nil
+		}
+
+		resp.Body = readCloser{transform.NewReader(resp.Body, enc.NewDecoder()), resp.Body}
+		params["charset"] = "utf-8"
+		resp.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return resp, nil
+	}
+}
+
+// sniffHTMLCharset returns the charset of the meta tag or the byte order mark of an HTML body,
+// or nil when the charset is only the guess of windows-1252 without any of them.
+func sniffHTMLCharset(preview []byte, contentType string) (encoding.Encoding, string) {
+	enc, name, _ := charset.DetermineEncoding(preview, contentType)
+	if name == "windows-1252" && !bytes.Contains(bytes.ToLower(preview), []byte("charset")) {
+		return nil, ""
+	}
+	return enc, name
+}
+
+// isTextMediaType reports whether the bodies of the media type are text that has a charset.
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/javascript"
+}
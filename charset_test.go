@@ -0,0 +1,78 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestCharsetDecodingHandler(t *testing.T) {
+	latin1, err := charmap.ISO8859_1.NewEncoder().String("Café crème brûlée")
+	require.Nil(t, err)
+	shiftJIS, err := japanese.ShiftJIS.NewEncoder().String("こんにちは世界")
+	require.Nil(t, err)
+	sniffed, err := charmap.ISO8859_1.NewEncoder().String(`<html><head><meta charset="iso-8859-1"></head><body>Señor</body></html>`)
+	require.Nil(t, err)
+	png := "\x89PNG\r\n\x1a\n\xe9\xe8"
+
+	serve := func(contentType, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/latin1":    serve("text/plain; charset=ISO-8859-1", latin1),
+		"/shift-jis": serve("application/xml; charset=Shift_JIS", shiftJIS),
+		"/sniffed":   serve("text/html", sniffed),
+		"/utf-8":     serve("text/plain; charset=utf-8", "Café"),
+		"/unknown":   serve("text/plain; charset=x-unknown", latin1),
+		"/binary":    serve("image/png", png),
+	})
+	c := NewClient(WithCharsetDecoding())
+
+	tests := []struct {
+		path        string
+		body        string
+		contentType string
+		decoded     bool
+	}{
+		{"/latin1", "Café crème brûlée", "text/plain; charset=utf-8", true},
+		{"/shift-jis", "こんにちは世界", "application/xml; charset=utf-8", true},
+		{"/sniffed", `<html><head><meta charset="iso-8859-1"></head><body>Señor</body></html>`, "text/html; charset=utf-8", true},
+		{"/utf-8", "Café", "text/plain; charset=utf-8", false},
+		{"/unknown", latin1, "text/plain; charset=x-unknown", false},
+		{"/binary", png, "image/png", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := c.Get(ts.URL(tt.path))
+			require.Nil(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.Nil(t, err)
+			require.Equal(t, tt.body, string(body))
+			require.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+			if tt.decoded {
+				require.Equal(t, int64(-1), resp.ContentLength)
+				require.Empty(t, resp.Header.Get("Content-Length"))
+			} else {
+				require.Equal(t, int64(len(tt.body)), resp.ContentLength)
+			}
+		})
+	}
+
+	// The bodies of the streaming requests are untouched.
+	req, _ := http.NewRequestWithContext(MarkStreaming(context.Background()), http.MethodGet, ts.URL("/latin1"), nil)
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, latin1, string(body))
+}
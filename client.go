@@ -1,13 +1,15 @@
 package gohttpclient
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
-	"github.com/opentracing-contrib/go-stdlib/nethttp"
+	"github.com/sirupsen/logrus"
 )
 
 // Doer is the interface for initiating requests, it needs to implement the Do method,
@@ -21,32 +23,120 @@ type Doer interface {
 // This package can be used as a basic toolkit for a microservice framework with HTTP requests as a carrier,
 // or as a more secure library to limit the size of concurrent requests and downloaded data.
 type Client struct {
-	client          *http.Client
-	requestTimeout  time.Duration
-	maxBodySize     uint64
-	retryOption     RetryOption
-	loggerOption    LoggerOption
-	rateLimitOption RateLimitOption
-	hystrixOption   HystrixOption
-	traceOption     TraceOption
-	cacheOption     CacheOption
-	requestHandler  RequestHandler
+	client           *http.Client
+	requestTimeout   time.Duration
+	maxBodySize      uint64
+	defaultHeader    http.Header
+	headerSizeOption HeaderSizeOption
+	responseGuard    ResponseGuardOption
+	deadlineOption   DeadlinePropagationOption
+	expectContinue   ExpectContinueOption
+	bodyReadTimeout  BodyReadTimeoutOption
+	maxResponseTime  MaxResponseTimeOption
+	clientTimings    bool
+	connEvents       bool
+	loadBalancer     LoadBalancer
+	connEventsOption ConnectionEventCallbacks
+	connMetrics      *connMetrics
+	rtWrappers       []RoundTripperWrapper
+	wrapOrder        TransportWrapOrder
+	captureRequest   func(req *http.Request)
+	statePersistence *statePersistence
+	retryOption      RetryOption
+	loggerOption     LoggerOption
+	loggerSkipPaths  []string
+	rateLimitOption  RateLimitOption
+	adaptiveOption   AdaptiveOption
+	hystrixOption    HystrixOption
+	fallbackOption   FallbackOption
+	faultOption      FaultOption
+	traceOption      TraceOption
+	cacheOption      CacheOption
+	requestHandler   RequestHandler
+	streamingMode    bool
+	dryRun           bool
+	dryRunStatus     int
+	bodyTransform    ResponseBodyTransformFunc
+	contentTypes     []string
+	charsetDecoding  bool
+	resumableOption  ResumableBodyOption
+	recorderOption   RecorderOption
+	retryLog         bool
+	preconditionErrs bool
+	requestPolicy    RequestPolicyFunc
+	strictMode       bool
+	configErr        error
+	optionErrs       []*OptionError
+	proxyURL         *url.URL
+	queueOption      QueueOption
+	defaultContext   func(ctx context.Context) context.Context
+	defaultDeadline  time.Duration
+	ndjsonOption     NDJSONOption
+	options          []appliedOption
+	queue            *requestQueue
+	clock            Clock
+
+	proxyFromEnvironment bool
 }
 
 // NewClient creates a new HTTP request client.
-// If no setting options are passed in, then it behaves exactly the same as the official package.
+// If no setting options are passed in, then it behaves the same as the official package,
+// except that the responses whose headers exceed the generous limits of NewResponseGuardOption
+// fail with a ResponseHeadersTooLargeError, see WithMaxResponseHeaderBytes and WithMaxResponseHeaderCount.
 // You can use the WithXXX series of methods to configure options.
 // It provides advanced functions such as retry, rate limit, circuit breaker, cache, log, and trace.
 func NewClient(options ...Option) *Client {
 	c := &Client{
-		client:         &http.Client{},
-		requestHandler: noOpRequestHandler,
+		client:               &http.Client{},
+		requestHandler:       noOpRequestHandler,
+		responseGuard:        NewResponseGuardOption(),
+		proxyFromEnvironment: true,
 	}
-	for _, opt := range options {
+	for i, opt := range options {
+		if opt == nil {
+			c.addOptionError(fmt.Sprintf("options[%d]", i), ErrNilOption)
+			continue
+		}
+		n := len(c.options)
 		opt(c)
+		if len(c.options) == n {
+			c.options = append(c.options, appliedOption{name: "OptionFunc", repeatable: true})
+		}
+	}
+
+	for _, err := range c.optionErrs {
+		logrus.WithError(err.Err).WithField("option", err.Option).Warn("gohttpclient option is not applied")
+	}
+
+	if c.clock != nil {
+		c.applyClock()
+	}
+
+	if c.retryLog && c.retryOption.OnRetry == nil {
+		logger := c.loggerOption.Logger
+		if logger == nil {
+			logger = defaultLogger
+		}
+		c.retryOption.OnRetry = RetryLogFunc(logger)
 	}
 
+	c.checkConfig()
+
 	bodySizeOption := NewBodySizeOption(c.maxBodySize)
+	if c.headerSizeOption.MaxHeaderBytes > 0 {
+		c.loggerOption.MaxHeaderBytes = c.headerSizeOption.MaxHeaderBytes
+	}
+	if len(c.loggerSkipPaths) > 0 {
+		skipPaths, skipFunc := LoggerSkipPaths(c.loggerSkipPaths...), c.loggerOption.SkipFunc
+		c.loggerOption.SkipFunc = skipPaths
+		if skipFunc != nil {
+			c.loggerOption.SkipFunc = func(req *http.Request) bool {
+				return skipPaths(req) || skipFunc(req)
+			}
+		}
+	}
+
+	c.responseGuard.TransportMaxResponseHeaderBytes = transportMaxResponseHeaderBytes(c.client.Transport)
 
 	var requestHandlers []RequestHandler
 
@@ -54,13 +144,35 @@ func NewClient(options ...Option) *Client {
 		Enable  bool
 		Handler RequestHandler
 	}{
+		{c.requestPolicy != nil, RequestPolicyHandler(c.requestPolicy, c.loggerOption)},
+		{c.traceOption.isEnabled() && c.traceOption.DetailedSpans, TraceDetailHandler(c.traceOption)},
+		{c.clientTimings, ClientTimingsHandler()},
+		{c.connEvents, ConnectionEventsHandler(c.connEventsOption)},
+		{len(c.defaultHeader) > 0, DefaultHeaderHandler(c.defaultHeader)},
+		{c.preconditionErrs, PreconditionHandler()},
+		{c.expectContinue.isEnabled(), ExpectContinueHandler(c.expectContinue)},
 		{c.loggerOption.isEnabled(), LoggerHandler(c.loggerOption)},
+		{c.recorderOption.isEnabled(), RecorderHandler(c.recorderOption)},
+		{c.headerSizeOption.isEnabled(), HeaderSizeHandler(c.headerSizeOption)},
+		{c.fallbackOption.isEnabled(), FallbackHandler(c.fallbackOption)},
 		{c.retryOption.isEnabled(), RetryHandler(c.retryOption)},
 		{c.rateLimitOption.isEnabled(), RateLimitHandler(c.rateLimitOption)},
-		{c.hystrixOption.isEnabled(), HystrixHandler(c.hystrixOption)},
+		{c.adaptiveOption.isEnabled(), AdaptiveHandler(c.adaptiveOption)},
 		{c.traceOption.isEnabled(), TraceHandler(c.traceOption)},
 		{c.cacheOption.isEnabled(), CacheHandler(c.cacheOption)},
+		{c.hystrixOption.isEnabled(), HystrixHandler(c.hystrixOption)},
+		{c.responseGuard.isEnabled(), ResponseGuardHandler(c.responseGuard)},
+		{len(c.contentTypes) > 0, ContentTypeHandler(c.contentTypes...)},
+		{c.charsetDecoding, CharsetDecodingHandler()},
+		{c.bodyTransform != nil, ResponseBodyTransformHandler(c.bodyTransform)},
 		{bodySizeOption.isEnabled(), BodySizeHandler(bodySizeOption)},
+		{c.resumableOption.isEnabled(), ResumableBodyHandler(c.resumableOption)},
+		{c.bodyReadTimeout.isEnabled(), BodyReadTimeoutHandler(c.bodyReadTimeout)},
+		{c.maxResponseTime.isEnabled(), MaxResponseTimeHandler(c.maxResponseTime)},
+		{c.deadlineOption.isEnabled(), DeadlinePropagationHandler(c.deadlineOption)},
+		{c.faultOption.isEnabled(), FaultInjectionHandler(c.faultOption)},
+		{c.clientTimings, clientTimingsAttemptHandler},
+		{c.loggerOption.isEnabled(), upstreamTimingHandler},
 	}
 	for _, g := range getRequestHandlers {
 		if g.Enable {
@@ -71,23 +183,128 @@ func NewClient(options ...Option) *Client {
 	if len(requestHandlers) > 0 {
 		c.requestHandler = ChainRequestHandlers(requestHandlers...)
 	}
-	if c.traceOption.isEnabled() {
-		c.client.Transport = &nethttp.Transport{RoundTripper: c.client.Transport}
+	if !c.proxyFromEnvironment {
+		c.client.Transport = withoutProxy(c.client.Transport)
+	}
+	if c.proxyURL != nil {
+		c.client.Transport = withProxy(c.client.Transport, c.proxyURL)
+	}
+	if c.expectContinue.isEnabled() {
+		c.client.Transport = withExpectContinueTimeout(c.client.Transport, c.expectContinue.Timeout)
+	}
+	if c.connMetrics != nil {
+		c.client.Transport = newConnMetricsTransport(c.client.Transport, c.connMetrics)
+	}
+	if c.captureRequest != nil {
+		c.client.Transport = withCapturedRequest(c.client.Transport, c.captureRequest)
+	}
+	if c.traceOption.isEnabled() || len(c.rtWrappers) > 0 {
+		c.client.Transport = wrapTransport(c.client.Transport, c.rtWrappers, c.traceOption.isEnabled(), c.wrapOrder)
 	}
 	if c.requestTimeout > 0 {
 		c.client.Timeout = c.requestTimeout
 	}
+	if c.queueOption.isEnabled() {
+		c.queue = newRequestQueue(c.queueOption, c.do)
+	}
 
 	return c
 }
 
+// ConfigSummary returns the options applied to the client, one per line in the order they are applied,
+// such as WithMaxRetry(3), which is useful for a bug report.
+// Only the arguments of the basic types are shown, the others are replaced by their types,
+// and the values of the sensitive default headers, such as Authorization, are redacted.
+func (c *Client) ConfigSummary() string {
+	lines := make([]string, 0, len(c.options))
+	for _, opt := range c.options {
+		lines = append(lines, opt.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// applyClock sets the clock of the client to the options that depend on time.
+func (c *Client) applyClock() {
+	c.retryOption.Clock = c.clock
+	c.loggerOption.Clock = c.clock
+	c.cacheOption.Clock = c.clock
+	c.adaptiveOption.Clock = c.clock
+	c.recorderOption.Clock = c.clock
+	c.deadlineOption.Clock = c.clock
+	c.faultOption.Clock = c.clock
+	c.maxResponseTime.Clock = c.clock
+	c.hystrixOption.Clock = c.clock
+	c.rateLimitOption.Clock = c.clock
+	if fc, ok := c.cacheOption.Cacher.(FileCache); ok {
+		fc.TimeNowFunc = c.clock.Now
+		c.cacheOption.Cacher = fc
+	}
+}
+
 // Do performs HTTP real requests.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	return c.do(req)
 }
 
 func (c *Client) do(req *http.Request) (*http.Response, error) {
-	return requestForDoer(c.client, c.requestHandler, req)
+	if c.configErr != nil {
+		resp, err := rejectMisconfigured(req, c.configErr)
+		return resp, wrapURLError(req, err)
+	}
+	if c.streamingMode && req != nil {
+		req = req.WithContext(MarkStreaming(req.Context()))
+	}
+	if c.dryRun && req != nil {
+		req = req.WithContext(MarkDryRun(req.Context()))
+	}
+	req, cancel := c.withDefaultContext(req)
+	resp, err := requestForDoer(dryRunDoer{doer: c.client, statusCode: c.dryRunStatus}, c.requestHandler, req)
+	if cancel != nil {
+		resp = cancelOnClose(resp, err, cancel)
+	}
+	return resp, wrapURLError(req, err)
+}
+
+// DoBytes performs the request, reads and closes the response body, and returns the body and the status code.
+// The body is limited by WithMaxBodySize even when the server does not send a Content-Length.
+func (c *Client) DoBytes(req *http.Request) ([]byte, int, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readLimitedBody(resp.Body, c.maxBodySize)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return body, resp.StatusCode, nil
+}
+
+// GetBytes initiates an HTTP GET request and returns the response body.
+func (c *Client) GetBytes(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := c.DoBytes(req)
+	return body, err
+}
+
+// readLimitedBody reads the whole body, and returns ErrResponseBodyTooLarge if it exceeds maxBodySize bytes,
+// 0 means no limit.
+func readLimitedBody(r io.Reader, maxBodySize uint64) ([]byte, error) {
+	if maxBodySize == 0 {
+		return io.ReadAll(r)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, int64(maxBodySize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(body)) > maxBodySize {
+		return nil, ErrResponseBodyTooLarge
+	}
+	return body, nil
 }
 
 // Get initiates an HTTP GET request.
@@ -122,3 +339,33 @@ func (c *Client) Head(url string) (resp *http.Response, err error) {
 	}
 	return c.Do(req)
 }
+
+// withoutProxy returns a copy of the transport that does not use a proxy.
+// Transports other than *http.Transport are returned unchanged.
+func withoutProxy(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	t = t.Clone()
+	t.Proxy = nil
+	return t
+}
+
+// withProxy returns a copy of the transport that uses the proxy of the URL.
+// Transports other than *http.Transport are returned unchanged.
+func withProxy(rt http.RoundTripper, proxyURL *url.URL) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	t = t.Clone()
+	t.Proxy = http.ProxyURL(proxyURL)
+	return t
+}
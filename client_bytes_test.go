@@ -0,0 +1,59 @@
+package gohttpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GetBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprint(w, "hello world")
+	}))
+	defer srv.Close()
+
+	body, err := NewClient().GetBytes(srv.URL)
+	require.Nil(t, err)
+	require.Equal(t, "hello world", string(body))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/missing", nil)
+	body, statusCode, err := NewClient().DoBytes(req)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotFound, statusCode)
+	require.Equal(t, "hello world", string(body))
+
+	_, err = NewClient(WithMaxBodySize(5)).GetBytes(srv.URL)
+	require.True(t, errors.Is(err, ErrResponseBodyTooLarge))
+
+	_, err = NewClient().GetBytes("😭://")
+	require.NotNil(t, err)
+}
+
+func TestClient_DoBytes_ContextCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	startTime := time.Now()
+	_, statusCode, err := NewClient().DoBytes(req)
+	require.NotNil(t, err)
+	require.Equal(t, http.StatusOK, statusCode)
+	require.True(t, time.Since(startTime) < 500*time.Millisecond)
+}
@@ -16,38 +16,21 @@ import (
 
 type ClientTestSuite struct {
 	suite.Suite
-	done chan bool
-	addr string
-	url  string
+	server *TestServer
+	url    string
 }
 
 func (suite *ClientTestSuite) SetupSuite() {
-	suite.done = make(chan bool)
-	suite.addr = ":19998"
 	path := "/client"
-	suite.url = fmt.Sprintf("http://localhost%s%s", suite.addr, path)
-
-	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			panic(err)
-		}
-		fmt.Fprint(w, r.Form.Encode())
-	}
-
-	go func() {
-		mux := http.NewServeMux()
-		mux.HandleFunc(path, handlerFunc)
-		srv := &http.Server{Addr: suite.addr, Handler: mux}
-		go func() {
-			<-suite.done
-			srv.Close()
-		}()
-		srv.ListenAndServe()
-	}()
-}
-
-func (suite *ClientTestSuite) TearDownSuite() {
-	close(suite.done)
+	suite.server = NewTestServer(suite.T(), map[string]http.HandlerFunc{
+		path: func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				panic(err)
+			}
+			fmt.Fprint(w, r.Form.Encode())
+		},
+	})
+	suite.url = suite.server.URL(path)
 }
 
 func (suite *ClientTestSuite) TestNewClient() {
@@ -0,0 +1,71 @@
+package gohttpclient
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time used by the interceptors,
+// it can be replaced to make the time related behavior deterministic in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by Clock, it behaves like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// RealClock is the Clock implemented by the time package, and it is used by default.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{t: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
+
+// timerResetter is implemented by the timers of RealClock and FakeClock, which can be reset like time.Timer.
+type timerResetter interface {
+	Reset(d time.Duration) bool
+}
+
+func getClock(c Clock) Clock {
+	if c == nil {
+		return RealClock
+	}
+	return c
+}
+
+func sleepContext(ctx context.Context, clock Clock, wait time.Duration) error {
+	timer := getClock(clock).NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
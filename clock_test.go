@@ -0,0 +1,59 @@
+package gohttpclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeClock(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	clock := NewFakeClock(now)
+	require.Equal(t, now, clock.Now())
+
+	timer := clock.NewTimer(10 * time.Millisecond)
+	clock.Advance(5 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	clock.Advance(5 * time.Millisecond)
+	require.Equal(t, now.Add(10*time.Millisecond), <-timer.C())
+	require.False(t, timer.Stop())
+
+	timer = clock.NewTimer(time.Second)
+	require.True(t, timer.Stop())
+	clock.BlockUntil(0)
+}
+
+func TestSleepContext(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	done := make(chan error, 1)
+	go func() {
+		done <- sleepContext(context.Background(), clock, time.Minute)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	require.Nil(t, <-done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, sleepContext(ctx, nil, time.Minute))
+}
+
+func TestWithClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	c := NewClient(
+		WithClock(clock),
+		WithLoggerOption(NewLoggerOption()),
+		WithCacheOption(NewCacheOption(NewFileCache(t.TempDir()))),
+	)
+	require.Equal(t, clock, c.clock)
+	require.Equal(t, clock, c.retryOption.Clock)
+	require.Equal(t, clock, c.loggerOption.Clock)
+	require.Equal(t, clock.Now(), c.cacheOption.Cacher.(FileCache).TimeNowFunc())
+}
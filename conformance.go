@@ -0,0 +1,61 @@
+package gohttpclient
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// wrapURLError makes the error of Client.Do look like the one of http.Client.Do, so that the callers
+// migrated from net/http keep working. The errors of the interceptors, such as a CircuitOpenError, are wrapped
+// in a *url.Error like the ones of the transport, whose Timeout reports the timeouts of the interceptors too,
+// and errors.Is and errors.As still find the original errors through it. The errors that already have
+// a *url.Error in their chain are returned as they are, such as the errors of the transport,
+// which tell the URL that failed, such as the one of a redirect.
+func wrapURLError(req *http.Request, err error) error {
+	if err == nil || req == nil || req.URL == nil {
+		return err
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return err
+	}
+	var netErr net.Error
+	if ClassifyError(nil, err) == ErrorCategoryTimeout && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		err = &timeoutError{err: err}
+	}
+	return &url.Error{Op: urlErrorOp(req.Method), URL: req.URL.Redacted(), Err: err}
+}
+
+// urlErrorOp returns the Op of a *url.Error of the method, such as "Get", the same as net/http.
+func urlErrorOp(method string) string {
+	if method == "" {
+		return "Get"
+	}
+	return method[:1] + strings.ToLower(method[1:])
+}
+
+// timeoutError marks a timeout of an interceptor, such as ErrResponseTimeout, as a timeout of net.Error,
+// so that the Timeout of the *url.Error wrapping it reports true.
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return e.err.Error()
+}
+
+func (e *timeoutError) Timeout() bool {
+	return true
+}
+
+func (e *timeoutError) Temporary() bool {
+	return true
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,97 @@
+package gohttpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// ConnectionEventCallbacks are the callbacks of the connection level events of the requests,
+// such as for recording the IP each request hit and the negotiated TLS version. All of them are optional,
+// and they may be called concurrently by the transport.
+type ConnectionEventCallbacks struct {
+	// OnDNSDone is called when the host is resolved, with the addresses or the error.
+	OnDNSDone func(host string, addrs []net.IPAddr, err error)
+	// OnConnectDone is called when a new connection is dialed, with the address dialed or the error.
+	OnConnectDone func(network, addr string, err error)
+	// OnTLSDone is called when the TLS handshake of a new connection completes, with the state or the error.
+	OnTLSDone func(state tls.ConnectionState, err error)
+}
+
+// remoteAddrRecorder records the remote address of the connection of the last attempt.
+type remoteAddrRecorder struct {
+	mu   sync.Mutex
+	addr string
+}
+
+func (r *remoteAddrRecorder) set(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addr = addr
+}
+
+func (r *remoteAddrRecorder) get() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addr
+}
+
+// RemoteAddrFromContext returns the remote address of the connection the request was sent on,
+// recorded by ConnectionEventsHandler, for example RemoteAddrFromContext(resp.Request.Context()).
+func RemoteAddrFromContext(ctx context.Context) (string, bool) {
+	r, ok := ctx.Value(remoteAddrContextKey).(*remoteAddrRecorder)
+	if !ok {
+		return "", false
+	}
+	addr := r.get()
+	return addr, addr != ""
+}
+
+// ConnectionEventsHandler creates an interceptor that calls the callbacks on the connection level events
+// of the requests, and records the remote address of the connection, including a reused one,
+// in LoggerEntry.RemoteAddr and for RemoteAddrFromContext.
+// The hooks are added by httptrace, so they compose with any ClientTrace already on the context of the request.
+func ConnectionEventsHandler(callbacks ConnectionEventCallbacks) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil {
+			return handlerFunc(req)
+		}
+
+		remoteAddr := &remoteAddrRecorder{}
+		var mu sync.Mutex
+		var dnsHost string
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				if info.Conn != nil && info.Conn.RemoteAddr() != nil {
+					remoteAddr.set(info.Conn.RemoteAddr().String())
+				}
+			},
+		}
+		if callbacks.OnDNSDone != nil {
+			trace.DNSStart = func(info httptrace.DNSStartInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				dnsHost = info.Host
+			}
+			trace.DNSDone = func(info httptrace.DNSDoneInfo) {
+				mu.Lock()
+				host := dnsHost
+				mu.Unlock()
+				callbacks.OnDNSDone(host, info.Addrs, info.Err)
+			}
+		}
+		if callbacks.OnConnectDone != nil {
+			trace.ConnectDone = callbacks.OnConnectDone
+		}
+		if callbacks.OnTLSDone != nil {
+			trace.TLSHandshakeDone = callbacks.OnTLSDone
+		}
+
+		ctx := context.WithValue(req.Context(), remoteAddrContextKey, remoteAddr)
+		req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+		return handlerFunc(req)
+	}
+}
@@ -0,0 +1,101 @@
+package gohttpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithConnectionEvents(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var dnsHosts, connectAddrs []string
+	var entries []LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entries = append(entries, e)
+	}
+	c := NewClient(
+		WithLoggerOption(loggerOption),
+		WithConnectionEvents(ConnectionEventCallbacks{
+			OnDNSDone: func(host string, addrs []net.IPAddr, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				require.Nil(t, err)
+				require.NotEmpty(t, addrs)
+				dnsHosts = append(dnsHosts, host)
+			},
+			OnConnectDone: func(network, addr string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					connectAddrs = append(connectAddrs, addr)
+				}
+			},
+		}),
+	)
+
+	// The trace already on the context is still called.
+	gotConn := false
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { gotConn = true },
+	})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, strings.Replace(ts.URL, "127.0.0.1", "localhost", 1), nil)
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.True(t, gotConn)
+
+	mu.Lock()
+	require.Equal(t, []string{"localhost"}, dnsHosts)
+	require.Equal(t, []string{ts.Listener.Addr().String()}, connectAddrs)
+	mu.Unlock()
+
+	addr, ok := RemoteAddrFromContext(resp.Request.Context())
+	require.True(t, ok)
+	require.Equal(t, ts.Listener.Addr().String(), addr)
+	require.Len(t, entries, 1)
+	require.Equal(t, ts.Listener.Addr().String(), entries[0].RemoteAddr)
+
+	// The remote address of a reused connection is recorded too.
+	resp, err = c.Get(ts.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Len(t, entries, 2)
+	require.Equal(t, ts.Listener.Addr().String(), entries[1].RemoteAddr)
+}
+
+func TestWithConnectionEvents_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var version uint16
+	c := NewClient(
+		WithHTTPClient(ts.Client()),
+		WithConnectionEvents(ConnectionEventCallbacks{
+			OnTLSDone: func(state tls.ConnectionState, err error) {
+				require.Nil(t, err)
+				version = state.Version
+			},
+		}),
+	)
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.NotZero(t, version)
+	require.Equal(t, resp.TLS.Version, version)
+}
@@ -0,0 +1,125 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// contentSniffLen is the number of bytes read to detect the content type, the same as http.DetectContentType.
+const contentSniffLen = 512
+
+// ErrUnexpectedContentType is the error that matches, by errors.Is,
+// the errors returned when the content type of a response is not the expected one.
+var ErrUnexpectedContentType = errors.New("The response content type is unexpected")
+
+// UnexpectedContentTypeError is returned when the content type of a response is not the expected one,
+// such as an HTML error page returned with status 200 by an intermediary.
+// ShouldRetryFunc implementations can retry it by errors.Is(err, ErrUnexpectedContentType).
+type UnexpectedContentTypeError struct {
+	Expected []string
+	// ContentType is the media type of the Content-Type header, or the detected one when the header is absent.
+	ContentType string
+	// Sniffed reports whether ContentType was detected from the body.
+	Sniffed    bool
+	StatusCode int
+	// Snippet is the beginning of the response body.
+	Snippet string
+}
+
+func (e *UnexpectedContentTypeError) Error() string {
+	return fmt.Sprintf("The response content type is unexpected: got '%s' with status %d, expected %s, body %q",
+		e.ContentType, e.StatusCode, strings.Join(e.Expected, ", "), e.Snippet)
+}
+
+// Is reports whether the target is ErrUnexpectedContentType.
+func (e *UnexpectedContentTypeError) Is(target error) bool {
+	return target == ErrUnexpectedContentType
+}
+
+// ContentTypeHandler creates an interceptor that checks the content type of the successful responses,
+// the expected types are media types such as "application/json", or wildcards such as "text/*".
+// When the response has no Content-Type header, it is detected from the first 512 bytes of the body,
+// which are put back in front of the body. A response of another type is closed,
+// and an UnexpectedContentTypeError is returned.
+// The responses without a body, such as 204 and the responses to HEAD, and the streaming requests are not checked.
+func ContentTypeHandler(expected ...string) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		resp, err := handlerFunc(req)
+		if err != nil || resp == nil || resp.Body == nil || isStreamingRequest(req) {
+			return resp, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.StatusCode == http.StatusNoContent ||
+			(req != nil && req.Method == http.MethodHead) {
+			return resp, nil
+		}
+
+		contentType, sniffed := resp.Header.Get("Content-Type"), false
+		var prefix []byte
+		if contentType == "" {
+			prefix, err = io.ReadAll(io.LimitReader(resp.Body, contentSniffLen))
+			if err != nil {
+				closeResponse(resp)
+				return nil, errors.Wrap(err, "Read the response body")
+			}
+			resp.Body = readCloser{
+				Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+				Closer: resp.Body,
+			}
+			contentType, sniffed = sniffContentType(prefix), true
+		}
+
+		mediaType := parseMediaType(contentType)
+		if matchContentType(mediaType, expected) {
+			return resp, nil
+		}
+
+		if prefix == nil {
+			prefix, _ = io.ReadAll(io.LimitReader(resp.Body, contentSniffLen))
+		}
+		closeResponse(resp)
+		return nil, &UnexpectedContentTypeError{
+			Expected:    expected,
+			ContentType: mediaType,
+			Sniffed:     sniffed,
+			StatusCode:  resp.StatusCode,
+			Snippet:     string(prefix),
+		}
+	}
+}
+
+// sniffContentType detects the content type of the beginning of a body by http.DetectContentType,
+// which does not recognize JSON, so a body that starts with '{' or '[' is detected as application/json.
+func sniffContentType(prefix []byte) string {
+	trimmed := bytes.TrimLeft(prefix, " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return "application/json"
+	}
+	return http.DetectContentType(prefix)
+}
+
+func parseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	}
+	return strings.ToLower(mediaType)
+}
+
+func matchContentType(mediaType string, expected []string) bool {
+	for _, e := range expected {
+		e = strings.ToLower(e)
+		if e == mediaType || e == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(e, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(e, "*")) {
+			return true
+		}
+	}
+	return false
+}
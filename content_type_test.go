@@ -0,0 +1,159 @@
+package gohttpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentTypeHandler(t *testing.T) {
+	handler := ContentTypeHandler("application/json")
+	respond := func(contentType, body string) RequestHandlerFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			if contentType != "" {
+				header.Set("Content-Type", contentType)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	// An HTML error page with a JSON expectation.
+	resp, err := handler(req, respond("text/html; charset=utf-8", "<html>Bad gateway</html>"))
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrUnexpectedContentType))
+	var e *UnexpectedContentTypeError
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, "text/html", e.ContentType)
+	require.False(t, e.Sniffed)
+	require.Equal(t, http.StatusOK, e.StatusCode)
+	require.Equal(t, "<html>Bad gateway</html>", e.Snippet)
+
+	// A sniffed HTML body.
+	_, err = handler(req, respond("", "<!DOCTYPE html><html>Bad gateway</html>"))
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, "text/html", e.ContentType)
+	require.True(t, e.Sniffed)
+
+	// A correct JSON response.
+	resp, err = handler(req, respond("application/json; charset=utf-8", `{"ok":true}`))
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, `{"ok":true}`, string(body))
+
+	// A missing Content-Type that sniffs correctly, the body is restored.
+	long := `  [` + strings.Repeat(`1,`, 1000) + `1]`
+	resp, err = handler(req, respond("", long))
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, long, string(body))
+
+	// The error responses and the streaming requests are not checked.
+	resp, err = handler(req, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{"Content-Type": {"text/html"}}, Body: http.NoBody}, nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	streamingReq := req.WithContext(MarkStreaming(req.Context()))
+	_, err = handler(streamingReq, respond("text/html", "<html></html>"))
+	require.Nil(t, err)
+
+	// The wildcards.
+	_, err = ContentTypeHandler("text/*")(req, respond("text/plain", "hello"))
+	require.Nil(t, err)
+	_, err = ContentTypeHandler("text/*")(req, respond("", "\x89PNG\x0d\x0a\x1a\x0a"))
+	require.True(t, errors.Is(err, ErrUnexpectedContentType))
+
+	// A body that fails to be sniffed is closed.
+	failing := &testTrackingBody{Reader: &testFailingBody{r: strings.NewReader("{"), fail: true}}
+	resp, err = handler(req, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: failing}, nil
+	})
+	require.Nil(t, resp)
+	require.Error(t, err)
+	require.True(t, failing.closed)
+}
+
+func TestWithContentTypeEnforcement_Retry(t *testing.T) {
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n == 1 {
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>Bad gateway</html>"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient(
+		WithContentTypeEnforcement("application/json"),
+		WithMaxRetry(1),
+		WithRetryBackOff(backoff.NewConstantBackOff(0)),
+		WithShouldRetryFunc(func(req *http.Request, resp *http.Response, err error) bool {
+			return errors.Is(err, ErrUnexpectedContentType)
+		}),
+	)
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, `{"ok":true}`, string(body))
+	require.Equal(t, 2, n)
+}
+
+func TestWithAllowedContentTypes(t *testing.T) {
+	pdf := "%PDF-1.4\n"
+	s := NewTestServer(t, map[string]http.HandlerFunc{
+		"/pdf": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte(pdf))
+		},
+		"/png": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+		},
+		"/error-page": func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["Content-Type"] = nil
+			_, _ = w.Write([]byte("<html><body>Please sign in</body></html>"))
+		},
+	})
+	c := NewClient(WithAllowedContentTypes("image/*", "application/pdf"))
+
+	body, err := c.GetBytes(s.URL("/pdf"))
+	require.Nil(t, err)
+	require.Equal(t, pdf, string(body))
+	_, err = c.GetBytes(s.URL("/png"))
+	require.Nil(t, err)
+
+	_, err = c.GetBytes(s.URL("/error-page"))
+	require.True(t, errors.Is(err, ErrUnexpectedContentType))
+	var contentTypeErr *UnexpectedContentTypeError
+	require.ErrorAs(t, err, &contentTypeErr)
+	require.True(t, contentTypeErr.Sniffed)
+	require.Equal(t, "text/html", contentTypeErr.ContentType)
+
+	// It is the same option as WithContentTypeEnforcement, so the one applied last takes effect with a warning.
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	c = NewClient(WithContentTypeEnforcement("text/html"), WithAllowedContentTypes("application/pdf"))
+	require.Equal(t, "WithContentTypeEnforcement([\"text/html\"])\nWithContentTypeEnforcement([\"application/pdf\"])", c.ConfigSummary())
+	entries := hook.AllEntries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "WithContentTypeEnforcement", entries[0].Data["option"])
+	_, err = c.GetBytes(s.URL("/error-page"))
+	require.True(t, errors.Is(err, ErrUnexpectedContentType))
+	_, err = c.GetBytes(s.URL("/pdf"))
+	require.Nil(t, err)
+}
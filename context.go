@@ -0,0 +1,21 @@
+package gohttpclient
+
+type contextKey int
+
+const (
+	streamingContextKey contextKey = iota
+	maxCacheAgeContextKey
+	serverBudgetContextKey
+	clientTimingsContextKey
+	upstreamContextKey
+	explainContextKey
+	cachePartitionContextKey
+	cacheTTLContextKey
+	cacheKeyContextKey
+	retryElsewhereContextKey
+	expectContinueContextKey
+	remoteAddrContextKey
+	responseSourceContextKey
+	dryRunContextKey
+	noCircuitBreakerContextKey
+)
@@ -0,0 +1,67 @@
+package gohttpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeadlinePropagationOption is an option configuration to propagate the remaining time budget of the request to the server.
+type DeadlinePropagationOption struct {
+	HeaderName string
+	Clock      Clock
+}
+
+// NewDeadlinePropagationOption creates an option configuration that sets the header named headerName,
+// such as X-Request-Timeout-Ms, to the remaining milliseconds before the deadline of the request context.
+func NewDeadlinePropagationOption(headerName string) DeadlinePropagationOption {
+	return DeadlinePropagationOption{HeaderName: headerName}
+}
+
+func (o DeadlinePropagationOption) isEnabled() bool {
+	return o.HeaderName != ""
+}
+
+// DeadlinePropagationHandler creates an interceptor that propagates the deadline of the request context to the server.
+// It computes the budget when the request is dispatched, so each retry attempt reflects the shrinking budget,
+// and it does nothing when the context has no deadline.
+// If the server echoes its own remaining budget in the same header,
+// it can be read by ServerBudgetFromContext(resp.Request.Context()).
+func DeadlinePropagationHandler(option DeadlinePropagationOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if deadline, ok := getRequestContext(req).Deadline(); ok {
+			remaining := deadline.Sub(getClock(option.Clock).Now())
+			if remaining < 0 {
+				remaining = 0
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set(option.HeaderName, strconv.FormatInt(remaining.Milliseconds(), 10))
+			if e := explainRequest(req); e != nil {
+				e.add("deadline", "propagate", 0, "%s=%d", option.HeaderName, remaining.Milliseconds())
+			}
+		}
+
+		resp, err := handlerFunc(req)
+		if resp == nil {
+			return resp, err
+		}
+		ms, parseErr := strconv.ParseInt(resp.Header.Get(option.HeaderName), 10, 64)
+		if parseErr == nil && req != nil {
+			// The request of the response is the last one of the redirects, which is kept like net/http does.
+			finalReq := resp.Request
+			if finalReq == nil {
+				finalReq = req
+			}
+			ctx := context.WithValue(finalReq.Context(), serverBudgetContextKey, time.Duration(ms)*time.Millisecond)
+			resp.Request = finalReq.WithContext(ctx)
+		}
+		return resp, err
+	}
+}
+
+// ServerBudgetFromContext returns the remaining budget echoed by the server, see DeadlinePropagationHandler.
+func ServerBudgetFromContext(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(serverBudgetContextKey).(time.Duration)
+	return d, ok
+}
@@ -0,0 +1,68 @@
+package gohttpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadlinePropagation(t *testing.T) {
+	var budgets []int64
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ms, err := strconv.ParseInt(req.Header.Get("X-Request-Timeout-Ms"), 10, 64)
+		require.Nil(t, err)
+		budgets = append(budgets, ms)
+		statusCode := http.StatusServiceUnavailable
+		if len(budgets) > 1 {
+			statusCode = http.StatusOK
+		}
+		return &http.Response{
+			StatusCode: statusCode,
+			Header:     http.Header{"X-Request-Timeout-Ms": []string{"42"}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithMaxRetry(1),
+		WithRetryBackOff(backoff.NewConstantBackOff(20*time.Millisecond)),
+		WithDeadlinePropagation("X-Request-Timeout-Ms"),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com", nil)
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, budgets, 2)
+	require.True(t, budgets[0] <= 500)
+	require.True(t, budgets[1] < budgets[0])
+	require.Empty(t, req.Header.Get("X-Request-Timeout-Ms"))
+
+	budget, ok := ServerBudgetFromContext(resp.Request.Context())
+	require.True(t, ok)
+	require.Equal(t, 42*time.Millisecond, budget)
+}
+
+func TestDeadlinePropagationHandler_NoDeadline(t *testing.T) {
+	handler := DeadlinePropagationHandler(NewDeadlinePropagationOption("X-Request-Timeout-Ms"))
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		require.Empty(t, req.Header.Get("X-Request-Timeout-Ms"))
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, nil
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	_, ok := ServerBudgetFromContext(req.Context())
+	require.False(t, ok)
+}
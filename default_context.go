@@ -0,0 +1,59 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// withDefaultContext applies the default context of WithDefaultContext to a request made with context.Background(),
+// and the default deadline of WithDefaultDeadline to a request whose context has no deadline.
+// The returned cancel must be called when the request fails, or be bound to its response by cancelOnClose.
+func (c *Client) withDefaultContext(req *http.Request) (*http.Request, context.CancelFunc) {
+	if req == nil || (c.defaultContext == nil && c.defaultDeadline <= 0) {
+		return req, nil
+	}
+	ctx := req.Context()
+	if c.defaultContext != nil && ctx == context.Background() {
+		ctx = c.defaultContext(ctx)
+	}
+	var cancel context.CancelFunc
+	if _, ok := ctx.Deadline(); !ok && c.defaultDeadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.defaultDeadline)
+	}
+	if ctx != req.Context() {
+		req = req.WithContext(ctx)
+	}
+	return req, cancel
+}
+
+// cancelOnClose calls cancel when the body of the response is closed or read to the end,
+// so that the context of the default deadline lives as long as the body is being read.
+// It is called at once when there is no body to read.
+func cancelOnClose(resp *http.Response, err error, cancel context.CancelFunc) *http.Response {
+	if err != nil || resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		cancel()
+		return resp
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.cancel()
+	}
+	return n, err
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,88 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type testDefaultContextKey struct{}
+
+func TestWithDefaultContext(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	var values []interface{}
+	c := NewClient(
+		WithDefaultContext(func(ctx context.Context) context.Context {
+			return context.WithValue(ctx, testDefaultContextKey{}, "tenant")
+		}),
+		WithRoundTripperWrapper(func(rt http.RoundTripper) http.RoundTripper {
+			return testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				values = append(values, req.Context().Value(testDefaultContextKey{}))
+				return rt.RoundTrip(req)
+			})
+		}),
+	)
+
+	resp, err := c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	// The context set by the caller is used as it is.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL("/"), nil)
+	resp, err = c.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, []interface{}{"tenant", nil}, values)
+}
+
+func TestWithDefaultDeadline(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/slow-body": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("hello "))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			_, _ = w.Write([]byte("world"))
+		},
+		"/slow": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(300 * time.Millisecond):
+			}
+		},
+	})
+	c := NewClient(WithDefaultDeadline(time.Second))
+
+	// The deadline lasts until the body is read.
+	resp, err := c.Get(ts.URL("/slow-body"))
+	require.Nil(t, err)
+	deadline, ok := resp.Request.Context().Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(time.Second), deadline, 200*time.Millisecond)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "hello world", string(body))
+	require.Nil(t, resp.Body.Close())
+	require.Equal(t, context.Canceled, resp.Request.Context().Err())
+
+	// The request slower than the deadline is canceled.
+	c = NewClient(WithDefaultDeadline(50 * time.Millisecond))
+	_, err = c.Get(ts.URL("/slow"))
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// The deadline of the caller is not overridden.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL("/slow"), nil)
+	resp, err = c.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+}
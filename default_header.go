@@ -0,0 +1,30 @@
+package gohttpclient
+
+import (
+	"net/http"
+)
+
+// DefaultHeaderHandler creates an interceptor that adds the headers to the requests that do not have them,
+// the headers set by the caller take precedence. The request of the caller is not modified.
+func DefaultHeaderHandler(header http.Header) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil {
+			return handlerFunc(req)
+		}
+		cloned := false
+		for key, values := range header {
+			if _, ok := req.Header[key]; ok {
+				continue
+			}
+			if !cloned {
+				req = req.Clone(req.Context())
+				if req.Header == nil {
+					req.Header = make(http.Header)
+				}
+				cloned = true
+			}
+			req.Header[key] = append([]string(nil), values...)
+		}
+		return handlerFunc(req)
+	}
+}
@@ -0,0 +1,66 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultHeaderHandler(t *testing.T) {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	header.Add("X-Tag", "a")
+	header.Add("X-Tag", "b")
+	handler := DefaultHeaderHandler(header)
+
+	var got http.Header
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		got = req.Header
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	_, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, "application/json", got.Get("Accept"))
+	require.Equal(t, []string{"a", "b"}, got.Values("X-Tag"))
+	require.Empty(t, req.Header)
+
+	req.Header.Set("Accept", "text/html")
+	_, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, "text/html", got.Get("Accept"))
+	require.Equal(t, []string{"a", "b"}, got.Values("X-Tag"))
+
+	req = &http.Request{Method: http.MethodGet, URL: req.URL}
+	_, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, "application/json", got.Get("Accept"))
+}
+
+func TestWithAcceptJSON(t *testing.T) {
+	var accept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithAcceptJSON())
+	resp, err := c.Get(srv.URL)
+	require.Nil(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, "application/json", accept)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept", "text/plain")
+	resp, err = c.Do(req)
+	require.Nil(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, "text/plain", accept)
+
+	c = NewClient(WithDefaultAccept("application/xml"), WithDefaultHeader("X-Client", "gohttpclient"))
+	require.Equal(t, "application/xml", c.defaultHeader.Get("Accept"))
+	require.Equal(t, "gohttpclient", c.defaultHeader.Get("X-Client"))
+}
@@ -0,0 +1,63 @@
+package gohttpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// DryRunHeader is the header of the responses synthesized for the dry-run requests, see MarkDryRun.
+const DryRunHeader = "X-Gohttpclient-Dry-Run"
+
+// DefaultDryRunStatusCode is the status code of the responses synthesized for the dry-run requests by default,
+// which is a success that no server sends.
+const DefaultDryRunStatusCode = 299
+
+// MarkDryRun marks the requests initiated with this context as dry-run requests, which go through all the interceptors,
+// such as the policy, the logger and the signing, but are never sent. An empty response of the status code
+// of WithDryRunStatus, or DefaultDryRunStatusCode, with the DryRunHeader header is returned instead.
+// The cache does not store the responses, and the circuit breaker does not count the requests.
+func MarkDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunContextKey, true)
+}
+
+// IsDryRun reports whether the context has been marked as dry-run by MarkDryRun.
+func IsDryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(dryRunContextKey).(bool)
+	return v
+}
+
+func isDryRunRequest(req *http.Request) bool {
+	return IsDryRun(getRequestContext(req))
+}
+
+// dryRunDoer synthesizes the responses of the dry-run requests instead of sending them by the doer.
+type dryRunDoer struct {
+	doer       Doer
+	statusCode int
+}
+
+func (d dryRunDoer) Do(req *http.Request) (*http.Response, error) {
+	if !isDryRunRequest(req) {
+		return d.doer.Do(req)
+	}
+	closeRequestBody(req)
+	statusCode := d.statusCode
+	if statusCode == 0 {
+		statusCode = DefaultDryRunStatusCode
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d Dry Run", statusCode),
+		StatusCode: statusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			DryRunHeader:     []string{"true"},
+			"Content-Length": []string{"0"},
+		},
+		Body:          http.NoBody,
+		ContentLength: 0,
+		Request:       req,
+	}, nil
+}
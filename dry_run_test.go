@@ -0,0 +1,87 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDryRun(t *testing.T) {
+	var sent int32
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&sent, 1)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("ok")), Request: req}, nil
+	})
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	hystrixOption := NewIsolatedHystrixOption()
+
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithDryRun(),
+		WithDefaultHeader("X-Api-Key", "secret"),
+		WithLoggerOption(loggerOption),
+		WithCacheOption(NewMemoryCacheOption()),
+		WithHystrixOption(hystrixOption),
+	)
+	resp, err := c.Post("https://example.com/items", "application/json", strings.NewReader(`{"name":"item"}`))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, DefaultDryRunStatusCode, resp.StatusCode)
+	require.Equal(t, "true", resp.Header.Get(DryRunHeader))
+	require.Equal(t, int32(0), atomic.LoadInt32(&sent))
+
+	// The logger records what would have been sent.
+	require.Equal(t, "https://example.com/items", entry.URL)
+	require.Equal(t, "secret", entry.RequestHeader.Get("X-Api-Key"))
+	require.Equal(t, `{"name":"item"}`, string(entry.RequestBody))
+	require.Equal(t, DefaultDryRunStatusCode, entry.StatusCode)
+
+	// The cache does not store the responses, and the circuit breaker does not count the requests.
+	resp, err = c.Get("https://example.com/items")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Nil(t, hystrixOption.CircuitManager.GetCircuit("https://example.com"))
+	c.dryRun = false
+	resp, err = c.Get("https://example.com/items")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(&sent))
+}
+
+func TestMarkDryRun(t *testing.T) {
+	var sent int32
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&sent, 1)
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	})
+	c := NewClient(WithHTTPClient(&http.Client{Transport: transport}), WithDryRunStatus(http.StatusAccepted))
+
+	require.False(t, IsDryRun(context.Background()))
+	ctx := MarkDryRun(context.Background())
+	require.True(t, IsDryRun(ctx))
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodDelete, "https://example.com/items/1", nil)
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Equal(t, req.URL, resp.Request.URL)
+	require.Equal(t, int32(0), atomic.LoadInt32(&sent))
+
+	resp, err = c.Get("https://example.com/items/1")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, resp.Header.Get(DryRunHeader))
+	require.Equal(t, int32(1), atomic.LoadInt32(&sent))
+}
@@ -0,0 +1,74 @@
+package gohttpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorCategory is the category of the failure of a request, see ClassifyError.
+// It tells a request that failed without a response apart from one that got an error status,
+// as they have very different operational meanings.
+type ErrorCategory int
+
+const (
+	// ErrorCategoryNone is the category of the requests that succeeded.
+	ErrorCategoryNone ErrorCategory = iota
+	// ErrorCategoryNetwork is the category of the requests that failed without a response,
+	// such as a refused connection, a TLS error or a rejection of an interceptor such as the open circuit.
+	ErrorCategoryNetwork
+	// ErrorCategoryTimeout is the category of the requests that timed out, by the timeout of the client,
+	// the deadline of the context, the retry deadline or the max response time.
+	ErrorCategoryTimeout
+	// ErrorCategoryHTTPStatus is the category of the responses whose status code is 400 or above.
+	ErrorCategoryHTTPStatus
+	// ErrorCategoryCanceled is the category of the requests whose context is canceled by the caller.
+	ErrorCategoryCanceled
+)
+
+var errorCategoryNames = map[ErrorCategory]string{
+	ErrorCategoryNone:       "none",
+	ErrorCategoryNetwork:    "network",
+	ErrorCategoryTimeout:    "timeout",
+	ErrorCategoryHTTPStatus: "http_status",
+	ErrorCategoryCanceled:   "canceled",
+}
+
+// String returns the name of the category, which is suitable for a label of the metrics, such as "network".
+func (c ErrorCategory) String() string {
+	if name, ok := errorCategoryNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ClassifyError returns the category of the result of a request, an error takes precedence over the response.
+func ClassifyError(resp *http.Response, err error) ErrorCategory {
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, context.Canceled):
+			return ErrorCategoryCanceled
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+			errors.Is(err, ErrRetryDeadlineExceeded), errors.Is(err, ErrResponseTimeout):
+			return ErrorCategoryTimeout
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return ErrorCategoryTimeout
+		}
+		return ErrorCategoryNetwork
+	}
+	if resp != nil && resp.StatusCode >= 400 {
+		return ErrorCategoryHTTPStatus
+	}
+	return ErrorCategoryNone
+}
+
+// RetryOnGoError is a ShouldRetryFunc that only retries the requests that failed without a response,
+// the ErrorCategoryNetwork and the ErrorCategoryTimeout ones, and returns the error status responses as they are.
+func RetryOnGoError(req *http.Request, resp *http.Response, err error) bool {
+	category := ClassifyError(resp, err)
+	return category == ErrorCategoryNetwork || category == ErrorCategoryTimeout
+}
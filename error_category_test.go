@@ -0,0 +1,96 @@
+package gohttpclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyError(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "http://127.0.0.1:1", Err: errors.New("connect: connection refused")}
+	tests := []struct {
+		name     string
+		resp     *http.Response
+		err      error
+		expected ErrorCategory
+	}{
+		{"success", &http.Response{StatusCode: http.StatusOK}, nil, ErrorCategoryNone},
+		{"redirect", &http.Response{StatusCode: http.StatusNotModified}, nil, ErrorCategoryNone},
+		{"client error status", &http.Response{StatusCode: http.StatusNotFound}, nil, ErrorCategoryHTTPStatus},
+		{"server error status", &http.Response{StatusCode: http.StatusBadGateway}, nil, ErrorCategoryHTTPStatus},
+		{"refused", nil, refused, ErrorCategoryNetwork},
+		{"circuit open", nil, &CircuitOpenError{Err: errors.New("circuit open")}, ErrorCategoryNetwork},
+		{"canceled", nil, &url.Error{Op: "Get", URL: "http://127.0.0.1:1", Err: context.Canceled}, ErrorCategoryCanceled},
+		{"deadline", nil, errors.Wrap(context.DeadlineExceeded, "Get"), ErrorCategoryTimeout},
+		{"retry deadline", nil, &RetryDeadlineExceededError{StatusCode: http.StatusBadGateway}, ErrorCategoryTimeout},
+		{"error takes precedence", &http.Response{StatusCode: http.StatusOK}, refused, ErrorCategoryNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, ClassifyError(tt.resp, tt.err))
+		})
+	}
+
+	require.Equal(t, "http_status", ErrorCategoryHTTPStatus.String())
+	require.Equal(t, "unknown", ErrorCategory(100).String())
+}
+
+func TestClassifyError_ClientTimeout(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		},
+	})
+	_, err := NewClient(WithRequestTimeout(10 * time.Millisecond)).Get(ts.URL("/"))
+	require.Equal(t, ErrorCategoryTimeout, ClassifyError(nil, err))
+}
+
+func TestWithRetryOnGoError(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	})
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	attempts := 0
+	c := NewClient(
+		WithLoggerOption(loggerOption),
+		WithMaxRetry(2),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithRetryOnGoError(),
+		WithFaultInjection(FaultOption{
+			Enabled: true,
+			ErrorFunc: func(req *http.Request) error {
+				attempts++
+				if req.URL.Path == "/refused" {
+					return errors.New("connect: connection refused")
+				}
+				return nil
+			},
+		}),
+	)
+
+	// The error status is not retried.
+	resp, err := c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 1, attempts)
+	require.Equal(t, ErrorCategoryHTTPStatus, entry.ErrorCategory)
+
+	// The failed transport is.
+	attempts = 0
+	_, err = c.Get(ts.URL("/refused"))
+	require.NotNil(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, ErrorCategoryNetwork, entry.ErrorCategory)
+}
@@ -0,0 +1,156 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// defaultExpectContinueMinBodySize is the default minimum size of the bodies sent with Expect: 100-continue.
+const defaultExpectContinueMinBodySize = 1024 * 1024
+
+// ExpectContinueOption defines the configuration of the Expect: 100-continue uploads.
+type ExpectContinueOption struct {
+	// Timeout is the time to wait for the 100 Continue of the server before the body is sent anyway,
+	// it is set to the ExpectContinueTimeout of the transport.
+	Timeout time.Duration
+	// MinBodySize is the minimum size of the bodies sent with Expect: 100-continue,
+	// the bodies of an unknown size are always sent with it.
+	MinBodySize int64
+}
+
+// NewExpectContinueOption creates an Expect: 100-continue option configuration
+// for the bodies of at least 1MB, which waits at most timeout for the 100 Continue.
+func NewExpectContinueOption(timeout time.Duration) ExpectContinueOption {
+	return ExpectContinueOption{
+		Timeout:     timeout,
+		MinBodySize: defaultExpectContinueMinBodySize,
+	}
+}
+
+func (o ExpectContinueOption) isEnabled() bool {
+	return o.Timeout > 0
+}
+
+// ExpectContinueHandler creates an interceptor that sends the large request bodies with Expect: 100-continue,
+// so that a server that rejects the request early, such as with 401 or 413, does not receive the body.
+// The transport must have an ExpectContinueTimeout, which WithExpectContinue sets.
+// LoggerEntry.ContinueGranted records whether the server granted the continue.
+// The LogFingerprint and LogRequestBody of the logger read the whole body, they should be disabled for large uploads.
+// An attempt rejected before its body was sent is retried with the same unread body,
+// and an attempt that sent a part of its body is only retried when the body can be rewound by GetBody.
+func ExpectContinueHandler(option ExpectContinueOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil || req.Body == nil || req.Body == http.NoBody || isStreamingRequest(req) ||
+			(req.ContentLength > 0 && req.ContentLength < option.MinBodySize) {
+			return handlerFunc(req)
+		}
+
+		body := &expectContinueBody{rc: req.Body}
+		state := &expectContinueState{body: body, getBody: req.GetBody}
+		ctx := httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+			Got100Continue: state.grant,
+		})
+		req = req.Clone(context.WithValue(ctx, expectContinueContextKey, state))
+		req.Header.Set("Expect", "100-continue")
+		req.Body = body
+		defer body.close()
+		return handlerFunc(req)
+	}
+}
+
+// expectContinueState records whether the server granted the continue, and how much of the body was sent.
+type expectContinueState struct {
+	mu      sync.Mutex
+	granted bool
+	body    *expectContinueBody
+	getBody func() (io.ReadCloser, error)
+}
+
+func (s *expectContinueState) grant() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.granted = true
+}
+
+func (s *expectContinueState) continueGranted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.granted
+}
+
+// prepareRetry prepares the body for the next attempt, and reports whether it can be retried.
+// The body that has not been read is reused, and the one partly sent is rewound by GetBody.
+func (s *expectContinueState) prepareRetry() bool {
+	s.mu.Lock()
+	s.granted = false
+	s.mu.Unlock()
+	return s.body.rewind(s.getBody)
+}
+
+func getExpectContinueState(req *http.Request) *expectContinueState {
+	state, _ := getRequestContext(req).Value(expectContinueContextKey).(*expectContinueState)
+	return state
+}
+
+// expectContinueBody counts the bytes of the body read by the transport,
+// it is closed by ExpectContinueHandler instead of the transport, so that the retries can reuse it.
+type expectContinueBody struct {
+	mu sync.Mutex
+	rc io.ReadCloser
+	n  int64
+}
+
+func (b *expectContinueBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, err := b.rc.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *expectContinueBody) Close() error {
+	return nil
+}
+
+func (b *expectContinueBody) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_ = b.rc.Close()
+}
+
+func (b *expectContinueBody) rewind(getBody func() (io.ReadCloser, error)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.n == 0 {
+		return true
+	}
+	if getBody == nil {
+		return false
+	}
+	rc, err := getBody()
+	if err != nil {
+		return false
+	}
+	_ = b.rc.Close()
+	b.rc, b.n = rc, 0
+	return true
+}
+
+// withExpectContinueTimeout returns a copy of the transport with the ExpectContinueTimeout.
+// Transports other than *http.Transport are returned unchanged.
+func withExpectContinueTimeout(rt http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	t = t.Clone()
+	t.ExpectContinueTimeout = timeout
+	return t
+}
@@ -0,0 +1,140 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+func TestWithExpectContinue_Rejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "100-continue", r.Header.Get("Expect"))
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer ts.Close()
+
+	logger, hook := test.NewNullLogger()
+	loggerOption := NewLoggerOption()
+	loggerOption.Logger = logrus.NewEntry(logger)
+	loggerOption.LogRequestBody = false
+	loggerOption.LogFingerprint = false
+	c := NewClient(WithExpectContinue(10*time.Second), WithLoggerOption(loggerOption))
+
+	size := 8 * defaultExpectContinueMinBodySize
+	body := &countingReader{r: bytes.NewReader(make([]byte, size))}
+	req, err := http.NewRequest(http.MethodPut, ts.URL, body)
+	require.Nil(t, err)
+	req.ContentLength = int64(size)
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	require.Less(t, atomic.LoadInt64(&body.n), int64(64*1024))
+
+	require.Len(t, hook.AllEntries(), 1)
+	require.Equal(t, false, hook.LastEntry().Data["continueGranted"])
+}
+
+func TestWithExpectContinue_Granted(t *testing.T) {
+	size := 2 * defaultExpectContinueMinBodySize
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.Nil(t, err)
+		require.Len(t, b, size)
+	}))
+	defer ts.Close()
+
+	logger, hook := test.NewNullLogger()
+	loggerOption := NewLoggerOption()
+	loggerOption.Logger = logrus.NewEntry(logger)
+	c := NewClient(WithExpectContinue(10*time.Second), WithLoggerOption(loggerOption))
+
+	resp, err := c.Post(ts.URL, "application/octet-stream", bytes.NewReader(make([]byte, size)))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, true, hook.LastEntry().Data["continueGranted"])
+}
+
+func TestWithExpectContinue_SmallBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("Expect"))
+	}))
+	defer ts.Close()
+
+	c := NewClient(WithExpectContinue(10 * time.Second))
+	resp, err := c.Post(ts.URL, "text/plain", bytes.NewReader([]byte("small")))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestWithExpectContinue_Retry(t *testing.T) {
+	size := 2 * defaultExpectContinueMinBodySize
+	tests := []struct {
+		name       string
+		readBody   bool
+		getBody    bool
+		wantStatus int
+		wantCalls  int32
+	}{
+		{"rejected before the body is sent", false, false, http.StatusOK, 2},
+		{"body sent and rewound", true, true, http.StatusOK, 2},
+		{"body sent and not rewindable", true, false, http.StatusServiceUnavailable, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					if tt.readBody {
+						_, _ = io.Copy(io.Discard, r.Body)
+					}
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				b, err := io.ReadAll(r.Body)
+				require.Nil(t, err)
+				require.Len(t, b, size)
+			}))
+			defer ts.Close()
+
+			c := NewClient(
+				WithExpectContinue(10*time.Second),
+				WithShouldRetryFunc(defaultShouldRetryFunc),
+				WithMaxRetry(1),
+				WithRetryBackOff(backoff.NewConstantBackOff(0)),
+			)
+			req, err := http.NewRequest(http.MethodPut, ts.URL, bytes.NewReader(make([]byte, size)))
+			require.Nil(t, err)
+			if !tt.getBody {
+				req.GetBody = nil
+			}
+			resp, err := c.Do(req)
+			require.Nil(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			require.Equal(t, tt.wantCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
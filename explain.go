@@ -0,0 +1,98 @@
+package gohttpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ExplainRecord is a decision made by a built-in interceptor for a request in explain mode, see WithExplain.
+type ExplainRecord struct {
+	// Handler is the name of the interceptor, such as "cache", "retry" and "ratelimit".
+	Handler string
+	// Decision is what the interceptor did, such as "hit", "miss" and "retry".
+	Decision string
+	// Reason describes why the decision was made, such as "key=abc not found".
+	Reason string
+	// Duration is the time spent on the decision, such as the time waited for a rate limit token.
+	Duration time.Duration
+}
+
+func (r ExplainRecord) String() string {
+	return fmt.Sprintf("%s %s: %s (%s)", r.Handler, r.Decision, r.Reason, r.Duration)
+}
+
+// explainRecorder collects the records of a request, the interceptors may run concurrently.
+type explainRecorder struct {
+	mu      sync.Mutex
+	records []ExplainRecord
+}
+
+func (e *explainRecorder) add(handler, decision string, d time.Duration, format string, args ...interface{}) {
+	r := ExplainRecord{Handler: handler, Decision: decision, Reason: fmt.Sprintf(format, args...), Duration: d}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.records = append(e.records, r)
+}
+
+func (e *explainRecorder) snapshot() []ExplainRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	records := make([]ExplainRecord, len(e.records))
+	copy(records, e.records)
+	return records
+}
+
+// WithExplain returns a context that turns on explain mode for the requests made with it.
+// In explain mode, the built-in interceptors record why a request was cached, retried, rate limited and so on,
+// and the records can be read by ExplainFromContext or ExplainFromResponse after the call.
+// Nothing is recorded for the requests without it.
+func WithExplain(ctx context.Context) context.Context {
+	if getExplainRecorder(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, explainContextKey, &explainRecorder{})
+}
+
+// ExplainFromContext returns the records of the requests made with a context returned by WithExplain.
+func ExplainFromContext(ctx context.Context) []ExplainRecord {
+	e := getExplainRecorder(ctx)
+	if e == nil {
+		return nil
+	}
+	return e.snapshot()
+}
+
+// ExplainFromResponse returns the records of the request of the response, see WithExplain.
+func ExplainFromResponse(resp *http.Response) []ExplainRecord {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	return ExplainFromContext(resp.Request.Context())
+}
+
+func getExplainRecorder(ctx context.Context) *explainRecorder {
+	e, _ := ctx.Value(explainContextKey).(*explainRecorder)
+	return e
+}
+
+// explainRequest returns the recorder of the request, it is nil when explain mode is off.
+func explainRequest(req *http.Request) *explainRecorder {
+	if req == nil {
+		return nil
+	}
+	return getExplainRecorder(req.Context())
+}
+
+// explainOutcome describes the result of an attempt for the records.
+func explainOutcome(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if resp == nil {
+		return "no response"
+	}
+	return fmt.Sprintf("status %d", resp.StatusCode)
+}
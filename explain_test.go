@@ -0,0 +1,106 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	retryOption := NewRetryOption(2, backoff.NewConstantBackOff(time.Millisecond))
+	cacheOption := NewMemoryCacheOption()
+	rateLimitOption := NewRateLimitOption(1000)
+	handler := ChainRequestHandlers(RetryHandler(retryOption), RateLimitHandler(rateLimitOption), CacheHandler(cacheOption))
+
+	statusCodes := []int{http.StatusServiceUnavailable, http.StatusOK}
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		statusCode := statusCodes[0]
+		statusCodes = statusCodes[1:]
+		return &http.Response{
+			StatusCode: statusCode,
+			Request:    req,
+			Body:       io.NopCloser(bytes.NewBufferString("hello world")),
+		}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/explain?q=1", nil)
+	hash := string(cacheOption.RequestHashFunc(req, nil, nil))
+	req = req.WithContext(WithExplain(req.Context()))
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	type record struct {
+		Handler, Decision, Reason string
+	}
+	getRecords := func(records []ExplainRecord) []record {
+		var rs []record
+		for _, r := range records {
+			rs = append(rs, record{r.Handler, r.Decision, r.Reason})
+		}
+		return rs
+	}
+	records := ExplainFromResponse(resp)
+	require.Len(t, records, 7)
+	require.True(t, records[0].Duration >= 0)
+	require.Equal(t, "ratelimit", records[0].Handler)
+	require.Equal(t, "wait", records[0].Decision)
+	require.Contains(t, records[0].Reason, "key=GET https://example.com/explain")
+	require.Equal(t, time.Millisecond, records[3].Duration)
+	require.Equal(t, []record{
+		{"cache", "miss", "key=" + hash + " not found"},
+		{"cache", "skip", "not cacheable: status 503"},
+		{"retry", "retry", "attempt 2 after 1ms: status 503"},
+		{"ratelimit", "wait", records[4].Reason},
+		{"cache", "miss", "key=" + hash + " not found"},
+		{"cache", "store", "key=" + hash + " ttl=5m0s"},
+	}, getRecords(records[1:]))
+	require.Equal(t, records, ExplainFromContext(req.Context()))
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/explain?q=1", nil)
+	req = req.WithContext(WithExplain(req.Context()))
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	records = ExplainFromResponse(resp)
+	require.Len(t, records, 2)
+	require.Equal(t, record{"cache", "hit", "key=" + hash}, getRecords(records)[1])
+}
+
+func TestExplain_Disabled(t *testing.T) {
+	ctx := context.Background()
+	require.Nil(t, ExplainFromContext(ctx))
+	require.Nil(t, ExplainFromResponse(nil))
+	require.Nil(t, ExplainFromResponse(&http.Response{}))
+
+	ctx = WithExplain(ctx)
+	require.Equal(t, ctx, WithExplain(ctx))
+	require.Empty(t, ExplainFromContext(ctx))
+}
+
+func TestExplain_Client(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithMaxRetry(1), WithShouldRetryFunc(defaultShouldRetryFunc), WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)))
+	req, _ := http.NewRequestWithContext(WithExplain(context.Background()), http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	records := ExplainFromResponse(resp)
+	require.Len(t, records, 2)
+	require.Equal(t, "attempt 2 after 1ms: status 503", records[0].Reason)
+	require.Equal(t, "give up", records[1].Decision)
+	require.Equal(t, "attempt 2: status 503", records[1].Reason)
+	require.Equal(t, "retry give up: attempt 2: status 503 (0s)", records[1].String())
+}
@@ -0,0 +1,99 @@
+package gohttpclient
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ServedByHeader is the header of the responses of FallbackHandler, whose value is the scheme and host
+// of the target that served the response, such as "https://mirror.example.com".
+const ServedByHeader = "X-Gohttpclient-Served-By"
+
+// FallbackOption is used to re-issue the failed requests against the fallback targets, such as a mirror host.
+type FallbackOption struct {
+	// Rewrites are tried in order after the primary attempt fails, each of them rewrites a clone of the request
+	// to the next target, such as RewriteHost("mirror.example.com"). A rewrite that returns nil is skipped.
+	Rewrites []func(*http.Request) *http.Request
+	// ShouldFallbackFunc reports whether an attempt failed and the next target should be tried,
+	// by default it is true when the request fails or the response status code is greater than or equal to 500.
+	ShouldFallbackFunc ShouldRetryFunc
+}
+
+// NewFallbackOption creates an option configuration that tries the rewrites in order with the default ShouldFallbackFunc.
+func NewFallbackOption(rewrites ...func(*http.Request) *http.Request) FallbackOption {
+	return FallbackOption{
+		Rewrites:           rewrites,
+		ShouldFallbackFunc: defaultShouldRetryFunc,
+	}
+}
+
+func (o FallbackOption) isEnabled() bool {
+	return len(o.Rewrites) > 0
+}
+
+// RewriteHost creates a rewrite of FallbackOption that sends the request to the host, such as "mirror.example.com",
+// the scheme, the path and the query are kept.
+func RewriteHost(host string) func(*http.Request) *http.Request {
+	return func(req *http.Request) *http.Request {
+		req.URL.Host = host
+		req.Host = ""
+		return req
+	}
+}
+
+// FallbackHandler is the interceptor that tries the rewrites of the request in order when the primary attempt fails.
+// It runs outside of the retries, so each target is retried on its own before the next one is tried,
+// and the circuits of the targets are separate since the default HystrixContructor names them by their hosts.
+// The body is rewound by GetBody for each fallback, so a request whose body has no GetBody is only sent once.
+// The response carries the target that served it in the ServedByHeader header,
+// and the result of the last attempt is returned when all of them fail.
+func FallbackHandler(option FallbackOption) RequestHandler {
+	shouldFallback := option.ShouldFallbackFunc
+	if shouldFallback == nil {
+		shouldFallback = defaultShouldRetryFunc
+	}
+
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil || req.URL == nil {
+			return handlerFunc(req)
+		}
+		rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+		resp, err := handlerFunc(req)
+		target := req
+		for _, rewrite := range option.Rewrites {
+			if !rewindable || !shouldFallback(target, resp, err) {
+				break
+			}
+			next := req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, bodyErr := req.GetBody()
+				if bodyErr != nil {
+					closeResponse(resp)
+					return nil, errors.Wrap(bodyErr, "Rewind the request body")
+				}
+				next.Body = body
+			}
+			rewritten := rewrite(next)
+			if rewritten == nil {
+				if next.Body != nil {
+					next.Body.Close()
+				}
+				continue
+			}
+
+			closeResponse(resp)
+			target = rewritten
+			resp, err = handlerFunc(target)
+		}
+
+		if resp != nil && target.URL != nil {
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			resp.Header.Set(ServedByHeader, getURLStringEndWithHost(target.URL))
+		}
+		return resp, err
+	}
+}
@@ -0,0 +1,116 @@
+package gohttpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackHandler(t *testing.T) {
+	var primaryHits int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryHits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("mirror " + r.URL.RequestURI() + " " + string(body)))
+	}))
+	defer mirror.Close()
+	mirrorURL, _ := url.Parse(mirror.URL)
+
+	option := NewFallbackOption(RewriteHost(mirrorURL.Host))
+	c := NewClient(WithFallbackOption(option))
+
+	resp, err := c.Post(primary.URL+"/files?v=1", "text/plain", strings.NewReader("hello"))
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "mirror /files?v=1 hello", string(body))
+	require.Equal(t, mirror.URL, resp.Header.Get(ServedByHeader))
+	require.Equal(t, int32(1), atomic.LoadInt32(&primaryHits))
+
+	// The primary that does not fail serves the request.
+	resp, err = c.Get(mirror.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, mirror.URL, resp.Header.Get(ServedByHeader))
+}
+
+func TestFallbackHandler_AllFail(t *testing.T) {
+	var hits []string
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hits = append(hits, req.URL.Host)
+		return &http.Response{
+			StatusCode: http.StatusBadGateway,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(req.URL.Host)),
+			Request:    req,
+		}, nil
+	})
+	skip := func(req *http.Request) *http.Request { return nil }
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithFallbackOption(NewFallbackOption(RewriteHost("a.example.com"), skip, RewriteHost("b.example.com"))),
+	)
+
+	resp, err := c.Get("https://primary.example.com/")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, []string{"primary.example.com", "a.example.com", "b.example.com"}, hits)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Equal(t, "https://b.example.com", resp.Header.Get(ServedByHeader))
+}
+
+func TestFallbackHandler_NotRewindable(t *testing.T) {
+	hits := 0
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hits++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	})
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithFallbackOption(NewFallbackOption(RewriteHost("mirror.example.com"))),
+	)
+
+	req, _ := http.NewRequest(http.MethodPost, "https://primary.example.com/", io.NopCloser(strings.NewReader("body")))
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 1, hits)
+	require.Equal(t, "https://primary.example.com", resp.Header.Get(ServedByHeader))
+}
+
+func TestFallbackHandler_SeparateCircuits(t *testing.T) {
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		status := http.StatusOK
+		if req.URL.Host == "primary.example.com" {
+			status = http.StatusServiceUnavailable
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	})
+	hystrixOption := NewIsolatedHystrixOption()
+	hystrixOption.IsFailureFunc = IsServerErrorFailure
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithHystrixOption(hystrixOption),
+		WithFallbackOption(NewFallbackOption(RewriteHost("mirror.example.com"))),
+	)
+
+	resp, err := c.Get("https://primary.example.com/")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotNil(t, hystrixOption.CircuitManager.GetCircuit("https://primary.example.com"))
+	require.NotNil(t, hystrixOption.CircuitManager.GetCircuit("https://mirror.example.com"))
+}
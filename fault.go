@@ -0,0 +1,144 @@
+package gohttpclient
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FaultInjectionEnv is the environment variable that turns on the fault injection of WithFaultInjection
+// when it is a true value of strconv.ParseBool, such as "1" or "true". It is read when the client is created.
+const FaultInjectionEnv = "GOHTTPCLIENT_FAULT_INJECTION"
+
+// ErrInjectedFault is the error injected by FaultOption.ErrorRate.
+var ErrInjectedFault = errors.New("The fault is injected")
+
+// FaultOption is an option configuration for the fault injection, which delays the requests,
+// fails them or rewrites the status codes of their responses to chaos test the callers without touching the upstream.
+// The faults are injected inside the retry and the circuit breaker, which react to them as to the real failures.
+// It ships dark, nothing is injected unless Enabled is set or FaultInjectionEnv is on.
+type FaultOption struct {
+	// Enabled turns on the fault injection regardless of FaultInjectionEnv.
+	Enabled bool
+	// URLPatterns are the patterns of the requests the faults are injected into, all the requests when it is empty.
+	// A pattern is matched by path.Match against the host and the path of the URL, such as "api.example.com/users/*".
+	URLPatterns []string
+	// LatencyDist returns the delay before each request is sent, no delay when it is nil.
+	LatencyDist func() time.Duration
+	// ErrorRate is the probability, from 0 to 1, that a request fails with ErrInjectedFault instead of being sent.
+	ErrorRate float64
+	// ErrorFunc returns the error a request fails with instead of being sent, or nil to send it.
+	ErrorFunc func(*http.Request) error
+	// StatusOverride rewrites the status codes of the responses of the requests that match its patterns,
+	// which are matched like URLPatterns, in the lexical order of the patterns when several of them match.
+	StatusOverride map[string]int
+	// Seed is the seed of the random source of ErrorRate, so the sequence of the injected errors
+	// is the same for the same sequence of requests.
+	Seed int64
+	// Clock is the source of time for the delays, RealClock is used when it is nil.
+	Clock Clock
+}
+
+// NewFaultOption creates a fault injection option configuration that injects nothing until it is configured,
+// and is turned on by FaultInjectionEnv.
+func NewFaultOption(seed int64) FaultOption {
+	return FaultOption{Seed: seed}
+}
+
+func (o FaultOption) isEnabled() bool {
+	if o.Enabled {
+		return true
+	}
+	on, _ := strconv.ParseBool(os.Getenv(FaultInjectionEnv))
+	return on
+}
+
+// FaultInjectionHandler implements an interceptor that injects the faults of the option,
+// and marks the requests in LoggerEntry.FaultInjected.
+func FaultInjectionHandler(option FaultOption) RequestHandler {
+	var mu sync.Mutex
+	random := rand.New(rand.NewSource(option.Seed))
+	injectError := func() bool {
+		if option.ErrorRate <= 0 {
+			return false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return random.Float64() < option.ErrorRate
+	}
+	overrides := make([]string, 0, len(option.StatusOverride))
+	for pattern := range option.StatusOverride {
+		overrides = append(overrides, pattern)
+	}
+	sort.Strings(overrides)
+
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil || req.URL == nil || !matchFaultPatterns(req, option.URLPatterns) {
+			return handlerFunc(req)
+		}
+		source := getResponseSource(req)
+
+		if option.LatencyDist != nil {
+			if delay := option.LatencyDist(); delay > 0 {
+				source.markFaultInjected()
+				if err := sleepContext(req.Context(), option.Clock, delay); err != nil {
+					closeRequestBody(req)
+					return nil, err
+				}
+			}
+		}
+
+		var err error
+		if option.ErrorFunc != nil {
+			err = option.ErrorFunc(req)
+		}
+		if injectError() && err == nil {
+			err = ErrInjectedFault
+		}
+		if err != nil {
+			source.markFaultInjected()
+			closeRequestBody(req)
+			return nil, err
+		}
+
+		resp, err := handlerFunc(req)
+		if err != nil || resp == nil {
+			return resp, err
+		}
+		for _, pattern := range overrides {
+			if matchFaultPattern(req, pattern) {
+				statusCode := option.StatusOverride[pattern]
+				source.markFaultInjected()
+				resp.StatusCode = statusCode
+				resp.Status = fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+				break
+			}
+		}
+		return resp, nil
+	}
+}
+
+func matchFaultPatterns(req *http.Request, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchFaultPattern(req, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchFaultPattern(req *http.Request, pattern string) bool {
+	ok, _ := path.Match(pattern, req.URL.Host+req.URL.Path)
+	return ok
+}
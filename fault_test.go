@@ -0,0 +1,162 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingClock records the durations of the timers, which fire at once.
+type recordingClock struct {
+	mu     sync.Mutex
+	timers []time.Duration
+}
+
+func (c *recordingClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *recordingClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timers = append(c.timers, d)
+	return RealClock.NewTimer(0)
+}
+
+func TestFaultInjectionHandler_Seed(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	latencies := []time.Duration{10 * time.Millisecond, 0, 0}
+	i := 0
+	clock := &recordingClock{}
+	var injected []bool
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		injected = append(injected, e.FaultInjected)
+	}
+	c := NewClient(
+		WithLoggerOption(loggerOption),
+		WithFaultInjection(FaultOption{
+			Enabled: true,
+			LatencyDist: func() time.Duration {
+				d := latencies[i%len(latencies)]
+				i++
+				return d
+			},
+			ErrorRate: 0.5,
+			Seed:      42,
+			Clock:     clock,
+		}),
+	)
+
+	var failed []bool
+	for n := 0; n < 8; n++ {
+		resp, err := c.Get(ts.URL("/"))
+		if err != nil {
+			require.True(t, errors.Is(err, ErrInjectedFault))
+		} else {
+			resp.Body.Close()
+		}
+		failed = append(failed, err != nil)
+	}
+	require.Equal(t, []bool{true, true, false, true, true, true, false, true}, failed)
+	require.Equal(t, 2, ts.RequestCount("/"))
+	require.Equal(t, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}, clock.timers)
+	// The 3rd request is neither delayed nor failed, the 7th is delayed only.
+	require.Equal(t, []bool{true, true, false, true, true, true, true, true}, injected)
+}
+
+func TestFaultInjectionHandler_Disabled(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	option := NewFaultOption(1)
+	option.ErrorRate = 1
+
+	t.Setenv(FaultInjectionEnv, "")
+	resp, err := NewClient(WithFaultInjection(option)).Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	t.Setenv(FaultInjectionEnv, "true")
+	_, err = NewClient(WithFaultInjection(option)).Get(ts.URL("/"))
+	require.True(t, errors.Is(err, ErrInjectedFault))
+	require.Equal(t, 1, ts.RequestCount("/"))
+}
+
+func TestFaultInjectionHandler_StatusOverride(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		},
+	})
+	host := strings.TrimPrefix(ts.URL(), "http://")
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	c := NewClient(
+		WithLoggerOption(loggerOption),
+		WithMaxRetry(2),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithFaultInjection(FaultOption{
+			Enabled:        true,
+			URLPatterns:    []string{host + "/flaky/*"},
+			StatusOverride: map[string]int{host + "/flaky/*": http.StatusServiceUnavailable},
+		}),
+	)
+
+	// The retry reacts to the rewritten status code as to a real one.
+	resp, err := c.Get(ts.URL("/flaky/users"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "503 Service Unavailable", resp.Status)
+	require.Equal(t, 3, ts.RequestCount("/flaky/users"))
+	require.True(t, entry.FaultInjected)
+	require.True(t, entry.RetriesExhausted)
+
+	// The requests that do not match the patterns are untouched.
+	resp, err = c.Get(ts.URL("/users"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 1, ts.RequestCount("/users"))
+	require.False(t, entry.FaultInjected)
+}
+
+func TestFaultInjectionHandler_OpensCircuit(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	errInjected := errors.New("connection reset by chaos")
+	hystrixOption := NewIsolatedHystrixOption()
+	c := NewClient(
+		WithHystrixOption(hystrixOption),
+		WithFaultInjection(FaultOption{
+			Enabled: true,
+			ErrorFunc: func(req *http.Request) error {
+				return errInjected
+			},
+		}),
+	)
+
+	// The circuit counts the injected errors as failures, and opens after 20 of them.
+	for n := 0; n < 20; n++ {
+		_, err := c.Get(ts.URL("/"))
+		require.True(t, errors.Is(err, errInjected))
+	}
+	_, err := c.Get(ts.URL("/"))
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.True(t, hystrixOption.IsOpen(ts.URL()))
+	require.Equal(t, 0, ts.RequestCount("/"))
+}
@@ -0,0 +1,123 @@
+package gohttpclient
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ErrHeadersTooLarge is the error that matches, by errors.Is, the errors returned when the request headers exceed the limits.
+var ErrHeadersTooLarge = errors.New("The request headers are too large")
+
+// HeadersTooLargeError is returned when the request headers exceed the limits,
+// Name is the header that exceeded the limit.
+type HeadersTooLargeError struct {
+	Name  string
+	Limit int
+	Size  int
+	// Reason is one of "bytes", "count" or "value".
+	Reason string
+}
+
+func (e *HeadersTooLargeError) Error() string {
+	return fmt.Sprintf("The request headers are too large: header '%s' exceeds the %s limit %d with %d", e.Name, e.Reason, e.Limit, e.Size)
+}
+
+// Is reports whether the target is ErrHeadersTooLarge.
+func (e *HeadersTooLargeError) Is(target error) bool {
+	return target == ErrHeadersTooLarge
+}
+
+// HeaderSizeOption is used to limit the size of the request headers, the trailers are included.
+// A limit of 0 means there is no limit.
+type HeaderSizeOption struct {
+	MaxHeaderBytes      int
+	MaxHeaderCount      int
+	MaxHeaderValueBytes int
+}
+
+// NewHeaderSizeOption creates an option configuration that limits the total bytes of the keys and values of the headers,
+// the count of the header values, and the bytes of a single header value.
+func NewHeaderSizeOption(maxHeaderBytes, maxHeaderCount, maxHeaderValueBytes int) HeaderSizeOption {
+	return HeaderSizeOption{
+		MaxHeaderBytes:      maxHeaderBytes,
+		MaxHeaderCount:      maxHeaderCount,
+		MaxHeaderValueBytes: maxHeaderValueBytes,
+	}
+}
+
+func (o HeaderSizeOption) isEnabled() bool {
+	return o.MaxHeaderBytes > 0 || o.MaxHeaderCount > 0 || o.MaxHeaderValueBytes > 0
+}
+
+// HeaderSizeHandler is the interceptor that rejects requests whose headers exceed the limits before they are sent.
+func HeaderSizeHandler(option HeaderSizeOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req != nil {
+			if err := checkHeaderSize(option, req.Header, req.Trailer); err != nil {
+				if e := explainRequest(req); e != nil {
+					e.add("headersize", "reject", 0, "%v", err)
+				}
+				return nil, err
+			}
+		}
+		return handlerFunc(req)
+	}
+}
+
+func checkHeaderSize(option HeaderSizeOption, headers ...http.Header) error {
+	totalBytes := 0
+	totalCount := 0
+	for _, h := range headers {
+		for _, key := range sortedHeaderKeys(h) {
+			for _, value := range h[key] {
+				totalBytes += len(key) + len(value)
+				totalCount++
+				if option.MaxHeaderValueBytes > 0 && len(value) > option.MaxHeaderValueBytes {
+					return &HeadersTooLargeError{Name: key, Limit: option.MaxHeaderValueBytes, Size: len(value), Reason: "value"}
+				}
+				if option.MaxHeaderBytes > 0 && totalBytes > option.MaxHeaderBytes {
+					return &HeadersTooLargeError{Name: key, Limit: option.MaxHeaderBytes, Size: totalBytes, Reason: "bytes"}
+				}
+				if option.MaxHeaderCount > 0 && totalCount > option.MaxHeaderCount {
+					return &HeadersTooLargeError{Name: key, Limit: option.MaxHeaderCount, Size: totalCount, Reason: "count"}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// truncateHTTPHeader copies the header and keeps at most maxBytes bytes of keys and values.
+func truncateHTTPHeader(h http.Header, maxBytes int) http.Header {
+	if h == nil || maxBytes <= 0 {
+		return h
+	}
+	result := make(http.Header)
+	remaining := maxBytes
+	for _, key := range sortedHeaderKeys(h) {
+		for _, value := range h[key] {
+			if remaining < len(key) {
+				return result
+			}
+			remaining -= len(key)
+			if len(value) > remaining {
+				value = value[:remaining]
+			}
+			remaining -= len(value)
+			result[key] = append(result[key], value)
+		}
+	}
+	return result
+}
+
+func sortedHeaderKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,107 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderSizeHandler(t *testing.T) {
+	cases := []struct {
+		Option HeaderSizeOption
+		Header http.Header
+		Name   string
+		Reason string
+	}{
+		{
+			Option: NewHeaderSizeOption(20, 0, 0),
+			Header: http.Header{"A": []string{"1"}, "X-Blob": []string{strings.Repeat("x", 100)}},
+			Name:   "X-Blob",
+			Reason: "bytes",
+		},
+		{
+			Option: NewHeaderSizeOption(0, 2, 0),
+			Header: http.Header{"A": []string{"1"}, "B": []string{"1", "2"}},
+			Name:   "B",
+			Reason: "count",
+		},
+		{
+			Option: NewHeaderSizeOption(0, 0, 10),
+			Header: http.Header{"A": []string{"1"}, "Token": []string{strings.Repeat("x", 11)}},
+			Name:   "Token",
+			Reason: "value",
+		},
+	}
+
+	for _, c := range cases {
+		requestTimes := 0
+		handlerFunc := func(req *http.Request) (*http.Response, error) {
+			requestTimes++
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		req.Header = c.Header
+		resp, err := HeaderSizeHandler(c.Option)(req, handlerFunc)
+		require.Nil(t, resp)
+		require.True(t, errors.Is(err, ErrHeadersTooLarge))
+		var headersErr *HeadersTooLargeError
+		require.True(t, errors.As(err, &headersErr))
+		require.Equal(t, c.Name, headersErr.Name)
+		require.Equal(t, c.Reason, headersErr.Reason)
+		require.Equal(t, 0, requestTimes)
+	}
+}
+
+func TestHeaderSizeHandler_Trailer(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req.Header.Set("A", "1")
+	req.Trailer = http.Header{"Checksum": []string{strings.Repeat("x", 20)}}
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+	_, err := HeaderSizeHandler(NewHeaderSizeOption(10, 0, 0))(req, handlerFunc)
+	var headersErr *HeadersTooLargeError
+	require.True(t, errors.As(err, &headersErr))
+	require.Equal(t, "Checksum", headersErr.Name)
+}
+
+func TestHeaderSizeHandler_OK(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req.Header.Set("A", "1")
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+	resp, err := HeaderSizeHandler(NewHeaderSizeOption(10, 10, 10))(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+}
+
+func TestTruncateHTTPHeader(t *testing.T) {
+	h := http.Header{"Aa": []string{"12345"}, "Bb": []string{"12345"}}
+	require.Equal(t, h, truncateHTTPHeader(h, 0))
+	require.Equal(t, http.Header{"Aa": []string{"12345"}, "Bb": []string{"1"}}, truncateHTTPHeader(h, 10))
+	require.Equal(t, http.Header{"Aa": []string{"12"}}, truncateHTTPHeader(h, 4))
+}
+
+func TestNewClient_WithMaxHeaderBytes(t *testing.T) {
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	c := NewClient(
+		WithLoggerOption(loggerOption),
+		WithMaxHeaderBytes(16),
+		WithMaxHeaderCount(10),
+		WithMaxHeaderValueBytes(1024),
+	)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req.Header.Set("X-Blob", strings.Repeat("x", 4096))
+	resp, err := c.Do(req)
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrHeadersTooLarge))
+	require.Equal(t, http.Header{"X-Blob": []string{"xxxxxxxxxx"}}, entry.RequestHeader)
+}
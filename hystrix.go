@@ -2,6 +2,7 @@ package gohttpclient
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -9,6 +10,8 @@ import (
 
 	"github.com/cep21/circuit"
 	"github.com/cep21/circuit/closers/hystrix"
+	"github.com/cep21/circuit/metrics/rolling"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,15 +27,7 @@ var defaultHystrixContructor HystrixContructor = func(req *http.Request, option
 		name = strings.ToLower(getURLStringEndWithHost(req.URL))
 	}
 
-	c := option.CircuitManager.GetCircuit(name)
-	if c != nil {
-		return c
-	}
-	c, err := option.CircuitManager.CreateCircuit(name)
-	if err != nil { // Error: circuit with that name already exists
-		c = option.CircuitManager.GetCircuit(name)
-	}
-	return c
+	return option.getOrCreateCircuit(name)
 }
 
 var defaultHystrixFactory = hystrix.Factory{
@@ -47,8 +42,20 @@ var defaultHystrixFactory = hystrix.Factory{
 	},
 }
 
-var defaultCircuitManager = &circuit.Manager{
-	DefaultCircuitProperties: []circuit.CommandPropertiesConstructor{
+// defaultCircuitManager is shared by all the options created by NewHystrixOption.
+var defaultCircuitManager = newCircuitManager()
+
+// newCircuitManager creates a circuit manager with the default settings of the circuit breakers,
+// whose circuits collect the rolling stats read by HystrixOption.Stats.
+// Their open times are tracked for Client.ExportState.
+func newCircuitManager() *circuit.Manager {
+	stats := &rolling.StatFactory{}
+	properties := append(defaultCircuitProperties(), stats.CreateConfig, createCircuitOpenTimeConfig)
+	return &circuit.Manager{DefaultCircuitProperties: properties}
+}
+
+func defaultCircuitProperties() []circuit.CommandPropertiesConstructor {
+	return []circuit.CommandPropertiesConstructor{
 		defaultHystrixFactory.Configure,
 		func(_circuitName string) circuit.Config {
 			return circuit.Config{
@@ -67,15 +74,40 @@ var defaultCircuitManager = &circuit.Manager{
 				Metrics: circuit.MetricsCollectors{},
 			}
 		},
-	},
+	}
 }
 
 // HystrixOption is an option configuration for the circuit breaker.
 type HystrixOption struct {
 	CircuitManager    *circuit.Manager
 	HystrixContructor HystrixContructor
+	// FallbackCacheOption is an opt-in graceful degradation. When it is set and the circuit is open,
+	// the last cached response of the request is returned instead of the CircuitOpenError.
+	// It is usually the same option passed to WithCacheOption,
+	// and its StaleTTL keeps expired responses available for the fallback.
+	FallbackCacheOption *CacheOption
+	// MaxConcurrentRequests caps the in-flight requests of each circuit, 0 means there is no limit.
+	// The requests that exceed it fail fast with a ConcurrencyLimitError, which is a bulkhead for each host.
+	// It applies to the circuits created by the default HystrixContructor after it is set,
+	// the circuits that already exist in a shared circuit manager keep their settings.
+	MaxConcurrentRequests int
+	// IsFailureFunc reports whether a response counts as a failure of the circuit, such as IsServerErrorFailure.
+	// The response is still returned to the caller as is, it only trips the circuit.
+	// Only the errors are failures when it is nil.
+	IsFailureFunc func(resp *http.Response, err error) bool
+	// Clock is the source of time of Stats and of the state snapshots, RealClock is used when it is nil.
+	Clock Clock
 }
 
+// IsServerErrorFailure is a HystrixOption.IsFailureFunc that counts the errors and the 5xx responses as failures.
+func IsServerErrorFailure(resp *http.Response, err error) bool {
+	return err != nil || resp == nil || resp.StatusCode >= 500
+}
+
+// errFailureResponse is returned to the circuit for the responses counted as failures by IsFailureFunc,
+// it never reaches the caller.
+var errFailureResponse = errors.New("the response is counted as a failure")
+
 // NewHystrixOption creates an option configuration for a circuit breaker.
 // Circuit breakers use the Hystrix Pattern,
 // which is a complex concept and requires a lot of effort to understand.
@@ -89,29 +121,303 @@ type HystrixOption struct {
 // it becomes an open-circuit state.
 // Then wait for 5 seconds, then retries 1 time,
 // and if successful, it changes back to the closed-circuit state.
+//
+// All the options created by NewHystrixOption share a package-level circuit manager,
+// so the clients using them share the state of the circuits of each host,
+// even if they are created separately.
+//
+// Deprecated: the sharing is implicit, use NewIsolatedHystrixOption for circuits owned by the option,
+// or SharedHystrixOption to share a circuit manager intentionally.
 func NewHystrixOption() HystrixOption {
+	return SharedHystrixOption(defaultCircuitManager)
+}
+
+// NewIsolatedHystrixOption creates an option configuration for a circuit breaker with the default settings,
+// which has its own circuit manager, so an open circuit of it does not affect the other options.
+// The copies of the option share the manager, pass it to the clients that should share the circuits.
+func NewIsolatedHystrixOption() HystrixOption {
+	return SharedHystrixOption(newCircuitManager())
+}
+
+// SharedHystrixOption creates an option configuration for a circuit breaker that uses the manager,
+// the options created with the same manager share the circuits of each host.
+// The settings of the circuits are the DefaultCircuitProperties of the manager.
+func SharedHystrixOption(manager *circuit.Manager) HystrixOption {
 	return HystrixOption{
-		CircuitManager:    defaultCircuitManager,
+		CircuitManager:    manager,
 		HystrixContructor: defaultHystrixContructor,
 	}
 }
 
+// ResetCircuit closes the circuit of the name, which is the lowercase scheme and host of the URL,
+// such as "https://example.com", and reports whether the circuit exists.
+// The circuit manager can not remove a circuit, so this is the way to clear its state in tests and admin endpoints.
+func (h HystrixOption) ResetCircuit(name string) bool {
+	if h.CircuitManager == nil {
+		return false
+	}
+	c := h.CircuitManager.GetCircuit(name)
+	if c == nil {
+		return false
+	}
+	c.CloseCircuit()
+	return true
+}
+
+// ResetCircuits closes all the circuits of the circuit manager.
+func (h HystrixOption) ResetCircuits() {
+	if h.CircuitManager == nil {
+		return
+	}
+	for _, c := range h.CircuitManager.AllCircuits() {
+		c.CloseCircuit()
+	}
+}
+
+// CircuitStats is a snapshot of the state of a circuit, see HystrixOption.Stats.
+type CircuitStats struct {
+	// Open reports whether the circuit is open, the requests fail fast with a CircuitOpenError.
+	Open bool
+	// RequestVolume is the number of the requests that succeeded or failed in the rolling window,
+	// which is 10 seconds by default. The requests rejected by the open circuit are not counted.
+	RequestVolume int64
+	// Errors is the number of the requests that failed in the rolling window.
+	Errors int64
+	// ErrorRate is Errors divided by RequestVolume, from 0 to 1, and 0 when there are no requests.
+	ErrorRate float64
+	// ConcurrentRequests is the number of the requests in flight.
+	ConcurrentRequests int64
+}
+
+// Stats returns a snapshot of the circuits of the circuit manager by their names, such as "https://example.com",
+// for the dashboards to scrape periodically. Only the circuits that exist are in the map.
+// The circuits of a manager passed to SharedHystrixOption only report Open and ConcurrentRequests,
+// unless their DefaultCircuitProperties collect the stats of the rolling package of the circuit library.
+func (h HystrixOption) Stats() map[string]CircuitStats {
+	stats := make(map[string]CircuitStats)
+	if h.CircuitManager == nil {
+		return stats
+	}
+	now := getClock(h.Clock).Now()
+	for _, c := range h.CircuitManager.AllCircuits() {
+		s := CircuitStats{
+			Open:               c.IsOpen(),
+			ConcurrentRequests: c.ConcurrentCommands(),
+		}
+		if runStats := rolling.FindCommandMetrics(c); runStats != nil {
+			s.RequestVolume = runStats.LegitimateAttemptsAt(now)
+			s.Errors = runStats.ErrorsAt(now)
+			s.ErrorRate = runStats.ErrorPercentageAt(now)
+		}
+		stats[c.Name()] = s
+	}
+	return stats
+}
+
+// getOrCreateCircuit returns the circuit of the name, which is created with the settings of the option if it does not exist.
+func (h HystrixOption) getOrCreateCircuit(name string) *circuit.Circuit {
+	c := h.CircuitManager.GetCircuit(name)
+	if c != nil {
+		return c
+	}
+	c, err := h.CircuitManager.CreateCircuit(name, h.circuitConfig())
+	if err != nil { // Error: circuit with that name already exists
+		c = h.CircuitManager.GetCircuit(name)
+	}
+	return c
+}
+
+// circuitConfig returns the settings of the option that override the DefaultCircuitProperties of the manager.
+func (h HystrixOption) circuitConfig() circuit.Config {
+	var config circuit.Config
+	if h.MaxConcurrentRequests > 0 {
+		config.Execution.MaxConcurrentRequests = int64(h.MaxConcurrentRequests)
+	}
+	return config
+}
+
+// IsOpen reports whether the circuit of the host is currently open, so that a load balancer can skip it.
+// The host is the name of a circuit of the default HystrixContructor, which is the scheme and host of the URL,
+// such as "https://example.com", or a bare host, such as "example.com:8080",
+// whose circuit of either http or https is checked. A host without a circuit yet is not open.
+func (h HystrixOption) IsOpen(host string) bool {
+	if !h.isEnabled() {
+		return false
+	}
+	host = strings.ToLower(host)
+	names := []string{host}
+	if !strings.Contains(host, "://") {
+		names = []string{"http://" + host, "https://" + host}
+	}
+	for _, name := range names {
+		if c := h.CircuitManager.GetCircuit(name); c != nil && c.IsOpen() {
+			return true
+		}
+	}
+	return false
+}
+
+// isCircuitOpen reports whether the circuit of the host of the URL is open, see IsOpen.
+func (h HystrixOption) isCircuitOpen(u *url.URL) bool {
+	return u != nil && h.IsOpen(getURLStringEndWithHost(u))
+}
+
 func (h HystrixOption) isEnabled() bool {
 	return h.HystrixContructor != nil && h.CircuitManager != nil
 }
 
+// ErrCircuitOpen is the error that matches, by errors.Is, the errors returned when the circuit is open.
+var ErrCircuitOpen = errors.New("circuit is open")
+
+// CircuitOpenError is returned when the circuit breaker rejects a request because the circuit is open.
+// It wraps the error of the circuit library and keeps its message.
+type CircuitOpenError struct {
+	Err error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the circuit library.
+func (e *CircuitOpenError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// ErrConcurrencyLimitReached is the error that matches, by errors.Is,
+// the errors returned when a circuit has reached HystrixOption.MaxConcurrentRequests.
+var ErrConcurrencyLimitReached = errors.New("circuit concurrency limit reached")
+
+// ConcurrencyLimitError is returned when the circuit breaker rejects a request
+// because the circuit has reached its limit of concurrent requests.
+// It wraps the error of the circuit library and keeps its message.
+type ConcurrencyLimitError struct {
+	Err error
+}
+
+func (e *ConcurrencyLimitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the circuit library.
+func (e *ConcurrencyLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrConcurrencyLimitReached.
+func (e *ConcurrencyLimitError) Is(target error) bool {
+	return target == ErrConcurrencyLimitReached
+}
+
 // HystrixHandler implements a circuit breaker interceptor.
+// The returned response and error are always consistent:
+// when the circuit library itself rejects the request, such as an open circuit or a concurrency limit,
+// no response is returned, and a response produced by a run whose result was superseded is closed.
+// The dry-run requests bypass the circuit breaker, see MarkDryRun, and so do the requests made with
+// the context of WithNoCircuitBreaker.
 func HystrixHandler(option HystrixOption) RequestHandler {
-	return func(req *http.Request, handlerFunc RequestHandlerFunc) (resp *http.Response, err error) {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if isDryRunRequest(req) {
+			return handlerFunc(req)
+		}
+		if IsNoCircuitBreaker(getRequestContext(req)) {
+			if e := explainRequest(req); e != nil {
+				e.add("hystrix", "skip", 0, "circuit breaker disabled by the context")
+			}
+			return handlerFunc(req)
+		}
+
+		var (
+			runResp *http.Response
+			runErr  error
+		)
+
 		c := option.HystrixContructor(req, option)
-		err = c.Execute(getRequestContext(req), func(_ctx context.Context) error {
-			resp, err = handlerFunc(req)
-			return err
+		err := c.Execute(getRequestContext(req), func(_ctx context.Context) error {
+			runResp, runErr = handlerFunc(req)
+			if runErr == nil && option.IsFailureFunc != nil && option.IsFailureFunc(runResp, runErr) {
+				return errFailureResponse
+			}
+			return runErr
 		}, func(_ctx context.Context, err error) error {
 			return err
 		})
+		if err == nil || err == errFailureResponse {
+			return runResp, runErr
+		}
+
+		circuitErr, ok := err.(circuitError)
+		if !ok {
+			return runResp, runErr
+		}
+
+		closeResponse(runResp)
+		e := explainRequest(req)
+		if circuitErr.CircuitOpen() {
+			getResponseSource(req).markFromCircuitBreaker()
+			if option.FallbackCacheOption != nil {
+				if re, ok := getStaleCacheEntry(*option.FallbackCacheOption, req); ok {
+					markCacheHit(req, re.Response, *option.FallbackCacheOption)
+					if e != nil {
+						e.add("hystrix", "fallback", 0, "circuit open, served a stale cached response")
+					}
+					return re.Response, re.Error
+				}
+			}
+			if e != nil {
+				e.add("hystrix", "reject", 0, "circuit open")
+			}
+			return nil, &CircuitOpenError{Err: err}
+		}
+		if e != nil {
+			e.add("hystrix", "reject", 0, "%v", err)
+		}
+		if circuitErr.ConcurrencyLimitReached() {
+			return nil, &ConcurrencyLimitError{Err: err}
+		}
+		return nil, err
+	}
+}
+
+// circuitError is implemented by the errors generated by the circuit library itself.
+type circuitError interface {
+	error
+	ConcurrencyLimitReached() bool
+	CircuitOpen() bool
+}
+
+// WithNoCircuitBreaker returns a context that makes HystrixHandler pass the requests made with it through,
+// such as the idempotent reads of a service backed by a cache, which are neither rejected when the circuit is open,
+// nor counted by the circuit.
+func WithNoCircuitBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCircuitBreakerContextKey, true)
+}
+
+// IsNoCircuitBreaker reports whether the circuit breaker is disabled for the context by WithNoCircuitBreaker.
+func IsNoCircuitBreaker(ctx context.Context) bool {
+	v, _ := ctx.Value(noCircuitBreakerContextKey).(bool)
+	return v
+}
+
+// closeResponse drains and closes the body of a response that will not be returned to the caller.
+func closeResponse(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
 		return
 	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+}
+
+// closeRequestBody closes the body of the request that is not sent, like http.Client does for the failed requests.
+func closeRequestBody(req *http.Request) {
+	if req != nil && req.Body != nil {
+		_ = req.Body.Close()
+	}
 }
 
 func getURLStringEndWithHost(u *url.URL) string {
@@ -2,9 +2,12 @@ package gohttpclient
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -139,3 +142,393 @@ func getTestCircuitManager() *circuit.Manager {
 
 	return defaultCircuitManager
 }
+
+type testTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *testTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestHystrixHandler_Success(t *testing.T) {
+	option := NewHystrixOption()
+	option.CircuitManager = getTestCircuitManager()
+	handler := HystrixHandler(option)
+
+	body := &testTrackingBody{Reader: bytes.NewBufferString("hello world")}
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: body}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	require.False(t, body.closed)
+}
+
+func TestHystrixHandler_ClosureError(t *testing.T) {
+	option := NewHystrixOption()
+	option.CircuitManager = getTestCircuitManager()
+	handler := HystrixHandler(option)
+
+	errHandler := errors.New("handler error")
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return nil, errHandler
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Equal(t, errHandler, err)
+	require.Nil(t, resp)
+	require.False(t, errors.Is(err, ErrCircuitOpen))
+}
+
+func TestHystrixHandler_CircuitOpen(t *testing.T) {
+	option := NewHystrixOption()
+	option.CircuitManager = getTestCircuitManager()
+	handler := HystrixHandler(option)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	option.HystrixContructor(req, option).OpenCircuit()
+
+	requestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		requestTimes++
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, resp)
+	require.NotNil(t, err)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	var circuitOpenErr *CircuitOpenError
+	require.True(t, errors.As(err, &circuitOpenErr))
+	require.Equal(t, "circuit is open: concurrencyReached=false circuitOpen=true", err.Error())
+	require.Equal(t, 0, requestTimes)
+}
+
+func TestHystrixHandler_NoCircuitBreaker(t *testing.T) {
+	option := NewIsolatedHystrixOption()
+	handler := HystrixHandler(option)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	option.HystrixContructor(req, option).OpenCircuit()
+
+	requestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		requestTimes++
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}
+
+	// The request of the context passes through the open circuit, and is not counted.
+	req = req.WithContext(WithNoCircuitBreaker(context.Background()))
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 1, requestTimes)
+	require.Zero(t, option.Stats()["https://example.com"].RequestVolume)
+
+	req = req.WithContext(context.Background())
+	_, err = handler(req, handlerFunc)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.Equal(t, 1, requestTimes)
+}
+
+func TestHystrixHandler_SupersededResponse(t *testing.T) {
+	// The fallback is always throttled, so the error of the circuit library supersedes the run result.
+	option := NewHystrixOption()
+	option.CircuitManager = getTestCircuitManager()
+	handler := HystrixHandler(option)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	c := option.HystrixContructor(req, option)
+	config := c.Config()
+	config.Fallback.MaxConcurrentRequests = 0
+	c.SetConfigThreadSafe(config)
+
+	body := &testTrackingBody{Reader: bytes.NewBufferString("hello world")}
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusFound, Body: body}, errors.New("redirect error")
+	}
+
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, resp)
+	require.NotNil(t, err)
+	require.False(t, errors.Is(err, ErrCircuitOpen))
+	require.True(t, body.closed)
+}
+
+func TestHystrixHandler_FallbackCache(t *testing.T) {
+	cacheOption := NewMemoryCacheOption()
+	cacheOption.CacheTTLFunc = func(*http.Request, *http.Response, error) time.Duration {
+		return 10 * time.Millisecond
+	}
+	cacheOption.StaleTTL = time.Minute
+	cacheHandler := CacheHandler(cacheOption)
+
+	option := NewHystrixOption()
+	option.CircuitManager = getTestCircuitManager()
+	option.FallbackCacheOption = &cacheOption
+	handler := ChainRequestHandlers(HystrixHandler(option), cacheHandler)
+
+	requestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		requestTimes++
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/cached", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, 1, requestTimes)
+
+	time.Sleep(20 * time.Millisecond)
+	option.HystrixContructor(req, option).OpenCircuit()
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/cached", nil)
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	respBody, _ := io.ReadAll(resp.Body)
+	require.Equal(t, "hello world", string(respBody))
+	require.Equal(t, 1, requestTimes)
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/not-cached", nil)
+	resp, err = handler(req, handlerFunc)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.Nil(t, resp)
+}
+
+func TestClient_CacheBeforeHystrix(t *testing.T) {
+	requestTimes := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestTimes++
+		_, _ = w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	option := NewIsolatedHystrixOption()
+	circuitRuns := 0
+	option.HystrixContructor = func(req *http.Request, option HystrixOption) *circuit.Circuit {
+		circuitRuns++
+		return defaultHystrixContructor(req, option)
+	}
+	c := NewClient(WithHystrixOption(option), WithCacheOption(NewMemoryCacheOption()))
+
+	resp, err := c.Get(ts.URL + "/cached")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 1, requestTimes)
+	require.Equal(t, 1, circuitRuns)
+
+	// The cache hits never go through the circuit.
+	resp, err = c.Get(ts.URL + "/cached")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 1, requestTimes)
+	require.Equal(t, 1, circuitRuns)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	option.HystrixContructor(req, option).OpenCircuit()
+	circuitRuns = 0
+
+	resp, err = c.Get(ts.URL + "/cached")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "hello world", string(respBody))
+	require.Equal(t, 0, circuitRuns)
+
+	resp, err = c.Get(ts.URL + "/not-cached")
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.Nil(t, resp)
+	require.Equal(t, 1, requestTimes)
+	require.Equal(t, 1, circuitRuns)
+}
+
+func TestIsolatedHystrixOption(t *testing.T) {
+	option1 := NewIsolatedHystrixOption()
+	option2 := NewIsolatedHystrixOption()
+	require.True(t, option1.CircuitManager != defaultCircuitManager)
+	require.True(t, option1.CircuitManager != option2.CircuitManager)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://Example.com/path", nil)
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	// The open circuit of one option does not affect the other one.
+	option1.HystrixContructor(req, option1).OpenCircuit()
+	_, err := HystrixHandler(option1)(req, handlerFunc)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	resp, err := HystrixHandler(option2)(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+
+	// The options with the same manager share the circuits.
+	option3 := SharedHystrixOption(option1.CircuitManager)
+	_, err = HystrixHandler(option3)(req, handlerFunc)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+
+	require.True(t, option3.ResetCircuit("https://example.com"))
+	require.False(t, option3.ResetCircuit("https://not-exists.com"))
+	resp, err = HystrixHandler(option1)(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+
+	option1.HystrixContructor(req, option1).OpenCircuit()
+	option2.HystrixContructor(req, option2).OpenCircuit()
+	option1.ResetCircuits()
+	require.False(t, option1.HystrixContructor(req, option1).IsOpen())
+	require.True(t, option2.HystrixContructor(req, option2).IsOpen())
+
+	require.False(t, HystrixOption{}.ResetCircuit("https://example.com"))
+	HystrixOption{}.ResetCircuits()
+}
+
+func TestNewHystrixOption_Shared(t *testing.T) {
+	require.True(t, NewHystrixOption().CircuitManager == defaultCircuitManager)
+}
+
+func TestHystrixHandler_MaxConcurrentRequests(t *testing.T) {
+	option := NewIsolatedHystrixOption()
+	option.MaxConcurrentRequests = 2
+	handler := HystrixHandler(option)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		started <- struct{}{}
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/slow", nil)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := handler(req, handlerFunc)
+			errs <- err
+		}()
+		<-started
+	}
+
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrConcurrencyLimitReached))
+	require.False(t, errors.Is(err, ErrCircuitOpen))
+	require.Equal(t, "throttling connections to command: concurrencyReached=true circuitOpen=false", err.Error())
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		require.Nil(t, <-errs)
+	}
+
+	// The circuits of the options without the limit are unlimited.
+	unlimited := NewIsolatedHystrixOption()
+	require.Equal(t, int64(-1), unlimited.HystrixContructor(req, unlimited).Config().Execution.MaxConcurrentRequests)
+}
+
+func TestHystrixHandler_IsFailureFunc(t *testing.T) {
+	option := NewIsolatedHystrixOption()
+	option.CircuitManager = getTestCircuitManager()
+	option.IsFailureFunc = IsServerErrorFailure
+	handler := HystrixHandler(option)
+
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(bytes.NewBufferString("unavailable"))}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/failure", nil)
+	for i := 0; i < 20; i++ {
+		// The 503 response is returned, and the sentinel error does not leak.
+		resp, err := handler(req, handlerFunc)
+		require.Nilf(t, err, "#%d", i)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		require.Equal(t, "unavailable", string(body))
+	}
+
+	// The 503 responses count as failures and open the circuit.
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+
+	require.False(t, IsServerErrorFailure(&http.Response{StatusCode: http.StatusNotFound}, nil))
+	require.True(t, IsServerErrorFailure(nil, errors.New("error")))
+}
+
+func TestHystrixOption_IsOpen(t *testing.T) {
+	option := NewIsolatedHystrixOption()
+	require.False(t, option.IsOpen("example.com"))
+
+	req, _ := http.NewRequest(http.MethodGet, "https://Example.com/path", nil)
+	c := option.HystrixContructor(req, option)
+	require.False(t, option.IsOpen("https://example.com"))
+	require.False(t, option.IsOpen("example.com"))
+
+	c.OpenCircuit()
+	require.True(t, option.IsOpen("https://example.com"))
+	require.True(t, option.IsOpen("EXAMPLE.com"))
+	require.False(t, option.IsOpen("http://example.com"))
+	require.False(t, option.IsOpen("other.com"))
+
+	require.True(t, option.ResetCircuit("https://example.com"))
+	require.False(t, option.IsOpen("example.com"))
+
+	require.False(t, HystrixOption{}.IsOpen("example.com"))
+}
+
+func TestHystrixOption_Stats(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/ok": func(w http.ResponseWriter, r *http.Request) {},
+		"/fail": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	})
+	option := NewIsolatedHystrixOption()
+	option.IsFailureFunc = IsServerErrorFailure
+	require.Empty(t, option.Stats())
+
+	c := NewClient(WithHystrixOption(option))
+	for _, path := range []string{"/ok", "/ok", "/ok", "/fail"} {
+		resp, err := c.Get(ts.URL(path))
+		require.Nil(t, err)
+		resp.Body.Close()
+	}
+
+	name := strings.ToLower(ts.URL())
+	stats := option.Stats()
+	require.Len(t, stats, 1)
+	require.Equal(t, CircuitStats{RequestVolume: 4, Errors: 1, ErrorRate: 0.25}, stats[name])
+
+	option.CircuitManager.GetCircuit(name).OpenCircuit()
+	require.True(t, option.Stats()[name].Open)
+
+	// The circuits of a manager without the rolling stats only report their states.
+	manager := &circuit.Manager{}
+	_, err := manager.CreateCircuit("https://example.com")
+	require.Nil(t, err)
+	require.Equal(t, map[string]CircuitStats{"https://example.com": {}}, SharedHystrixOption(manager).Stats())
+
+	require.Empty(t, HystrixOption{}.Stats())
+
+	// The stats are taken at the time of the clock of the client.
+	start := time.Now()
+	clock := NewFakeClock(start)
+	c = NewClient(WithHystrixOption(NewIsolatedHystrixOption()), WithClock(clock))
+	resp, err := c.Get(ts.URL("/ok"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	clock.Advance(time.Since(start))
+	require.Equal(t, int64(1), c.hystrixOption.Stats()[name].RequestVolume)
+	clock.Advance(time.Minute)
+	require.Zero(t, c.hystrixOption.Stats()[name].RequestVolume)
+}
@@ -0,0 +1,78 @@
+package gohttpclient
+
+import (
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+)
+
+// LoadBalancer picks the upstream of each request of a MultiClient, see WithLoadBalancer.
+type LoadBalancer interface {
+	// Pick returns one of the candidates, which are the indexes of the base URLs of the MultiClient
+	// whose circuits are not open, in the order of the base URLs. It is never called with no candidates.
+	Pick(req *http.Request, candidates []int) int
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// RoundRobin creates a LoadBalancer that picks the candidates in turn.
+func RoundRobin() LoadBalancer {
+	return &roundRobin{}
+}
+
+func (r *roundRobin) Pick(req *http.Request, candidates []int) int {
+	n := atomic.AddUint64(&r.next, 1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+type random struct{}
+
+// Random creates a LoadBalancer that picks a random candidate.
+func Random() LoadBalancer {
+	return random{}
+}
+
+func (random) Pick(req *http.Request, candidates []int) int {
+	return candidates[rand.Intn(len(candidates))]
+}
+
+type weightedRandom struct {
+	weights []int
+}
+
+// WeightedRandom creates a LoadBalancer that picks a random candidate in proportion to its weight,
+// the weights are in the order of the base URLs, and a base URL without a weight has the weight 1.
+// A base URL of the weight 0 is only picked when all the candidates have the weight 0.
+func WeightedRandom(weights ...int) LoadBalancer {
+	return weightedRandom{weights: weights}
+}
+
+func (w weightedRandom) weight(i int) int {
+	if i >= len(w.weights) {
+		return 1
+	}
+	if w.weights[i] < 0 {
+		return 0
+	}
+	return w.weights[i]
+}
+
+func (w weightedRandom) Pick(req *http.Request, candidates []int) int {
+	total := 0
+	for _, i := range candidates {
+		total += w.weight(i)
+	}
+	if total == 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+	n := rand.Intn(total)
+	for _, i := range candidates {
+		n -= w.weight(i)
+		if n < 0 {
+			return i
+		}
+	}
+	return candidates[len(candidates)-1]
+}
@@ -0,0 +1,79 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundRobin(t *testing.T) {
+	lb := RoundRobin()
+	var picks []int
+	for i := 0; i < 6; i++ {
+		picks = append(picks, lb.Pick(nil, []int{0, 2, 3}))
+	}
+	require.Equal(t, []int{0, 2, 3, 0, 2, 3}, picks)
+}
+
+func TestRandom(t *testing.T) {
+	lb := Random()
+	counts := map[int]int{}
+	for i := 0; i < 1000; i++ {
+		counts[lb.Pick(nil, []int{1, 2})]++
+	}
+	require.Len(t, counts, 2)
+	require.Greater(t, counts[1], 300)
+	require.Greater(t, counts[2], 300)
+}
+
+func TestWeightedRandom(t *testing.T) {
+	lb := WeightedRandom(3, 1, 0)
+	counts := map[int]int{}
+	for i := 0; i < 4000; i++ {
+		counts[lb.Pick(nil, []int{0, 1, 2})]++
+	}
+	require.Zero(t, counts[2])
+	require.InDelta(t, 3000, counts[0], 300)
+	require.InDelta(t, 1000, counts[1], 300)
+
+	// The candidates of the weight 0 are picked when all of them are.
+	require.Equal(t, 2, lb.Pick(nil, []int{2}))
+	// A base URL without a weight has the weight 1.
+	require.Equal(t, 3, lb.Pick(nil, []int{2, 3}))
+}
+
+func TestMultiClient_LoadBalancer(t *testing.T) {
+	counts := make([]int, 3)
+	var baseURLs []string
+	for i := range counts {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counts[i]++
+		}))
+		defer ts.Close()
+		baseURLs = append(baseURLs, ts.URL)
+	}
+
+	option := NewIsolatedHystrixOption()
+	m, err := NewMultiClient(baseURLs, WithLoadBalancer(RoundRobin()), WithHystrixOption(option))
+	require.Nil(t, err)
+	for i := 0; i < 6; i++ {
+		resp, err := m.Get("/ping")
+		require.Nil(t, err)
+		resp.Body.Close()
+	}
+	require.Equal(t, []int{2, 2, 2}, counts)
+
+	// The upstream whose circuit is open is excluded.
+	u, _ := url.Parse(baseURLs[1])
+	option.HystrixContructor(&http.Request{URL: u}, option).OpenCircuit()
+	for i := 0; i < 4; i++ {
+		resp, err := m.Get("/ping")
+		require.Nil(t, err)
+		resp.Body.Close()
+	}
+	require.Equal(t, []int{4, 2, 4}, counts)
+}
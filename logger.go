@@ -2,11 +2,15 @@ package gohttpclient
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"io"
 	"net/http"
+	"sync"
 	"time"
+	"unicode/utf8"
 
-	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,16 +23,74 @@ var (
 type LoggerFunc func(req *http.Request, e LoggerEntry, option LoggerOption)
 
 var defaultLoggerFunc LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+	requestBody, requestBodyEncoded := option.BinaryBodyEncoding.encode(e.RequestBody)
+	responseBody, responseBodyEncoded := option.BinaryBodyEncoding.encode(e.ResponseBody)
 	fields := logrus.Fields{
 		"method":         e.Method,
 		"url":            e.URL,
 		"requestHeader":  copyHTTPHeader(e.RequestHeader),
-		"requestBody":    string(e.RequestBody),
+		"requestBody":    requestBody,
 		"responseHeader": copyHTTPHeader(e.ResponseHeader),
-		"responseBody":   string(e.ResponseBody),
+		"responseBody":   responseBody,
 		"statusCode":     e.StatusCode,
+		"fingerprint":    string(e.Fingerprint),
 		"executeTime":    e.ExecuteTime.String(),
 		"executeTimeMs":  e.ExecuteTime.Milliseconds(),
+		"wallTime":       e.WallTime.String(),
+		"wallTimeMs":     e.WallTime.Milliseconds(),
+		"upstreamTime":   e.UpstreamTime.String(),
+		"upstreamTimeMs": e.UpstreamTime.Milliseconds(),
+		"attempts":       e.Attempts,
+	}
+	if requestBodyEncoded {
+		fields["requestBodyEncoding"] = option.BinaryBodyEncoding.String()
+	}
+	if responseBodyEncoded {
+		fields["responseBodyEncoding"] = option.BinaryBodyEncoding.String()
+	}
+	if e.Timings != nil {
+		fields["dnsTime"] = e.Timings.DNS.String()
+		fields["connectTime"] = e.Timings.Connect.String()
+		fields["tlsHandshakeTime"] = e.Timings.TLSHandshake.String()
+		fields["firstByteTime"] = e.Timings.FirstByte.String()
+	}
+	if e.RemoteAddr != "" {
+		fields["remoteAddr"] = e.RemoteAddr
+	}
+	if e.ExpectContinue {
+		fields["continueGranted"] = e.ContinueGranted
+	}
+	if option.isSlowMode() && !e.Slow {
+		fields = logrus.Fields{
+			"method":        e.Method,
+			"url":           e.URL,
+			"statusCode":    e.StatusCode,
+			"executeTime":   e.ExecuteTime.String(),
+			"executeTimeMs": e.ExecuteTime.Milliseconds(),
+		}
+	} else if option.isSlowMode() {
+		fields["slow"] = true
+	}
+	if e.FromCache {
+		fields["fromCache"] = true
+	}
+	if e.FromCircuitBreaker {
+		fields["fromCircuitBreaker"] = true
+	}
+	if e.RetriesExhausted {
+		fields["retriesExhausted"] = true
+	}
+	if e.FaultInjected {
+		fields["faultInjected"] = true
+	}
+	if e.ErrorCategory != ErrorCategoryNone {
+		fields["errorCategory"] = e.ErrorCategory.String()
+	}
+	if e.PolicyDenied {
+		fields["policyDenied"] = true
+		fields["policyError"] = e.PolicyError.Error()
+		option.Logger.WithFields(fields).Warn(option.LogMessage)
+		return
 	}
 	if e.StatusCode < 400 {
 		option.Logger.WithFields(fields).Info(option.LogMessage)
@@ -44,8 +106,79 @@ type LoggerOption struct {
 	LogRequestBody    bool
 	LogResponseHeader bool
 	LogResponseBody   bool
+	LogFingerprint    bool
 	Logger            *logrus.Entry
 	LoggerFunc        LoggerFunc
+	// MaxHeaderBytes truncates the recorded request and response headers to at most this number of bytes,
+	// 0 means no limit.
+	MaxHeaderBytes int
+	// Clock is the source of time for the execution time, RealClock is used when it is nil.
+	Clock Clock
+	// SkipFunc reports whether a request is not logged, such as a health check,
+	// the bodies of the skipped requests are not copied either. All the requests are logged when it is nil.
+	SkipFunc func(req *http.Request) bool
+	// SlowThreshold turns on the slow request mode, in which only the requests slower than it are logged
+	// with the headers and the bodies, and the others get a terse line without them.
+	SlowThreshold time.Duration
+	// SlowPercentile, such as 0.99, also turns on the slow request mode, the requests slower than the estimate
+	// of the percentile of the execute time of their host are slow. The estimate needs 5 requests to start.
+	SlowPercentile float64
+	// BinaryBodyEncoding is the encoding of the logged bodies that are not valid UTF-8 by the default LoggerFunc,
+	// the encoded bodies are flagged by the requestBodyEncoding and responseBodyEncoding fields.
+	BinaryBodyEncoding BinaryBodyEncoding
+}
+
+// BinaryBodyEncoding is the encoding of a logged body that is not valid UTF-8.
+type BinaryBodyEncoding int
+
+const (
+	// BinaryBodyEncodingNone logs the bodies as they are.
+	BinaryBodyEncodingNone BinaryBodyEncoding = iota
+	// BinaryBodyEncodingBase64 logs the bodies in the standard base64 encoding.
+	BinaryBodyEncodingBase64
+	// BinaryBodyEncodingHex logs the bodies in the hexadecimal encoding.
+	BinaryBodyEncodingHex
+)
+
+func (e BinaryBodyEncoding) String() string {
+	switch e {
+	case BinaryBodyEncodingNone:
+		return "none"
+	case BinaryBodyEncodingBase64:
+		return "base64"
+	case BinaryBodyEncodingHex:
+		return "hex"
+	}
+	return "unknown"
+}
+
+// encode returns the body to be logged, and whether it is encoded because it is not valid UTF-8.
+func (e BinaryBodyEncoding) encode(body []byte) (string, bool) {
+	if utf8.Valid(body) {
+		return string(body), false
+	}
+	switch e {
+	case BinaryBodyEncodingBase64:
+		return base64.StdEncoding.EncodeToString(body), true
+	case BinaryBodyEncodingHex:
+		return hex.EncodeToString(body), true
+	}
+	return string(body), false
+}
+
+func (o LoggerOption) isSlowMode() bool {
+	return o.SlowThreshold > 0 || (o.SlowPercentile > 0 && o.SlowPercentile < 1)
+}
+
+// LoggerSkipPaths returns a LoggerOption.SkipFunc that skips the requests whose URL path is one of the paths.
+func LoggerSkipPaths(paths ...string) func(req *http.Request) bool {
+	skip := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		skip[p] = true
+	}
+	return func(req *http.Request) bool {
+		return req != nil && req.URL != nil && skip[req.URL.Path]
+	}
 }
 
 // HTTPHeader holds HTTP request and response headers.
@@ -62,20 +195,66 @@ type LoggerEntry struct {
 	StatusCode     int
 	ExecuteTime    time.Duration
 	StartTime      time.Time
+	// Fingerprint is the stable hash value of the request generated by RequestFingerprint.
+	Fingerprint []byte
+	// WallTime is the same as ExecuteTime, the total time including rate limit waits, retry sleeps and other interceptors.
+	WallTime time.Duration
+	// UpstreamTime is the sum of the time spent by all attempts in the innermost request,
+	// and LastUpstreamTime is the time spent by the last attempt.
+	UpstreamTime     time.Duration
+	LastUpstreamTime time.Duration
+	// Attempts is the number of attempts that reached the innermost request, 0 for a cached response.
+	Attempts int
+	// Timings is the timing breakdown of the request, it is only set by WithClientTimings.
+	Timings *ClientTimings
+	// Slow reports whether the request is slow in the slow request mode, see LoggerOption.SlowThreshold,
+	// the headers and the bodies of the requests that are not slow are not recorded in this mode.
+	Slow bool
+	// PolicyDenied reports whether the request is denied by the policy of WithRequestPolicy and is not sent,
+	// and PolicyError is the error of the policy.
+	PolicyDenied bool
+	PolicyError  error
+	// ExpectContinue reports whether the request was sent with Expect: 100-continue by WithExpectContinue,
+	// and ContinueGranted whether the server granted the continue of the last attempt.
+	ExpectContinue  bool
+	ContinueGranted bool
+	// RemoteAddr is the remote address of the connection of the last attempt, recorded by WithConnectionEvents.
+	RemoteAddr string
+	// FromCache reports whether the response was served from the cache, including the stale response
+	// served by the fallback of the circuit breaker, and the upstream did not receive the request.
+	FromCache bool
+	// FromCircuitBreaker reports whether the request was rejected, or served by the fallback,
+	// by the circuit breaker because the circuit is open.
+	FromCircuitBreaker bool
+	// RetriesExhausted reports whether the retries gave up on a failed attempt, because of MaxRetry,
+	// the back off or the retry deadline.
+	RetriesExhausted bool
+	// FaultInjected reports whether a fault was injected into the request by WithFaultInjection,
+	// a delay, an error or a rewritten status code.
+	FaultInjected bool
+	// Error is the error of the request, nil when it got a response.
+	Error error
+	// ErrorCategory is the category of the failure of the request by ClassifyError,
+	// which tells a failed transport apart from an error status.
+	ErrorCategory ErrorCategory
 }
 
 // NewLoggerOption creates a log option configuration.
 // By default it will record the request body and the response body,
 // which will have a certain performance loss, you can choose to turn it off.
+// The bodies of streaming requests are never recorded, see MarkStreaming.
+// The bodies that are not valid UTF-8 are logged in base64.
+// The fingerprint of the request is not recorded by default, see RequestFingerprint.
 func NewLoggerOption() LoggerOption {
 	return LoggerOption{
-		LogRequestHeader:  true,
-		LogRequestBody:    true,
-		LogResponseHeader: true,
-		LogResponseBody:   true,
-		LogMessage:        defaultLogMessage,
-		Logger:            defaultLogger,
-		LoggerFunc:        defaultLoggerFunc,
+		LogRequestHeader:   true,
+		LogRequestBody:     true,
+		LogResponseHeader:  true,
+		LogResponseBody:    true,
+		LogMessage:         defaultLogMessage,
+		Logger:             defaultLogger,
+		LoggerFunc:         defaultLoggerFunc,
+		BinaryBodyEncoding: BinaryBodyEncodingBase64,
 	}
 }
 
@@ -85,39 +264,86 @@ func (o LoggerOption) isEnabled() bool {
 
 // LoggerHandler implements a logging interceptor that logs the request context.
 func LoggerHandler(option LoggerOption) RequestHandler {
+	slowLog := newSlowLog(option)
 	return func(req *http.Request, handlerFunc RequestHandlerFunc) (resp *http.Response, err error) {
-		startTime := time.Now()
+		if option.SkipFunc != nil && option.SkipFunc(req) {
+			return handlerFunc(req)
+		}
+
+		var fingerprint []byte
+		if option.LogFingerprint && req != nil && req.URL != nil {
+			var fingerprintErr error
+			fingerprint, fingerprintErr = RequestFingerprint(req)
+			if fingerprintErr != nil {
+				logrus.WithError(fingerprintErr).Warn("gohttpclient build request fingerprint")
+			}
+		}
+
+		upstream := &upstreamRecorder{clock: option.Clock}
+		source := &responseSource{}
+		if req != nil {
+			ctx := context.WithValue(req.Context(), upstreamContextKey, upstream)
+			req = req.WithContext(context.WithValue(ctx, responseSourceContextKey, source))
+		}
+
+		startTime := getClock(option.Clock).Now()
 		resp, err = handlerFunc(req)
 
-		entry, loggerErr := getLoggerEntry(req, resp, option, startTime)
+		entryOption, slow := option, false
+		if slowLog != nil {
+			slow = slowLog.observe(req, getClock(option.Clock).Now().Sub(startTime))
+			if !slow {
+				entryOption.LogRequestHeader, entryOption.LogRequestBody = false, false
+				entryOption.LogResponseHeader, entryOption.LogResponseBody = false, false
+			}
+		}
+		entry, loggerErr := BuildLoggerEntry(req, resp, entryOption, startTime)
 		if loggerErr != nil {
 			logrus.WithError(loggerErr).Warn("gohttpclient build logger entry")
 			return
 		}
+		entry.Slow = slow
+		entry.Fingerprint = fingerprint
+		entry.UpstreamTime, entry.LastUpstreamTime, entry.Attempts = upstream.get()
+		entry.FromCache, entry.FromCircuitBreaker, entry.RetriesExhausted, entry.FaultInjected = source.get()
+		entry.Error = err
+		entry.ErrorCategory = ClassifyError(resp, err)
 
+		if option.LoggerFunc == nil {
+			defaultLoggerFunc(req, entry, option)
+			return
+		}
 		option.LoggerFunc(req, entry, option)
 		return
 	}
 }
 
-func getLoggerEntry(req *http.Request, resp *http.Response, option LoggerOption, startTime time.Time) (entry LoggerEntry, err error) {
-	if req == nil {
-		err = errors.New("http.Request is nil")
-		return
-	}
-
+// BuildLoggerEntry builds the entry of the request and the response for a LoggerFunc, such as in a custom handler,
+// the ExecuteTime is the time since startTime, and the headers and the bodies are recorded as the option sets,
+// the bodies are read and restored. The fields of the whole call, such as Attempts and FromCache,
+// are only set by LoggerHandler. The entry of a nil request only has the response,
+// and the URL of a request with a nil URL is empty.
+func BuildLoggerEntry(req *http.Request, resp *http.Response, option LoggerOption, startTime time.Time) (entry LoggerEntry, err error) {
 	entry = LoggerEntry{
-		Method:      req.Method,
-		URL:         req.URL.String(),
 		StartTime:   startTime,
-		ExecuteTime: time.Now().Sub(startTime),
+		ExecuteTime: getClock(option.Clock).Now().Sub(startTime),
 	}
+	entry.WallTime = entry.ExecuteTime
 
-	if option.LogRequestHeader {
-		entry.RequestHeader = req.Header
+	if req != nil {
+		entry.Method = req.Method
+		if req.URL != nil {
+			entry.URL = req.URL.String()
+		}
+	}
+
+	if option.LogRequestHeader && req != nil {
+		entry.RequestHeader = truncateHTTPHeader(req.Header, option.MaxHeaderBytes)
 	}
 
-	if option.LogRequestBody && req != nil && req.Body != nil {
+	streaming := isStreamingRequest(req)
+
+	if option.LogRequestBody && !streaming && req != nil && req.Body != nil {
 		entry.RequestBody, err = copyHTTPRequestBody(req)
 		if err != nil {
 			return
@@ -125,10 +351,10 @@ func getLoggerEntry(req *http.Request, resp *http.Response, option LoggerOption,
 	}
 
 	if option.LogResponseHeader && resp != nil {
-		entry.ResponseHeader = resp.Header
+		entry.ResponseHeader = truncateHTTPHeader(resp.Header, option.MaxHeaderBytes)
 	}
 
-	if option.LogResponseBody && resp != nil && resp.Body != nil {
+	if option.LogResponseBody && !streaming && resp != nil && resp.Body != nil {
 		entry.ResponseBody, err = copyHTTPResponseBody(resp)
 		if err != nil {
 			return
@@ -139,9 +365,116 @@ func getLoggerEntry(req *http.Request, resp *http.Response, option LoggerOption,
 		entry.StatusCode = resp.StatusCode
 	}
 
+	if timings, ok := ClientTimingsFromContext(getRequestContext(req)); ok {
+		entry.Timings = &timings
+	}
+
+	if addr, ok := RemoteAddrFromContext(getRequestContext(req)); ok {
+		entry.RemoteAddr = addr
+	}
+
+	if state := getExpectContinueState(req); state != nil {
+		entry.ExpectContinue = true
+		entry.ContinueGranted = state.continueGranted()
+	}
+
 	return entry, nil
 }
 
+// upstreamRecorder records the time spent by each attempt in the innermost request.
+type upstreamRecorder struct {
+	clock    Clock
+	mu       sync.Mutex
+	sum      time.Duration
+	last     time.Duration
+	attempts int
+}
+
+func (u *upstreamRecorder) add(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.sum += d
+	u.last = d
+	u.attempts++
+}
+
+func (u *upstreamRecorder) get() (sum, last time.Duration, attempts int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.sum, u.last, u.attempts
+}
+
+// responseSource records where the response of a request came from for LoggerEntry,
+// it is marked by the interceptors inside the logger, and its methods do nothing on a nil one.
+type responseSource struct {
+	mu                 sync.Mutex
+	fromCache          bool
+	fromCircuitBreaker bool
+	retriesExhausted   bool
+	faultInjected      bool
+}
+
+// getResponseSource returns the response source of the logger of the request, or nil without a logger.
+func getResponseSource(req *http.Request) *responseSource {
+	s, _ := getRequestContext(req).Value(responseSourceContextKey).(*responseSource)
+	return s
+}
+
+func (s *responseSource) markFromCache() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fromCache = true
+}
+
+func (s *responseSource) markFromCircuitBreaker() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fromCircuitBreaker = true
+}
+
+func (s *responseSource) markRetriesExhausted() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retriesExhausted = true
+}
+
+func (s *responseSource) markFaultInjected() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faultInjected = true
+}
+
+func (s *responseSource) get() (fromCache, fromCircuitBreaker, retriesExhausted, faultInjected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fromCache, s.fromCircuitBreaker, s.retriesExhausted, s.faultInjected
+}
+
+// upstreamTimingHandler is placed innermost to measure the time of each attempt for LoggerEntry.UpstreamTime.
+func upstreamTimingHandler(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+	upstream, ok := getRequestContext(req).Value(upstreamContextKey).(*upstreamRecorder)
+	if !ok {
+		return handlerFunc(req)
+	}
+	clock := getClock(upstream.clock)
+	startTime := clock.Now()
+	resp, err := handlerFunc(req)
+	upstream.add(clock.Now().Sub(startTime))
+	return resp, err
+}
+
 func copyHTTPRequestBody(req *http.Request) ([]byte, error) {
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
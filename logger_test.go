@@ -8,7 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -82,7 +85,290 @@ func TestDefaultLoggerFunc(t *testing.T) {
 	}
 	url := "https://example.com"
 	req, _ := http.NewRequest(http.MethodPost, url, nil)
-	entry, err := getLoggerEntry(req, resp, option, time.Now())
+	entry, err := BuildLoggerEntry(req, resp, option, time.Now())
 	require.Nil(t, err)
 	defaultLoggerFunc(req, entry, option)
 }
+
+func TestDefaultLoggerFunc_BinaryBody(t *testing.T) {
+	body := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+	tests := []struct {
+		encoding     BinaryBodyEncoding
+		responseBody string
+		flag         interface{}
+	}{
+		{BinaryBodyEncodingBase64, "iVBOR/8A", "base64"},
+		{BinaryBodyEncodingHex, "89504e47ff00", "hex"},
+		{BinaryBodyEncodingNone, string(body), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding.String(), func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			option := NewLoggerOption()
+			option.Logger = logrus.NewEntry(logger)
+			option.BinaryBodyEncoding = tt.encoding
+			resp := &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader(body))}
+			req, _ := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader("name=café"))
+			entry, err := BuildLoggerEntry(req, resp, option, time.Now())
+			require.Nil(t, err)
+			defaultLoggerFunc(req, entry, option)
+
+			data := hook.LastEntry().Data
+			require.Equal(t, tt.responseBody, data["responseBody"])
+			require.Equal(t, tt.flag, data["responseBodyEncoding"])
+			// The UTF-8 bodies and the numeric fields are logged as they are.
+			require.Equal(t, "name=café", data["requestBody"])
+			require.Nil(t, data["requestBodyEncoding"])
+			require.Equal(t, 200, data["statusCode"])
+			require.IsType(t, int64(0), data["executeTimeMs"])
+		})
+	}
+}
+
+func TestLoggerRequestHander_Fingerprint(t *testing.T) {
+	var entries []LoggerEntry
+	option := NewLoggerOption()
+	option.LogFingerprint = true
+	option.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entries = append(entries, e)
+	}
+	handler := LoggerHandler(option)
+
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/fingerprint", nil)
+		_, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+	}
+	for _, body := range []string{"foo=bar", "foo=bar", "foo=bar2"} {
+		req, _ := http.NewRequest(http.MethodPost, "https://example.com/fingerprint", strings.NewReader(body))
+		_, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+	}
+
+	require.Len(t, entries, 5)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/fingerprint", nil)
+	require.Equal(t, DefaultRequestHashFunc(req, nil, nil), entries[0].Fingerprint)
+	require.Equal(t, entries[0].Fingerprint, entries[1].Fingerprint)
+	require.Equal(t, entries[2].Fingerprint, entries[3].Fingerprint)
+	require.NotEqual(t, entries[0].Fingerprint, entries[2].Fingerprint)
+	require.NotEqual(t, entries[3].Fingerprint, entries[4].Fingerprint)
+	require.Equal(t, "foo=bar", string(entries[2].RequestBody))
+}
+
+func TestLoggerRequestHander_FingerprintClosesBody(t *testing.T) {
+	server := NewTestServer(t, map[string]http.HandlerFunc{
+		"/fingerprint": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusOK)
+		},
+	})
+
+	var entries []LoggerEntry
+	option := NewLoggerOption()
+	option.LogFingerprint = true
+	option.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entries = append(entries, e)
+	}
+	client := NewClient(WithLoggerOption(option))
+	defer client.CloseQueue()
+
+	body := &testTrackingBody{Reader: strings.NewReader("foo=bar")}
+	req, err := http.NewRequest(http.MethodPost, server.URL("/fingerprint"), body)
+	require.Nil(t, err)
+	resp, err := client.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	require.True(t, body.closed)
+	require.Equal(t, body, req.Body)
+	require.Len(t, entries, 1)
+	require.NotEmpty(t, entries[0].Fingerprint)
+}
+
+func TestLoggerRequestHander_UpstreamTime(t *testing.T) {
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	rateLimitOption := NewRateLimitOption(10)
+	rateLimitOption.RateLimitFunc = func(req *http.Request, option RateLimitOption) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		time.Sleep(10 * time.Millisecond)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithLoggerOption(loggerOption),
+		WithRateLimitOption(rateLimitOption),
+	)
+	resp, err := c.Get("https://example.com")
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+
+	require.Equal(t, 1, entry.Attempts)
+	require.Equal(t, entry.ExecuteTime, entry.WallTime)
+	require.True(t, entry.WallTime >= 60*time.Millisecond)
+	require.True(t, entry.UpstreamTime >= 10*time.Millisecond)
+	require.True(t, entry.UpstreamTime < 50*time.Millisecond)
+	require.Equal(t, entry.UpstreamTime, entry.LastUpstreamTime)
+}
+
+func TestLoggerRequestHander_SkipPaths(t *testing.T) {
+	var logged []string
+	option := NewLoggerOption()
+	option.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		logged = append(logged, e.URL)
+	}
+	option.SkipFunc = LoggerSkipPaths("/healthz", "/metrics")
+	handler := LoggerHandler(option)
+
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		return &http.Response{StatusCode: 200, Body: &testTrackingBody{Reader: strings.NewReader("ok")}}, nil
+	}
+
+	for _, url := range []string{"https://example.com/healthz", "https://example.com/metrics", "https://example.com/api"} {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		// The bodies of the skipped requests are not copied.
+		_, copied := resp.Body.(*testTrackingBody)
+		require.Equal(t, url != "https://example.com/api", copied)
+	}
+	require.Equal(t, []string{"https://example.com/api"}, logged)
+
+	c := NewClient(WithLoggerOption(NewLoggerOption()), WithLoggerSkipPaths("/healthz"))
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/healthz", nil)
+	require.True(t, c.loggerOption.SkipFunc(req))
+	require.False(t, LoggerSkipPaths("/healthz")(nil))
+
+	// WithLoggerOption applied later keeps the skip paths, and its own SkipFunc.
+	option = NewLoggerOption()
+	option.SkipFunc = LoggerSkipPaths("/metrics")
+	c = NewClient(WithLoggerSkipPaths("/healthz"), WithLoggerOption(option))
+	for _, url := range []string{"https://example.com/healthz", "https://example.com/metrics", "https://example.com/api"} {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		require.Equal(t, url != "https://example.com/api", c.loggerOption.SkipFunc(req))
+	}
+}
+
+func TestLoggerHandler_NilURL(t *testing.T) {
+	var entries []LoggerEntry
+	option := NewLoggerOption()
+	option.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entries = append(entries, e)
+	}
+	handler := LoggerHandler(option)
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	req := &http.Request{Method: http.MethodGet, Header: http.Header{}}
+	require.NotPanics(t, func() {
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	require.Len(t, entries, 1)
+	require.Equal(t, http.MethodGet, entries[0].Method)
+	require.Equal(t, "", entries[0].URL)
+	require.Equal(t, []byte("hello world"), entries[0].ResponseBody)
+
+	require.NotPanics(t, func() {
+		_, err := handler(nil, handlerFunc)
+		require.Nil(t, err)
+	})
+	require.Len(t, entries, 2)
+	require.Equal(t, "", entries[1].Method)
+	require.Equal(t, http.StatusOK, entries[1].StatusCode)
+
+	require.NotPanics(t, func() {
+		entry, err := BuildLoggerEntry(req, nil, NewLoggerOption(), time.Now())
+		require.Nil(t, err)
+		defaultLoggerFunc(req, entry, NewLoggerOption())
+	})
+}
+
+func TestLoggerRequestHander_ResponseSource(t *testing.T) {
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	status := http.StatusOK
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("ok")), Request: req}, nil
+	})
+	cacheOption := NewMemoryCacheOption()
+	cacheOption.CacheStatusHeader = true
+	hystrixOption := NewIsolatedHystrixOption()
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithLoggerOption(loggerOption),
+		WithCacheOption(cacheOption),
+		WithHystrixOption(hystrixOption),
+	)
+
+	resp, err := c.Get("https://example.com/cached")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.False(t, entry.FromCache)
+	require.Empty(t, resp.Header.Get(CacheStatusHeader))
+	require.Equal(t, 1, entry.Attempts)
+
+	resp, err = c.Get("https://example.com/cached")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.True(t, entry.FromCache)
+	require.False(t, entry.FromCircuitBreaker)
+	require.Equal(t, "HIT", resp.Header.Get(CacheStatusHeader))
+	require.Equal(t, 0, entry.Attempts)
+
+	// The circuit rejects the requests while it is open.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/other", nil)
+	hystrixOption.HystrixContructor(req, hystrixOption).OpenCircuit()
+	_, err = c.Get("https://example.com/other")
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+	require.True(t, entry.FromCircuitBreaker)
+	require.False(t, entry.FromCache)
+	require.False(t, entry.RetriesExhausted)
+}
+
+func TestLoggerRequestHander_RetriesExhausted(t *testing.T) {
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	status := http.StatusServiceUnavailable
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	})
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithLoggerOption(loggerOption),
+		WithMaxRetry(2),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+	)
+
+	resp, err := c.Get("https://example.com")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 3, entry.Attempts)
+	require.True(t, entry.RetriesExhausted)
+
+	status = http.StatusOK
+	resp, err = c.Get("https://example.com")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.False(t, entry.RetriesExhausted)
+}
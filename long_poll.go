@@ -0,0 +1,123 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+)
+
+// LongPollOption configures Client.LongPoll.
+type LongPollOption func(o *longPollOptions)
+
+type longPollOptions struct {
+	backOff       backoff.BackOff
+	maxIterations int
+}
+
+// WithLongPollBackOff sets the back off between the iterations of LongPoll after the failed ones,
+// LongPoll returns the last error when it stops. The default is an exponential back off that never stops.
+func WithLongPollBackOff(b backoff.BackOff) LongPollOption {
+	return func(o *longPollOptions) {
+		o.backOff = b
+	}
+}
+
+// WithLongPollMaxIterations caps the number of requests issued by LongPoll, 0 means no limit.
+func WithLongPollMaxIterations(n int) LongPollOption {
+	return func(o *longPollOptions) {
+		o.maxIterations = n
+	}
+}
+
+// LongPoll issues the request again and again through the whole chain of the client, such as an endpoint
+// that holds the connection until it has data or answers 204, and calls onResponse with each response,
+// whose body is closed after onResponse returns.
+//
+// The request is issued again immediately when onResponse returns true without an error,
+// and after the back off of WithLongPollBackOff when the request fails or onResponse returns true with an error.
+// It stops when onResponse returns false, with its error, when the back off stops, with the last error,
+// when WithLongPollMaxIterations is reached, with the error of the last iteration, and when ctx is done,
+// with the error of ctx, which cancels the request in flight too.
+// The body of the request is sent by each iteration, it is rewound by GetBody, or read into memory without it.
+func (c *Client) LongPoll(ctx context.Context, req *http.Request, onResponse func(*http.Response) (continuePolling bool, err error), opts ...LongPollOption) error {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0
+	o := longPollOptions{backOff: b}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	getBody := req.GetBody
+	if getBody == nil && req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return errors.Wrap(err, "Read the request body")
+		}
+		getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	o.backOff.Reset()
+	var lastErr error
+	for i := 0; o.maxIterations <= 0 || i < o.maxIterations; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		continuePolling, err := c.longPollOnce(ctx, req, getBody, onResponse)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !continuePolling {
+			return err
+		}
+		lastErr = err
+		if err == nil {
+			o.backOff.Reset()
+			continue
+		}
+		if i+1 == o.maxIterations {
+			break
+		}
+
+		wait := o.backOff.NextBackOff()
+		if wait == backoff.Stop {
+			return err
+		}
+		if err := sleepContext(ctx, c.clock, wait); err != nil {
+			return err
+		}
+	}
+	return lastErr
+}
+
+// longPollOnce issues the request with a context of its own, which is canceled when the iteration is done,
+// and returns whether to continue polling, a failed request always continues.
+func (c *Client) longPollOnce(ctx context.Context, req *http.Request, getBody func() (io.ReadCloser, error),
+	onResponse func(*http.Response) (bool, error)) (bool, error) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	attempt := req.Clone(attemptCtx)
+	if getBody != nil {
+		body, err := getBody()
+		if err != nil {
+			return false, errors.Wrap(err, "Rewind the request body")
+		}
+		attempt.Body = body
+		attempt.GetBody = getBody
+	}
+
+	resp, err := c.Do(attempt)
+	if err != nil {
+		return true, err
+	}
+	defer closeResponse(resp)
+	return onResponse(resp)
+}
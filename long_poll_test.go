@@ -0,0 +1,124 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_LongPoll(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	n := 0
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/poll": func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			bodies = append(bodies, string(body))
+			n++
+			i := n
+			mu.Unlock()
+			if i%2 == 1 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			_, _ = w.Write([]byte{byte('a' + i/2 - 1)})
+		},
+	})
+	clock := &recordingClock{}
+	c := NewClient(WithClock(clock))
+
+	// The 204 responses are polled again immediately, and the body is sent by each iteration.
+	req, _ := http.NewRequest(http.MethodPost, ts.URL("/poll"), strings.NewReader("cursor=1"))
+	req.GetBody = nil
+	var data []string
+	err := c.LongPoll(context.Background(), req, func(resp *http.Response) (bool, error) {
+		if resp.StatusCode == http.StatusNoContent {
+			return true, nil
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		data = append(data, string(body))
+		return len(data) < 2, nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"a", "b"}, data)
+	require.Equal(t, []string{"cursor=1", "cursor=1", "cursor=1", "cursor=1"}, bodies)
+	require.Empty(t, clock.timers)
+}
+
+func TestClient_LongPollBackOff(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/unavailable": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	})
+	clock := &recordingClock{}
+	c := NewClient(WithClock(clock))
+	errUnavailable := errors.New("unavailable")
+	onResponse := func(resp *http.Response) (bool, error) {
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			return true, errUnavailable
+		}
+		return false, nil
+	}
+
+	// The failed iterations are backed off, and the error of the last one is returned at the cap.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL("/unavailable"), nil)
+	err := c.LongPoll(context.Background(), req, onResponse,
+		WithLongPollBackOff(backoff.NewConstantBackOff(time.Second)), WithLongPollMaxIterations(3))
+	require.Equal(t, errUnavailable, err)
+	require.Equal(t, 3, ts.RequestCount("/unavailable"))
+	require.Equal(t, []time.Duration{time.Second, time.Second}, clock.timers)
+
+	// The polling stops when the back off stops.
+	err = c.LongPoll(context.Background(), req, onResponse, WithLongPollBackOff(&backoff.StopBackOff{}))
+	require.Equal(t, errUnavailable, err)
+	require.Equal(t, 4, ts.RequestCount("/unavailable"))
+
+	// The failed requests are backed off too.
+	req, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1:1/", nil)
+	err = c.LongPoll(context.Background(), req, onResponse,
+		WithLongPollBackOff(backoff.NewConstantBackOff(time.Second)), WithLongPollMaxIterations(2))
+	require.NotNil(t, err)
+	require.Len(t, clock.timers, 3)
+}
+
+func TestClient_LongPollCancel(t *testing.T) {
+	received := make(chan struct{}, 1)
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/hold": func(w http.ResponseWriter, r *http.Request) {
+			received <- struct{}{}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+		},
+	})
+	c := NewClient()
+
+	// The request in flight is canceled with the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL("/hold"), nil)
+	start := time.Now()
+	err := c.LongPoll(ctx, req, func(resp *http.Response) (bool, error) {
+		return true, nil
+	})
+	require.Equal(t, context.Canceled, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Equal(t, 1, ts.RequestCount("/hold"))
+}
@@ -0,0 +1,124 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrResponseTimeout is returned by a request, or by the reads of its response body,
+// when the response is not received in full within the time of WithMaxResponseTime.
+var ErrResponseTimeout = errors.New("The response was not received in full within the max response time")
+
+// MaxResponseTimeOption defines the configuration of the cap on the time of receiving a whole response.
+type MaxResponseTimeOption struct {
+	// Timeout is the maximum time from sending the request to reading the last byte of the response body.
+	Timeout time.Duration
+	// Clock is the source of time for the cap, RealClock is used when it is nil.
+	Clock Clock
+}
+
+// NewMaxResponseTimeOption creates a max response time option configuration,
+// the response that is not received in full within timeout fails with ErrResponseTimeout.
+func NewMaxResponseTimeOption(timeout time.Duration) MaxResponseTimeOption {
+	return MaxResponseTimeOption{
+		Timeout: timeout,
+	}
+}
+
+func (o MaxResponseTimeOption) isEnabled() bool {
+	return o.Timeout > 0
+}
+
+// MaxResponseTimeHandler creates an interceptor that caps the wall-clock time of receiving the whole response,
+// from sending the request to the end of its body. When the time is up, the context of the request is canceled,
+// which aborts the request or the body in flight, and the request or the read fails with ErrResponseTimeout.
+// Unlike BodyReadTimeoutHandler, it cuts off a server that sends the headers quickly but dribbles the body forever,
+// and unlike WithRequestTimeout, the cap applies to each attempt, so a slow body is retried
+// when the body is read inside the retry loop by RetryOption.RetryOnBodyReadError.
+// The time the caller spends between the reads is counted.
+func MaxResponseTimeHandler(option MaxResponseTimeOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		ctx, cancel := context.WithCancel(req.Context())
+		deadline := &responseDeadline{cancel: cancel}
+		timer := getClock(option.Clock).NewTimer(option.Timeout)
+		go func() {
+			select {
+			case <-timer.C():
+				deadline.expire()
+			case <-ctx.Done():
+			}
+		}()
+		stop := func() {
+			timer.Stop()
+			cancel()
+		}
+
+		resp, err := handlerFunc(req.WithContext(ctx))
+		if err != nil {
+			stop()
+			if deadline.isExpired() {
+				err = ErrResponseTimeout
+			}
+			return resp, err
+		}
+		if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+			stop()
+			return resp, err
+		}
+		resp.Body = &responseDeadlineBody{rc: resp.Body, deadline: deadline, stop: stop}
+		return resp, err
+	}
+}
+
+// responseDeadline cancels the context of the request when the max response time is up.
+type responseDeadline struct {
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	expired bool
+}
+
+func (d *responseDeadline) expire() {
+	d.mu.Lock()
+	d.expired = true
+	d.mu.Unlock()
+	d.cancel()
+}
+
+func (d *responseDeadline) isExpired() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+// responseDeadlineBody fails the reads with ErrResponseTimeout once the max response time is up,
+// and stops the timer when the body is read to the end or closed.
+type responseDeadlineBody struct {
+	rc       io.ReadCloser
+	deadline *responseDeadline
+	stop     func()
+}
+
+func (b *responseDeadlineBody) Read(p []byte) (int, error) {
+	if b.deadline.isExpired() {
+		return 0, ErrResponseTimeout
+	}
+	n, err := b.rc.Read(p)
+	if err == io.EOF {
+		b.stop()
+	} else if err != nil && b.deadline.isExpired() {
+		return n, ErrResponseTimeout
+	}
+	return n, err
+}
+
+func (b *responseDeadlineBody) Close() error {
+	err := b.rc.Close()
+	b.stop()
+	return err
+}
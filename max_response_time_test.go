@@ -0,0 +1,132 @@
+package gohttpclient
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// dribble writes a byte of the body every interval until the request is canceled.
+func dribble(w http.ResponseWriter, r *http.Request, interval time.Duration) {
+	for {
+		_, _ = w.Write([]byte("."))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func TestMaxResponseTimeHandler(t *testing.T) {
+	stall := make(chan struct{})
+	ts := newStallingServer(stall)
+	defer ts.Close()
+	defer close(stall)
+
+	clock := NewFakeClock(time.Now())
+	option := NewMaxResponseTimeOption(time.Second)
+	option.Clock = clock
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	resp, err := MaxResponseTimeHandler(option)(req, http.DefaultClient.Do)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(resp.Body, buf)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(buf))
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := resp.Body.Read(buf)
+		errc <- err
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	require.Equal(t, ErrResponseTimeout, <-errc)
+
+	_, err = resp.Body.Read(buf)
+	require.Equal(t, ErrResponseTimeout, err)
+}
+
+func TestWithMaxResponseTime(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/dribble": func(w http.ResponseWriter, r *http.Request) {
+			dribble(w, r, 10*time.Millisecond)
+		},
+		"/slow-headers": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		},
+		"/ok": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		},
+	})
+	// The body that keeps arriving never trips the body read timeout, but it is cut off by the max response time.
+	c := NewClient(WithMaxResponseTime(100*time.Millisecond), WithBodyReadTimeout(time.Second))
+
+	start := time.Now()
+	resp, err := c.Get(ts.URL("/dribble"))
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.Equal(t, ErrResponseTimeout, err)
+	require.NotEmpty(t, body)
+	require.Less(t, time.Since(start), time.Second)
+	require.Nil(t, resp.Body.Close())
+
+	// The request that does not get the headers in time fails too.
+	_, err = c.Get(ts.URL("/slow-headers"))
+	require.True(t, errors.Is(err, ErrResponseTimeout))
+	require.Equal(t, ErrorCategoryTimeout, ClassifyError(nil, err))
+
+	resp, err = c.Get(ts.URL("/ok"))
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "ok", string(body))
+	require.Nil(t, resp.Body.Close())
+}
+
+func TestWithMaxResponseTime_Retry(t *testing.T) {
+	var mu sync.Mutex
+	n := 0
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			n++
+			i := n
+			mu.Unlock()
+			if i == 1 {
+				dribble(w, r, 10*time.Millisecond)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		},
+	})
+	c := NewClient(
+		WithMaxResponseTime(100*time.Millisecond),
+		WithRetryOnBodyReadError(),
+		WithMaxRetry(1),
+		WithRetryBackOff(backoff.NewConstantBackOff(0)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+	)
+
+	// The slow body fails the first attempt inside the retry loop, and the second one is returned.
+	resp, err := c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "ok", string(body))
+	require.Equal(t, 2, ts.RequestCount("/"))
+}
@@ -0,0 +1,142 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MultiClient sends each request to the first of several upstream base URLs,
+// and fails over to the next one when the attempt fails, for the high availability of an upstream.
+type MultiClient struct {
+	client   *Client
+	baseURLs []*url.URL
+}
+
+// NewMultiClient creates a client of the upstream base URLs, such as "https://a.example.com/api",
+// which are tried in order. The options configure the client that sends the requests,
+// and an attempt is failed over when the ShouldRetryFunc of WithShouldRetryFunc is true for it,
+// or by default when it fails or its status code is greater than or equal to 500.
+// With WithHystrixOption, the circuit of each host is separate, so a dead upstream is skipped quickly
+// by the ErrCircuitOpen of its open circuit.
+func NewMultiClient(baseURLs []string, options ...Option) (*MultiClient, error) {
+	if len(baseURLs) == 0 {
+		return nil, errors.New("No base URL of the multi client")
+	}
+	m := &MultiClient{client: NewClient(options...)}
+	for _, baseURL := range baseURLs {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Parse the base URL %s", baseURL)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.Errorf("The base URL %s is not absolute", baseURL)
+		}
+		m.baseURLs = append(m.baseURLs, u)
+	}
+	return m, nil
+}
+
+// Do sends the request to the base URLs in order until one of them does not fail,
+// the path and the query of the URL of the request are kept and appended to the base URL.
+// With WithLoadBalancer, each attempt is sent to the base URL picked by the LoadBalancer among the ones
+// not tried yet, and the base URLs whose circuits of WithHystrixOption are open are excluded,
+// unless all of them are open.
+// The body is rewound by GetBody for each failover, so a request whose body has no GetBody
+// is only sent once. The result of the last attempt is returned when all of them fail.
+func (m *MultiClient) Do(req *http.Request) (*http.Response, error) {
+	if req == nil || req.URL == nil {
+		return nil, errors.New("Request or URL is nil")
+	}
+	shouldFailover := m.client.retryOption.ShouldRetryFunc
+	if shouldFailover == nil {
+		shouldFailover = defaultShouldRetryFunc
+	}
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	remaining := m.candidates()
+	for attempt := 0; len(remaining) > 0; attempt++ {
+		if attempt > 0 {
+			closeResponse(resp)
+		}
+		i := remaining[0]
+		if m.client.loadBalancer != nil {
+			i = m.client.loadBalancer.Pick(req, remaining)
+		}
+		var ok bool
+		if remaining, ok = removeCandidate(remaining, i); !ok {
+			return nil, errors.Errorf("The load balancer picked %d, which is not a candidate", i)
+		}
+
+		attemptReq := req.Clone(req.Context())
+		attemptReq.URL = joinBaseURL(m.baseURLs[i], req.URL)
+		attemptReq.Host = ""
+		if attempt > 0 && req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, errors.Wrap(bodyErr, "Rewind the request body")
+			}
+			attemptReq.Body = body
+		}
+
+		resp, err = m.client.Do(attemptReq)
+		if !rewindable || len(remaining) == 0 || !shouldFailover(attemptReq, resp, err) {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+// candidates returns the indexes of the base URLs to try, which are the ones whose circuits are not open
+// when there is a LoadBalancer, or all of them.
+func (m *MultiClient) candidates() []int {
+	var all, healthy []int
+	for i, base := range m.baseURLs {
+		all = append(all, i)
+		if m.client.loadBalancer == nil || !m.client.hystrixOption.isCircuitOpen(base) {
+			healthy = append(healthy, i)
+		}
+	}
+	if len(healthy) == 0 {
+		return all
+	}
+	return healthy
+}
+
+// removeCandidate removes i from the candidates, and reports whether it is one of them.
+func removeCandidate(candidates []int, i int) ([]int, bool) {
+	remaining := make([]int, 0, len(candidates))
+	for _, j := range candidates {
+		if j != i {
+			remaining = append(remaining, j)
+		}
+	}
+	return remaining, len(remaining) < len(candidates)
+}
+
+// Get initiates an HTTP GET request of the path, such as "/users?page=2", see Do.
+func (m *MultiClient) Get(path string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return m.Do(req)
+}
+
+// joinBaseURL appends the path and the query of u to the base URL.
+func joinBaseURL(base, u *url.URL) *url.URL {
+	joined := *base
+	joined.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(u.Path, "/")
+	joined.RawPath = ""
+	if u.RawQuery != "" {
+		joined.RawQuery = u.RawQuery
+	}
+	joined.Fragment = ""
+	return &joined
+}
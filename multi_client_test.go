@@ -0,0 +1,98 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiClient_Failover(t *testing.T) {
+	var requests1, requests2 int
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests1++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts1.Close()
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests2++
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery + " " + string(body)))
+	}))
+	defer ts2.Close()
+
+	m, err := NewMultiClient([]string{ts1.URL + "/api", ts2.URL + "/api/"})
+	require.Nil(t, err)
+
+	req, _ := http.NewRequest(http.MethodPost, "/items?page=2", bytes.NewBufferString("hello"))
+	resp, err := m.Do(req)
+	require.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "/api/items?page=2 hello", string(body))
+	require.Equal(t, 1, requests1)
+	require.Equal(t, 1, requests2)
+
+	// A body that can not be rewound is not failed over.
+	req, _ = http.NewRequest(http.MethodPost, "/items", io.NopCloser(bytes.NewBufferString("hello")))
+	resp, err = m.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, 2, requests1)
+	require.Equal(t, 1, requests2)
+}
+
+func TestMultiClient_AllFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := ts.URL
+	ts.Close()
+
+	m, err := NewMultiClient([]string{deadURL, deadURL})
+	require.Nil(t, err)
+	resp, err := m.Get("/ping")
+	require.NotNil(t, err)
+	require.Nil(t, resp)
+
+	_, err = NewMultiClient(nil)
+	require.NotNil(t, err)
+	_, err = NewMultiClient([]string{"/relative"})
+	require.NotNil(t, err)
+}
+
+func TestMultiClient_CircuitOpen(t *testing.T) {
+	var requests1, requests2 int
+	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests1++
+	}))
+	defer ts1.Close()
+	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests2++
+	}))
+	defer ts2.Close()
+
+	option := NewIsolatedHystrixOption()
+	m, err := NewMultiClient([]string{ts1.URL, ts2.URL}, WithHystrixOption(option))
+	require.Nil(t, err)
+
+	u, _ := url.Parse(ts1.URL)
+	option.HystrixContructor(&http.Request{URL: u}, option).OpenCircuit()
+
+	resp, err := m.Get("/ping")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 0, requests1)
+	require.Equal(t, 1, requests2)
+
+	// The error of the last upstream is returned.
+	v, _ := url.Parse(ts2.URL)
+	option.HystrixContructor(&http.Request{URL: v}, option).OpenCircuit()
+	_, err = m.Get("/ping")
+	require.True(t, errors.Is(err, ErrCircuitOpen))
+}
@@ -0,0 +1,156 @@
+package gohttpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// NDJSONContentType is the content type of the newline delimited JSON streams accepted by GetNDJSON.
+const NDJSONContentType = "application/x-ndjson"
+
+// defaultNDJSONMaxLineSize is the default maximum size of a line of GetNDJSON.
+const defaultNDJSONMaxLineSize = 1024 * 1024
+
+// ndjsonSnippetLen is the number of bytes of the line kept in an NDJSONDecodeError.
+const ndjsonSnippetLen = 64
+
+// ErrStopIteration is returned by the onItem function of GetNDJSON to stop reading the stream without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// ErrNDJSONDecodeFailed is the error that matches, by errors.Is, the lines of GetNDJSON that can not be decoded.
+var ErrNDJSONDecodeFailed = errors.New("Failed to decode the NDJSON line")
+
+// NDJSONDecodeError is the error of a line of GetNDJSON that can not be decoded, see NDJSONOption.OnDecodeError.
+type NDJSONDecodeError struct {
+	// Line is the number of the line, starting at 1.
+	Line int
+	// Snippet is the beginning of the line.
+	Snippet string
+	Err     error
+}
+
+func (e *NDJSONDecodeError) Error() string {
+	return fmt.Sprintf("Failed to decode the NDJSON line %d: %v, line %s", e.Line, e.Err, e.Snippet)
+}
+
+// Unwrap returns the error of the decoder.
+func (e *NDJSONDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrNDJSONDecodeFailed.
+func (e *NDJSONDecodeError) Is(target error) bool {
+	return target == ErrNDJSONDecodeFailed
+}
+
+// NDJSONOption defines the configuration of GetNDJSON.
+type NDJSONOption struct {
+	// MaxLineSize is the maximum size of a line, the stream fails when a line exceeds it, the default is 1MB.
+	MaxLineSize int
+	// OnDecodeError is called with an NDJSONDecodeError for each line that can not be decoded,
+	// the line is skipped when it returns nil, and the stream fails with the error it returns otherwise.
+	// The stream fails with the NDJSONDecodeError when it is nil. See SkipNDJSONDecodeErrors.
+	OnDecodeError func(err *NDJSONDecodeError) error
+}
+
+// SkipNDJSONDecodeErrors is an NDJSONOption.OnDecodeError that skips the lines that can not be decoded.
+func SkipNDJSONDecodeErrors(err *NDJSONDecodeError) error {
+	return nil
+}
+
+// GetNDJSON initiates an HTTP GET request for a stream of newline delimited JSON, such as a watch API,
+// decodes each line into a new item of newItem, and calls onItem with it.
+// The request is a streaming request, so the interceptors never buffer the stream, see MarkStreaming.
+// It stops without an error when onItem returns ErrStopIteration, and returns the error of the context when it is done.
+// The responses whose status code is not 2xx fail without reading the stream. Empty lines are skipped.
+func (c *Client) GetNDJSON(ctx context.Context, url string, newItem func() interface{}, onItem func(interface{}) error) error {
+	req, err := http.NewRequestWithContext(MarkStreaming(ctx), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", NDJSONContentType)
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("Unexpected status %d of the NDJSON stream", resp.StatusCode)
+	}
+
+	maxLineSize := c.ndjsonOption.MaxLineSize
+	if maxLineSize <= 0 {
+		maxLineSize = defaultNDJSONMaxLineSize
+	}
+	bufSize := 4096
+	if bufSize > maxLineSize {
+		bufSize = maxLineSize
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, bufSize), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		item := newItem()
+		if err := json.Unmarshal(data, item); err != nil {
+			if len(data) > ndjsonSnippetLen {
+				data = data[:ndjsonSnippetLen]
+			}
+			decodeErr := &NDJSONDecodeError{Line: line, Snippet: string(data), Err: err}
+			if c.ndjsonOption.OnDecodeError == nil {
+				return decodeErr
+			}
+			if err := c.ndjsonOption.OnDecodeError(decodeErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := onItem(item); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return errors.Errorf("The NDJSON line %d exceeds the max line size %d", line+1, maxLineSize)
+		}
+		return errors.Wrap(err, "Read the NDJSON stream")
+	}
+	return nil
+}
+
+// GetJSONLines initiates an HTTP GET request for a stream of newline delimited JSON like GetNDJSON,
+// and calls fn with each line as it is read, without holding the whole response in memory.
+// The raw message is a copy of the line, so fn may keep it.
+func (c *Client) GetJSONLines(url string, fn func(json.RawMessage) error) error {
+	return c.GetJSONLinesContext(context.Background(), url, fn)
+}
+
+// GetJSONLinesContext is the same as GetJSONLines, the stream stops with the error of ctx when it is done.
+func (c *Client) GetJSONLinesContext(ctx context.Context, url string, fn func(json.RawMessage) error) error {
+	newItem := func() interface{} {
+		return &json.RawMessage{}
+	}
+	onItem := func(item interface{}) error {
+		return fn(*item.(*json.RawMessage))
+	}
+	return c.GetNDJSON(ctx, url, newItem, onItem)
+}
@@ -0,0 +1,185 @@
+package gohttpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+type testNDJSONItem struct {
+	ID int `json:"id"`
+}
+
+func getTestNDJSONServer(t *testing.T, n, malformed int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, NDJSONContentType, r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", NDJSONContentType)
+		for i := 0; i < n; i++ {
+			if i == malformed {
+				_, _ = w.Write([]byte("{\"id\": oops}\n"))
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "{\"id\": %d}\n", i)
+			if i%100 == 0 {
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+}
+
+func TestClientGetNDJSON(t *testing.T) {
+	ts := getTestNDJSONServer(t, 1000, 500)
+	defer ts.Close()
+
+	collect := func(c *Client) ([]int, error) {
+		var ids []int
+		err := c.GetNDJSON(context.Background(), ts.URL, func() interface{} {
+			return &testNDJSONItem{}
+		}, func(item interface{}) error {
+			ids = append(ids, item.(*testNDJSONItem).ID)
+			return nil
+		})
+		return ids, err
+	}
+
+	// The malformed line aborts the stream by default.
+	ids, err := collect(NewClient())
+	require.True(t, errors.Is(err, ErrNDJSONDecodeFailed))
+	var decodeErr *NDJSONDecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, 501, decodeErr.Line)
+	require.Equal(t, `{"id": oops}`, decodeErr.Snippet)
+	require.Len(t, ids, 500)
+	require.Equal(t, 499, ids[499])
+
+	// The malformed line is reported and skipped.
+	var reported []*NDJSONDecodeError
+	c := NewClient(WithNDJSONOption(NDJSONOption{
+		OnDecodeError: func(err *NDJSONDecodeError) error {
+			reported = append(reported, err)
+			return SkipNDJSONDecodeErrors(err)
+		},
+	}))
+	ids, err = collect(c)
+	require.Nil(t, err)
+	require.Len(t, ids, 999)
+	require.Equal(t, 499, ids[499])
+	require.Equal(t, 501, ids[500])
+	require.Len(t, reported, 1)
+	require.Equal(t, 501, reported[0].Line)
+}
+
+func TestClientGetNDJSON_Stop(t *testing.T) {
+	ts := getTestNDJSONServer(t, 1000, -1)
+	defer ts.Close()
+
+	c := NewClient(WithCacheOption(NewMemoryCacheOption()))
+	newItem := func() interface{} { return &testNDJSONItem{} }
+
+	n := 0
+	err := c.GetNDJSON(context.Background(), ts.URL, newItem, func(item interface{}) error {
+		n++
+		if n == 10 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, 10, n)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err = c.GetNDJSON(ctx, ts.URL, newItem, func(item interface{}) error {
+		n++
+		if n == 10 {
+			cancel()
+		}
+		return nil
+	})
+	require.True(t, errors.Is(err, context.Canceled))
+	require.GreaterOrEqual(t, n, 10)
+	require.Less(t, n, 1000)
+
+	errFailed := errors.New("failed")
+	err = c.GetNDJSON(context.Background(), ts.URL, newItem, func(item interface{}) error {
+		return errFailed
+	})
+	require.Equal(t, errFailed, err)
+}
+
+func TestClientGetNDJSON_MaxLineSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{\"id\": 1}\n\n"))
+		_, _ = fmt.Fprintf(w, "{\"id\": 2, \"pad\": \"%s\"}\n", strings.Repeat("x", 100))
+	}))
+	defer ts.Close()
+
+	ids := []int{}
+	c := NewClient(WithNDJSONOption(NDJSONOption{MaxLineSize: 64}))
+	err := c.GetNDJSON(context.Background(), ts.URL, func() interface{} {
+		return &testNDJSONItem{}
+	}, func(item interface{}) error {
+		ids = append(ids, item.(*testNDJSONItem).ID)
+		return nil
+	})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "The NDJSON line 3 exceeds the max line size 64")
+	require.Equal(t, []int{1}, ids)
+
+	ts404 := httptest.NewServer(http.NotFoundHandler())
+	defer ts404.Close()
+	err = c.GetNDJSON(context.Background(), ts404.URL, nil, nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Unexpected status 404")
+}
+
+func TestClientGetJSONLines(t *testing.T) {
+	ts := getTestNDJSONServer(t, 3, -1)
+	defer ts.Close()
+
+	var lines []string
+	err := NewClient().GetJSONLines(ts.URL, func(line json.RawMessage) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{`{"id": 0}`, `{"id": 1}`, `{"id": 2}`}, lines)
+}
+
+func TestClientGetJSONLines_Cancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "{\"id\": %d}\n", i)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	// The lines are read as they arrive, the logger does not wait for the end of the body.
+	logger, _ := test.NewNullLogger()
+	loggerOption := NewLoggerOption()
+	loggerOption.Logger = logrus.NewEntry(logger)
+	c := NewClient(WithLoggerOption(loggerOption))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	err := c.GetJSONLinesContext(ctx, ts.URL, func(line json.RawMessage) error {
+		n++
+		if n == 3 {
+			cancel()
+		}
+		return nil
+	})
+	require.Equal(t, context.Canceled, errors.Cause(err))
+	require.Equal(t, 3, n)
+}
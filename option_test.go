@@ -1,11 +1,15 @@
 package gohttpclient
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -51,6 +55,14 @@ func TestWithRetryBackOff(t *testing.T) {
 	require.Equal(t, retryBackOff, c.retryOption.RetryBackOff)
 }
 
+func TestWithRetryRateLimit(t *testing.T) {
+	c := NewClient()
+	option := NewRateLimitOption(10)
+	WithRetryRateLimit(option)(c)
+	require.NotNil(t, c.retryOption.RateLimitOption)
+	require.Equal(t, option.RateLimits, c.retryOption.RateLimitOption.RateLimits)
+}
+
 func TestWithLoggerOption(t *testing.T) {
 	c := NewClient()
 	loggerOption := NewLoggerOption()
@@ -70,6 +82,13 @@ func TestWithRateLimitOption(t *testing.T) {
 	require.Equal(t, rateLimitOption, c.rateLimitOption)
 }
 
+func TestWithAdaptiveThrottle(t *testing.T) {
+	c := NewClient()
+	option := NewAdaptiveOption(10, 1, 100, time.Second)
+	WithAdaptiveThrottle(option)(c)
+	require.Equal(t, option, c.adaptiveOption)
+}
+
 func TestWithHystrixOption(t *testing.T) {
 	c := NewClient()
 	hystrixOption := NewHystrixOption()
@@ -90,3 +109,118 @@ func TestWithCacheOption(t *testing.T) {
 	WithCacheOption(cacheOption)(c)
 	require.Equal(t, true, c.cacheOption.isEnabled())
 }
+
+func TestWithStreamingMode(t *testing.T) {
+	c := NewClient()
+	WithStreamingMode()(c)
+	require.True(t, c.streamingMode)
+}
+
+func TestWithProxyFromEnvironment(t *testing.T) {
+	c := NewClient()
+	require.True(t, c.proxyFromEnvironment)
+	require.Nil(t, c.client.Transport)
+
+	c = NewClient(WithProxyFromEnvironment(false))
+	require.False(t, c.proxyFromEnvironment)
+	transport, ok := c.client.Transport.(*http.Transport)
+	require.True(t, ok)
+	require.Nil(t, transport.Proxy)
+	require.NotNil(t, http.DefaultTransport.(*http.Transport).Proxy)
+
+	custom := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	c = NewClient(
+		WithHTTPClient(&http.Client{Transport: custom}),
+		WithProxyFromEnvironment(false),
+	)
+	require.Nil(t, c.client.Transport.(*http.Transport).Proxy)
+	require.NotNil(t, custom.Proxy)
+}
+
+func TestWithProxy(t *testing.T) {
+	var proxied string
+	proxy := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			proxied = r.URL.String()
+		},
+	})
+
+	c, err := NewClientWithError(WithProxy("http://user:secret@" + strings.TrimPrefix(proxy.URL(), "http://")))
+	require.Nil(t, err)
+	require.NotContains(t, c.ConfigSummary(), "secret")
+	resp, err := c.Get("http://upstream.example.com/path?q=1")
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, "http://upstream.example.com/path?q=1", proxied)
+
+	for _, rawURL := range []string{"://bad", "proxy.example.com"} {
+		c, err = NewClientWithError(WithProxy(rawURL))
+		require.Nil(t, c)
+		var optionErr *OptionError
+		require.ErrorAs(t, err, &optionErr)
+		require.Equal(t, "WithProxy", optionErr.Option)
+	}
+
+	// NewClient ignores the option with a warning.
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	c = NewClient(WithProxy("://bad"))
+	require.NotNil(t, c)
+	require.Nil(t, c.proxyURL)
+	entries := hook.AllEntries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "gohttpclient option is not applied", entries[0].Message)
+	require.Equal(t, "WithProxy", entries[0].Data["option"])
+}
+
+func TestClientConfigSummary(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	streaming := false
+	c := NewClient(
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Second)),
+		WithRequestTimeout(5*time.Second),
+		WithDefaultHeader("Authorization", "Bearer secret"),
+		WithDefaultHeader("X-Api-Key", "secret"),
+		WithAcceptJSON(),
+		WithContentTypeEnforcement("application/json"),
+		OptionFunc(func(c *Client) { streaming = c.streamingMode }),
+		WithMaxRetry(5),
+	)
+	require.Equal(t, uint64(5), c.retryOption.MaxRetry)
+	require.False(t, streaming)
+	require.Equal(t, "Bearer secret", c.defaultHeader.Get("Authorization"))
+	require.Equal(t, `WithMaxRetry(3)
+WithRetryBackOff(<*backoff.ConstantBackOff>)
+WithRequestTimeout(5s)
+WithDefaultHeader("Authorization", "REDACTED")
+WithDefaultHeader("X-Api-Key", "REDACTED")
+WithDefaultHeader("Accept", "application/json")
+WithContentTypeEnforcement(["application/json"])
+OptionFunc()
+WithMaxRetry(5)`, c.ConfigSummary())
+	require.NotContains(t, c.ConfigSummary(), "secret")
+
+	// Only the option of the same kind applied twice is warned,
+	// besides the retry misconfigured without a ShouldRetryFunc.
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	require.Equal(t, logrus.WarnLevel, entries[0].Level)
+	require.Equal(t, "WithMaxRetry", entries[0].Data["option"])
+	require.Equal(t, "Retry", entries[1].Data["handler"])
+	require.Equal(t, "ShouldRetryFunc", entries[1].Data["field"])
+
+	// A nil option is not applied with a warning, and reported by NewClientWithError.
+	hook.Reset()
+	require.Empty(t, NewClient(nil).ConfigSummary())
+	entries = hook.AllEntries()
+	require.Len(t, entries, 1)
+	require.Equal(t, "options[0]", entries[0].Data["option"])
+	_, err := NewClientWithError(WithMaxRetry(3), nil)
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "options[1]", optionErr.Option)
+	require.True(t, errors.Is(err, ErrNilOption))
+}
@@ -0,0 +1,108 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrRequestDenied is the error that matches, by errors.Is, the requests denied by the policy of WithRequestPolicy.
+var ErrRequestDenied = errors.New("The request is denied by the policy")
+
+// RequestDeniedError is returned for a request denied by the policy, it wraps the error of the policy.
+type RequestDeniedError struct {
+	Err error
+}
+
+func (e *RequestDeniedError) Error() string {
+	return fmt.Sprintf("The request is denied by the policy: %v", e.Err)
+}
+
+// Is reports whether the target is ErrRequestDenied.
+func (e *RequestDeniedError) Is(target error) bool {
+	return target == ErrRequestDenied
+}
+
+// Unwrap returns the error of the policy.
+func (e *RequestDeniedError) Unwrap() error {
+	return e.Err
+}
+
+// RequestPolicyFunc decides whether a request may be sent, a non-nil error denies it.
+// It is meant to check the URL and the headers, such as against an allowlist of hosts.
+type RequestPolicyFunc func(ctx context.Context, req *http.Request) error
+
+// RequestPolicyHandler creates an interceptor that denies the requests the policy returns an error for
+// with a RequestDeniedError, before anything else is done for them.
+// The denials are logged by the logger of loggerOption, when it is enabled, with LoggerEntry.PolicyDenied set.
+// The part of the request body read by the policy is restored for the allowed requests,
+// and the body of the denied requests is closed like http.Client does for the failed requests.
+func RequestPolicyHandler(policy RequestPolicyFunc, loggerOption LoggerOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil {
+			return handlerFunc(req)
+		}
+
+		startTime := getClock(loggerOption.Clock).Now()
+		var body *policyBody
+		preq := req
+		if req.Body != nil && req.Body != http.NoBody {
+			body = &policyBody{body: req.Body}
+			r := *req
+			r.Body = body
+			preq = &r
+		}
+
+		err := policy(getRequestContext(req), preq)
+		if body != nil && body.buf.Len() > 0 {
+			r := *req
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body.buf.Bytes()), body.body), body.body}
+			req = &r
+		}
+		if err == nil {
+			return handlerFunc(req)
+		}
+
+		logPolicyDenied(req, err, loggerOption, startTime)
+		closeRequestBody(req)
+		return nil, &RequestDeniedError{Err: err}
+	}
+}
+
+// policyBody records the bytes of the request body read by the policy, so that they can be restored.
+// Closing it does not close the request body.
+type policyBody struct {
+	body io.ReadCloser
+	buf  bytes.Buffer
+}
+
+func (b *policyBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (b *policyBody) Close() error {
+	return nil
+}
+
+func logPolicyDenied(req *http.Request, err error, option LoggerOption, startTime time.Time) {
+	if !option.isEnabled() || (option.SkipFunc != nil && option.SkipFunc(req)) {
+		return
+	}
+	entry, loggerErr := BuildLoggerEntry(req, nil, option, startTime)
+	if loggerErr != nil {
+		logrus.WithError(loggerErr).Warn("gohttpclient build logger entry")
+		return
+	}
+	entry.PolicyDenied = true
+	entry.PolicyError = err
+	entry.Error = err
+	option.LoggerFunc(req, entry, option)
+}
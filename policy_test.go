@@ -0,0 +1,96 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRequestPolicy(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	allowed, _ := url.Parse(ts.URL)
+
+	errNotApproved := errors.New("host is not approved")
+	logger, hook := test.NewNullLogger()
+	loggerOption := NewLoggerOption()
+	loggerOption.Logger = logrus.NewEntry(logger)
+	c := NewClient(
+		WithLoggerOption(loggerOption),
+		WithRequestPolicy(func(ctx context.Context, req *http.Request) error {
+			if req.URL.Host != allowed.Host {
+				return errNotApproved
+			}
+			return nil
+		}),
+	)
+
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 1, requests)
+	require.Len(t, hook.AllEntries(), 1)
+	require.Nil(t, hook.LastEntry().Data["policyDenied"])
+
+	deniedURL := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	resp, err = c.Get(deniedURL)
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrRequestDenied))
+	require.True(t, errors.Is(err, errNotApproved))
+	require.Equal(t, 1, requests)
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	entry := entries[1]
+	require.Equal(t, logrus.WarnLevel, entry.Level)
+	require.Equal(t, true, entry.Data["policyDenied"])
+	require.Equal(t, errNotApproved.Error(), entry.Data["policyError"])
+	require.Equal(t, deniedURL, entry.Data["url"])
+}
+
+func TestRequestPolicyHandler_RestoresBody(t *testing.T) {
+	handler := RequestPolicyHandler(func(ctx context.Context, req *http.Request) error {
+		p := make([]byte, 5)
+		_, err := io.ReadFull(req.Body, p)
+		require.Nil(t, err)
+		require.Nil(t, req.Body.Close())
+		if string(p) == "deny!" {
+			return errors.New("denied")
+		}
+		return nil
+	}, LoggerOption{})
+
+	var got []byte
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		var err error
+		got, err = io.ReadAll(req.Body)
+		require.Nil(t, err)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com", strings.NewReader("hello world"))
+	_, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.Equal(t, "hello world", string(got))
+
+	got = nil
+	body := &testTrackingBody{Reader: strings.NewReader("deny!")}
+	req, _ = http.NewRequest(http.MethodPost, "https://example.com", body)
+	_, err = handler(req, handlerFunc)
+	require.True(t, errors.Is(err, ErrRequestDenied))
+	require.Nil(t, got)
+	require.True(t, body.closed)
+}
@@ -0,0 +1,61 @@
+package gohttpclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPreconditionFailed is the error that matches, by errors.Is,
+// the errors returned for the 412 Precondition Failed responses, see WithPreconditionErrors.
+var ErrPreconditionFailed = errors.New("The precondition of the request failed")
+
+// PreconditionFailedError is returned for a 412 Precondition Failed response to a conditional request,
+// such as a PUT with an If-Match header whose entity has been changed by another client.
+// The caller usually fetches the entity again and retries with its new ETag.
+type PreconditionFailedError struct {
+	// IfMatch is the If-Match header of the request.
+	IfMatch string
+	// Response is the 412 response, its body has not been read and must be closed by the caller.
+	Response *http.Response
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return fmt.Sprintf("The precondition of the request failed: If-Match '%s'", e.IfMatch)
+}
+
+// Is reports whether the target is ErrPreconditionFailed.
+func (e *PreconditionFailedError) Is(target error) bool {
+	return target == ErrPreconditionFailed
+}
+
+// SetIfMatch sets the If-Match header of the request to the entity tag, such as the ETag of a previous GET,
+// so that the server only applies the request when the entity has not been changed.
+// The tag is quoted when it is not, and "*" matches any entity.
+func SetIfMatch(req *http.Request, etag string) {
+	if etag != "*" && !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	req.Header.Set("If-Match", etag)
+}
+
+// PreconditionHandler creates an interceptor that turns the 412 Precondition Failed responses
+// to the requests with an If-Match header into a PreconditionFailedError, which wraps the response.
+func PreconditionHandler() RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		resp, err := handlerFunc(req)
+		if err != nil || resp == nil || resp.StatusCode != http.StatusPreconditionFailed || req == nil {
+			return resp, err
+		}
+		ifMatch := req.Header.Get("If-Match")
+		if ifMatch == "" {
+			return resp, nil
+		}
+		return nil, &PreconditionFailedError{IfMatch: ifMatch, Response: resp}
+	}
+}
@@ -0,0 +1,91 @@
+package gohttpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetIfMatch(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPut, "https://example.com", nil)
+	SetIfMatch(req, "v1")
+	require.Equal(t, `"v1"`, req.Header.Get("If-Match"))
+	SetIfMatch(req, `W/"v2"`)
+	require.Equal(t, `W/"v2"`, req.Header.Get("If-Match"))
+	SetIfMatch(req, "*")
+	require.Equal(t, "*", req.Header.Get("If-Match"))
+}
+
+func TestWithPreconditionErrors(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		etag     = `"v1"`
+		requests int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if r.Method == http.MethodPut {
+			if r.Header.Get("If-Match") != etag {
+				w.Header().Set("ETag", etag)
+				w.WriteHeader(http.StatusPreconditionFailed)
+				_, _ = w.Write([]byte("stale"))
+				return
+			}
+			etag = `"v2"`
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	c := NewClient(
+		WithPreconditionErrors(),
+		WithMaxRetry(3),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithRetryBackOff(backoff.NewConstantBackOff(0)),
+	)
+	put := func(etag string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL, strings.NewReader("data"))
+		SetIfMatch(req, etag)
+		return c.Do(req)
+	}
+
+	resp, err := put("v1")
+	require.Nil(t, err)
+	require.Equal(t, `"v2"`, resp.Header.Get("ETag"))
+	resp.Body.Close()
+
+	// The stale ETag fails with the typed error, which is not retried.
+	resp, err = put("v1")
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrPreconditionFailed))
+	var e *PreconditionFailedError
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, `"v1"`, e.IfMatch)
+	require.Equal(t, http.StatusPreconditionFailed, e.Response.StatusCode)
+	require.Equal(t, `"v2"`, e.Response.Header.Get("ETag"))
+	body, err := io.ReadAll(e.Response.Body)
+	require.Nil(t, err)
+	require.Equal(t, "stale", string(body))
+	e.Response.Body.Close()
+	require.Equal(t, 2, requests)
+
+	// A 412 without If-Match is returned as usual.
+	req, _ := http.NewRequest(http.MethodPut, ts.URL, nil)
+	req.Header.Set("If-None-Match", "*")
+	handler := PreconditionHandler()
+	resp, err = handler(req, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusPreconditionFailed, Body: http.NoBody}, nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
@@ -0,0 +1,112 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtobufContentType is the content type of the protobuf messages sent and accepted by PostProto and GetProto.
+const ProtobufContentType = "application/x-protobuf"
+
+// protoSnippetLen is the number of bytes of the body kept in a ProtoDecodeError.
+const protoSnippetLen = 64
+
+// ErrProtoDecodeFailed is the error that matches, by errors.Is, the errors returned when a protobuf response can not be decoded.
+var ErrProtoDecodeFailed = errors.New("Failed to decode the protobuf response")
+
+// ProtoDecodeError is returned when the response of PostProto or GetProto can not be decoded,
+// including the responses whose status code is not 2xx.
+type ProtoDecodeError struct {
+	StatusCode int
+	// Snippet is the hex encoded beginning of the body.
+	Snippet string
+	Err     error
+}
+
+func (e *ProtoDecodeError) Error() string {
+	return fmt.Sprintf("Failed to decode the protobuf response with status %d: %v, body %s", e.StatusCode, e.Err, e.Snippet)
+}
+
+// Unwrap returns the error of the decoder.
+func (e *ProtoDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrProtoDecodeFailed.
+func (e *ProtoDecodeError) Is(target error) bool {
+	return target == ErrProtoDecodeFailed
+}
+
+// PostProto initiates an HTTP POST request with the protobuf message in, and decodes the response into out.
+// The request and the response bodies are limited by WithMaxBodySize.
+// The response body has been read, and it is replaced by a copy that can be read again.
+func (c *Client) PostProto(url string, in, out proto.Message) (*http.Response, error) {
+	return c.PostProtoContext(context.Background(), url, in, out)
+}
+
+// PostProtoContext is the same as PostProto with the context of the request.
+func (c *Client) PostProtoContext(ctx context.Context, url string, in, out proto.Message) (*http.Response, error) {
+	data, err := proto.Marshal(in)
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal the protobuf request")
+	}
+	if c.maxBodySize > 0 && uint64(len(data)) > c.maxBodySize {
+		return nil, errors.Errorf("The protobuf request of %d bytes exceeds the max body size %d", len(data), c.maxBodySize)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ProtobufContentType)
+	return c.doProto(req, out)
+}
+
+// GetProto initiates an HTTP GET request and decodes the protobuf response into out, see PostProto.
+func (c *Client) GetProto(url string, out proto.Message) (*http.Response, error) {
+	return c.GetProtoContext(context.Background(), url, out)
+}
+
+// GetProtoContext is the same as GetProto with the context of the request.
+func (c *Client) GetProtoContext(ctx context.Context, url string, out proto.Message) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.doProto(req, out)
+}
+
+func (c *Client) doProto(req *http.Request, out proto.Message) (*http.Response, error) {
+	req.Header.Set("Accept", ProtobufContentType)
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readLimitedBody(resp.Body, c.maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = errors.Errorf("unexpected status %d", resp.StatusCode)
+	} else {
+		err = proto.Unmarshal(body, out)
+	}
+	if err != nil {
+		snippet := body
+		if len(snippet) > protoSnippetLen {
+			snippet = snippet[:protoSnippetLen]
+		}
+		return resp, &ProtoDecodeError{StatusCode: resp.StatusCode, Snippet: hex.EncodeToString(snippet), Err: err}
+	}
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package gohttpclient
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestClient_PostProto(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, ProtobufContentType, r.Header.Get("Content-Type"))
+		require.Equal(t, ProtobufContentType, r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", ProtobufContentType)
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	c := NewClient()
+	out := &wrapperspb.StringValue{}
+	resp, err := c.PostProto(ts.URL, wrapperspb.String("hello world"), out)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "hello world", out.GetValue())
+
+	// The body can be read again.
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	expected, err := proto.Marshal(wrapperspb.String("hello world"))
+	require.Nil(t, err)
+	require.Equal(t, expected, body)
+
+	// The request body is limited by the max body size.
+	c = NewClient(WithMaxBodySize(4))
+	_, err = c.PostProtoContext(context.Background(), ts.URL, wrapperspb.String("hello world"), out)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "exceeds the max body size 4")
+}
+
+func TestClient_GetProto(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			data, _ := proto.Marshal(wrapperspb.Int64(42))
+			_, _ = w.Write(data)
+		case "/html":
+			_, _ = w.Write([]byte("<html>Bad gateway</html>"))
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("not found"))
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(WithMaxBodySize(64))
+	out := &wrapperspb.Int64Value{}
+	_, err := c.GetProto(ts.URL+"/ok", out)
+	require.Nil(t, err)
+	require.Equal(t, int64(42), out.GetValue())
+
+	resp, err := c.GetProto(ts.URL+"/html", out)
+	require.True(t, errors.Is(err, ErrProtoDecodeFailed))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var e *ProtoDecodeError
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, http.StatusOK, e.StatusCode)
+	require.Equal(t, hex.EncodeToString([]byte("<html>Bad gateway</html>")), e.Snippet)
+
+	_, err = c.GetProtoContext(context.Background(), ts.URL+"/missing", out)
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, http.StatusNotFound, e.StatusCode)
+	require.Equal(t, hex.EncodeToString([]byte("not found")), e.Snippet)
+
+	_, err = c.GetProto(ts.URL+"/large", out)
+	require.True(t, errors.Is(err, ErrResponseBodyTooLarge))
+}
@@ -0,0 +1,223 @@
+package gohttpclient
+
+import (
+	"encoding"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// GetWithQuery initiates an HTTP GET request with the query merged into the query of the URL.
+// The query is a url.Values, a map[string]string, a map[string][]string, or a struct, or a pointer to one,
+// whose fields are encoded by their url tags, such as `url:"page,omitempty"`:
+// the name defaults to the name of the field, "-" skips the field, and omitempty skips its zero value.
+// The slices are encoded as repeated params, time.Time as RFC3339, and the nil pointers are skipped.
+// The params are sorted by name, so that the same query always produces the same URL and cache key.
+func (c *Client) GetWithQuery(rawURL string, query interface{}) (*http.Response, error) {
+	values, err := encodeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	u, err := mergeQuery(rawURL, values)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(u)
+}
+
+// GetQuery initiates an HTTP GET request with the params merged into the query of the base URL,
+// the values are escaped, and the params are sorted by name, see GetWithQuery.
+func (c *Client) GetQuery(baseURL string, params map[string]string) (*http.Response, error) {
+	return c.GetWithQuery(baseURL, params)
+}
+
+// QueryBuilder builds the query params of a URL, such as
+// NewQueryBuilder().Add("page", "2").Add("tag", "a").Add("tag", "b").URL("https://example.com/items").
+type QueryBuilder struct {
+	values url.Values
+}
+
+// NewQueryBuilder creates an empty query builder.
+func NewQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{values: url.Values{}}
+}
+
+// Add adds the value to the param, after the values it already has.
+func (b *QueryBuilder) Add(key, value string) *QueryBuilder {
+	b.values.Add(key, value)
+	return b
+}
+
+// Set replaces the values of the param with the value.
+func (b *QueryBuilder) Set(key, value string) *QueryBuilder {
+	b.values.Set(key, value)
+	return b
+}
+
+// Values returns the params built.
+func (b *QueryBuilder) Values() url.Values {
+	return b.values
+}
+
+// Encode returns the escaped query of the params, sorted by name.
+func (b *QueryBuilder) Encode() string {
+	return b.values.Encode()
+}
+
+// URL returns the base URL with the params merged into its query, sorted by name.
+func (b *QueryBuilder) URL(baseURL string) (string, error) {
+	return mergeQuery(baseURL, b.values)
+}
+
+// mergeQuery adds the values to the query of the URL, and returns the URL with the params sorted by name.
+func mergeQuery(rawURL string, values url.Values) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	merged := u.Query()
+	for key, vs := range values {
+		merged[key] = append(merged[key], vs...)
+	}
+	u.RawQuery = merged.Encode()
+	return u.String(), nil
+}
+
+func encodeQuery(query interface{}) (url.Values, error) {
+	switch q := query.(type) {
+	case nil:
+		return url.Values{}, nil
+	case url.Values:
+		return q, nil
+	case map[string][]string:
+		return url.Values(q), nil
+	case map[string]string:
+		values := url.Values{}
+		for key, value := range q {
+			values.Set(key, value)
+		}
+		return values, nil
+	}
+
+	v := reflect.ValueOf(query)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return url.Values{}, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errors.Errorf("Unsupported query type %T", query)
+	}
+	values := url.Values{}
+	if err := encodeQueryStruct(values, v); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func encodeQueryStruct(values url.Values, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+
+		fv := v.Field(i)
+		if field.Anonymous && name == "" && fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			if err := encodeQueryStruct(values, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		if (fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array) && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formatQueryValue(fv.Index(j))
+				if err != nil {
+					return errors.Wrapf(err, "Encode the query field %s", field.Name)
+				}
+				values.Add(name, s)
+			}
+			continue
+		}
+		s, err := formatQueryValue(fv)
+		if err != nil {
+			return errors.Wrapf(err, "Encode the query field %s", field.Name)
+		}
+		values.Add(name, s)
+	}
+	return nil
+}
+
+func formatQueryValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	}
+	return "", errors.Errorf("Unsupported type %s", v.Type())
+}
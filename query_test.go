@@ -0,0 +1,129 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testQueryPage struct {
+	Page int `url:"page,omitempty"`
+	Size int `url:"size"`
+}
+
+type testQuery struct {
+	testQueryPage
+	Q       string    `url:"q"`
+	Tags    []string  `url:"tag,omitempty"`
+	Since   time.Time `url:"since,omitempty"`
+	Limit   *int      `url:"limit"`
+	Debug   bool      `url:"debug,omitempty"`
+	Skipped string    `url:"-"`
+	Name    string
+	private string
+}
+
+func TestEncodeQuery(t *testing.T) {
+	limit := 10
+	values, err := encodeQuery(testQuery{
+		testQueryPage: testQueryPage{Size: 20},
+		Q:             "a b",
+		Tags:          []string{"x", "y"},
+		Since:         time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Limit:         &limit,
+		Skipped:       "skipped",
+		Name:          "n",
+		private:       "private",
+	})
+	require.Nil(t, err)
+	require.Equal(t, "Name=n&limit=10&q=a+b&since=2024-01-02T03%3A04%3A05Z&size=20&tag=x&tag=y", values.Encode())
+
+	// The zero values of omitempty and the nil pointers are skipped.
+	values, err = encodeQuery(&testQuery{})
+	require.Nil(t, err)
+	require.Equal(t, "Name=&q=&size=0", values.Encode())
+
+	values, err = encodeQuery(map[string]string{"b": "2", "a": "1"})
+	require.Nil(t, err)
+	require.Equal(t, "a=1&b=2", values.Encode())
+
+	values, err = encodeQuery(url.Values{"a": {"1", "2"}})
+	require.Nil(t, err)
+	require.Equal(t, "a=1&a=2", values.Encode())
+
+	_, err = encodeQuery(42)
+	require.NotNil(t, err)
+	_, err = encodeQuery(struct {
+		M map[string]string `url:"m"`
+	}{})
+	require.NotNil(t, err)
+}
+
+func TestClient_GetWithQuery(t *testing.T) {
+	requests := 0
+	var rawQuery string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		rawQuery = r.URL.RawQuery
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	c := NewClient(WithCacheOption(NewMemoryCacheOption()))
+
+	// The query is merged with the one of the URL.
+	resp, err := c.GetWithQuery(ts.URL+"/search?z=1&tag=w", testQuery{Q: "x", Tags: []string{"v"}})
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, "Name=&q=x&size=0&tag=w&tag=v&z=1", rawQuery)
+
+	// The same query produces the same cache key regardless of the order of its fields.
+	resp, err = c.GetWithQuery(ts.URL+"/search", testQuery{Q: "x", Name: "n", testQueryPage: testQueryPage{Page: 2}})
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 2, requests)
+	resp, err = c.GetWithQuery(ts.URL+"/search", testQuery{testQueryPage: testQueryPage{Page: 2}, Name: "n", Q: "x"})
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 2, requests)
+	resp, err = c.GetWithQuery(ts.URL+"/search", map[string]string{"size": "0", "q": "x", "page": "2", "Name": "n"})
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 2, requests)
+
+	_, err = c.GetWithQuery(ts.URL, 42)
+	require.NotNil(t, err)
+}
+
+func TestClient_GetQuery(t *testing.T) {
+	var rawQuery string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+	}))
+	defer ts.Close()
+
+	resp, err := NewClient().GetQuery(ts.URL+"/search?lang=en", map[string]string{"q": "a b&c=d", "page": "2"})
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, "lang=en&page=2&q=a+b%26c%3Dd", rawQuery)
+
+	_, err = NewClient().GetQuery("://bad", nil)
+	require.NotNil(t, err)
+}
+
+func TestQueryBuilder(t *testing.T) {
+	b := NewQueryBuilder().Add("tag", "a").Add("tag", "b/c").Set("page", "1").Set("page", "2")
+	require.Equal(t, url.Values{"tag": {"a", "b/c"}, "page": {"2"}}, b.Values())
+	require.Equal(t, "page=2&tag=a&tag=b%2Fc", b.Encode())
+
+	u, err := b.URL("https://example.com/items?tag=z#top")
+	require.Nil(t, err)
+	require.Equal(t, "https://example.com/items?page=2&tag=z&tag=a&tag=b%2Fc#top", u)
+
+	_, err = b.URL("://bad")
+	require.NotNil(t, err)
+}
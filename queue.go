@@ -0,0 +1,131 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrQueueFull is returned by Client.Submit when the request queue is full.
+var ErrQueueFull = errors.New("The request queue is full")
+
+// ErrQueueClosed is returned by Client.Submit after the request queue is closed by Client.CloseQueue.
+var ErrQueueClosed = errors.New("The request queue is closed")
+
+// ErrQueueNotEnabled is returned by Client.Submit when the client is not created with WithRequestQueue.
+var ErrQueueNotEnabled = errors.New("The request queue is not enabled")
+
+// Result is the result of a request submitted by Client.Submit.
+type Result struct {
+	Response *http.Response
+	Err      error
+}
+
+// QueueOption defines the configuration of the request queue of Client.Submit.
+type QueueOption struct {
+	// Workers is the number of the requests that are performed concurrently.
+	Workers int
+	// QueueSize is the maximum number of the requests waiting for a worker,
+	// the requests beyond it fail with ErrQueueFull.
+	QueueSize int
+}
+
+// NewQueueOption creates a request queue option configuration,
+// at most workers requests are performed concurrently and at most queueSize requests wait for them.
+func NewQueueOption(workers, queueSize int) QueueOption {
+	return QueueOption{
+		Workers:   workers,
+		QueueSize: queueSize,
+	}
+}
+
+func (o QueueOption) isEnabled() bool {
+	return o.Workers > 0
+}
+
+type queuedRequest struct {
+	req    *http.Request
+	result chan Result
+}
+
+// requestQueue is a bounded queue of requests performed by a fixed number of workers.
+type requestQueue struct {
+	mu     sync.RWMutex
+	jobs   chan queuedRequest
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func newRequestQueue(option QueueOption, do func(*http.Request) (*http.Response, error)) *requestQueue {
+	size := option.QueueSize
+	if size < 0 {
+		size = 0
+	}
+	q := &requestQueue{jobs: make(chan queuedRequest, size)}
+	q.wg.Add(option.Workers)
+	for i := 0; i < option.Workers; i++ {
+		go func() {
+			defer q.wg.Done()
+			for job := range q.jobs {
+				job.result <- performQueuedRequest(job.req, do)
+			}
+		}()
+	}
+	return q
+}
+
+// performQueuedRequest performs the request unless its context is done while it was waiting in the queue.
+func performQueuedRequest(req *http.Request, do func(*http.Request) (*http.Response, error)) Result {
+	if err := getRequestContext(req).Err(); err != nil {
+		return Result{Err: err}
+	}
+	resp, err := do(req)
+	return Result{Response: resp, Err: err}
+}
+
+func (q *requestQueue) submit(req *http.Request) (<-chan Result, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	result := make(chan Result, 1)
+	select {
+	case q.jobs <- queuedRequest{req: req, result: result}:
+		return result, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+func (q *requestQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Submit queues the request to be performed asynchronously by the workers of WithRequestQueue,
+// and returns a channel that receives its result once.
+// The queued requests go through all the interceptors of the client, so they are performed at the rate
+// of WithRateLimitOption, and a producer that outruns the origin gets ErrQueueFull instead of growing goroutines.
+// A request whose context is done while it waits in the queue is not sent and its result is the context error.
+// The caller must close the body of a successful response, as for Do.
+func (c *Client) Submit(req *http.Request) (<-chan Result, error) {
+	if c.queue == nil {
+		return nil, ErrQueueNotEnabled
+	}
+	return c.queue.submit(req)
+}
+
+// CloseQueue stops accepting requests by Submit and waits for the queued ones to be performed,
+// after which the workers of the queue exit. It is safe to call it more than once.
+func (c *Client) CloseQueue() {
+	if c.queue != nil {
+		c.queue.close()
+	}
+}
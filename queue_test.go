@@ -0,0 +1,150 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSubmit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	c := NewClient(WithRequestQueue(2, 10))
+	defer c.CloseQueue()
+
+	var results []<-chan Result
+	for _, path := range []string{"/a", "/b", "/c"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		result, err := c.Submit(req)
+		require.Nil(t, err)
+		results = append(results, result)
+	}
+	for i, path := range []string{"/a", "/b", "/c"} {
+		r := <-results[i]
+		require.Nil(t, r.Err)
+		body, err := io.ReadAll(r.Response.Body)
+		r.Response.Body.Close()
+		require.Nil(t, err)
+		require.Equal(t, path, string(body))
+	}
+}
+
+func TestClientSubmit_QueueFull(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		started <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	c := NewClient(WithRequestQueue(1, 1))
+	submit := func() (<-chan Result, error) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		return c.Submit(req)
+	}
+
+	// The first request is taken by the worker, the second one waits in the queue.
+	first, err := submit()
+	require.Nil(t, err)
+	<-started
+	second, err := submit()
+	require.Nil(t, err)
+
+	_, err = submit()
+	require.True(t, errors.Is(err, ErrQueueFull))
+
+	close(release)
+	for _, result := range []<-chan Result{first, second} {
+		r := <-result
+		require.Nil(t, r.Err)
+		r.Response.Body.Close()
+	}
+	c.CloseQueue()
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	_, err = submit()
+	require.True(t, errors.Is(err, ErrQueueClosed))
+}
+
+func TestClientSubmit_RateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// 5 requests at 100 requests per second take at least 40ms, however many workers there are.
+	c := NewClient(
+		WithRequestQueue(5, 5),
+		WithRateLimitOption(NewRateLimitOption(100)),
+	)
+	defer c.CloseQueue()
+
+	start := time.Now()
+	var results []<-chan Result
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		result, err := c.Submit(req)
+		require.Nil(t, err)
+		results = append(results, result)
+	}
+	for _, result := range results {
+		r := <-result
+		require.Nil(t, r.Err)
+		r.Response.Body.Close()
+	}
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestClientSubmit_CanceledWhileQueued(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		started <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	c := NewClient(WithRequestQueue(1, 1))
+	defer c.CloseQueue()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	first, err := c.Submit(req)
+	require.Nil(t, err)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	second, err := c.Submit(req)
+	require.Nil(t, err)
+	cancel()
+	close(release)
+
+	r := <-first
+	require.Nil(t, r.Err)
+	r.Response.Body.Close()
+	r = <-second
+	require.Nil(t, r.Response)
+	require.True(t, errors.Is(r.Err, context.Canceled))
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestClientSubmit_NotEnabled(t *testing.T) {
+	c := NewClient()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	_, err := c.Submit(req)
+	require.True(t, errors.Is(err, ErrQueueNotEnabled))
+	c.CloseQueue()
+}
@@ -0,0 +1,111 @@
+package gohttpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrRangeIgnored is the error that matches, by errors.Is, the range requests answered with the full body.
+var ErrRangeIgnored = errors.New("The server ignored the range of the request")
+
+// ErrRangeNotSatisfied is the error that matches, by errors.Is, the range requests answered with
+// 416 Range Not Satisfiable, or with another range than the one requested.
+var ErrRangeNotSatisfied = errors.New("The range of the request is not satisfied")
+
+// RangeError is returned by Client.GetRange when the response is not the range requested.
+type RangeError struct {
+	// Start and End are the range requested, End is -1 for the rest of the body.
+	Start int64
+	End   int64
+	// StatusCode and ContentRange are the ones of the response.
+	StatusCode   int
+	ContentRange string
+
+	err error
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%s: requested bytes %d-%s, got status %d with Content-Range '%s'",
+		e.err.Error(), e.Start, formatRangeEnd(e.End), e.StatusCode, e.ContentRange)
+}
+
+// Is reports whether the target is ErrRangeIgnored or ErrRangeNotSatisfied, whichever the error is.
+func (e *RangeError) Is(target error) bool {
+	return target == e.err
+}
+
+func formatRangeEnd(end int64) string {
+	if end < 0 {
+		return ""
+	}
+	return strconv.FormatInt(end, 10)
+}
+
+// GetRange initiates an HTTP GET request of the bytes from start to end of the body, both inclusive,
+// an end of -1 requests the rest of the body. The response must be a 206 Partial Content of the same range,
+// otherwise it is closed and a RangeError is returned, which is ErrRangeIgnored for a 200 with the full body,
+// and ErrRangeNotSatisfied for a 416 or another range. The responses of the other statuses are returned as is.
+// The cache of WithCacheOption keeps each range separately, and never serves a range from a cached full body.
+func (c *Client) GetRange(ctx context.Context, url string, start, end int64) (*http.Response, error) {
+	if start < 0 || (end >= 0 && end < start) {
+		return nil, errors.Errorf("Invalid range %d-%d", start, end)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%s", start, formatRangeEnd(end)))
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rangeErr := &RangeError{Start: start, End: end, StatusCode: resp.StatusCode, ContentRange: resp.Header.Get("Content-Range")}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		gotStart, gotEnd, ok := parseContentRange(rangeErr.ContentRange)
+		if ok && gotStart == start && (gotEnd == end || end < 0) {
+			return resp, nil
+		}
+		rangeErr.err = ErrRangeNotSatisfied
+	case http.StatusOK:
+		rangeErr.err = ErrRangeIgnored
+	case http.StatusRequestedRangeNotSatisfiable:
+		rangeErr.err = ErrRangeNotSatisfied
+	default:
+		return resp, nil
+	}
+	closeResponse(resp)
+	return nil, rangeErr
+}
+
+// parseContentRange parses a Content-Range such as "bytes 100-199/200" or "bytes 100-199/*",
+// and returns the first and the last byte positions.
+func parseContentRange(contentRange string) (start, end int64, ok bool) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, 0, false
+	}
+	r := strings.TrimPrefix(contentRange, "bytes ")
+	if i := strings.IndexByte(r, '/'); i >= 0 {
+		r = r[:i]
+	}
+	i := strings.IndexByte(r, '-')
+	if i < 0 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(r[:i], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err = strconv.ParseInt(r[i+1:], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
@@ -0,0 +1,113 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+const testRangeContent = "0123456789abcdefghij"
+
+func TestClient_GetRange(t *testing.T) {
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewTestServer(t, map[string]http.HandlerFunc{
+		"/file": func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "file", modTime, strings.NewReader(testRangeContent))
+		},
+		"/ignore": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(testRangeContent))
+		},
+		"/wrong": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-4/20")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write([]byte(testRangeContent[:5]))
+		},
+	})
+	c := NewClient()
+	ctx := context.Background()
+
+	resp, err := c.GetRange(ctx, s.URL("/file"), 5, 9)
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	require.Equal(t, "56789", string(body))
+	require.Equal(t, "bytes=5-9", s.LastRequest("/file").Header.Get("Range"))
+
+	resp, err = c.GetRange(ctx, s.URL("/file"), 15, -1)
+	require.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "fghij", string(body))
+
+	_, err = c.GetRange(ctx, s.URL("/ignore"), 5, 9)
+	require.True(t, errors.Is(err, ErrRangeIgnored))
+	var rangeErr *RangeError
+	require.ErrorAs(t, err, &rangeErr)
+	require.Equal(t, http.StatusOK, rangeErr.StatusCode)
+
+	_, err = c.GetRange(ctx, s.URL("/wrong"), 5, 9)
+	require.True(t, errors.Is(err, ErrRangeNotSatisfied))
+	require.False(t, errors.Is(err, ErrRangeIgnored))
+
+	_, err = c.GetRange(ctx, s.URL("/file"), 100, 200)
+	require.True(t, errors.Is(err, ErrRangeNotSatisfied))
+
+	_, err = c.GetRange(ctx, s.URL("/file"), 9, 5)
+	require.NotNil(t, err)
+}
+
+func TestClient_GetRangeCache(t *testing.T) {
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewTestServer(t, map[string]http.HandlerFunc{
+		"/file": func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "file", modTime, bytes.NewReader([]byte(testRangeContent)))
+		},
+		"/ignore": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(testRangeContent))
+		},
+	})
+	c := NewClient(WithCacheOption(NewMemoryCacheOption()))
+	ctx := context.Background()
+	get := func(start, end int64) string {
+		resp, err := c.GetRange(ctx, s.URL("/file"), start, end)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return string(body)
+	}
+
+	// The full body is cached, and never serves a range.
+	body, err := c.GetBytes(s.URL("/file"))
+	require.Nil(t, err)
+	require.Equal(t, testRangeContent, string(body))
+	require.Equal(t, "01234", get(0, 4))
+	require.Equal(t, 2, s.RequestCount("/file"))
+
+	// Each range is cached separately.
+	require.Equal(t, "56789", get(5, 9))
+	require.Equal(t, 3, s.RequestCount("/file"))
+	require.Equal(t, "01234", get(0, 4))
+	require.Equal(t, "56789", get(5, 9))
+	require.Equal(t, 3, s.RequestCount("/file"))
+	body, err = c.GetBytes(s.URL("/file"))
+	require.Nil(t, err)
+	require.Equal(t, testRangeContent, string(body))
+	require.Equal(t, 3, s.RequestCount("/file"))
+
+	// A full body returned for a range is not cached for it.
+	for i := 0; i < 2; i++ {
+		_, err = c.GetRange(ctx, s.URL("/ignore"), 0, 4)
+		require.True(t, errors.Is(err, ErrRangeIgnored))
+	}
+	require.Equal(t, 2, s.RequestCount("/ignore"))
+}
@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"go.uber.org/ratelimit"
 )
@@ -23,11 +24,7 @@ var defaultRateLimitFunc RateLimitFunc = func(req *http.Request, option RateLimi
 		key = fmt.Sprintf("%s %s", req.Method, strings.ToLower(getURLStringEndWithPath(req.URL)))
 	}
 
-	val, _ := option.RateLimits.LoadOrStore(key, option.RateLimitConstructor())
-	rl := val.(ratelimit.Limiter)
-	_ = rl.Take()
-
-	return nil
+	return takeRateLimit(req, option, key)
 }
 
 // RateLimitAllRequestsFunc enforces a rate limit, each request is included in the rate limit,
@@ -35,19 +32,46 @@ var defaultRateLimitFunc RateLimitFunc = func(req *http.Request, option RateLimi
 var RateLimitAllRequestsFunc RateLimitFunc = func(req *http.Request, option RateLimitOption) error {
 	key := "__all__"
 
-	val, _ := option.RateLimits.LoadOrStore(key, option.RateLimitConstructor())
+	return takeRateLimit(req, option, key)
+}
+
+// takeRateLimit waits for a token of the rate limiter of the key.
+func takeRateLimit(req *http.Request, option RateLimitOption, key string) error {
+	if option.RateLimits == nil {
+		return &MisconfiguredHandlerError{Handler: "RateLimit", Field: "RateLimits"}
+	}
+	val, ok := option.RateLimits.Load(key)
+	if !ok {
+		if option.RateLimitConstructor == nil {
+			return &MisconfiguredHandlerError{Handler: "RateLimit", Field: "RateLimitConstructor"}
+		}
+		val, _ = option.RateLimits.LoadOrStore(key, newStateLimiter(option.RateLimitConstructor(), option.Rate, option.Clock))
+	}
 	rl := val.(ratelimit.Limiter)
-	_ = rl.Take()
 
+	e := explainRequest(req)
+	if e == nil {
+		_ = rl.Take()
+		return nil
+	}
+	start := time.Now()
+	_ = rl.Take()
+	d := time.Since(start)
+	e.add("ratelimit", "wait", d, "waited %s key=%s", d, key)
 	return nil
 }
 
 // RateLimitOption defines a rate limit option configuration.
+// The copies of an option share its RateLimits, which is safe for concurrent use,
+// so passing the same option to several clients enforces one rate of each key across all of them.
 type RateLimitOption struct {
 	Rate                 int
 	RateLimitConstructor RateLimitConstructor
-	RateLimits           *sync.Map
-	RateLimitFunc        RateLimitFunc
+	// RateLimits stores the rate limiter of each key, such as the method and the URL of the requests.
+	RateLimits    *sync.Map
+	RateLimitFunc RateLimitFunc
+	// Clock is the source of time of the waits restored by Client.ImportState, RealClock is used when it is nil.
+	Clock Clock
 }
 
 func (r RateLimitOption) isEnabled() bool {
@@ -73,10 +97,20 @@ func NewRateLimitOption(rate int) RateLimitOption {
 	}
 }
 
+// take enforces the rate limit by the RateLimitFunc, or by the default one when it is nil.
+func (r RateLimitOption) take(req *http.Request) error {
+	if r.RateLimitFunc == nil {
+		return defaultRateLimitFunc(req, r)
+	}
+	return r.RateLimitFunc(req, r)
+}
+
 // RateLimitHandler creates a rate-limiting interceptor that limits the maximum number of requests per second.
+// The default RateLimitFunc is used when it is nil, and a MisconfiguredHandlerError is returned
+// when the rate limiter of a request can not be created.
 func RateLimitHandler(option RateLimitOption) RequestHandler {
 	return func(req *http.Request, handlerFunc RequestHandlerFunc) (resp *http.Response, err error) {
-		err = option.RateLimitFunc(req, option)
+		err = option.take(req)
 		if err != nil {
 			return
 		}
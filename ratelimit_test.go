@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 	"time"
@@ -111,3 +112,34 @@ func TestGetURLStringEndWithPath(t *testing.T) {
 		require.Equal(t, c.Output, result)
 	}
 }
+
+func TestRateLimitOption_SharedByClients(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// The two clients share 100 requests per second, so 10 requests take at least 90ms,
+	// instead of 40ms when each has its own rate.
+	rate := 100
+	times := 10
+	option := NewRateLimitOption(rate)
+	clients := []*Client{
+		NewClient(WithRateLimitOption(option)),
+		NewClient(WithRateLimitOption(option)),
+	}
+
+	startTime := time.Now()
+	for i := 0; i < times; i++ {
+		resp, err := clients[i%2].Get(ts.URL)
+		require.Nil(t, err)
+		resp.Body.Close()
+	}
+	minTakes := time.Second / time.Duration(rate) * time.Duration(times-1)
+	require.GreaterOrEqual(t, time.Since(startTime), minTakes)
+
+	n := 0
+	option.RateLimits.Range(func(key, val interface{}) bool {
+		n++
+		return true
+	})
+	require.Equal(t, 1, n)
+}
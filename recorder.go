@@ -0,0 +1,173 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// recorderFileExt is the extension of the files written by RecorderHandler.
+const recorderFileExt = ".entry"
+
+// RecorderOption is used to record the requests and responses to files, which can be served by a replay server later.
+type RecorderOption struct {
+	Dir string
+	// SampleRate is the ratio of the requests that are recorded, between 0 and 1.
+	SampleRate float64
+	// EncoderDecoder serializes the entries, it is the same one used by the cache by default.
+	EncoderDecoder RequestEntryEncoderDecoder
+	// RandFunc returns a number in [0, 1) to sample the requests.
+	RandFunc func() float64
+	// Clock is the source of time for the file names, RealClock is used when it is nil.
+	Clock Clock
+}
+
+// NewRecorderOption creates an option configuration that records a sampled subset of the requests to dir,
+// each request and its response is written to a timestamped file.
+func NewRecorderOption(dir string, sampleRate float64) RecorderOption {
+	return RecorderOption{
+		Dir:            dir,
+		SampleRate:     sampleRate,
+		EncoderDecoder: requestEntryEncoderDecoder{},
+		RandFunc:       rand.Float64,
+	}
+}
+
+func (o RecorderOption) isEnabled() bool {
+	return o.Dir != "" && o.SampleRate > 0 && o.EncoderDecoder != nil && o.RandFunc != nil
+}
+
+// RecorderHandler creates an interceptor that records the sampled requests and their responses to files.
+// A request that fails to be recorded is only logged as a warning, its response is returned as is.
+// The streaming requests are not recorded, see MarkStreaming.
+func RecorderHandler(option RecorderOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil || isStreamingRequest(req) || option.RandFunc() >= option.SampleRate {
+			return handlerFunc(req)
+		}
+
+		var reqBody []byte
+		if req.Body != nil && req.Body != http.NoBody {
+			var err error
+			reqBody, err = copyHTTPRequestBody(req)
+			if err != nil {
+				return nil, errors.Wrap(err, "Read the request body")
+			}
+		}
+
+		resp, err := handlerFunc(req)
+
+		recorded := *req
+		recorded.Body = io.NopCloser(bytes.NewReader(reqBody))
+		now := getClock(option.Clock).Now()
+		value, encodeErr := option.EncoderDecoder.Encode(RequestEntry{
+			Request:  &recorded,
+			Response: resp,
+			Error:    err,
+			StoredAt: now,
+		})
+		if encodeErr != nil {
+			logrus.WithError(encodeErr).Warn("gohttpclient encode recorded request")
+			return resp, err
+		}
+
+		name := fmt.Sprintf("%s-%08x%s", now.UTC().Format("20060102T150405.000000000Z"), rand.Uint32(), recorderFileExt)
+		if writeErr := writeFileAtomic(context.Background(), filepath.Join(option.Dir, name), value, 0600); writeErr != nil {
+			logrus.WithError(writeErr).WithField("dir", option.Dir).Warn("gohttpclient write recorded request")
+		}
+		return resp, err
+	}
+}
+
+// NewReplayHandler creates an http.Handler that serves the responses recorded in dir by RecorderHandler.
+// The requests are matched by the method and the request URI,
+// the responses of the same request are served in the recorded order, and the last one is repeated.
+// The requests that were not recorded get a 404 response.
+func NewReplayHandler(dir string, encoderDecoder RequestEntryEncoderDecoder) (http.Handler, error) {
+	if encoderDecoder == nil {
+		encoderDecoder = requestEntryEncoderDecoder{}
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+recorderFileExt))
+	if err != nil {
+		return nil, errors.Wrap(err, "List the recorded files")
+	}
+	sort.Strings(names)
+
+	h := &replayHandler{entries: make(map[string][]RequestEntry), served: make(map[string]int)}
+	for _, name := range names {
+		value, err := os.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Read the recorded file '%s'", name)
+		}
+		re, err := encoderDecoder.Decode(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Decode the recorded file '%s'", name)
+		}
+		key := replayKey(re.Request)
+		h.entries[key] = append(h.entries[key], re)
+	}
+	return h, nil
+}
+
+// NewReplayServer starts a local server that serves the responses recorded in dir, see NewReplayHandler.
+// The recorded URLs are matched by the request URI only, so point the client at the URL of the server.
+func NewReplayServer(dir string) (*httptest.Server, error) {
+	h, err := NewReplayHandler(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httptest.NewServer(h), nil
+}
+
+type replayHandler struct {
+	mu      sync.Mutex
+	entries map[string][]RequestEntry
+	served  map[string]int
+}
+
+func (h *replayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := replayKey(r)
+
+	h.mu.Lock()
+	entries := h.entries[key]
+	i := h.served[key]
+	if i < len(entries)-1 {
+		h.served[key] = i + 1
+	}
+	h.mu.Unlock()
+
+	if len(entries) == 0 {
+		http.Error(w, "No recorded response for "+key, http.StatusNotFound)
+		return
+	}
+	re := entries[i]
+	if re.Response == nil {
+		http.Error(w, fmt.Sprintf("Recorded error for %s: %v", key, re.Error), http.StatusBadGateway)
+		return
+	}
+
+	for k, values := range re.Response.Header {
+		if strings.EqualFold(k, "Content-Length") {
+			continue
+		}
+		w.Header()[k] = values
+	}
+	w.WriteHeader(re.Response.StatusCode)
+	_, _ = io.Copy(w, re.Response.Body)
+}
+
+func replayKey(req *http.Request) string {
+	return req.Method + " " + req.URL.RequestURI()
+}
@@ -0,0 +1,170 @@
+package gohttpclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderAndReplayServer(t *testing.T) {
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Count", strings.Repeat("n", n))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(r.Method + ":" + r.URL.RequestURI() + ":" + string(body)))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	c := NewClient(WithRecorder(dir, 1))
+
+	resp, err := c.Get(ts.URL + "/a?x=1")
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "GET:/a?x=1:", string(body))
+
+	resp, err = c.Post(ts.URL+"/b", "text/plain", strings.NewReader("hello"))
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, "POST:/b:hello", string(body))
+
+	resp, err = c.Get(ts.URL + "/a?x=1")
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+recorderFileExt))
+	require.Nil(t, err)
+	require.Len(t, names, 3)
+
+	rs, err := NewReplayServer(dir)
+	require.Nil(t, err)
+	defer rs.Close()
+
+	replay := func(method, uri, body string) (*http.Response, string) {
+		req, err := http.NewRequest(method, rs.URL+uri, strings.NewReader(body))
+		require.Nil(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return resp, string(b)
+	}
+
+	resp, body2 := replay(http.MethodGet, "/a?x=1", "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "n", resp.Header.Get("X-Count"))
+	require.Equal(t, "GET:/a?x=1:", body2)
+
+	resp, _ = replay(http.MethodGet, "/a?x=1", "")
+	require.Equal(t, "nnn", resp.Header.Get("X-Count"))
+	resp, _ = replay(http.MethodGet, "/a?x=1", "")
+	require.Equal(t, "nnn", resp.Header.Get("X-Count"))
+
+	resp, body2 = replay(http.MethodPost, "/b", "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "POST:/b:hello", body2)
+
+	resp, _ = replay(http.MethodGet, "/missing", "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRecorderSampleRate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	c := NewClient(WithRecorder(dir, 0))
+	require.False(t, c.recorderOption.isEnabled())
+
+	option := NewRecorderOption(dir, 0.5)
+	samples := []float64{0.7, 0.2}
+	option.RandFunc = func() float64 {
+		v := samples[0]
+		samples = samples[1:]
+		return v
+	}
+	handler := RecorderHandler(option)
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		require.Nil(t, err)
+		resp, err := handler(req, http.DefaultClient.Do)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		require.Equal(t, "ok", string(body))
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestRecorderSkipsStreamingRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	c := NewClient(WithRecorder(dir, 1), WithStreamingMode())
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 0)
+}
+
+type testFailingEncoderDecoder struct {
+	requestEntryEncoderDecoder
+}
+
+func (testFailingEncoderDecoder) Encode(entry RequestEntry) ([]byte, error) {
+	return nil, errors.New("encode failed")
+}
+
+func TestRecorderFailures(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	encodeFailed := NewRecorderOption(t.TempDir(), 1)
+	encodeFailed.EncoderDecoder = testFailingEncoderDecoder{}
+	writeFailed := NewRecorderOption(filepath.Join(t.TempDir(), "missing"), 1)
+
+	// The failures of the recording are logged, and the responses are returned as is.
+	for _, option := range []RecorderOption{encodeFailed, writeFailed} {
+		hook.Reset()
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		require.Nil(t, err)
+		resp, err := RecorderHandler(option)(req, http.DefaultClient.Do)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		require.Equal(t, "ok", string(body))
+		require.Nil(t, resp.Body.Close())
+		require.Len(t, hook.AllEntries(), 1)
+		require.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	}
+}
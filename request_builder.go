@@ -0,0 +1,154 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RequestBuilder builds a request fluently, see Client.NewRequest.
+// The first error of the builder, such as a bad URL or a body that can not be marshaled,
+// is kept by it and returned by Build and Do, the later calls do not replace it.
+type RequestBuilder struct {
+	c           *Client
+	method      string
+	url         *url.URL
+	query       url.Values
+	header      http.Header
+	ctx         context.Context
+	body        io.Reader
+	contentType string
+	err         error
+}
+
+// NewRequest creates a builder of a request of the method and the URL, which is sent by the client, for example,
+//
+//	resp, err := c.NewRequest(http.MethodPost, "https://example.com/items").
+//		Query("page", "2").
+//		Header("X-Tenant", tenant).
+//		JSONBody(item).
+//		Context(ctx).
+//		Do()
+func (c *Client) NewRequest(method, rawURL string) *RequestBuilder {
+	b := &RequestBuilder{
+		c:      c,
+		method: method,
+		query:  url.Values{},
+		header: http.Header{},
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		b.setErr(errors.Wrap(err, "Parse the request URL"))
+	}
+	b.url = u
+	return b
+}
+
+func (b *RequestBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Query adds the query param, after the ones of the URL. The params given more than once are all kept.
+func (b *RequestBuilder) Query(key, value string) *RequestBuilder {
+	b.query.Add(key, value)
+	return b
+}
+
+// Header adds the request header, the headers given more than once are all kept.
+func (b *RequestBuilder) Header(key, value string) *RequestBuilder {
+	b.header.Add(key, value)
+	return b
+}
+
+// Context sets the context of the request, the default is context.Background().
+func (b *RequestBuilder) Context(ctx context.Context) *RequestBuilder {
+	b.ctx = ctx
+	return b
+}
+
+// JSONBody sets the body to the JSON encoding of v, with the application/json content type.
+func (b *RequestBuilder) JSONBody(v interface{}) *RequestBuilder {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.setErr(errors.Wrap(err, "Marshal the JSON request body"))
+		return b
+	}
+	return b.setBody(bytes.NewReader(data), "application/json")
+}
+
+// FormBody sets the body to the URL encoded form of values, with the application/x-www-form-urlencoded content type.
+func (b *RequestBuilder) FormBody(values url.Values) *RequestBuilder {
+	return b.setBody(strings.NewReader(values.Encode()), "application/x-www-form-urlencoded")
+}
+
+// BytesBody sets the body to data, the content type can be set by Header.
+func (b *RequestBuilder) BytesBody(data []byte) *RequestBuilder {
+	return b.setBody(bytes.NewReader(data), "")
+}
+
+// BodyReader sets the body to r, the content type can be set by Header.
+// The request can only be retried with the body when r is a *bytes.Buffer, *bytes.Reader or *strings.Reader,
+// as for http.NewRequest.
+func (b *RequestBuilder) BodyReader(r io.Reader) *RequestBuilder {
+	return b.setBody(r, "")
+}
+
+func (b *RequestBuilder) setBody(r io.Reader, contentType string) *RequestBuilder {
+	b.body = r
+	b.contentType = contentType
+	return b
+}
+
+// Err returns the first error of the builder.
+func (b *RequestBuilder) Err() error {
+	return b.err
+}
+
+// Build returns the request, which can be sent by Client.Do, or the first error of the builder.
+// The bodies of JSONBody, FormBody and BytesBody have a GetBody, so that the request can be retried.
+func (b *RequestBuilder) Build() (*http.Request, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	ctx := b.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	u := *b.url
+	if len(b.query) > 0 {
+		if u.RawQuery == "" {
+			u.RawQuery = b.query.Encode()
+		} else {
+			u.RawQuery += "&" + b.query.Encode()
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, b.method, u.String(), b.body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range b.header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	if b.contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", b.contentType)
+	}
+	return req, nil
+}
+
+// Do builds the request and sends it by the client.
+func (b *RequestBuilder) Do() (*http.Response, error) {
+	req, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return b.c.Do(req)
+}
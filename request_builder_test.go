@@ -0,0 +1,123 @@
+package gohttpclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBuilder_Query(t *testing.T) {
+	c := NewClient()
+
+	req, err := c.NewRequest(http.MethodGet, "https://example.com/items").
+		Query("page", "2").
+		Query("q", "a b&c").
+		Build()
+	require.Nil(t, err)
+	require.Equal(t, "https://example.com/items?page=2&q=a+b%26c", req.URL.String())
+
+	// The params are added after the ones of the URL.
+	req, err = c.NewRequest(http.MethodGet, "https://example.com/items?sort=desc&page=1").
+		Query("page", "2").
+		Build()
+	require.Nil(t, err)
+	require.Equal(t, "sort=desc&page=1&page=2", req.URL.RawQuery)
+	require.Equal(t, []string{"1", "2"}, req.URL.Query()["page"])
+}
+
+func TestRequestBuilder_Header(t *testing.T) {
+	req, err := NewClient().NewRequest(http.MethodPost, "https://example.com").
+		Header("X-Tenant", "a").
+		Header("X-Tenant", "b").
+		Header("Content-Type", "application/vnd.api+json").
+		JSONBody(map[string]int{"n": 1}).
+		Build()
+	require.Nil(t, err)
+	require.Equal(t, []string{"a", "b"}, req.Header.Values("X-Tenant"))
+	require.Equal(t, "application/vnd.api+json", req.Header.Get("Content-Type"))
+}
+
+func TestRequestBuilder_Body(t *testing.T) {
+	c := NewClient()
+
+	req, err := c.NewRequest(http.MethodPost, "https://example.com").JSONBody(map[string]int{"n": 1}).Build()
+	require.Nil(t, err)
+	require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	require.Equal(t, int64(len(`{"n":1}`)), req.ContentLength)
+	body, err := io.ReadAll(req.Body)
+	require.Nil(t, err)
+	require.Equal(t, `{"n":1}`, string(body))
+	// The body can be read again for a retry.
+	rc, err := req.GetBody()
+	require.Nil(t, err)
+	body, err = io.ReadAll(rc)
+	require.Nil(t, err)
+	require.Equal(t, `{"n":1}`, string(body))
+
+	req, err = c.NewRequest(http.MethodPost, "https://example.com").FormBody(url.Values{"a": {"1"}}).Build()
+	require.Nil(t, err)
+	require.Equal(t, "application/x-www-form-urlencoded", req.Header.Get("Content-Type"))
+	require.NotNil(t, req.GetBody)
+
+	req, err = c.NewRequest(http.MethodPut, "https://example.com").BytesBody([]byte("hello")).Build()
+	require.Nil(t, err)
+	require.Empty(t, req.Header.Get("Content-Type"))
+	require.Equal(t, int64(5), req.ContentLength)
+	require.NotNil(t, req.GetBody)
+
+	req, err = c.NewRequest(http.MethodPut, "https://example.com").BodyReader(io.LimitReader(nil, 0)).Build()
+	require.Nil(t, err)
+	require.Nil(t, req.GetBody)
+}
+
+func TestRequestBuilder_Err(t *testing.T) {
+	c := NewClient()
+
+	b := c.NewRequest(http.MethodPost, "https://example.com").JSONBody(func() {})
+	require.NotNil(t, b.Err())
+	_, err := b.Do()
+	require.Equal(t, b.Err(), err)
+	var jsonErr *json.UnsupportedTypeError
+	require.ErrorAs(t, err, &jsonErr)
+
+	// The first error is kept.
+	b = c.NewRequest(http.MethodGet, "://bad").JSONBody(func() {})
+	_, err = b.Build()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "Parse the request URL")
+}
+
+func TestRequestBuilder_Do(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]string
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&in))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"page":   r.URL.Query().Get("page"),
+			"tenant": r.Header.Get("X-Tenant"),
+			"name":   in["name"],
+		})
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp, err := NewClient().NewRequest(http.MethodPost, ts.URL).
+		Query("page", "2").
+		Header("X-Tenant", "t1").
+		JSONBody(map[string]string{"name": "item"}).
+		Context(ctx).
+		Do()
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var out map[string]string
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&out))
+	require.Equal(t, map[string]string{"page": "2", "tenant": "t1", "name": "item"}, out)
+}
@@ -0,0 +1,24 @@
+package gohttpclient
+
+import (
+	"net/http"
+)
+
+// captureRequestTransport calls capture with a copy of each request before it is sent by the transport.
+type captureRequestTransport struct {
+	rt      http.RoundTripper
+	capture func(req *http.Request)
+}
+
+func (t *captureRequestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.capture(req.Clone(req.Context()))
+	return t.rt.RoundTrip(req)
+}
+
+// withCapturedRequest wraps rt, or http.DefaultTransport when it is nil, to capture the requests it sends.
+func withCapturedRequest(rt http.RoundTripper, capture func(req *http.Request)) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &captureRequestTransport{rt: rt, capture: capture}
+}
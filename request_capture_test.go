@@ -0,0 +1,55 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCapturedRequest(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	})
+	var mu sync.Mutex
+	var captured []*http.Request
+	traceOption := NewTraceOption()
+	traceOption.Tracer = mocktracer.New()
+	c := NewClient(
+		WithDefaultHeader("X-Api-Key", "key"),
+		WithTraceOption(traceOption),
+		WithRoundTripperWrapper(func(rt http.RoundTripper) http.RoundTripper {
+			return testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req.Header.Set("X-Signature", "signed")
+				return rt.RoundTrip(req)
+			})
+		}),
+		WithMaxRetry(1),
+		WithRetryBackOff(&backoff.ZeroBackOff{}),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithCapturedRequest(func(req *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			captured = append(captured, req)
+		}),
+	)
+
+	resp, err := c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+
+	// Each attempt is captured with the headers of the interceptors, the wrappers and the tracing.
+	require.Len(t, captured, 2)
+	for _, req := range captured {
+		require.Equal(t, ts.URL("/"), req.URL.String())
+		require.Equal(t, "key", req.Header.Get("X-Api-Key"))
+		require.Equal(t, "signed", req.Header.Get("X-Signature"))
+		require.NotEmpty(t, req.Header.Get("mockpfx-ids-traceid"))
+		require.Equal(t, req.Header.Get("X-Signature"), ts.LastRequest("/").Header.Get("X-Signature"))
+	}
+}
@@ -0,0 +1,137 @@
+package gohttpclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrResponseHeadersTooLarge is the error that matches, by errors.Is, the errors returned when the response headers exceed the limits.
+var ErrResponseHeadersTooLarge = errors.New("The server response headers are too large")
+
+// ResponseHeadersTooLargeError is returned when the response headers exceed the limits,
+// Name is the header that exceeded the limit, it is empty when the transport stopped reading the headers.
+type ResponseHeadersTooLargeError struct {
+	Name  string
+	Limit int
+	Size  int
+	// Reason is one of "bytes" or "count".
+	Reason string
+}
+
+func (e *ResponseHeadersTooLargeError) Error() string {
+	if e.Name == "" && e.Limit <= 0 {
+		return fmt.Sprintf("The server response headers are too large: exceed the %s limit of the transport", e.Reason)
+	}
+	if e.Name == "" {
+		return fmt.Sprintf("The server response headers are too large: exceed the %s limit %d", e.Reason, e.Limit)
+	}
+	return fmt.Sprintf("The server response headers are too large: header '%s' exceeds the %s limit %d with %d", e.Name, e.Reason, e.Limit, e.Size)
+}
+
+// Is reports whether the target is ErrResponseHeadersTooLarge.
+func (e *ResponseHeadersTooLargeError) Is(target error) bool {
+	return target == ErrResponseHeadersTooLarge
+}
+
+// ResponseGuardOption is used to limit the size of the response headers, a limit of 0 means there is no limit.
+type ResponseGuardOption struct {
+	MaxResponseHeaderBytes int
+	MaxResponseHeaderCount int
+	// TransportMaxResponseHeaderBytes is the MaxResponseHeaderBytes of the http.Transport of the client,
+	// which is the limit reported when the transport stops reading the headers, 0 means it is unknown.
+	// NewClient sets it from the transport of the client.
+	TransportMaxResponseHeaderBytes int
+}
+
+// defaultTransportMaxResponseHeaderBytes is the limit of http.Transport when its MaxResponseHeaderBytes is 0.
+const defaultTransportMaxResponseHeaderBytes = 10 << 20
+
+// transportMaxResponseHeaderBytes returns the limit of the response headers of the transport, 0 when it is unknown.
+func transportMaxResponseHeaderBytes(rt http.RoundTripper) int {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return 0
+	}
+	if t.MaxResponseHeaderBytes > 0 {
+		return int(t.MaxResponseHeaderBytes)
+	}
+	return defaultTransportMaxResponseHeaderBytes
+}
+
+// NewResponseGuardOption creates an option configuration with generous limits,
+// 1MB for the total bytes of the keys and values of the response headers, and 1000 for the count of the header values.
+// They are the limits used by the client by default.
+func NewResponseGuardOption() ResponseGuardOption {
+	return ResponseGuardOption{
+		MaxResponseHeaderBytes: 1024 * 1024,
+		MaxResponseHeaderCount: 1000,
+	}
+}
+
+func (o ResponseGuardOption) isEnabled() bool {
+	return o.MaxResponseHeaderBytes > 0 || o.MaxResponseHeaderCount > 0
+}
+
+// ResponseGuardHandler is the interceptor that rejects the responses whose headers exceed the limits,
+// the body of a rejected response is drained and closed,
+// and the interceptors before it, such as the logger and the cache, only see the error.
+// The headers have already been read when the interceptor runs, and http.Transport stops reading them
+// at its MaxResponseHeaderBytes, which is 10MB by default, set it lower to bound the memory used by an absurd response,
+// the error of the transport is also returned as a ResponseHeadersTooLargeError with the limit of the transport.
+func ResponseGuardHandler(option ResponseGuardOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		resp, err := handlerFunc(req)
+		if err != nil {
+			if option.MaxResponseHeaderBytes > 0 && isTransportHeaderLimitError(err) {
+				return nil, &ResponseHeadersTooLargeError{Limit: option.TransportMaxResponseHeaderBytes, Reason: "bytes"}
+			}
+			return resp, err
+		}
+		if resp == nil {
+			return resp, err
+		}
+
+		sizeOption := HeaderSizeOption{
+			MaxHeaderBytes: option.MaxResponseHeaderBytes,
+			MaxHeaderCount: option.MaxResponseHeaderCount,
+		}
+		if err := checkResponseHeaderSize(sizeOption, resp.Header); err != nil {
+			closeResponse(resp)
+			var e *HeadersTooLargeError
+			if errors.As(err, &e) {
+				return nil, &ResponseHeadersTooLargeError{Name: e.Name, Limit: e.Limit, Size: e.Size, Reason: e.Reason}
+			}
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// checkResponseHeaderSize is checkHeaderSize without sorting the keys of the headers of every response,
+// the keys are only sorted to report a stable name when a limit is exceeded.
+func checkResponseHeaderSize(option HeaderSizeOption, h http.Header) error {
+	totalBytes, totalCount := 0, 0
+	for key, values := range h {
+		totalCount += len(values)
+		for _, value := range values {
+			totalBytes += len(key) + len(value)
+		}
+	}
+	if (option.MaxHeaderBytes > 0 && totalBytes > option.MaxHeaderBytes) ||
+		(option.MaxHeaderCount > 0 && totalCount > option.MaxHeaderCount) {
+		return checkHeaderSize(option, h)
+	}
+	return nil
+}
+
+// isTransportHeaderLimitError reports whether the error is returned by http.Transport
+// when the response headers exceed its MaxResponseHeaderBytes, which is not a typed error.
+func isTransportHeaderLimitError(err error) bool {
+	return strings.Contains(err.Error(), "server response headers exceeded")
+}
@@ -0,0 +1,132 @@
+package gohttpclient
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManyHeadersServer(n int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < n; i++ {
+			w.Header().Add("Set-Cookie", fmt.Sprintf("c%d=v", i))
+		}
+		_, _ = w.Write([]byte("hello world"))
+	}))
+}
+
+func TestResponseGuardHandler_Count(t *testing.T) {
+	srv := newTestManyHeadersServer(3000)
+	defer srv.Close()
+
+	var loggerEntry *LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		loggerEntry = &e
+	}
+	cacheOption := NewMemoryCacheOption()
+	c := NewClient(WithLoggerOption(loggerOption), WithCacheOption(cacheOption))
+
+	resp, err := c.Get(srv.URL)
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrResponseHeadersTooLarge))
+	var e *ResponseHeadersTooLargeError
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, "Set-Cookie", e.Name)
+	require.Equal(t, "count", e.Reason)
+	require.Equal(t, 1000, e.Limit)
+
+	require.NotNil(t, loggerEntry)
+	require.Nil(t, loggerEntry.ResponseHeader)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	_, err = cacheOption.Cacher.Get(cacheOption.RequestHashFunc(req, nil, nil))
+	require.Equal(t, ErrCacheKeyNotFound, err)
+
+	c = NewClient(WithMaxResponseHeaderCount(0))
+	resp, err = c.Get(srv.URL)
+	require.Nil(t, err)
+	require.Len(t, resp.Header.Values("Set-Cookie"), 3000)
+	_ = resp.Body.Close()
+}
+
+func TestResponseGuardHandler_Bytes(t *testing.T) {
+	handler := ResponseGuardHandler(ResponseGuardOption{MaxResponseHeaderBytes: 100})
+	body := &testTrackingBody{Reader: bytes.NewBufferString("hello world")}
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set("A", "1")
+		header.Set("B", string(bytes.Repeat([]byte("b"), 100)))
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: body}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, resp)
+	require.Equal(t, &ResponseHeadersTooLargeError{Name: "B", Limit: 100, Size: 103, Reason: "bytes"}, err)
+	require.True(t, body.closed)
+	require.Equal(t, "The server response headers are too large: header 'B' exceeds the bytes limit 100 with 103", err.Error())
+
+	handler = ResponseGuardHandler(ResponseGuardOption{})
+	body = &testTrackingBody{Reader: bytes.NewBufferString("hello world")}
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	require.False(t, body.closed)
+}
+
+func TestResponseGuardHandler_TransportLimit(t *testing.T) {
+	var response bytes.Buffer
+	response.WriteString("HTTP/1.1 200 OK\r\n")
+	for i := 0; i < 200000; i++ {
+		fmt.Fprintf(&response, "Set-Cookie: cookie%d=%0100d\r\n", i, i)
+	}
+	response.WriteString("Content-Length: 0\r\n\r\n")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = http.ReadRequest(bufio.NewReader(conn))
+				_, _ = io.Copy(conn, bytes.NewReader(response.Bytes()))
+			}()
+		}
+	}()
+
+	c := NewClient(WithHTTPClient(&http.Client{Transport: &http.Transport{MaxResponseHeaderBytes: 512 * 1024}}))
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	resp, err := c.Get("http://" + ln.Addr().String())
+	runtime.ReadMemStats(&after)
+
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, ErrResponseHeadersTooLarge))
+	require.Equal(t, fmt.Sprintf("Get %q: The server response headers are too large: exceed the bytes limit 524288",
+		"http://"+ln.Addr().String()), err.Error())
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(response.Len()/2))
+
+	// The limit of a custom transport is unknown.
+	transport := testRoundTripperFunc((&http.Transport{MaxResponseHeaderBytes: 512 * 1024}).RoundTrip)
+	c = NewClient(WithHTTPClient(&http.Client{Transport: transport}))
+	_, err = c.Get("http://" + ln.Addr().String())
+	require.True(t, errors.Is(err, ErrResponseHeadersTooLarge))
+	require.Contains(t, err.Error(), "exceed the bytes limit of the transport")
+
+	require.Equal(t, defaultTransportMaxResponseHeaderBytes, NewClient().responseGuard.TransportMaxResponseHeaderBytes)
+}
@@ -0,0 +1,132 @@
+package gohttpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ResumableBodyOption is used to resume the response bodies of GET requests that fail in the middle of reading.
+type ResumableBodyOption struct {
+	// MaxResumes is the maximum number of Range requests made for a response body.
+	MaxResumes int
+}
+
+// NewResumableBodyOption creates an option configuration that resumes a response body at most maxResumes times.
+func NewResumableBodyOption(maxResumes int) ResumableBodyOption {
+	return ResumableBodyOption{MaxResumes: maxResumes}
+}
+
+func (o ResumableBodyOption) isEnabled() bool {
+	return o.MaxResumes > 0
+}
+
+// ResumableBodyHandler creates an interceptor that wraps the response bodies of GET requests,
+// so that an error in the middle of reading transparently issues a Range request for the remaining bytes,
+// and the caller reads the full body seamlessly.
+// A body is only resumed when the server sent Accept-Ranges: bytes and an ETag or a Last-Modified,
+// which is sent as If-Range so that a changed resource is never spliced,
+// otherwise the original read error is returned.
+// The encoded bodies, including the ones transparently decompressed by the transport, are never resumed,
+// because the offset of the decoded bytes is not a position in the representation the Range applies to.
+func ResumableBodyHandler(option ResumableBodyOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		resp, err := handlerFunc(req)
+		if err != nil || resp == nil || resp.Body == nil || req == nil ||
+			req.Method != http.MethodGet || req.Header.Get("Range") != "" || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+
+		if resp.Uncompressed || !isIdentityContentEncoding(resp.Header.Get("Content-Encoding")) {
+			return resp, err
+		}
+
+		validator := resp.Header.Get("ETag")
+		if validator == "" || strings.HasPrefix(validator, "W/") {
+			validator = resp.Header.Get("Last-Modified")
+		}
+		if validator == "" || !strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+			return resp, err
+		}
+
+		resp.Body = &resumableBody{
+			rc:          resp.Body,
+			req:         req,
+			handlerFunc: handlerFunc,
+			validator:   validator,
+			maxResumes:  option.MaxResumes,
+		}
+		return resp, nil
+	}
+}
+
+type resumableBody struct {
+	rc          io.ReadCloser
+	req         *http.Request
+	handlerFunc RequestHandlerFunc
+	validator   string
+	maxResumes  int
+
+	offset  int64
+	resumes int
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.rc.Read(p)
+		b.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if b.resumes >= b.maxResumes || !b.resume() {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume requests the remaining bytes, and replaces the body when the server returns them.
+func (b *resumableBody) resume() bool {
+	b.resumes++
+	req := b.req.Clone(b.req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+	req.Header.Set("If-Range", b.validator)
+
+	resp, err := b.handlerFunc(req)
+	if err != nil {
+		if resp != nil {
+			closeResponse(resp)
+		}
+		return false
+	}
+	if resp.StatusCode != http.StatusPartialContent || contentRangeStart(resp.Header.Get("Content-Range")) != b.offset {
+		closeResponse(resp)
+		return false
+	}
+
+	_ = b.rc.Close()
+	b.rc = resp.Body
+	return true
+}
+
+func (b *resumableBody) Close() error {
+	return b.rc.Close()
+}
+
+// isIdentityContentEncoding reports whether a Content-Encoding leaves the body unencoded.
+func isIdentityContentEncoding(encoding string) bool {
+	encoding = strings.TrimSpace(encoding)
+	return encoding == "" || strings.EqualFold(encoding, "identity")
+}
+
+// contentRangeStart returns the first byte position of a Content-Range such as "bytes 100-199/200", or -1.
+func contentRangeStart(contentRange string) int64 {
+	start, _, ok := parseContentRange(contentRange)
+	if !ok {
+		return -1
+	}
+	return start
+}
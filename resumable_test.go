@@ -0,0 +1,181 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testResumableServer struct {
+	content      []byte
+	etag         string
+	acceptRanges bool
+	encoding     string
+	// drops are the numbers of body bytes sent before dropping the connection of each request.
+	drops []int
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (s *testResumableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	i := len(s.requests)
+	s.requests = append(s.requests, r)
+	etag := s.etag
+	s.mu.Unlock()
+
+	start := 0
+	status := "200 OK"
+	if rng := r.Header.Get("Range"); rng != "" && r.Header.Get("If-Range") == etag {
+		start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		status = "206 Partial Content"
+	}
+
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(buf, "HTTP/1.1 %s\r\n", status)
+	fmt.Fprintf(buf, "Content-Length: %d\r\n", len(s.content)-start)
+	fmt.Fprintf(buf, "ETag: %s\r\n", etag)
+	if s.acceptRanges {
+		fmt.Fprintf(buf, "Accept-Ranges: bytes\r\n")
+	}
+	if s.encoding != "" {
+		fmt.Fprintf(buf, "Content-Encoding: %s\r\n", s.encoding)
+	}
+	if start > 0 {
+		fmt.Fprintf(buf, "Content-Range: bytes %d-%d/%d\r\n", start, len(s.content)-1, len(s.content))
+	}
+	fmt.Fprintf(buf, "Connection: close\r\n\r\n")
+	body := s.content[start:]
+	if i < len(s.drops) && s.drops[i] < len(body) {
+		body = body[:s.drops[i]]
+	}
+	_, _ = buf.Write(body)
+	_ = buf.Flush()
+}
+
+func newTestResumableServer(drops ...int) *testResumableServer {
+	return &testResumableServer{
+		content:      bytes.Repeat([]byte("0123456789"), 1000),
+		etag:         `"v1"`,
+		acceptRanges: true,
+		drops:        drops,
+	}
+}
+
+func TestResumableBodyHandler(t *testing.T) {
+	s := newTestResumableServer(3000, 2000)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := NewClient(WithResumableBodyReads(3))
+	body, err := c.GetBytes(srv.URL)
+	require.Nil(t, err)
+	require.Equal(t, s.content, body)
+
+	require.Len(t, s.requests, 3)
+	require.Equal(t, "", s.requests[0].Header.Get("Range"))
+	require.Equal(t, "bytes=3000-", s.requests[1].Header.Get("Range"))
+	require.Equal(t, `"v1"`, s.requests[1].Header.Get("If-Range"))
+	require.Equal(t, "bytes=5000-", s.requests[2].Header.Get("Range"))
+}
+
+func TestResumableBodyHandler_MaxResumes(t *testing.T) {
+	s := newTestResumableServer(1000, 1000, 1000)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := NewClient(WithResumableBodyReads(2))
+	_, err := c.GetBytes(srv.URL)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.Len(t, s.requests, 3)
+}
+
+func TestResumableBodyHandler_NotResumable(t *testing.T) {
+	// The resource changed, the server returns the full content instead of the range.
+	s := newTestResumableServer(1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			s.mu.Lock()
+			s.etag = `"v2"`
+			s.mu.Unlock()
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithResumableBodyReads(3))
+	_, err := c.GetBytes(srv.URL)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.Len(t, s.requests, 2)
+
+	// The server does not support ranges.
+	s = newTestResumableServer(1000)
+	s.acceptRanges = false
+	srv2 := httptest.NewServer(s)
+	defer srv2.Close()
+	_, err = c.GetBytes(srv2.URL)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.Len(t, s.requests, 1)
+
+	// Only GET requests are resumed.
+	s = newTestResumableServer(1000)
+	srv3 := httptest.NewServer(s)
+	defer srv3.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv3.URL, nil)
+	_, _, err = c.DoBytes(req)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.Len(t, s.requests, 1)
+}
+
+func TestResumableBodyHandler_Encoded(t *testing.T) {
+	content := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(content)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, _ = w.Write(content)
+	require.Nil(t, w.Close())
+
+	// The transport decompresses the body transparently, the offset of the decoded bytes must not be resumed.
+	s := newTestResumableServer(gz.Len() / 2)
+	s.content = gz.Bytes()
+	s.encoding = "gzip"
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := NewClient(WithResumableBodyReads(3))
+	_, err := c.GetBytes(srv.URL)
+	require.NotNil(t, err)
+	require.Len(t, s.requests, 1)
+
+	// The body is not decompressed when the caller asks for the encoding itself.
+	s.requests = nil
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	_, _, err = c.DoBytes(req)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	require.Len(t, s.requests, 1)
+}
+
+func TestContentRangeStart(t *testing.T) {
+	require.Equal(t, int64(100), contentRangeStart("bytes 100-199/200"))
+	require.Equal(t, int64(0), contentRangeStart("bytes 0-199/*"))
+	require.Equal(t, int64(-1), contentRangeStart("bytes */200"))
+	require.Equal(t, int64(-1), contentRangeStart("items 1-2/3"))
+	require.Equal(t, int64(-1), contentRangeStart(""))
+}
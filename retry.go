@@ -1,29 +1,248 @@
 package gohttpclient
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // ShouldRetryFunc defines a function that determines whether a retry is required.
 type ShouldRetryFunc func(*http.Request, *http.Response, error) bool
 
 // defaultShouldRetryFunc is the default function that determines whether to retry by default.
-// If the request fails or the response status code is greater than or equal to 500, it will be retried.
+// If the request fails or the response status code is greater than or equal to 500, it will be retried,
+// except for the RetryOption.PermanentStatusCodes, such as 501.
 var defaultShouldRetryFunc ShouldRetryFunc = func(req *http.Request, resp *http.Response, err error) bool {
 	ok := err == nil && resp != nil && resp.StatusCode < 500
 	return !ok
 }
 
+// retryBodyInspectSize is the maximum number of bytes of the response body inspected by RetryIfBodyContains.
+const retryBodyInspectSize = 64 * 1024
+
+// RetryIfBodyContains creates a ShouldRetryFunc that retries like the default one,
+// and also retries the responses whose body contains substr, such as a 200 with
+// the JSON error envelope {"code": "THROTTLED"}. At most the first 64KB of the body are inspected,
+// they are buffered and put back, so the response returned after the last attempt is read as usual.
+// The responses of streaming requests are not inspected, and a body that fails to be read is retried.
+func RetryIfBodyContains(substr string) ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		if defaultShouldRetryFunc(req, resp, err) {
+			return true
+		}
+		if resp == nil || resp.Body == nil || resp.Body == http.NoBody || isStreamingRequest(req) {
+			return false
+		}
+		prefix, readErr := io.ReadAll(io.LimitReader(resp.Body, retryBodyInspectSize))
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(prefix), resp.Body), resp.Body}
+		if readErr != nil {
+			return true
+		}
+		return bytes.Contains(prefix, []byte(substr))
+	}
+}
+
+// RetryDecision is the decision of a RetryDecisionFunc about a failed attempt.
+type RetryDecision int
+
+const (
+	// NoRetry returns the result of the attempt, such as for a certificate error or a 404,
+	// which would fail the same way on any endpoint.
+	NoRetry RetryDecision = iota
+	// RetryAfterBackoff retries the same endpoint after the back off, such as for a 429.
+	RetryAfterBackoff
+	// RetryImmediatelyElsewhere retries at once without the back off, such as for a refused connection,
+	// and marks the context of the next attempt for the endpoint selector, see RetryElsewhereFromContext.
+	RetryImmediatelyElsewhere
+)
+
+// RetryDecisionFunc defines a function that decides whether and how a failed attempt is retried.
+type RetryDecisionFunc func(*http.Request, *http.Response, error) RetryDecision
+
+// RetryElsewhereFromContext reports whether the request is an immediate retry of RetryImmediatelyElsewhere,
+// and returns the hosts of the attempts that failed before it, which an endpoint selector,
+// such as a custom transport or a DialContext, should avoid.
+func RetryElsewhereFromContext(ctx context.Context) ([]string, bool) {
+	hosts, ok := ctx.Value(retryElsewhereContextKey).([]string)
+	return hosts, ok
+}
+
 // RetryOption defines a retry option configuration.
 type RetryOption struct {
 	ShouldRetryFunc ShouldRetryFunc
 	MaxRetry        uint64
 	RetryBackOff    backoff.BackOff
+	// Clock is the source of time for the sleeps between retries, RealClock is used when it is nil.
+	Clock Clock
+	// RateLimitOption gates the retries through a rate limiter, each retry takes a token after the back off.
+	// The option can be the same one used by RateLimitHandler, or one shared by many clients,
+	// since the copies of a RateLimitOption share its rate limiters,
+	// so that the retry rate of a fleet is bounded instead of coming in synchronized waves.
+	// The first attempt does not take a token.
+	RateLimitOption *RateLimitOption
+	// OnRetry is called before the sleep of each retry with the number of the next attempt,
+	// the delay before it, and the result of the failed attempt, see WithRetryLog.
+	OnRetry OnRetryFunc
+	// RetryDecisionFunc decides how the failed attempts are retried and takes precedence over ShouldRetryFunc,
+	// which is the same as a RetryDecisionFunc that returns RetryAfterBackoff when it is true and NoRetry otherwise.
+	// The immediate retries count towards MaxRetry too.
+	RetryDecisionFunc RetryDecisionFunc
+	// RetryAfter uses the Retry-After header of the failed responses, in seconds or an HTTP date,
+	// as the delay before the retry instead of the back off. The back off applies when the header is absent or malformed.
+	RetryAfter bool
+	// MaxInterval caps the delay before each retry, including the one of RetryAfter, 0 means no cap.
+	// It is unlike the MaxElapsedTime of an exponential back off, which bounds the total time of the retries.
+	MaxInterval time.Duration
+	// MaxElapsedTime stops the retries once the time since the first attempt, including the delay
+	// before the next one, would exceed it, 0 means no limit. The last result is then returned as
+	// a RetryDeadlineExceededError. It applies to any back off, whichever of it and MaxRetry comes first,
+	// and it is independent of the deadline of the context of the request.
+	MaxElapsedTime time.Duration
+	// RetryOnBodyReadError reads the body of each response inside the retry loop, so that a failure
+	// of reading it, such as a connection reset halfway, fails the attempt and is retried as an error,
+	// and the returned response has the fully read body. The streaming requests are exempt.
+	// The bodies larger than MaxBufferedBodySize are not read ahead, only their beginning is.
+	RetryOnBodyReadError bool
+	// MaxBufferedBodySize is the maximum size of the bodies read by RetryOnBodyReadError, the default is 10MB.
+	MaxBufferedBodySize int64
+	// ResetRequest is called with a clone of the request before each retry, after the delay, to rebuild its body
+	// and headers, such as a payload signed again with a new nonce. When it is set, the body is not rewound
+	// automatically, and an error of it stops the retries and is returned.
+	ResetRequest func(req *http.Request) error
+	// PermanentStatusCodes are the status codes of the permanent failures, which are never retried
+	// whatever the ShouldRetryFunc or the RetryDecisionFunc says, such as a 410 Gone.
+	// DefaultPermanentStatusCodes is used when it is nil, and an empty slice retries all of them. See MarkPermanent.
+	PermanentStatusCodes []int
+}
+
+// DefaultPermanentStatusCodes is the default of RetryOption.PermanentStatusCodes,
+// the requests that get them would fail the same way however many times they are retried.
+var DefaultPermanentStatusCodes = []int{
+	http.StatusBadRequest,
+	http.StatusUnauthorized,
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusMethodNotAllowed,
+	http.StatusGone,
+	http.StatusUnprocessableEntity,
+	http.StatusNotImplemented,
+}
+
+// isPermanentFailure reports whether the result of an attempt is a permanent failure that is never retried,
+// which is an error marked by MarkPermanent or a response of the PermanentStatusCodes.
+func (r RetryOption) isPermanentFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, ErrPermanent)
+	}
+	if resp == nil {
+		return false
+	}
+	codes := r.PermanentStatusCodes
+	if codes == nil {
+		codes = DefaultPermanentStatusCodes
+	}
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrPermanent is the error that matches, by errors.Is, the errors marked by MarkPermanent.
+var ErrPermanent = errors.New("The failure is permanent")
+
+// PermanentError is an error marked by MarkPermanent, the retries stop at once when an attempt fails with it.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error marked.
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrPermanent.
+func (e *PermanentError) Is(target error) bool {
+	return target == ErrPermanent
+}
+
+// MarkPermanent marks the error as a permanent failure, which an interceptor or a transport inside the retry
+// returns to stop the retries at once whatever the ShouldRetryFunc says, like backoff.Permanent.
+// The error is returned to the caller as a PermanentError, and a nil error is returned as nil.
+func MarkPermanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// defaultMaxBufferedBodySize is the default of RetryOption.MaxBufferedBodySize.
+const defaultMaxBufferedBodySize = 10 * 1024 * 1024
+
+// ErrRetryDeadlineExceeded is the error that matches, by errors.Is, the requests whose retries
+// are stopped by RetryOption.MaxElapsedTime.
+var ErrRetryDeadlineExceeded = errors.New("The retry deadline is exceeded")
+
+// RetryDeadlineExceededError is returned when the retries are stopped by RetryOption.MaxElapsedTime,
+// it wraps the error of the last attempt, if any.
+type RetryDeadlineExceededError struct {
+	// Attempts is the number of the attempts made.
+	Attempts int
+	// Elapsed is the time since the first attempt.
+	Elapsed time.Duration
+	// StatusCode is the status code of the last response, 0 when the last attempt failed with an error.
+	StatusCode int
+	Err        error
+}
+
+func (e *RetryDeadlineExceededError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("The retry deadline is exceeded after %d attempts in %s: %v", e.Attempts, e.Elapsed, e.Err)
+	}
+	return fmt.Sprintf("The retry deadline is exceeded after %d attempts in %s: status %d", e.Attempts, e.Elapsed, e.StatusCode)
+}
+
+// Is reports whether the target is ErrRetryDeadlineExceeded.
+func (e *RetryDeadlineExceededError) Is(target error) bool {
+	return target == ErrRetryDeadlineExceeded
+}
+
+// Unwrap returns the error of the last attempt.
+func (e *RetryDeadlineExceededError) Unwrap() error {
+	return e.Err
+}
+
+// OnRetryFunc defines a function that is called before each retry.
+type OnRetryFunc func(req *http.Request, attempt int, delay time.Duration, resp *http.Response, err error)
+
+// RetryLogFunc creates an OnRetryFunc that logs each retry at the warn level with the logger.
+func RetryLogFunc(logger *logrus.Entry) OnRetryFunc {
+	return func(req *http.Request, attempt int, delay time.Duration, resp *http.Response, err error) {
+		fields := logrus.Fields{
+			"attempt": attempt,
+			"delay":   delay.String(),
+			"reason":  explainOutcome(resp, err),
+		}
+		if req != nil && req.URL != nil {
+			fields["method"] = req.Method
+			fields["url"] = req.URL.String()
+		}
+		logger.WithFields(fields).Warn("http client retry")
+	}
 }
 
 // NewRetryOption creates a retry options configuration.
@@ -42,7 +261,17 @@ func NewRetryOption(maxRetry uint64, retryBackOff backoff.BackOff) RetryOption {
 }
 
 func (r RetryOption) isEnabled() bool {
-	return r.ShouldRetryFunc != nil && r.RetryBackOff != nil && r.MaxRetry > 0
+	return (r.ShouldRetryFunc != nil || r.RetryDecisionFunc != nil) && r.RetryBackOff != nil && r.MaxRetry > 0
+}
+
+func (r RetryOption) decide(req *http.Request, resp *http.Response, err error) RetryDecision {
+	if r.RetryDecisionFunc != nil {
+		return r.RetryDecisionFunc(req, resp, err)
+	}
+	if r.ShouldRetryFunc(req, resp, err) {
+		return RetryAfterBackoff
+	}
+	return NoRetry
 }
 
 // RetryHandler creates a retry interceptor that can set the maximum number of retries, and the time interval between each retry.
@@ -53,10 +282,20 @@ func RetryHandler(option RetryOption) RequestHandler {
 		}
 
 		b := newFromBackOff(option.RetryBackOff)
+		if option.MaxInterval > 0 {
+			b = &cappedBackOff{BackOff: b, max: option.MaxInterval}
+		}
 		b = backoff.WithMaxRetries(b, option.MaxRetry)
+		e := explainRequest(req)
+		clock := getClock(option.Clock)
+		startTime := clock.Now()
+		attempt := 0
+		attemptReq := req
+		var failedHosts []string
 
 		fn := func() bool {
-			resp, err = handlerFunc(req)
+			attempt++
+			resp, err = handlerFunc(attemptReq)
 			defer func() {
 				if err != nil && resp != nil {
 					if resp.Body != nil {
@@ -65,18 +304,96 @@ func RetryHandler(option RetryOption) RequestHandler {
 					resp = nil
 				}
 			}()
-			should := option.ShouldRetryFunc(req, resp, err)
-			if !should {
+			if err == nil && option.RetryOnBodyReadError && !isStreamingRequest(req) {
+				err = bufferResponseBody(resp, option.MaxBufferedBodySize)
+			}
+			if option.isPermanentFailure(resp, err) {
+				if e != nil {
+					e.add("retry", "give up", 0, "attempt %d: permanent failure: %s", attempt, explainOutcome(resp, err))
+				}
+				return false
+			}
+			decision := option.decide(attemptReq, resp, err)
+			if decision == NoRetry {
+				return false
+			}
+			if s := getExpectContinueState(attemptReq); s != nil && option.ResetRequest == nil && !s.prepareRetry() {
+				if e != nil {
+					e.add("retry", "give up", 0, "attempt %d: the body was sent and can not be rewound", attempt)
+				}
 				return false
 			}
 			d := b.NextBackOff()
 			if d == backoff.Stop {
+				getResponseSource(req).markRetriesExhausted()
+				if e != nil {
+					e.add("retry", "give up", 0, "attempt %d: %s", attempt, explainOutcome(resp, err))
+				}
 				return false
 			}
-			if err2 := sleepContext(getRequestContext(req), d); err2 != nil {
-				err = errors.Wrapf(err2, "%v", err)
-				return false
+			if decision == RetryImmediatelyElsewhere {
+				d = 0
+			} else if option.RetryAfter && resp != nil {
+				if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), clock.Now()); ok {
+					d = wait
+					if option.MaxInterval > 0 && d > option.MaxInterval {
+						d = option.MaxInterval
+					}
+				}
+			}
+			if option.MaxElapsedTime > 0 {
+				if elapsed := clock.Now().Sub(startTime); elapsed+d > option.MaxElapsedTime {
+					getResponseSource(req).markRetriesExhausted()
+					if e != nil {
+						e.add("retry", "give up", 0, "attempt %d: the retry deadline %s is exceeded: %s",
+							attempt, option.MaxElapsedTime, explainOutcome(resp, err))
+					}
+					deadlineErr := &RetryDeadlineExceededError{Attempts: attempt, Elapsed: elapsed, Err: err}
+					if resp != nil {
+						deadlineErr.StatusCode = resp.StatusCode
+					}
+					err = deadlineErr
+					return false
+				}
+			}
+			if decision == RetryImmediatelyElsewhere {
+				if attemptReq.URL != nil {
+					failedHosts = append(failedHosts[:len(failedHosts):len(failedHosts)], attemptReq.URL.Host)
+				}
+				attemptReq = req.WithContext(context.WithValue(getRequestContext(req), retryElsewhereContextKey, failedHosts))
+				if e != nil {
+					e.add("retry", "retry elsewhere", 0, "attempt %d: %s", attempt+1, explainOutcome(resp, err))
+				}
+			} else {
+				attemptReq = req
+				if e != nil {
+					e.add("retry", "retry", d, "attempt %d after %s: %s", attempt+1, d, explainOutcome(resp, err))
+				}
+			}
+			if option.OnRetry != nil {
+				option.OnRetry(req, attempt+1, d, resp, err)
+			}
+			if decision != RetryImmediatelyElsewhere {
+				if err2 := sleepContext(getRequestContext(req), option.Clock, d); err2 != nil {
+					err = errors.Wrapf(err2, "%v", err)
+					return false
+				}
+			}
+			if option.RateLimitOption != nil {
+				if err2 := option.RateLimitOption.take(req); err2 != nil {
+					err = errors.Wrapf(err2, "%v", err)
+					return false
+				}
 			}
+			if option.ResetRequest != nil {
+				attemptReq = attemptReq.Clone(getRequestContext(attemptReq))
+				if err2 := option.ResetRequest(attemptReq); err2 != nil {
+					err = errors.Wrapf(err2, "Reset the request of attempt %d", attempt+1)
+					return false
+				}
+			}
+			// The response of the failed attempt is replaced by the one of the retry.
+			closeResponse(resp)
 			return true
 		}
 
@@ -88,6 +405,72 @@ func RetryHandler(option RetryOption) RequestHandler {
 	}
 }
 
+// bufferResponseBody reads the body of the response into memory, unless it is larger than max,
+// in which case the part read is put back before the rest of the body.
+func bufferResponseBody(resp *http.Response, max int64) error {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+	if max <= 0 {
+		max = defaultMaxBufferedBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return errors.Wrap(err, "Read the response body")
+	}
+	if int64(len(body)) > max {
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// cappedBackOff never returns a delay longer than max, except backoff.Stop.
+type cappedBackOff struct {
+	backoff.BackOff
+	max time.Duration
+}
+
+func (b *cappedBackOff) NextBackOff() time.Duration {
+	d := b.BackOff.NextBackOff()
+	if d != backoff.Stop && d > b.max {
+		return b.max
+	}
+	return d
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date,
+// and returns the delay from now. The delay of a date in the past is zero, and false is returned for a malformed value.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(header, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, true
+		}
+		if seconds > int64(maxDurationSeconds) {
+			seconds = int64(maxDurationSeconds)
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// maxDurationSeconds is the maximum number of seconds of a time.Duration.
+const maxDurationSeconds = time.Duration(1<<63-1) / time.Second
+
 func newFromBackOff(b backoff.BackOff) backoff.BackOff {
 	var b2 backoff.BackOff
 	switch v := b.(type) {
@@ -109,14 +492,3 @@ func newFromBackOff(b backoff.BackOff) backoff.BackOff {
 	b2.Reset()
 	return b2
 }
-
-func sleepContext(ctx context.Context, wait time.Duration) error {
-	timer := time.NewTimer(wait)
-	defer timer.Stop()
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-timer.C:
-		return nil
-	}
-}
@@ -7,10 +7,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,7 +23,9 @@ func TestRetryRequestHandler(t *testing.T) {
 	maxRetry := uint64(3)
 	backOffWait := 5 * time.Millisecond
 	curRetry := uint64(0)
+	clock := NewFakeClock(time.Now())
 	options := NewRetryOption(maxRetry, backoff.NewConstantBackOff(backOffWait))
+	options.Clock = clock
 	options.ShouldRetryFunc = func(req *http.Request, resp *http.Response, err error) bool {
 		curRetry++
 		return curRetry < maxRetry
@@ -33,51 +39,55 @@ func TestRetryRequestHandler(t *testing.T) {
 	}
 
 	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
-	startTime := time.Now()
-	resp, err := handler(req, handlerFunc)
-	endTime := time.Now()
+	startTime := clock.Now()
+	resp, err := runRetryWithFakeClock(clock, backOffWait, 2, func() (*http.Response, error) {
+		return handler(req, handlerFunc)
+	})
 	require.Nil(t, err)
 	require.NotNil(t, resp)
 	// Actual retries 2 times, a total of 10ms.
-	minTakes := int64(backOffWait/time.Millisecond) * int64(maxRetry-1)
-	maxTakes := int64(backOffWait/time.Millisecond) * int64(maxRetry)
-	realTakes := int64(endTime.Sub(startTime) / time.Millisecond)
-	require.True(t, minTakes <= realTakes && realTakes < maxTakes)
+	require.Equal(t, 2*backOffWait, clock.Now().Sub(startTime))
+	require.Equal(t, maxRetry, curRetry)
 }
 
 func TestRetryRequestHandler_AllFailed(t *testing.T) {
 	// Retry 3 times, each time interval is 5ms, all 3 times fail.
 	maxRetry := uint64(3)
 	backOffWait := 5 * time.Millisecond
+	requestTimes := 0
+	clock := NewFakeClock(time.Now())
 	options := NewRetryOption(maxRetry, backoff.NewConstantBackOff(backOffWait))
+	options.Clock = clock
 	options.ShouldRetryFunc = func(req *http.Request, resp *http.Response, err error) bool {
 		return true
 	}
 	handler := RetryHandler(options)
 
 	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		requestTimes++
 		return &http.Response{
 			Body: io.NopCloser(bytes.NewBufferString("hello world")),
 		}, nil
 	}
 
 	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
-	startTime := time.Now()
-	resp, err := handler(req, handlerFunc)
-	endTime := time.Now()
+	startTime := clock.Now()
+	resp, err := runRetryWithFakeClock(clock, backOffWait, int(maxRetry), func() (*http.Response, error) {
+		return handler(req, handlerFunc)
+	})
 	require.Nil(t, err)
 	require.NotNil(t, resp)
-	minTakes := int64(backOffWait/time.Millisecond) * int64(maxRetry)
-	maxTakes := int64(backOffWait/time.Millisecond) * int64(maxRetry+1)
-	realTakes := int64(endTime.Sub(startTime) / time.Millisecond)
-	require.True(t, minTakes <= realTakes && realTakes < maxTakes)
+	require.Equal(t, time.Duration(maxRetry)*backOffWait, clock.Now().Sub(startTime))
+	require.Equal(t, int(maxRetry)+1, requestTimes)
 }
 
 func TestRetryRequestHandler_NoFailed(t *testing.T) {
 	// Retry 3 times with 5ms interval each time. Success the first time.
 	maxRetry := uint64(3)
 	backOffWait := 5 * time.Millisecond
+	clock := NewFakeClock(time.Now())
 	options := NewRetryOption(maxRetry, backoff.NewConstantBackOff(backOffWait))
+	options.Clock = clock
 	options.ShouldRetryFunc = func(req *http.Request, resp *http.Response, err error) bool {
 		return false
 	}
@@ -90,14 +100,30 @@ func TestRetryRequestHandler_NoFailed(t *testing.T) {
 	}
 
 	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
-	startTime := time.Now()
+	startTime := clock.Now()
 	resp, err := handler(req, handlerFunc)
-	endTime := time.Now()
 	require.Nil(t, err)
 	require.NotNil(t, resp)
-	maxTakes := int64(backOffWait / time.Millisecond)
-	realTakes := int64(endTime.Sub(startTime) / time.Millisecond)
-	require.True(t, realTakes < maxTakes)
+	require.Equal(t, time.Duration(0), clock.Now().Sub(startTime))
+}
+
+// runRetryWithFakeClock runs fn in a goroutine, and advances the clock by step each time a sleep is waiting, sleeps times in total.
+func runRetryWithFakeClock(clock *FakeClock, step time.Duration, sleeps int, fn func() (*http.Response, error)) (*http.Response, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := fn()
+		done <- result{resp, err}
+	}()
+	for i := 0; i < sleeps; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(step)
+	}
+	r := <-done
+	return r.resp, r.err
 }
 
 func TestRetryRequestHandler_ContextCancel(t *testing.T) {
@@ -176,3 +202,565 @@ func TestNewFromBackOff_NotDefined(t *testing.T) {
 	_ = newFromBackOff(&testBackOff{})
 	require.Equal(t, "undefind backoff", errmsg)
 }
+
+func TestRetryRequestHandler_RateLimit(t *testing.T) {
+	rateLimitTimes := 0
+	rateLimitOption := NewRateLimitOption(1000)
+	rateLimitOption.RateLimitFunc = func(req *http.Request, option RateLimitOption) error {
+		rateLimitTimes++
+		return defaultRateLimitFunc(req, option)
+	}
+	options := NewRetryOption(3, backoff.NewConstantBackOff(time.Millisecond))
+	options.RateLimitOption = &rateLimitOption
+	handler := RetryHandler(options)
+
+	requestTimes := 0
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		requestTimes++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(bytes.NewBufferString("hello world"))}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	require.Equal(t, 4, requestTimes)
+	require.Equal(t, 3, rateLimitTimes)
+	_, ok := rateLimitOption.RateLimits.Load("GET https://example.com")
+	require.True(t, ok)
+
+	// The retries stop when the rate limiter fails.
+	rateLimitErr := errors.New("rate limit error")
+	rateLimitOption.RateLimitFunc = func(req *http.Request, option RateLimitOption) error {
+		return rateLimitErr
+	}
+	requestTimes = 0
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, rateLimitErr))
+	require.Equal(t, 1, requestTimes)
+}
+
+func TestWithRetryLog(t *testing.T) {
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	logger, hook := test.NewNullLogger()
+	loggerOption := NewLoggerOption()
+	loggerOption.Logger = logrus.NewEntry(logger)
+	loggerOption.LoggerFunc = func(*http.Request, LoggerEntry, LoggerOption) {}
+	c := NewClient(
+		WithLoggerOption(loggerOption),
+		WithRetryLog(),
+		WithMaxRetry(3),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+	)
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	for i, entry := range entries {
+		require.Equal(t, logrus.WarnLevel, entry.Level)
+		require.Equal(t, "http client retry", entry.Message)
+		require.Equal(t, i+2, entry.Data["attempt"])
+		require.Equal(t, "1ms", entry.Data["delay"])
+		require.Equal(t, "status 503", entry.Data["reason"])
+		require.Equal(t, ts.URL, entry.Data["url"])
+	}
+
+	// A custom OnRetry takes precedence.
+	attempts := []int{}
+	option := NewRetryOption(1, backoff.NewConstantBackOff(0))
+	option.OnRetry = func(req *http.Request, attempt int, delay time.Duration, resp *http.Response, err error) {
+		attempts = append(attempts, attempt)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	_, _ = RetryHandler(option)(req, func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("error")
+	})
+	require.Equal(t, []int{2}, attempts)
+}
+
+func TestRetryRequestHandler_RetryDecision(t *testing.T) {
+	backOffWait := time.Hour
+	errRefused := errors.New("connection refused")
+	newHandler := func(clock Clock, decision RetryDecision) RequestHandler {
+		options := NewRetryOption(2, backoff.NewConstantBackOff(backOffWait))
+		options.Clock = clock
+		options.RetryDecisionFunc = func(req *http.Request, resp *http.Response, err error) RetryDecision {
+			return decision
+		}
+		return RetryHandler(options)
+	}
+
+	var attempts []*http.Request
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		attempts = append(attempts, req)
+		return nil, errRefused
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://a.example.com", nil)
+
+	// NoRetry returns the first result.
+	clock := NewFakeClock(time.Now())
+	_, err := newHandler(clock, NoRetry)(req, handlerFunc)
+	require.Equal(t, errRefused, err)
+	require.Len(t, attempts, 1)
+
+	// RetryAfterBackoff sleeps before each retry, and the context is not marked.
+	attempts = nil
+	startTime := clock.Now()
+	_, err = runRetryWithFakeClock(clock, backOffWait, 2, func() (*http.Response, error) {
+		return newHandler(clock, RetryAfterBackoff)(req, handlerFunc)
+	})
+	require.Equal(t, errRefused, err)
+	require.Len(t, attempts, 3)
+	require.Equal(t, 2*backOffWait, clock.Now().Sub(startTime))
+	for _, attempt := range attempts {
+		_, ok := RetryElsewhereFromContext(attempt.Context())
+		require.False(t, ok)
+	}
+
+	// RetryImmediatelyElsewhere does not sleep, which would block on the fake clock,
+	// and marks the context of the retries with the failed hosts.
+	attempts = nil
+	startTime = clock.Now()
+	realStartTime := time.Now()
+	_, err = newHandler(clock, RetryImmediatelyElsewhere)(req, handlerFunc)
+	require.Equal(t, errRefused, err)
+	require.Len(t, attempts, 3)
+	require.Equal(t, time.Duration(0), clock.Now().Sub(startTime))
+	require.Less(t, time.Since(realStartTime), time.Second)
+	_, ok := RetryElsewhereFromContext(attempts[0].Context())
+	require.False(t, ok)
+	hosts, ok := RetryElsewhereFromContext(attempts[1].Context())
+	require.True(t, ok)
+	require.Equal(t, []string{"a.example.com"}, hosts)
+	hosts, ok = RetryElsewhereFromContext(attempts[2].Context())
+	require.True(t, ok)
+	require.Equal(t, []string{"a.example.com", "a.example.com"}, hosts)
+}
+
+func TestRetryRequestHandler_DefaultRetryDecision(t *testing.T) {
+	options := NewRetryOption(1, backoff.NewConstantBackOff(0))
+	require.Equal(t, RetryAfterBackoff, options.decide(nil, nil, errors.New("error")))
+	require.Equal(t, RetryAfterBackoff, options.decide(nil, &http.Response{StatusCode: http.StatusBadGateway}, nil))
+	require.Equal(t, NoRetry, options.decide(nil, &http.Response{StatusCode: http.StatusNotFound}, nil))
+
+	options.ShouldRetryFunc = nil
+	require.False(t, options.isEnabled())
+	options.RetryDecisionFunc = func(*http.Request, *http.Response, error) RetryDecision { return NoRetry }
+	require.True(t, options.isEnabled())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 10, 21, 7, 26, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"120", 120 * time.Second, true},
+		{" 0 ", 0, true},
+		{"-5", 0, true},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 2 * time.Minute, true},
+		{"Wed, 21 Oct 2015 07:20:00 GMT", 0, true},
+		{"Wednesday, 21-Oct-15 07:28:00 GMT", 2 * time.Minute, true},
+		{"1.5", 0, false},
+		{"garbage", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.header, now)
+		require.Equal(t, tt.ok, ok, tt.header)
+		require.Equal(t, tt.want, got, tt.header)
+	}
+}
+
+func TestRetryRequestHandler_RetryAfter(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	options := NewRetryOption(2, backoff.NewConstantBackOff(time.Hour))
+	options.Clock = clock
+	options.RetryAfter = true
+	handler := RetryHandler(options)
+
+	retryAfter := []string{"2", "garbage"}
+	requestTimes := 0
+	handlerFunc := func(req *http.Request) (*http.Response, error) {
+		requestTimes++
+		if requestTimes > len(retryAfter) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}
+		header := http.Header{}
+		header.Set("Retry-After", retryAfter[requestTimes-1])
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header, Body: http.NoBody}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	startTime := clock.Now()
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		done <- resp
+	}()
+	// The first retry waits for the Retry-After, the malformed one falls back to the back off.
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Second)
+	clock.BlockUntil(1)
+	require.Equal(t, 2*time.Second, clock.Now().Sub(startTime))
+	clock.Advance(time.Hour)
+	resp := <-done
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 3, requestTimes)
+}
+
+func TestRetryRequestHandler_MaxInterval(t *testing.T) {
+	exponentialBackOff := backoff.NewExponentialBackOff()
+	exponentialBackOff.InitialInterval = time.Second
+	exponentialBackOff.Multiplier = 2
+	exponentialBackOff.RandomizationFactor = 0
+
+	tests := []struct {
+		b      backoff.BackOff
+		delays []time.Duration
+	}{
+		{exponentialBackOff, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}},
+		{backoff.NewConstantBackOff(time.Second), []time.Duration{time.Second, time.Second, time.Second, time.Second}},
+	}
+	for _, tt := range tests {
+		clock := NewFakeClock(time.Now())
+		options := NewRetryOption(4, tt.b)
+		options.Clock = clock
+		options.MaxInterval = 3 * time.Second
+		var delays []time.Duration
+		options.OnRetry = func(req *http.Request, attempt int, delay time.Duration, resp *http.Response, err error) {
+			delays = append(delays, delay)
+		}
+		handler := RetryHandler(options)
+
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		_, err := runRetryWithFakeClock(clock, time.Hour, 4, func() (*http.Response, error) {
+			return handler(req, func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("error")
+			})
+		})
+		require.NotNil(t, err)
+		require.Equal(t, tt.delays, delays)
+	}
+
+	// The delay of Retry-After is capped too.
+	options := NewRetryOption(1, backoff.NewConstantBackOff(time.Second))
+	options.RetryAfter = true
+	options.MaxInterval = 3 * time.Second
+	clock := NewFakeClock(time.Now())
+	options.Clock = clock
+	var delay time.Duration
+	options.OnRetry = func(req *http.Request, attempt int, d time.Duration, resp *http.Response, err error) {
+		delay = d
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	_, _ = runRetryWithFakeClock(clock, time.Hour, 1, func() (*http.Response, error) {
+		return RetryHandler(options)(req, func(req *http.Request) (*http.Response, error) {
+			header := http.Header{}
+			header.Set("Retry-After", "3600")
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header, Body: http.NoBody}, nil
+		})
+	})
+	require.Equal(t, 3*time.Second, delay)
+}
+
+func TestRetryRequestHandler_MaxElapsedTime(t *testing.T) {
+	newOptions := func(maxRetry uint64, clock Clock) RetryOption {
+		options := NewRetryOption(maxRetry, backoff.NewConstantBackOff(4*time.Second))
+		options.Clock = clock
+		options.MaxElapsedTime = 10 * time.Second
+		return options
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+
+	// The attempts at 0s, 4s and 8s are made, the one at 12s would exceed the deadline.
+	clock := NewFakeClock(time.Now())
+	attempts := 0
+	resp, err := runRetryWithFakeClock(clock, 4*time.Second, 2, func() (*http.Response, error) {
+		return RetryHandler(newOptions(10, clock))(req, func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		})
+	})
+	require.Nil(t, resp)
+	require.Equal(t, 3, attempts)
+	require.True(t, errors.Is(err, ErrRetryDeadlineExceeded))
+	var deadlineErr *RetryDeadlineExceededError
+	require.True(t, errors.As(err, &deadlineErr))
+	require.Equal(t, 3, deadlineErr.Attempts)
+	require.Equal(t, 8*time.Second, deadlineErr.Elapsed)
+	require.Equal(t, http.StatusServiceUnavailable, deadlineErr.StatusCode)
+
+	// The error of the last attempt is wrapped.
+	clock = NewFakeClock(time.Now())
+	errLast := errors.New("connection refused")
+	_, err = runRetryWithFakeClock(clock, 4*time.Second, 2, func() (*http.Response, error) {
+		return RetryHandler(newOptions(10, clock))(req, func(req *http.Request) (*http.Response, error) {
+			return nil, errLast
+		})
+	})
+	require.True(t, errors.Is(err, ErrRetryDeadlineExceeded))
+	require.True(t, errors.Is(err, errLast))
+
+	// MaxRetry comes first.
+	clock = NewFakeClock(time.Now())
+	attempts = 0
+	resp, err = runRetryWithFakeClock(clock, 4*time.Second, 1, func() (*http.Response, error) {
+		return RetryHandler(newOptions(1, clock))(req, func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		})
+	})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, 2, attempts)
+}
+
+func TestWithRetryIfBodyContains(t *testing.T) {
+	var requests int32
+	throttled := int32(1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if atomic.AddInt32(&requests, 1) <= atomic.LoadInt32(&throttled) {
+			_, _ = w.Write([]byte(`{"code": "THROTTLED"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code": "OK"}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient(
+		WithMaxRetry(2),
+		WithRetryBackOff(backoff.NewConstantBackOff(0)),
+		WithRetryIfBodyContains(`"THROTTLED"`),
+	)
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, `{"code": "OK"}`, string(body))
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// The body of the last attempt is returned intact when the retries are exhausted.
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&throttled, 10)
+	resp, err = c.Get(ts.URL)
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	require.Equal(t, `{"code": "THROTTLED"}`, string(body))
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+type testFailingBody struct {
+	r    io.Reader
+	fail bool
+}
+
+func (b *testFailingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF && b.fail {
+		return n, errors.New("connection reset by peer")
+	}
+	return n, err
+}
+
+func (b *testFailingBody) Close() error {
+	return nil
+}
+
+func TestWithRetryOnBodyReadError(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	attempts := 0
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		body := &testFailingBody{r: bytes.NewReader(payload), fail: attempts == 1}
+		if attempts == 1 {
+			body.r = bytes.NewReader(payload[:300])
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: body, Request: req}, nil
+	})
+
+	newClient := func(options ...Option) *Client {
+		return NewClient(append([]Option{
+			WithHTTPClient(&http.Client{Transport: transport}),
+			WithShouldRetryFunc(defaultShouldRetryFunc),
+			WithMaxRetry(2),
+			WithRetryBackOff(backoff.NewConstantBackOff(0)),
+		}, options...)...)
+	}
+
+	resp, err := newClient(WithRetryOnBodyReadError()).Get("https://example.com")
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, payload, body)
+	require.Equal(t, 2, attempts)
+
+	// Without it, the failure of the body surfaces to the caller.
+	attempts = 0
+	resp, err = newClient().Get("https://example.com")
+	require.Nil(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NotNil(t, err)
+	require.Equal(t, 1, attempts)
+
+	// The streaming requests are exempt.
+	attempts = 0
+	req, _ := http.NewRequestWithContext(MarkStreaming(context.Background()), http.MethodGet, "https://example.com", nil)
+	resp, err = newClient(WithRetryOnBodyReadError()).Do(req)
+	require.Nil(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NotNil(t, err)
+	require.Equal(t, 1, attempts)
+
+	// The body larger than MaxBufferedBodySize is returned as is.
+	attempts = 10
+	options := NewRetryOption(2, backoff.NewConstantBackOff(0))
+	options.RetryOnBodyReadError = true
+	options.MaxBufferedBodySize = 100
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com", nil)
+	resp, err = RetryHandler(options)(req, transport.RoundTrip)
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Equal(t, payload, body)
+	require.Equal(t, 11, attempts)
+}
+
+func TestWithBeforeRetry(t *testing.T) {
+	var received []string
+	s := NewTestServer(t, map[string]http.HandlerFunc{
+		"/sign": func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received = append(received, r.Header.Get("X-Signature")+" "+string(body))
+			if len(received) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		},
+	})
+
+	nonce := 0
+	sign := func(req *http.Request) error {
+		nonce++
+		body := fmt.Sprintf("payload-%d", nonce)
+		req.Body = io.NopCloser(bytes.NewBufferString(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Set("X-Signature", fmt.Sprintf("sig-%d", nonce))
+		return nil
+	}
+	c := NewClient(
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithBeforeRetry(sign),
+	)
+
+	req, err := http.NewRequest(http.MethodPost, s.URL("/sign"), nil)
+	require.Nil(t, err)
+	require.Nil(t, sign(req))
+	resp, err := c.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"sig-1 payload-1", "sig-2 payload-2", "sig-3 payload-3"}, received)
+	// The request of the caller is not modified.
+	require.Equal(t, "sig-1", req.Header.Get("X-Signature"))
+
+	// An error of the reset stops the retries.
+	received = nil
+	resetErr := errors.New("sign failed")
+	c = NewClient(
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithBeforeRetry(func(req *http.Request) error { return resetErr }),
+	)
+	resp, err = c.Post(s.URL("/sign"), "text/plain", bytes.NewBufferString("payload"))
+	require.Nil(t, resp)
+	require.True(t, errors.Is(err, resetErr))
+	require.Len(t, received, 1)
+}
+
+func TestRetryRequestHandler_PermanentFailure(t *testing.T) {
+	status := http.StatusNotImplemented
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		},
+	})
+	options := []Option{
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+	}
+
+	// A 501 is not retried anymore by the default ShouldRetryFunc.
+	resp, err := NewClient(options...).Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	require.Equal(t, 1, ts.RequestCount("/"))
+
+	// Whatever the ShouldRetryFunc says.
+	status = http.StatusGone
+	c := NewClient(WithMaxRetry(3), WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(func(req *http.Request, resp *http.Response, err error) bool { return true }))
+	resp, err = c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 2, ts.RequestCount("/"))
+
+	// Unless the status codes are configured.
+	status = http.StatusNotImplemented
+	resp, err = NewClient(append(options, WithPermanentStatusCodes(http.StatusGone))...).Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 6, ts.RequestCount("/"))
+	resp, err = NewClient(append(options, WithPermanentStatusCodes())...).Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 10, ts.RequestCount("/"))
+}
+
+func TestMarkPermanent(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	attempts := 0
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, MarkPermanent(errRefused)
+	})
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+	)
+
+	_, err := c.Get("https://example.com")
+	require.Equal(t, 1, attempts)
+	require.True(t, errors.Is(err, ErrPermanent))
+	require.True(t, errors.Is(err, errRefused))
+	var permanentErr *PermanentError
+	require.True(t, errors.As(err, &permanentErr))
+
+	require.Nil(t, MarkPermanent(nil))
+}
@@ -0,0 +1,158 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSlowLogHosts bounds the number of the hosts that have their own latency estimate,
+// the requests to the other hosts share a single estimate.
+const maxSlowLogHosts = 1024
+
+// slowLog decides whether a request is slow for LoggerOption.SlowThreshold and LoggerOption.SlowPercentile.
+type slowLog struct {
+	threshold  time.Duration
+	percentile float64
+
+	mu        sync.RWMutex
+	estimates map[string]*p2Quantile
+	overflow  *p2Quantile
+}
+
+func newSlowLog(option LoggerOption) *slowLog {
+	if !option.isSlowMode() {
+		return nil
+	}
+	s := &slowLog{threshold: option.SlowThreshold}
+	if option.SlowPercentile > 0 && option.SlowPercentile < 1 {
+		s.percentile = option.SlowPercentile
+		s.estimates = make(map[string]*p2Quantile)
+		s.overflow = newP2Quantile(s.percentile)
+	}
+	return s
+}
+
+// observe records the execute time of the request, and reports whether it is slow,
+// which is compared with the estimate of the percentile of its host before the request.
+func (s *slowLog) observe(req *http.Request, d time.Duration) bool {
+	slow := s.threshold > 0 && d > s.threshold
+	if s.percentile > 0 {
+		host := ""
+		if req != nil && req.URL != nil {
+			host = req.URL.Host
+		}
+		if estimate, ok := s.estimate(host).observe(float64(d)); ok && float64(d) > estimate {
+			slow = true
+		}
+	}
+	return slow
+}
+
+func (s *slowLog) estimate(host string) *p2Quantile {
+	s.mu.RLock()
+	e, ok := s.estimates[host]
+	s.mu.RUnlock()
+	if ok {
+		return e
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.estimates[host]; ok {
+		return e
+	}
+	if len(s.estimates) >= maxSlowLogHosts {
+		return s.overflow
+	}
+	e = newP2Quantile(s.percentile)
+	s.estimates[host] = e
+	return e
+}
+
+// p2Quantile is the P² algorithm of Jain and Chlamtac, which estimates a quantile of a stream in constant memory.
+type p2Quantile struct {
+	mu        sync.Mutex
+	n         int
+	heights   [5]float64
+	positions [5]float64
+	desired   [5]float64
+	increment [5]float64
+}
+
+func newP2Quantile(p float64) *p2Quantile {
+	e := &p2Quantile{}
+	e.increment = [5]float64{0, p / 2, p, (1 + p) / 2, 1}
+	e.desired = [5]float64{1, 1 + 2*p, 1 + 4*p, 3 + 2*p, 5}
+	e.positions = [5]float64{1, 2, 3, 4, 5}
+	return e
+}
+
+// observe returns the estimate before adding x, and whether the estimate is available,
+// which needs 5 observations.
+func (e *p2Quantile) observe(x float64) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.n < 5 {
+		e.heights[e.n] = x
+		e.n++
+		if e.n == 5 {
+			sort.Float64s(e.heights[:])
+		}
+		return 0, false
+	}
+	estimate := e.heights[2]
+	e.n++
+
+	var k int
+	switch {
+	case x < e.heights[0]:
+		e.heights[0] = x
+		k = 0
+	case x >= e.heights[4]:
+		e.heights[4] = x
+		k = 3
+	default:
+		for k = 0; k < 3; k++ {
+			if x < e.heights[k+1] {
+				break
+			}
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		e.positions[i]++
+	}
+	for i := range e.desired {
+		e.desired[i] += e.increment[i]
+	}
+
+	for i := 1; i <= 3; i++ {
+		d := e.desired[i] - e.positions[i]
+		if (d >= 1 && e.positions[i+1]-e.positions[i] > 1) || (d <= -1 && e.positions[i-1]-e.positions[i] < -1) {
+			s := 1.0
+			if d < 0 {
+				s = -1
+			}
+			h := e.parabolic(i, s)
+			if e.heights[i-1] < h && h < e.heights[i+1] {
+				e.heights[i] = h
+			} else {
+				e.heights[i] = e.linear(i, s)
+			}
+			e.positions[i] += s
+		}
+	}
+	return estimate, true
+}
+
+func (e *p2Quantile) parabolic(i int, d float64) float64 {
+	q, n := e.heights, e.positions
+	return q[i] + d/(n[i+1]-n[i-1])*((n[i]-n[i-1]+d)*(q[i+1]-q[i])/(n[i+1]-n[i])+(n[i+1]-n[i]-d)*(q[i]-q[i-1])/(n[i]-n[i-1]))
+}
+
+func (e *p2Quantile) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return e.heights[i] + d*(e.heights[j]-e.heights[i])/(e.positions[j]-e.positions[i])
+}
@@ -0,0 +1,118 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestP2Quantile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	e := newP2Quantile(0.9)
+	values := make([]float64, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		x := r.Float64() * 1000
+		values = append(values, x)
+		_, ok := e.observe(x)
+		require.Equal(t, i >= 5, ok)
+	}
+	sort.Float64s(values)
+	estimate, ok := e.observe(0)
+	require.True(t, ok)
+	require.InDelta(t, values[9000], estimate, 20)
+}
+
+// testSlowLogRun drives a bimodal latency distribution, every 10th request takes slowLatency,
+// and returns the indexes of the requests logged with the bodies.
+func testSlowLogRun(t *testing.T, option LoggerOption, n int, fastLatency, slowLatency time.Duration) []int {
+	clock := NewFakeClock(time.Unix(0, 0))
+	option.Clock = clock
+	var full []int
+	i := 0
+	option.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		if e.Slow {
+			require.Equal(t, "hello world", string(e.ResponseBody))
+			require.NotNil(t, e.ResponseHeader)
+			full = append(full, i)
+		} else {
+			require.Nil(t, e.ResponseBody)
+			require.Nil(t, e.RequestHeader)
+		}
+	}
+	handler := LoggerHandler(option)
+
+	for i = 0; i < n; i++ {
+		latency := fastLatency + time.Duration(i%3)*time.Millisecond
+		if i%10 == 9 {
+			latency = slowLatency
+		}
+		handlerFunc := func(req *http.Request) (*http.Response, error) {
+			clock.Advance(latency)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"X-Test": {"OK"}},
+				Body:       io.NopCloser(bytes.NewBufferString("hello world")),
+			}, nil
+		}
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/slow", nil)
+		req.Header.Set("X-Request", "1")
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		require.Equal(t, "hello world", string(body))
+	}
+	return full
+}
+
+func TestLoggerHandler_SlowThreshold(t *testing.T) {
+	option := NewLoggerOption()
+	option.SlowThreshold = 100 * time.Millisecond
+	full := testSlowLogRun(t, option, 100, 10*time.Millisecond, 500*time.Millisecond)
+
+	expected := []int{}
+	for i := 9; i < 100; i += 10 {
+		expected = append(expected, i)
+	}
+	require.Equal(t, expected, full)
+}
+
+func TestLoggerHandler_SlowPercentile(t *testing.T) {
+	option := NewLoggerOption()
+	option.SlowPercentile = 0.95
+	full := testSlowLogRun(t, option, 200, 10*time.Millisecond, 500*time.Millisecond)
+
+	// After the estimate warms up, only the requests of the slow mode are logged with the bodies.
+	var late []int
+	for _, i := range full {
+		if i >= 50 {
+			late = append(late, i)
+		}
+	}
+	expected := []int{}
+	for i := 59; i < 200; i += 10 {
+		expected = append(expected, i)
+	}
+	require.Equal(t, expected, late, fmt.Sprint(full))
+}
+
+func TestSlowLog_BoundedHosts(t *testing.T) {
+	option := NewLoggerOption()
+	option.SlowPercentile = 0.9
+	s := newSlowLog(option)
+	for i := 0; i < maxSlowLogHosts+10; i++ {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("https://host-%d.example.com", i), nil)
+		s.observe(req, time.Millisecond)
+	}
+	require.Len(t, s.estimates, maxSlowLogHosts)
+	require.Equal(t, 10, s.overflow.n)
+
+	require.Nil(t, newSlowLog(NewLoggerOption()))
+}
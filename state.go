@@ -0,0 +1,430 @@
+package gohttpclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cep21/circuit"
+	"github.com/cep21/circuit/closers/hystrix"
+	"github.com/cep21/circuit/metrics/rolling"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/ratelimit"
+)
+
+// StateSnapshotVersion is the version of the schema of the snapshots of Client.ExportState,
+// Client.ImportState ignores the snapshots of the other versions.
+const StateSnapshotVersion = 1
+
+// DefaultStateMaxAge is the age of a snapshot of Client.ExportState beyond which it is stale,
+// and it is the TTL of the snapshots stored by WithStatePersistence.
+const DefaultStateMaxAge = 10 * time.Minute
+
+// maxStateClockSkew is how far in the future the time of a snapshot may be because of the clock skew of the hosts,
+// a snapshot from further in the future is ignored.
+const maxStateClockSkew = time.Minute
+
+var (
+	// ErrStaleState is returned by Client.ImportState for a snapshot older than DefaultStateMaxAge,
+	// or too far in the future, which is ignored.
+	ErrStaleState = errors.New("The state snapshot is stale")
+	// ErrIncompatibleState is returned by Client.ImportState for a snapshot of another StateSnapshotVersion,
+	// which is ignored.
+	ErrIncompatibleState = errors.New("The state snapshot is incompatible")
+)
+
+// stateSnapshot is the snapshot of Client.ExportState, the durations are relative to CreatedAt.
+type stateSnapshot struct {
+	Version   int
+	CreatedAt time.Time
+	Circuits  map[string]circuitState
+	// RateLimits is the time until the next token of the rate limiter of each key.
+	RateLimits map[string]time.Duration
+}
+
+type circuitState struct {
+	Open bool
+	// ReopenIn is the rest of the sleep window of an open circuit.
+	ReopenIn      time.Duration
+	RequestVolume int64
+	Errors        int64
+}
+
+// ExportState returns a snapshot of the state of the circuit breaker and the rate limiter of the client in msgpack,
+// which ImportState restores to a new client, such as after a restart, so that it does not hammer a recovering upstream.
+// The snapshot has the open circuits with the rest of their sleep windows, the request volume and the errors
+// of the circuits in the rolling window, and the time until the next token of the rate limiter of each key.
+func (c *Client) ExportState() ([]byte, error) {
+	now := getClock(c.clock).Now()
+	s := stateSnapshot{Version: StateSnapshotVersion, CreatedAt: now}
+	if c.hystrixOption.isEnabled() {
+		s.Circuits = c.hystrixOption.exportState(now)
+	}
+	if c.rateLimitOption.isEnabled() {
+		s.RateLimits = exportRateLimitState(c.rateLimitOption, now)
+	}
+	data, err := msgpack.Marshal(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "Encode the state snapshot")
+	}
+	return data, nil
+}
+
+// ImportState restores a snapshot of ExportState, the time passed since the snapshot is taken off its durations.
+// The open circuits are opened until the rest of their sleep windows elapses, the request volume and the errors
+// are added to the closed circuits unless the rolling window has passed, and the rate limiter of each key
+// waits for the rest of the time until its next token.
+// The snapshots of another StateSnapshotVersion fail with ErrIncompatibleState, and the ones older than
+// DefaultStateMaxAge, or from the future beyond the clock skew, fail with ErrStaleState, nothing is restored from them.
+func (c *Client) ImportState(data []byte) error {
+	var s stateSnapshot
+	if err := msgpack.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "Decode the state snapshot")
+	}
+	if s.Version != StateSnapshotVersion {
+		return errors.Wrapf(ErrIncompatibleState, "version %d", s.Version)
+	}
+	now := getClock(c.clock).Now()
+	age := now.Sub(s.CreatedAt)
+	if age > DefaultStateMaxAge || age < -maxStateClockSkew {
+		return errors.Wrapf(ErrStaleState, "taken at %s", s.CreatedAt.Format(time.RFC3339))
+	}
+	if age < 0 {
+		age = 0
+	}
+
+	if c.hystrixOption.isEnabled() {
+		c.hystrixOption.importState(s.Circuits, now, age)
+	}
+	if c.rateLimitOption.isEnabled() {
+		importRateLimitState(c.rateLimitOption, s.RateLimits, now, age)
+	}
+	return nil
+}
+
+func (h HystrixOption) exportState(now time.Time) map[string]circuitState {
+	stats := h.Stats()
+	circuits := make(map[string]circuitState, len(stats))
+	for _, c := range h.CircuitManager.AllCircuits() {
+		s := stats[c.Name()]
+		state := circuitState{Open: s.Open, RequestVolume: s.RequestVolume, Errors: s.Errors}
+		if state.Open {
+			state.ReopenIn = circuitReopenIn(c, now)
+		}
+		circuits[c.Name()] = state
+	}
+	return circuits
+}
+
+func (h HystrixOption) importState(circuits map[string]circuitState, now time.Time, age time.Duration) {
+	for name, state := range circuits {
+		c := h.getOrCreateCircuit(name)
+		if c == nil {
+			continue
+		}
+		if state.Open {
+			restoreOpenCircuit(c, state.ReopenIn-age, now)
+			continue
+		}
+
+		opener, ok := c.ClosedToOpen.(*hystrix.Opener)
+		if !ok || age >= opener.Config().RollingDuration {
+			continue
+		}
+		// The rolling windows of a circuit created just now start after the time of the import,
+		// and they are kept by the real time of the circuit library, whatever the clock of the client.
+		now := time.Now()
+		runStats := rolling.FindCommandMetrics(c)
+		for i := int64(0); i < state.RequestVolume; i++ {
+			if i < state.Errors {
+				opener.ErrFailure(now, 0)
+				if runStats != nil {
+					runStats.ErrFailure(now, 0)
+				}
+				continue
+			}
+			opener.Success(now, 0)
+			if runStats != nil {
+				runStats.Success(now, 0)
+			}
+		}
+	}
+}
+
+// circuitReopenIn returns the rest of the sleep window of the open circuit,
+// which is the whole window when the circuit does not track its open time.
+func circuitReopenIn(c *circuit.Circuit, now time.Time) time.Duration {
+	closer, ok := c.OpenToClose.(*hystrix.Closer)
+	if !ok {
+		return 0
+	}
+	window := closer.Config().SleepWindow
+	t := findCircuitOpenTime(c)
+	if t == nil || t.get().IsZero() {
+		return window
+	}
+	if rest := t.get().Add(window).Sub(now); rest > 0 {
+		return rest
+	}
+	return 0
+}
+
+// restoreOpenCircuit opens the circuit as if it was opened so long ago that the rest of its sleep window is rest,
+// the circuit allows a request to check whether to close at once when rest is not positive.
+func restoreOpenCircuit(c *circuit.Circuit, rest time.Duration, now time.Time) {
+	c.OpenCircuit()
+	if !c.IsOpen() {
+		return
+	}
+	closer, ok := c.OpenToClose.(*hystrix.Closer)
+	if !ok {
+		return
+	}
+	if rest < 0 {
+		rest = 0
+	}
+	// The closer fails fast for the whole sleep window from the moment it is opened, whatever the time passed to it,
+	// so it is opened again with the rest of the window.
+	config := closer.Config()
+	restConfig := config
+	restConfig.SleepWindow = rest
+	closer.SetConfigThreadSafe(restConfig)
+	closer.Opened(now)
+	closer.SetConfigThreadSafe(config)
+	if t := findCircuitOpenTime(c); t != nil {
+		t.Opened(now.Add(rest - config.SleepWindow))
+	}
+}
+
+// circuitOpenTime tracks the time the circuit is opened, it is a circuit.Metrics of the circuits
+// of the managers created by this package, see newCircuitManager.
+type circuitOpenTime struct {
+	mu       sync.Mutex
+	openedAt time.Time
+}
+
+func createCircuitOpenTimeConfig(_ string) circuit.Config {
+	return circuit.Config{
+		Metrics: circuit.MetricsCollectors{
+			Circuit: []circuit.Metrics{&circuitOpenTime{}},
+		},
+	}
+}
+
+func findCircuitOpenTime(c *circuit.Circuit) *circuitOpenTime {
+	for _, m := range c.Config().Metrics.Circuit {
+		if t, ok := m.(*circuitOpenTime); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+func (t *circuitOpenTime) Opened(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.openedAt = now
+}
+
+func (t *circuitOpenTime) Closed(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.openedAt = time.Time{}
+}
+
+func (t *circuitOpenTime) get() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.openedAt
+}
+
+// stateLimiter is a rate limiter that tracks the time of its next token for Client.ExportState,
+// and waits until the time restored by Client.ImportState before its first token.
+type stateLimiter struct {
+	ratelimit.Limiter
+	per       time.Duration
+	clock     Clock
+	mu        sync.Mutex
+	last      time.Time
+	notBefore time.Time
+}
+
+// newStateLimiter wraps the limiter of the rate per second, the rate of a custom limiter may be unknown,
+// and then only the time restored by Client.ImportState is tracked.
+func newStateLimiter(limiter ratelimit.Limiter, rate int, clock Clock) *stateLimiter {
+	l := &stateLimiter{Limiter: limiter, clock: getClock(clock)}
+	if rate > 0 {
+		l.per = time.Second / time.Duration(rate)
+	}
+	return l
+}
+
+func (l *stateLimiter) Take() time.Time {
+	l.mu.Lock()
+	wait := l.notBefore.Sub(l.clock.Now())
+	l.notBefore = time.Time{}
+	l.mu.Unlock()
+	if wait > 0 {
+		_ = sleepContext(context.Background(), l.clock, wait)
+	}
+
+	t := l.Limiter.Take()
+	// The limiter keeps the real time, the time of the token is tracked by the clock.
+	now := l.clock.Now()
+	l.mu.Lock()
+	if now.After(l.last) {
+		l.last = now
+	}
+	l.mu.Unlock()
+	return t
+}
+
+// debt returns the time until the next token.
+func (l *stateLimiter) debt(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	next := l.notBefore
+	if !l.last.IsZero() && l.last.Add(l.per).After(next) {
+		next = l.last.Add(l.per)
+	}
+	return next.Sub(now)
+}
+
+func (l *stateLimiter) restore(notBefore time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if notBefore.After(l.notBefore) {
+		l.notBefore = notBefore
+	}
+}
+
+func exportRateLimitState(option RateLimitOption, now time.Time) map[string]time.Duration {
+	debts := make(map[string]time.Duration)
+	option.RateLimits.Range(func(key, val interface{}) bool {
+		name, ok := key.(string)
+		l, isState := val.(*stateLimiter)
+		if ok && isState {
+			if d := l.debt(now); d > 0 {
+				debts[name] = d
+			}
+		}
+		return true
+	})
+	return debts
+}
+
+func importRateLimitState(option RateLimitOption, debts map[string]time.Duration, now time.Time, age time.Duration) {
+	if option.RateLimitConstructor == nil {
+		return
+	}
+	for key, debt := range debts {
+		if debt <= age {
+			continue
+		}
+		val, _ := option.RateLimits.LoadOrStore(key, newStateLimiter(option.RateLimitConstructor(), option.Rate, option.Clock))
+		if l, ok := val.(*stateLimiter); ok {
+			l.restore(now.Add(debt - age))
+		}
+	}
+}
+
+// statePersistence stores the snapshots of the state of a client to a Cacher, see WithStatePersistence.
+type statePersistence struct {
+	cacher   Cacher
+	key      string
+	interval time.Duration
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// StartStatePersistence restores the snapshot of WithStatePersistence stored by the Cacher, if any,
+// and stores a new snapshot every interval until the context is done or StopStatePersistence is called.
+// The error of a snapshot that can not be restored, such as ErrStaleState, is returned, the snapshots are stored anyway.
+// It does nothing without WithStatePersistence, or when it is already started.
+func (c *Client) StartStatePersistence(ctx context.Context) error {
+	p := c.statePersistence
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	if p.started || p.stopped {
+		p.mu.Unlock()
+		return nil
+	}
+	p.started = true
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	p.mu.Unlock()
+
+	data, err := cacheGet(ctx, p.cacher, []byte(p.key))
+	if err == nil {
+		err = c.ImportState(data)
+	}
+	if errors.Cause(err) == ErrCacheKeyNotFound {
+		err = nil
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "Restore the state from the cache key '%s'", p.key)
+	}
+
+	if p.interval <= 0 {
+		close(p.done)
+		return err
+	}
+	go func() {
+		defer close(p.done)
+		for {
+			timer := getClock(c.clock).NewTimer(p.interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-p.stop:
+				timer.Stop()
+				return
+			case <-timer.C():
+				p.save(ctx, c)
+			}
+		}
+	}()
+	return err
+}
+
+func (p *statePersistence) save(ctx context.Context, c *Client) {
+	data, err := c.ExportState()
+	if err == nil {
+		err = cacheSet(ctx, p.cacher, []byte(p.key), data, DefaultStateMaxAge)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("key", p.key).Warn("gohttpclient persist state")
+	}
+}
+
+// StopStatePersistence stops storing the snapshots of WithStatePersistence, and stores a last one,
+// such as before the process exits. It does nothing without WithStatePersistence, or when it is already stopped.
+func (c *Client) StopStatePersistence() {
+	p := c.statePersistence
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	started := p.started
+	p.mu.Unlock()
+
+	if started {
+		close(p.stop)
+		<-p.done
+	}
+	p.save(context.Background(), c)
+}
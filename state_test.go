@@ -0,0 +1,242 @@
+package gohttpclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cep21/circuit"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func getTestStateCircuitManager() *circuit.Manager {
+	manager := getTestCircuitManager()
+	manager.DefaultCircuitProperties = append(manager.DefaultCircuitProperties, createCircuitOpenTimeConfig)
+	return manager
+}
+
+func TestClient_ExportImportState_OpenCircuit(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	name := strings.ToLower(ts.URL())
+	// The sleep window is 300ms.
+	option := SharedHystrixOption(getTestStateCircuitManager())
+	c := NewClient(WithHystrixOption(option))
+	resp, err := c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	option.CircuitManager.GetCircuit(name).OpenCircuit()
+	time.Sleep(150 * time.Millisecond)
+
+	data, err := c.ExportState()
+	require.Nil(t, err)
+	var s stateSnapshot
+	require.Nil(t, msgpack.Unmarshal(data, &s))
+	require.True(t, s.Circuits[name].Open)
+	require.InDelta(t, 150*time.Millisecond, s.Circuits[name].ReopenIn, float64(100*time.Millisecond))
+
+	// The fresh client keeps the circuit open until the sleep window of the old one elapses,
+	// not a whole sleep window from the import.
+	fresh := SharedHystrixOption(getTestStateCircuitManager())
+	c = NewClient(WithHystrixOption(fresh))
+	require.Nil(t, c.ImportState(data))
+	require.True(t, fresh.IsOpen(name))
+	_, err = c.Get(ts.URL("/"))
+	var circuitOpenErr *CircuitOpenError
+	require.True(t, errors.As(err, &circuitOpenErr))
+	require.Equal(t, 1, ts.RequestCount("/"))
+
+	time.Sleep(225 * time.Millisecond)
+	resp, err = c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, 2, ts.RequestCount("/"))
+	require.False(t, fresh.IsOpen(name))
+}
+
+func TestClient_ExportImportState_ClosedCircuit(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/ok": func(w http.ResponseWriter, r *http.Request) {},
+		"/fail": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	})
+	name := strings.ToLower(ts.URL())
+	option := NewIsolatedHystrixOption()
+	option.IsFailureFunc = IsServerErrorFailure
+	c := NewClient(WithHystrixOption(option))
+	for _, path := range []string{"/ok", "/ok", "/ok", "/fail"} {
+		resp, err := c.Get(ts.URL(path))
+		require.Nil(t, err)
+		resp.Body.Close()
+	}
+	data, err := c.ExportState()
+	require.Nil(t, err)
+
+	fresh := NewIsolatedHystrixOption()
+	require.Nil(t, NewClient(WithHystrixOption(fresh)).ImportState(data))
+	require.Equal(t, CircuitStats{RequestVolume: 4, Errors: 1, ErrorRate: 0.25}, fresh.Stats()[name])
+}
+
+func TestClient_ImportState_Ignored(t *testing.T) {
+	option := NewIsolatedHystrixOption()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	option.HystrixContructor(req, option).OpenCircuit()
+	data, err := NewClient(WithHystrixOption(option)).ExportState()
+	require.Nil(t, err)
+	var s stateSnapshot
+	require.Nil(t, msgpack.Unmarshal(data, &s))
+
+	encode := func(modify func(s *stateSnapshot)) []byte {
+		snapshot := s
+		modify(&snapshot)
+		data, err := msgpack.Marshal(snapshot)
+		require.Nil(t, err)
+		return data
+	}
+	cases := []struct {
+		data []byte
+		err  error
+	}{
+		{encode(func(s *stateSnapshot) { s.Version = StateSnapshotVersion + 1 }), ErrIncompatibleState},
+		{encode(func(s *stateSnapshot) { s.CreatedAt = s.CreatedAt.Add(-DefaultStateMaxAge - time.Second) }), ErrStaleState},
+		{encode(func(s *stateSnapshot) { s.CreatedAt = s.CreatedAt.Add(2 * time.Minute) }), ErrStaleState},
+	}
+	for i, v := range cases {
+		fresh := NewIsolatedHystrixOption()
+		err := NewClient(WithHystrixOption(fresh)).ImportState(v.data)
+		require.Truef(t, errors.Is(err, v.err), "#%d: %v", i, err)
+		require.Falsef(t, fresh.IsOpen("https://example.com"), "#%d", i)
+	}
+
+	fresh := NewIsolatedHystrixOption()
+	require.NotNil(t, NewClient(WithHystrixOption(fresh)).ImportState([]byte("garbage")))
+
+	// A clock slightly ahead is tolerated.
+	data = encode(func(s *stateSnapshot) { s.CreatedAt = s.CreatedAt.Add(30 * time.Second) })
+	require.Nil(t, NewClient(WithHystrixOption(fresh)).ImportState(data))
+	require.True(t, fresh.IsOpen("https://example.com"))
+}
+
+func TestClient_ExportImportState_RateLimit(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {},
+	})
+	c := NewClient(WithRateLimitOption(NewRateLimitOption(2)))
+	resp, err := c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	data, err := c.ExportState()
+	require.Nil(t, err)
+
+	// The fresh client waits for the next token of the old one.
+	c = NewClient(WithRateLimitOption(NewRateLimitOption(2)))
+	require.Nil(t, c.ImportState(data))
+	start := time.Now()
+	resp, err = c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Greater(t, time.Since(start), 300*time.Millisecond)
+
+	// Without the snapshot, the first request is not limited.
+	c = NewClient(WithRateLimitOption(NewRateLimitOption(2)))
+	start = time.Now()
+	resp, err = c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Less(t, time.Since(start), 300*time.Millisecond)
+}
+
+func TestClient_ExportImportState_Clock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	option := NewIsolatedHystrixOption()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	option.HystrixContructor(req, option).OpenCircuit()
+	data, err := NewClient(WithHystrixOption(option), WithClock(clock)).ExportState()
+	require.Nil(t, err)
+	var s stateSnapshot
+	require.Nil(t, msgpack.Unmarshal(data, &s))
+	require.True(t, clock.Now().Equal(s.CreatedAt))
+
+	// The age of the snapshot is measured by the clock of the client.
+	clock.Advance(DefaultStateMaxAge + time.Second)
+	fresh := NewIsolatedHystrixOption()
+	err = NewClient(WithHystrixOption(fresh), WithClock(clock)).ImportState(data)
+	require.True(t, errors.Is(err, ErrStaleState))
+	require.False(t, fresh.IsOpen("https://example.com"))
+
+	// The rate limiter waits for the restored token by the clock of the client.
+	key := "GET https://example.com/"
+	data, err = msgpack.Marshal(stateSnapshot{
+		Version:    StateSnapshotVersion,
+		CreatedAt:  clock.Now(),
+		RateLimits: map[string]time.Duration{key: time.Hour},
+	})
+	require.Nil(t, err)
+	rateLimitOption := NewRateLimitOption(100)
+	c := NewClient(WithRateLimitOption(rateLimitOption), WithClock(clock))
+	require.Nil(t, c.ImportState(data))
+	taken := make(chan struct{})
+	go func() {
+		_ = c.rateLimitOption.take(req)
+		close(taken)
+	}()
+	clock.BlockUntil(1)
+	select {
+	case <-taken:
+		t.Fatal("the token is taken before the restored time")
+	default:
+	}
+	clock.Advance(time.Hour)
+	<-taken
+}
+
+func TestWithStatePersistence(t *testing.T) {
+	cacher := NewMemoryCache()
+	option := NewIsolatedHystrixOption()
+	clock := NewFakeClock(time.Now())
+	c := NewClient(WithHystrixOption(option), WithStatePersistence(cacher, "state", time.Second), WithClock(clock))
+	ctx, cancel := context.WithCancel(context.Background())
+	require.Nil(t, c.StartStatePersistence(ctx))
+	require.Nil(t, c.StartStatePersistence(ctx))
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	option.HystrixContructor(req, option).OpenCircuit()
+	_, err := cacher.Get([]byte("state"))
+	require.Equal(t, ErrCacheKeyNotFound, errors.Cause(err))
+
+	// A snapshot is stored every interval of the clock of the client.
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	require.Eventually(t, func() bool {
+		_, err := cacher.Get([]byte("state"))
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	// The snapshots are not stored anymore when the context is done, but at StopStatePersistence.
+	cancel()
+	c.StopStatePersistence()
+	c.StopStatePersistence()
+	_, err = cacher.Get([]byte("state"))
+	require.Nil(t, err)
+
+	// Nothing is restored when the client is created, but when the persistence is started.
+	fresh := NewIsolatedHystrixOption()
+	c = NewClient(WithHystrixOption(fresh), WithStatePersistence(cacher, "state", 0))
+	require.False(t, fresh.IsOpen("https://example.com"))
+	require.Nil(t, c.StartStatePersistence(context.Background()))
+	require.True(t, fresh.IsOpen("https://example.com"))
+	c.StopStatePersistence()
+
+	// A snapshot that can not be restored is reported.
+	require.Nil(t, cacher.Set([]byte("state"), []byte("garbage"), time.Minute))
+	c = NewClient(WithHystrixOption(NewIsolatedHystrixOption()), WithStatePersistence(cacher, "state", 0))
+	require.NotNil(t, c.StartStatePersistence(context.Background()))
+
+	NewClient().StopStatePersistence()
+	require.Nil(t, NewClient().StartStatePersistence(context.Background()))
+}
@@ -0,0 +1,58 @@
+package gohttpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// MarkStreaming marks the requests initiated with this context as streaming requests.
+// The built-in interceptors never read the whole body of a streaming request into memory,
+// the logger only records the headers and status code, and the cache does not store the response.
+func MarkStreaming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamingContextKey, true)
+}
+
+// IsStreaming reports whether the context has been marked as streaming by MarkStreaming.
+func IsStreaming(ctx context.Context) bool {
+	v, _ := ctx.Value(streamingContextKey).(bool)
+	return v
+}
+
+func isStreamingRequest(req *http.Request) bool {
+	return IsStreaming(getRequestContext(req))
+}
+
+// limitedReadCloser returns ErrResponseBodyTooLarge once more than n bytes have been read,
+// the bytes within the limit are returned before the error.
+type limitedReadCloser struct {
+	rc       io.ReadCloser
+	n        uint64
+	exceeded bool
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrResponseBodyTooLarge
+	}
+	// Compare with the remaining count, l.n+1 overflows when the limit is math.MaxUint64.
+	if len(p) > 0 && uint64(len(p)-1) > l.n {
+		p = p[:l.n+1]
+	}
+	n, err := l.rc.Read(p)
+	if uint64(n) > l.n {
+		n = int(l.n)
+		l.n = 0
+		l.exceeded = true
+		if n == 0 {
+			return 0, ErrResponseBodyTooLarge
+		}
+		return n, nil
+	}
+	l.n -= uint64(n)
+	return n, err
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.rc.Close()
+}
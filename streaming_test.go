@@ -0,0 +1,159 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type testCountingReader struct {
+	remaining int64
+	read      int64
+}
+
+func (r *testCountingReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if n > r.remaining {
+		n = r.remaining
+	}
+	for i := int64(0); i < n; i++ {
+		p[i] = 'x'
+	}
+	r.remaining -= n
+	atomic.AddInt64(&r.read, n)
+	return int(n), nil
+}
+
+type testRoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn testRoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestStreamingMode(t *testing.T) {
+	bodySize := int64(64 * 1024 * 1024)
+	source := &testCountingReader{remaining: bodySize}
+	transport := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(source),
+			ContentLength: -1,
+			Request:       req,
+		}, nil
+	})
+
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithStreamingMode(),
+		WithMaxBodySize(uint64(bodySize)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithLoggerOption(loggerOption),
+		WithRateLimitOption(NewRateLimitOption(10)),
+		WithHystrixOption(NewHystrixOption()),
+		WithTraceOption(NewTraceOption()),
+		WithCacheOption(NewMemoryCacheOption()),
+	)
+
+	resp, err := c.Get("https://example.com/stream")
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	require.Nil(t, entry.ResponseBody)
+	require.Equal(t, http.StatusOK, entry.StatusCode)
+
+	maxBuffered := int64(0)
+	consumed := int64(0)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		consumed += int64(n)
+		if buffered := atomic.LoadInt64(&source.read) - consumed; buffered > maxBuffered {
+			maxBuffered = buffered
+		}
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+	}
+	require.Nil(t, resp.Body.Close())
+	require.Equal(t, bodySize, consumed)
+	require.True(t, maxBuffered <= 1024*1024, "buffered %d bytes", maxBuffered)
+}
+
+func TestStreamingMode_MarkStreaming(t *testing.T) {
+	ctx := context.Background()
+	require.False(t, IsStreaming(ctx))
+	require.True(t, IsStreaming(MarkStreaming(ctx)))
+}
+
+func TestBodySizeHandler_Streaming(t *testing.T) {
+	option := NewBodySizeOption(5)
+	handler := BodySizeHandler(option)
+
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(bytes.NewBufferString("hello world")),
+		}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	req = req.WithContext(MarkStreaming(req.Context()))
+	resp, err := handler(req, handlerFunc)
+	require.Nil(t, err)
+	require.NotNil(t, resp)
+	body, err := io.ReadAll(resp.Body)
+	require.Equal(t, ErrResponseBodyTooLarge, err)
+	require.Equal(t, "hello", string(body))
+
+	// The bytes within the limit read at once are returned before the error.
+	resp, err = handler(req, handlerFunc)
+	require.Nil(t, err)
+	p := make([]byte, 64)
+	n, err := resp.Body.Read(p)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(p[:n]))
+	n, err = resp.Body.Read(p)
+	require.Zero(t, n)
+	require.Equal(t, ErrResponseBodyTooLarge, err)
+}
+
+func TestCacheHandler_Streaming(t *testing.T) {
+	handler := CacheHandler(NewMemoryCacheOption())
+	realRequestTimes := 0
+	handlerFunc := func(req *http.Request) (resp *http.Response, err error) {
+		realRequestTimes++
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewBufferString("hello world")),
+		}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com/streaming", nil)
+		req = req.WithContext(MarkStreaming(req.Context()))
+		resp, err := handler(req, handlerFunc)
+		require.Nil(t, err)
+		require.NotNil(t, resp)
+	}
+	require.Equal(t, 2, realRequestTimes)
+}
@@ -0,0 +1,196 @@
+package gohttpclient
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrMisconfiguredHandler is the error that matches, by errors.Is, the errors of the misconfigured handlers.
+var ErrMisconfiguredHandler = errors.New("The handler is misconfigured")
+
+// MisconfiguredHandlerError is returned when a handler is enabled, or half configured, but a field it needs is missing,
+// Handler is the name of the handler, such as RateLimit, and Field is the missing field of its option.
+type MisconfiguredHandlerError struct {
+	Handler string
+	Field   string
+}
+
+func (e *MisconfiguredHandlerError) Error() string {
+	return fmt.Sprintf("The handler %s is misconfigured: %s is missing", e.Handler, e.Field)
+}
+
+// Is reports whether the target is ErrMisconfiguredHandler.
+func (e *MisconfiguredHandlerError) Is(target error) bool {
+	return target == ErrMisconfiguredHandler
+}
+
+// ConfigError is returned by NewClientWithError in the strict mode, and by the requests of a client created by NewClient
+// in the strict mode, with all the misconfigured handlers of the client.
+type ConfigError struct {
+	Errors []*MisconfiguredHandlerError
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "The client is misconfigured: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether the target is ErrMisconfiguredHandler.
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrMisconfiguredHandler
+}
+
+// NewClientWithError creates a new HTTP request client like NewClient, and returns the OptionError of the first
+// option that can not be applied, such as WithProxy of an invalid URL, which NewClient only logs as a warning.
+// In the strict mode of WithStrictMode, it also returns a ConfigError when some handlers are misconfigured,
+// such as WithMaxRetry without WithRetryBackOff, which are only logged as warnings without the strict mode.
+func NewClientWithError(options ...Option) (*Client, error) {
+	c := NewClient(options...)
+	if len(c.optionErrs) > 0 {
+		c.CloseQueue()
+		return nil, c.optionErrs[0]
+	}
+	if c.configErr != nil {
+		c.CloseQueue()
+		return nil, c.configErr
+	}
+	return c, nil
+}
+
+// NewClientE is an alias of NewClientWithError.
+//
+// Deprecated: use NewClientWithError.
+func NewClientE(options ...Option) (*Client, error) {
+	return NewClientWithError(options...)
+}
+
+// checkConfig reports the misconfigured handlers of the client, they are the errors of the requests
+// in the strict mode, and the warnings otherwise.
+func (c *Client) checkConfig() {
+	errs := c.misconfigurations()
+	if len(errs) == 0 {
+		return
+	}
+	if c.strictMode {
+		c.configErr = &ConfigError{Errors: errs}
+		return
+	}
+	for _, err := range errs {
+		logrus.WithField("handler", err.Handler).WithField("field", err.Field).
+			Warn("gohttpclient handler is misconfigured")
+	}
+}
+
+// configField is a field of an option, which is missing when the check is true.
+type configField struct {
+	name    string
+	missing bool
+}
+
+// misconfigurations returns the handlers that are enabled but miss a field, which fail or fall back to
+// the default at request time, and the ones that are half configured, which are silently disabled.
+func (c *Client) misconfigurations() []*MisconfiguredHandlerError {
+	var errs []*MisconfiguredHandlerError
+	check := func(handler string, fields ...configField) {
+		for _, f := range fields {
+			if f.missing {
+				errs = append(errs, &MisconfiguredHandlerError{Handler: handler, Field: f.name})
+			}
+		}
+	}
+
+	if r := c.retryOption; !r.isEnabled() {
+		decided := r.ShouldRetryFunc != nil || r.RetryDecisionFunc != nil
+		if r.MaxRetry > 0 || r.RetryBackOff != nil || decided || r.MaxInterval > 0 || r.MaxElapsedTime > 0 {
+			check("Retry",
+				configField{"MaxRetry", r.MaxRetry == 0},
+				configField{"RetryBackOff", r.RetryBackOff == nil},
+				configField{"ShouldRetryFunc", !decided},
+			)
+		}
+	}
+
+	if a := c.adaptiveOption; !a.isEnabled() && (a.Limiters != nil || a.MaxLimit > 0 || a.LatencyTarget > 0) {
+		check("Adaptive",
+			configField{"Limiters", a.Limiters == nil},
+			configField{"MaxLimit", a.MaxLimit <= 0},
+			configField{"LatencyTarget", a.LatencyTarget <= 0},
+		)
+	}
+
+	l := c.loggerOption
+	check("Logger",
+		configField{"LoggerFunc", l.Logger != nil && l.LoggerFunc == nil},
+		configField{"Logger", l.Logger == nil && l.LoggerFunc != nil},
+	)
+
+	check("RateLimit", rateLimitMisconfigurations(c.rateLimitOption)...)
+	if o := c.retryOption.RateLimitOption; o != nil {
+		fields := rateLimitMisconfigurations(*o)
+		if !o.isEnabled() {
+			fields = []configField{{"RateLimits", true}}
+		}
+		check("RetryRateLimit", fields...)
+	}
+
+	o := c.cacheOption
+	cacheFields := []configField{
+		{"ShouldCacheFunc", o.ShouldCacheFunc == nil},
+		{"RequestHashFunc", o.RequestHashFunc == nil},
+		{"CacheTTLFunc", o.CacheTTLFunc == nil},
+		{"Cacher", o.Cacher == nil},
+		{"EncoderDecoder", o.EncoderDecoder == nil},
+	}
+	missingCacheFields := 0
+	for _, f := range cacheFields {
+		if f.missing {
+			missingCacheFields++
+		}
+	}
+	if missingCacheFields < len(cacheFields) {
+		check("Cache", cacheFields...)
+	}
+
+	h := c.hystrixOption
+	check("Hystrix",
+		configField{"HystrixContructor", h.HystrixContructor == nil && h.CircuitManager != nil},
+		configField{"CircuitManager", h.HystrixContructor != nil && h.CircuitManager == nil},
+	)
+
+	if r := c.recorderOption; r.Dir != "" {
+		check("Recorder",
+			configField{"SampleRate", r.SampleRate <= 0},
+			configField{"EncoderDecoder", r.EncoderDecoder == nil},
+			configField{"RandFunc", r.RandFunc == nil},
+		)
+	}
+	return errs
+}
+
+// rateLimitMisconfigurations returns the fields of the rate limit option that is enabled or half configured.
+// The RateLimitConstructor is only needed by the default RateLimitFunc, which is used when it is nil.
+func rateLimitMisconfigurations(o RateLimitOption) []configField {
+	if !o.isEnabled() {
+		return []configField{
+			{"RateLimits", o.Rate > 0 || o.RateLimitConstructor != nil || o.RateLimitFunc != nil},
+		}
+	}
+	return []configField{
+		{"RateLimitFunc", o.RateLimitFunc == nil},
+		{"RateLimitConstructor", o.RateLimitFunc == nil && o.RateLimitConstructor == nil},
+	}
+}
+
+// rejectMisconfigured returns the error of the client misconfigured in the strict mode for a request,
+// and closes the body of the request like http.Client does for the failed requests.
+func rejectMisconfigured(req *http.Request, err error) (*http.Response, error) {
+	closeRequestBody(req)
+	return nil, err
+}
@@ -0,0 +1,178 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Misconfigurations(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	retryWithoutShouldRetry := OptionFunc(func(c *Client) {
+		c.retryOption.MaxRetry = 3
+		c.retryOption.RetryBackOff = backoff.NewConstantBackOff(time.Millisecond)
+	})
+	adaptiveWithoutLimiters := NewAdaptiveOption(1, 1, 10, time.Second)
+	adaptiveWithoutLimiters.Limiters = nil
+	rateLimitWithoutFunc := NewRateLimitOption(100)
+	rateLimitWithoutFunc.RateLimitFunc = nil
+	rateLimitWithoutLimiter := NewRateLimitOption(100)
+	rateLimitWithoutLimiter.RateLimitFunc, rateLimitWithoutLimiter.RateLimitConstructor = nil, nil
+	retryRateLimit := RateLimitOption{Rate: 10}
+	logger, _ := test.NewNullLogger()
+	loggerWithoutFunc := NewLoggerOption()
+	loggerWithoutFunc.Logger = logrus.NewEntry(logger)
+	loggerWithoutFunc.LoggerFunc = nil
+	cacheWithoutCacher := NewMemoryCacheOption()
+	cacheWithoutCacher.Cacher = nil
+	hystrixWithoutManager := NewIsolatedHystrixOption()
+	hystrixWithoutManager.CircuitManager = nil
+	recorderWithoutRand := OptionFunc(func(c *Client) {
+		c.recorderOption = NewRecorderOption(t.TempDir(), 0.5)
+		c.recorderOption.RandFunc = nil
+	})
+
+	tests := []struct {
+		name    string
+		option  Option
+		handler string
+		fields  []string
+		// broken reports whether the requests fail without the strict mode too.
+		broken bool
+	}{
+		{"retry without RetryBackOff", WithMaxRetry(3), "Retry", []string{"RetryBackOff", "ShouldRetryFunc"}, false},
+		{"retry without ShouldRetryFunc", retryWithoutShouldRetry, "Retry", []string{"ShouldRetryFunc"}, false},
+		{"retry without MaxRetry", WithShouldRetryFunc(defaultShouldRetryFunc), "Retry", []string{"MaxRetry", "RetryBackOff"}, false},
+		{"adaptive without Limiters", WithAdaptiveThrottle(adaptiveWithoutLimiters), "Adaptive", []string{"Limiters"}, false},
+		{"rate limit without RateLimitFunc", WithRateLimitOption(rateLimitWithoutFunc), "RateLimit", []string{"RateLimitFunc"}, false},
+		{"rate limit without limiter", WithRateLimitOption(rateLimitWithoutLimiter), "RateLimit", []string{"RateLimitFunc", "RateLimitConstructor"}, true},
+		{"rate limit without RateLimits", WithRateLimitOption(RateLimitOption{Rate: 10}), "RateLimit", []string{"RateLimits"}, false},
+		{"retry rate limit without RateLimits", WithRetryRateLimit(retryRateLimit), "RetryRateLimit", []string{"RateLimits"}, false},
+		{"logger without LoggerFunc", WithLoggerOption(loggerWithoutFunc), "Logger", []string{"LoggerFunc"}, false},
+		{"cache without Cacher", WithCacheOption(cacheWithoutCacher), "Cache", []string{"Cacher"}, false},
+		{"hystrix without CircuitManager", WithHystrixOption(hystrixWithoutManager), "Hystrix", []string{"CircuitManager"}, false},
+		{"recorder without RandFunc", recorderWithoutRand, "Recorder", []string{"RandFunc"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected []*MisconfiguredHandlerError
+			for _, field := range tt.fields {
+				expected = append(expected, &MisconfiguredHandlerError{Handler: tt.handler, Field: field})
+			}
+
+			// The strict mode returns the misconfigurations from NewClientWithError, and from the requests of NewClient.
+			c, err := NewClientWithError(tt.option, WithStrictMode())
+			require.Nil(t, c)
+			require.True(t, errors.Is(err, ErrMisconfiguredHandler))
+			var configErr *ConfigError
+			require.ErrorAs(t, err, &configErr)
+			require.Equal(t, expected, configErr.Errors)
+
+			_, err = NewClient(tt.option, WithStrictMode()).Get(ts.URL)
+			require.True(t, errors.Is(err, ErrMisconfiguredHandler))
+
+			// Otherwise they are warnings, and the requests do not panic.
+			c, err = NewClientWithError(tt.option)
+			require.Nil(t, err)
+			require.NotNil(t, c)
+			require.NotPanics(t, func() {
+				resp, err := c.Get(ts.URL)
+				if tt.broken {
+					require.True(t, errors.Is(err, ErrMisconfiguredHandler))
+					return
+				}
+				require.Nil(t, err)
+				resp.Body.Close()
+			})
+		})
+	}
+}
+
+func TestClient_MisconfigurationsWarning(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	c := NewClient(WithRateLimitOption(RateLimitOption{Rate: 10}))
+	require.NotNil(t, c)
+	entries := hook.AllEntries()
+	require.Len(t, entries, 1)
+	require.Equal(t, logrus.WarnLevel, entries[0].Level)
+	require.Equal(t, "gohttpclient handler is misconfigured", entries[0].Message)
+	require.Equal(t, "RateLimit", entries[0].Data["handler"])
+	require.Equal(t, "RateLimits", entries[0].Data["field"])
+
+	// The strict mode does not warn.
+	hook.Reset()
+	_, err := NewClientWithError(WithStrictMode(), WithRateLimitOption(RateLimitOption{Rate: 10}))
+	require.NotNil(t, err)
+	require.Empty(t, hook.AllEntries())
+}
+
+func TestClient_StrictModeWellConfigured(t *testing.T) {
+	c, err := NewClientWithError(
+		WithStrictMode(),
+		WithRateLimitOption(NewRateLimitOption(100)),
+		WithCacheOption(NewMemoryCacheOption()),
+		WithHystrixOption(NewIsolatedHystrixOption()),
+	)
+	require.Nil(t, err)
+	require.NotNil(t, c)
+}
+
+func TestMisconfiguredHandlerError(t *testing.T) {
+	err := &ConfigError{Errors: []*MisconfiguredHandlerError{
+		{Handler: "RateLimit", Field: "RateLimitFunc"},
+		{Handler: "Cache", Field: "Cacher"},
+	}}
+	require.Equal(t, "The client is misconfigured: The handler RateLimit is misconfigured: RateLimitFunc is missing; "+
+		"The handler Cache is misconfigured: Cacher is missing", err.Error())
+	require.True(t, errors.Is(err.Errors[0], ErrMisconfiguredHandler))
+}
+
+func TestWithStrictMode_Retry(t *testing.T) {
+	// Forgetting the ShouldRetryFunc disables the retries.
+	_, err := NewClientWithError(
+		WithStrictMode(),
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+	)
+	require.True(t, errors.Is(err, ErrMisconfiguredHandler))
+	require.Contains(t, err.Error(), "The handler Retry is misconfigured: ShouldRetryFunc is missing")
+
+	c, err := NewClientWithError(
+		WithStrictMode(),
+		WithMaxRetry(3),
+		WithRetryBackOff(backoff.NewConstantBackOff(time.Millisecond)),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+	)
+	require.Nil(t, err)
+	require.True(t, c.retryOption.isEnabled())
+
+	c, err = NewClientWithError(WithMaxRetry(3))
+	require.Nil(t, err)
+	require.False(t, c.retryOption.isEnabled())
+}
+
+func TestNewClientWithError(t *testing.T) {
+	c, err := NewClientWithError(WithProxy("://bad"))
+	require.Nil(t, c)
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "WithProxy", optionErr.Option)
+
+	c, err = NewClientWithError(WithProxy("http://proxy.example.com:3128"))
+	require.Nil(t, err)
+	require.NotNil(t, c)
+}
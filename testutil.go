@@ -0,0 +1,85 @@
+package gohttpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestServer is a local HTTP server for the tests of the clients, which listens on a random port
+// and records the requests it receives by their URL paths.
+type TestServer struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	counts map[string]int
+	last   map[string]*http.Request
+	bodies map[string][]byte
+}
+
+// NewTestServer starts a test server that serves the routes, which are the patterns of http.ServeMux,
+// such as "/users/", and their handlers. The server is closed by the cleanup of t.
+func NewTestServer(t testing.TB, routes map[string]http.HandlerFunc) *TestServer {
+	mux := http.NewServeMux()
+	for pattern, handlerFunc := range routes {
+		mux.HandleFunc(pattern, handlerFunc)
+	}
+	s := &TestServer{
+		counts: make(map[string]int),
+		last:   make(map[string]*http.Request),
+		bodies: make(map[string][]byte),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.record(r)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// record buffers the body of the request, which is still readable by the handler, and records the request.
+func (s *TestServer) record(r *http.Request) {
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[r.URL.Path]++
+	s.last[r.URL.Path] = r.Clone(context.Background())
+	s.bodies[r.URL.Path] = body
+}
+
+// URL returns the base URL of the server, such as "http://127.0.0.1:54321", or the URL of the path when it is given.
+func (s *TestServer) URL(path ...string) string {
+	return s.server.URL + strings.Join(path, "")
+}
+
+// RequestCount returns the number of the requests received of the URL path.
+func (s *TestServer) RequestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[path]
+}
+
+// LastRequest returns the last request received of the URL path, or nil if there is none.
+// Its body is buffered, so it can be read after the request is served, and once by each call of LastRequest.
+func (s *TestServer) LastRequest(path string) *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.last[path]
+	if !ok {
+		return nil
+	}
+	r = r.Clone(context.Background())
+	r.Body = io.NopCloser(bytes.NewReader(s.bodies[path]))
+	return r
+}
@@ -0,0 +1,48 @@
+package gohttpclient
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestServer(t *testing.T) {
+	s := NewTestServer(t, map[string]http.HandlerFunc{
+		"/echo": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(w, r.Body)
+		},
+	})
+	require.Equal(t, 0, s.RequestCount("/echo"))
+	require.Nil(t, s.LastRequest("/echo"))
+
+	c := NewClient()
+	for _, body := range []string{"first", "second"} {
+		resp, err := c.Post(s.URL("/echo"), "text/plain", strings.NewReader(body))
+		require.Nil(t, err)
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err)
+		require.Equal(t, body, string(respBody))
+	}
+	require.Equal(t, 2, s.RequestCount("/echo"))
+
+	last := s.LastRequest("/echo")
+	require.Equal(t, http.MethodPost, last.Method)
+	require.Equal(t, "text/plain", last.Header.Get("Content-Type"))
+	for i := 0; i < 2; i++ {
+		body, err := io.ReadAll(s.LastRequest("/echo").Body)
+		require.Nil(t, err)
+		require.Equal(t, "second", string(body))
+	}
+
+	// The requests of the paths without a route are recorded too.
+	resp, err := c.Get(s.URL("/missing?q=1"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.Equal(t, 1, s.RequestCount("/missing"))
+	require.Equal(t, "q=1", s.LastRequest("/missing").URL.RawQuery)
+}
@@ -0,0 +1,119 @@
+package gohttpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ClientTimings is the timing breakdown of the last attempt of a request, captured by httptrace.
+// A zero duration means the phase did not happen, for example DNS and Connect are zero for a reused connection.
+type ClientTimings struct {
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// FirstByte is the time from the start of the attempt to the first byte of the response.
+	FirstByte time.Duration
+	Reused    bool
+}
+
+// clientTimingsRecorder records the timings from the httptrace hooks, which may be called concurrently.
+type clientTimingsRecorder struct {
+	mu      sync.Mutex
+	timings ClientTimings
+
+	start          time.Time
+	dnsStart       time.Time
+	connectStart   time.Time
+	handshakeStart time.Time
+}
+
+func (t *clientTimingsRecorder) snapshot() ClientTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timings
+}
+
+func (t *clientTimingsRecorder) reset(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timings = ClientTimings{}
+	t.start = now
+}
+
+func (t *clientTimingsRecorder) clientTrace() *httptrace.ClientTrace {
+	record := func(fn func(now time.Time)) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		fn(time.Now())
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func(now time.Time) { t.dnsStart = now })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func(now time.Time) { t.timings.DNS = now.Sub(t.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			record(func(now time.Time) { t.connectStart = now })
+		},
+		ConnectDone: func(string, string, error) {
+			record(func(now time.Time) { t.timings.Connect = now.Sub(t.connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			record(func(now time.Time) { t.handshakeStart = now })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func(now time.Time) { t.timings.TLSHandshake = now.Sub(t.handshakeStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func(time.Time) { t.timings.Reused = info.Reused })
+		},
+		GotFirstResponseByte: func() {
+			record(func(now time.Time) { t.timings.FirstByte = now.Sub(t.start) })
+		},
+	}
+}
+
+// ClientTimingsFromContext returns the timings captured by ClientTimingsHandler,
+// for example ClientTimingsFromContext(resp.Request.Context()).
+func ClientTimingsFromContext(ctx context.Context) (ClientTimings, bool) {
+	t := getClientTimingsRecorder(ctx)
+	if t == nil {
+		return ClientTimings{}, false
+	}
+	return t.snapshot(), true
+}
+
+func getClientTimingsRecorder(ctx context.Context) *clientTimingsRecorder {
+	t, _ := ctx.Value(clientTimingsContextKey).(*clientTimingsRecorder)
+	return t
+}
+
+// ClientTimingsHandler creates an interceptor that captures the DNS, connect, TLS handshake and first byte timings of the request.
+// The timings are recorded in LoggerEntry.Timings when the logger is enabled, and can be read by ClientTimingsFromContext.
+func ClientTimingsHandler() RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil {
+			return handlerFunc(req)
+		}
+		ctx := context.WithValue(req.Context(), clientTimingsContextKey, &clientTimingsRecorder{})
+		req = req.WithContext(ctx)
+		return handlerFunc(req)
+	}
+}
+
+// clientTimingsAttemptHandler resets the timings and installs the trace for each attempt,
+// it is placed after the retry interceptor.
+func clientTimingsAttemptHandler(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+	timings := getClientTimingsRecorder(getRequestContext(req))
+	if timings == nil {
+		return handlerFunc(req)
+	}
+	timings.reset(time.Now())
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timings.clientTrace()))
+	return handlerFunc(req)
+}
@@ -0,0 +1,58 @@
+package gohttpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithClientTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, "hello world")
+	}))
+	defer srv.Close()
+
+	var entry LoggerEntry
+	loggerOption := NewLoggerOption()
+	loggerOption.LoggerFunc = func(req *http.Request, e LoggerEntry, option LoggerOption) {
+		entry = e
+	}
+	c := NewClient(
+		WithHTTPClient(&http.Client{Transport: &http.Transport{}}),
+		WithClientTimings(),
+		WithLoggerOption(loggerOption),
+	)
+
+	resp, err := c.Get(srv.URL)
+	require.Nil(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	require.Nil(t, resp.Body.Close())
+
+	require.NotNil(t, entry.Timings)
+	require.False(t, entry.Timings.Reused)
+	require.True(t, entry.Timings.Connect > 0)
+	require.True(t, entry.Timings.FirstByte >= 5*time.Millisecond)
+
+	timings, ok := ClientTimingsFromContext(resp.Request.Context())
+	require.True(t, ok)
+	require.Equal(t, *entry.Timings, timings)
+
+	resp, err = c.Get(srv.URL)
+	require.Nil(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	require.Nil(t, resp.Body.Close())
+	require.True(t, entry.Timings.Reused)
+	require.Equal(t, time.Duration(0), entry.Timings.Connect)
+}
+
+func TestClientTimingsFromContext_NotInstalled(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	_, ok := ClientTimingsFromContext(req.Context())
+	require.False(t, ok)
+}
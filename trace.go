@@ -6,6 +6,8 @@ import (
 
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
 )
 
 // TraceComponentNameFunc defines a function that gets the name of the tracking component by request.
@@ -26,6 +28,10 @@ type TraceOption struct {
 	ComponentName         string
 	ComponentNameFunc     TraceComponentNameFunc
 	ClientConnectionTrace bool
+	// DetailedSpans starts a span for the whole call, including the retries and the waits of the interceptors,
+	// the spans of the attempts are its children. The decisions of the built-in interceptors,
+	// such as a cache hit or a retry, are logged to it with their durations, see TraceDetailHandler.
+	DetailedSpans bool
 }
 
 // NewTraceOption creates a new option configuration for distributed tracing.
@@ -60,3 +66,57 @@ func TraceHandler(option TraceOption) RequestHandler {
 		return handlerFunc(req)
 	}
 }
+
+// TraceDetailHandler creates an interceptor that starts a span for the whole call when TraceOption.DetailedSpans is set,
+// it should be the outermost one so that the span covers all the other interceptors.
+// The records of explain mode are logged to the span when the call finishes, so explain mode is turned on
+// for the request, see WithExplain. The span is tagged with the cache decision and the number of retries.
+func TraceDetailHandler(option TraceOption) RequestHandler {
+	return func(req *http.Request, handlerFunc RequestHandlerFunc) (*http.Response, error) {
+		if req == nil {
+			return handlerFunc(req)
+		}
+
+		ctx := WithExplain(req.Context())
+		e := getExplainRecorder(ctx)
+		start := len(e.snapshot())
+
+		opts := []opentracing.StartSpanOption{ext.SpanKindRPCClient}
+		if parent := opentracing.SpanFromContext(ctx); parent != nil {
+			opts = append(opts, opentracing.ChildOf(parent.Context()))
+		}
+		span := option.Tracer.StartSpan(option.ComponentNameFunc(req), opts...)
+		defer span.Finish()
+		ext.Component.Set(span, option.ComponentName)
+		ext.HTTPMethod.Set(span, req.Method)
+		if req.URL != nil {
+			ext.HTTPUrl.Set(span, req.URL.String())
+		}
+
+		resp, err := handlerFunc(req.WithContext(opentracing.ContextWithSpan(ctx, span)))
+
+		retries := 0
+		for _, r := range e.snapshot()[start:] {
+			span.LogFields(
+				log.String("handler", r.Handler),
+				log.String("decision", r.Decision),
+				log.String("reason", r.Reason),
+				log.String("duration", r.Duration.String()),
+			)
+			switch {
+			case r.Handler == "cache" && (r.Decision == "hit" || r.Decision == "miss"):
+				span.SetTag("cache", r.Decision)
+			case r.Handler == "retry" && r.Decision == "retry":
+				retries++
+			}
+		}
+		span.SetTag("retries", retries)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err))
+		} else if resp != nil {
+			ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
+		}
+		return resp, err
+	}
+}
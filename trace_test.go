@@ -4,10 +4,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 
+	"github.com/cenkalti/backoff/v4"
+
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/uber/jaeger-client-go"
@@ -18,38 +23,21 @@ import (
 
 type TraceTestSuite struct {
 	suite.Suite
-	done chan bool
-	addr string
-	url  string
+	server *TestServer
+	url    string
 }
 
 func (suite *TraceTestSuite) SetupSuite() {
-	suite.done = make(chan bool)
-	suite.addr = ":19999"
 	path := "/client"
-	suite.url = fmt.Sprintf("http://localhost%s%s", suite.addr, path)
-
-	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			panic(err)
-		}
-		fmt.Fprint(w, r.Form.Encode())
-	}
-
-	go func() {
-		mux := http.NewServeMux()
-		mux.HandleFunc(path, handlerFunc)
-		srv := &http.Server{Addr: suite.addr, Handler: mux}
-		go func() {
-			<-suite.done
-			srv.Close()
-		}()
-		srv.ListenAndServe()
-	}()
-}
-
-func (suite *TraceTestSuite) TearDownSuite() {
-	close(suite.done)
+	suite.server = NewTestServer(suite.T(), map[string]http.HandlerFunc{
+		path: func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseForm(); err != nil {
+				panic(err)
+			}
+			fmt.Fprint(w, r.Form.Encode())
+		},
+	})
+	suite.url = suite.server.URL(path)
 }
 
 func (suite *TraceTestSuite) TestTraceHandler() {
@@ -97,3 +85,106 @@ func getTestTracer() (opentracing.Tracer, io.Closer, error) {
 		config.Metrics(metrics.NullFactory),
 	)
 }
+
+func TestTraceDetailHandler_CacheHit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello world")
+	}))
+	defer ts.Close()
+
+	tracer := mocktracer.New()
+	option := NewTraceOption()
+	option.Tracer = tracer
+	option.DetailedSpans = true
+	c := NewClient(WithTraceOption(option), WithCacheOption(NewMemoryCacheOption()))
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(ts.URL)
+		require.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		require.Equal(t, "hello world", string(body))
+	}
+
+	spans := getTestDetailedSpans(tracer)
+	require.Len(t, spans, 2)
+	require.Equal(t, "miss", spans[0].Tag("cache"))
+	require.Equal(t, "hit", spans[1].Tag("cache"))
+	require.Equal(t, 0, spans[1].Tag("retries"))
+	require.Equal(t, uint16(http.StatusOK), spans[1].Tag("http.status_code"))
+	require.Equal(t, [][2]string{{"cache", "hit"}}, getTestSpanDecisions(spans[1]))
+	// Only the miss reaches the transport.
+	require.Len(t, tracer.FinishedSpans(), 3)
+}
+
+func TestTraceDetailHandler_Retry(t *testing.T) {
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "hello world")
+	}))
+	defer ts.Close()
+
+	tracer := mocktracer.New()
+	option := NewTraceOption()
+	option.Tracer = tracer
+	option.DetailedSpans = true
+	c := NewClient(
+		WithTraceOption(option),
+		WithMaxRetry(3),
+		WithShouldRetryFunc(defaultShouldRetryFunc),
+		WithRetryBackOff(backoff.NewConstantBackOff(0)),
+	)
+
+	resp, err := c.Get(ts.URL)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	spans := getTestDetailedSpans(tracer)
+	require.Len(t, spans, 1)
+	require.Equal(t, 2, spans[0].Tag("retries"))
+	require.Equal(t, [][2]string{{"retry", "retry"}, {"retry", "retry"}}, getTestSpanDecisions(spans[0]))
+
+	// The spans of the attempts are the children of the detailed span.
+	attempts := 0
+	for _, span := range tracer.FinishedSpans() {
+		if span.ParentID == spans[0].SpanContext.SpanID {
+			attempts++
+		}
+	}
+	require.Equal(t, 3, attempts)
+}
+
+// getTestDetailedSpans returns the finished spans started by TraceDetailHandler.
+func getTestDetailedSpans(tracer *mocktracer.MockTracer) []*mocktracer.MockSpan {
+	var spans []*mocktracer.MockSpan
+	for _, span := range tracer.FinishedSpans() {
+		if _, ok := span.Tags()["retries"]; ok {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func getTestSpanDecisions(span *mocktracer.MockSpan) [][2]string {
+	var decisions [][2]string
+	for _, record := range span.Logs() {
+		var d [2]string
+		for _, field := range record.Fields {
+			switch field.Key {
+			case "handler":
+				d[0] = field.ValueString
+			case "decision":
+				d[1] = field.ValueString
+			}
+		}
+		if d[0] != "" {
+			decisions = append(decisions, d)
+		}
+	}
+	return decisions
+}
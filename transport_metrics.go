@@ -0,0 +1,208 @@
+package gohttpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TransportStats is the connection statistics of the transport of a client, see WithConnectionMetrics.
+type TransportStats struct {
+	// Created is the number of new connections used by the requests.
+	Created int64
+	// Reused is the number of times an existing connection was reused by a request.
+	Reused int64
+	// Closed is the number of connections that have been closed.
+	Closed int64
+	// IdleClosed is the number of connections that were closed while idle in the pool,
+	// such as by the idle timeout or CloseIdleConnections.
+	IdleClosed int64
+	// Active is the number of connections currently in use by requests.
+	Active int64
+	// Idle is the number of connections currently idle in the pool.
+	Idle int64
+}
+
+// ReuseRate returns the ratio of the requests that reused a connection.
+func (s TransportStats) ReuseRate() float64 {
+	total := s.Created + s.Reused
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Reused) / float64(total)
+}
+
+type connMetrics struct {
+	created    int64
+	reused     int64
+	closed     int64
+	idleClosed int64
+	active     int64
+	idle       int64
+}
+
+func (m *connMetrics) stats() TransportStats {
+	return TransportStats{
+		Created:    atomic.LoadInt64(&m.created),
+		Reused:     atomic.LoadInt64(&m.reused),
+		Closed:     atomic.LoadInt64(&m.closed),
+		IdleClosed: atomic.LoadInt64(&m.idleClosed),
+		Active:     atomic.LoadInt64(&m.active),
+		Idle:       atomic.LoadInt64(&m.idle),
+	}
+}
+
+const (
+	connStateNew int32 = iota
+	connStateActive
+	connStateIdle
+)
+
+// metricsConn tracks whether a connection is in use or idle, so that its closing is counted correctly.
+type metricsConn struct {
+	net.Conn
+	m *connMetrics
+
+	mu     sync.Mutex
+	state  int32
+	uses   int64
+	closed bool
+}
+
+// acquire marks the connection in use and returns the number of its uses.
+func (c *metricsConn) acquire() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.setState(connStateActive)
+	}
+	c.uses++
+	return c.uses
+}
+
+// release marks the connection idle, unless it has been closed or acquired again by another request,
+// since the httptrace hook is called after the connection is put back to the pool.
+func (c *metricsConn) release(uses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed && c.uses == uses {
+		c.setState(connStateIdle)
+	}
+}
+
+func (c *metricsConn) setState(state int32) {
+	c.m.addState(c.state, -1)
+	c.m.addState(state, 1)
+	c.state = state
+}
+
+func (c *metricsConn) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		atomic.AddInt64(&c.m.closed, 1)
+		if c.state == connStateIdle {
+			atomic.AddInt64(&c.m.idleClosed, 1)
+		}
+		c.setState(connStateNew)
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (m *connMetrics) addState(state int32, delta int64) {
+	switch state {
+	case connStateActive:
+		atomic.AddInt64(&m.active, delta)
+	case connStateIdle:
+		atomic.AddInt64(&m.idle, delta)
+	}
+}
+
+// connMetricsTransport counts the connections of the requests by httptrace,
+// and wraps the dialer of an *http.Transport to know when the connections are closed.
+type connMetricsTransport struct {
+	rt http.RoundTripper
+	m  *connMetrics
+}
+
+func newConnMetricsTransport(rt http.RoundTripper, m *connMetrics) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if t, ok := rt.(*http.Transport); ok {
+		t = t.Clone()
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+		}
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &metricsConn{Conn: conn, m: m}, nil
+		}
+		rt = t
+	}
+	return &connMetricsTransport{rt: rt, m: m}
+}
+
+func (t *connMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		conn *metricsConn
+		uses int64
+	)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&t.m.reused, 1)
+			} else {
+				atomic.AddInt64(&t.m.created, 1)
+			}
+			conn = unwrapMetricsConn(info.Conn)
+			if conn != nil {
+				uses = conn.acquire()
+			}
+		},
+		PutIdleConn: func(err error) {
+			if err == nil && conn != nil {
+				conn.release(uses)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.rt.RoundTrip(req)
+}
+
+func unwrapMetricsConn(conn net.Conn) *metricsConn {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	c, _ := conn.(*metricsConn)
+	return c
+}
+
+// TransportStats returns the connection statistics of the client, which are all zero unless WithConnectionMetrics is set.
+// The Closed, IdleClosed, Active and Idle statistics are only available when the transport is an *http.Transport.
+func (c *Client) TransportStats() TransportStats {
+	if c.connMetrics == nil {
+		return TransportStats{}
+	}
+	return c.connMetrics.stats()
+}
+
+// CloseIdleConnections closes the idle connections of the underlying transport.
+func (t *connMetricsTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if ci, ok := t.rt.(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,51 @@
+package gohttpclient
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/close" {
+			w.Header().Set("Connection", "close")
+		}
+		_, _ = w.Write([]byte("hello world"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithConnectionMetrics())
+	get := func(path string) {
+		resp, err := c.Get(srv.URL + path)
+		require.Nil(t, err)
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+	}
+
+	for i := 0; i < 3; i++ {
+		get("/")
+	}
+	require.Eventually(t, func() bool {
+		return c.TransportStats() == TransportStats{Created: 1, Reused: 2, Idle: 1}
+	}, time.Second, time.Millisecond)
+	require.Equal(t, 2.0/3.0, c.TransportStats().ReuseRate())
+
+	c.client.CloseIdleConnections()
+	require.Equal(t, TransportStats{Created: 1, Reused: 2, Closed: 1, IdleClosed: 1}, c.TransportStats())
+
+	get("/close")
+	require.Eventually(t, func() bool {
+		return c.TransportStats() == TransportStats{Created: 2, Reused: 2, Closed: 2, IdleClosed: 1}
+	}, time.Second, time.Millisecond)
+}
+
+func TestConnectionMetrics_Disabled(t *testing.T) {
+	c := NewClient()
+	require.Equal(t, TransportStats{}, c.TransportStats())
+	require.Equal(t, 0.0, c.TransportStats().ReuseRate())
+}
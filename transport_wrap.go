@@ -0,0 +1,59 @@
+package gohttpclient
+
+import (
+	"net/http"
+
+	"github.com/opentracing-contrib/go-stdlib/nethttp"
+)
+
+// RoundTripperWrapper wraps the transport of the client with a RoundTripper, such as one that signs the requests.
+type RoundTripperWrapper func(rt http.RoundTripper) http.RoundTripper
+
+// TransportWrapOrder is the order of the tracing transport and the RoundTripperWrappers
+// of WithRoundTripperWrapper when they wrap the transport of the client.
+type TransportWrapOrder int
+
+const (
+	// TransportWrapTraceOutermost wraps the tracing transport around the RoundTripperWrappers,
+	// so that the span covers them and they see the headers of the span injected into the request.
+	TransportWrapTraceOutermost TransportWrapOrder = iota
+	// TransportWrapUserOutermost wraps the RoundTripperWrappers around the tracing transport,
+	// so that the span only covers the transport of the client.
+	TransportWrapUserOutermost
+)
+
+func (o TransportWrapOrder) String() string {
+	switch o {
+	case TransportWrapTraceOutermost:
+		return "trace_outermost"
+	case TransportWrapUserOutermost:
+		return "user_outermost"
+	}
+	return "unknown"
+}
+
+// wrapTransport wraps rt with the RoundTripperWrappers and the tracing transport in the order,
+// the wrappers are applied in their order, so the last one is the outermost of them.
+// The wrappers wrap http.DefaultTransport when rt is nil.
+func wrapTransport(rt http.RoundTripper, wrappers []RoundTripperWrapper, trace bool, order TransportWrapOrder) http.RoundTripper {
+	wrapUser := func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil && len(wrappers) > 0 {
+			rt = http.DefaultTransport
+		}
+		for _, w := range wrappers {
+			rt = w(rt)
+		}
+		return rt
+	}
+	wrapTrace := func(rt http.RoundTripper) http.RoundTripper {
+		if !trace {
+			return rt
+		}
+		return &nethttp.Transport{RoundTripper: rt}
+	}
+
+	if order == TransportWrapUserOutermost {
+		return wrapUser(wrapTrace(rt))
+	}
+	return wrapTrace(wrapUser(rt))
+}
@@ -0,0 +1,63 @@
+package gohttpclient
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTransportWrapOrder(t *testing.T) {
+	ts := NewTestServer(t, map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) {},
+	})
+
+	tests := []struct {
+		order  TransportWrapOrder
+		traced bool
+	}{
+		{TransportWrapTraceOutermost, true},
+		{TransportWrapUserOutermost, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order.String(), func(t *testing.T) {
+			var calls []string
+			wrapper := func(name string) RoundTripperWrapper {
+				return func(rt http.RoundTripper) http.RoundTripper {
+					return testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+						// The span context is injected into the headers by the tracing transport.
+						calls = append(calls, name)
+						require.Equal(t, tt.traced, req.Header.Get("mockpfx-ids-traceid") != "")
+						return rt.RoundTrip(req)
+					})
+				}
+			}
+			traceOption := NewTraceOption()
+			traceOption.Tracer = mocktracer.New()
+			c := NewClient(
+				WithTraceOption(traceOption),
+				WithRoundTripperWrapper(wrapper("inner")),
+				WithRoundTripperWrapper(wrapper("outer")),
+				WithTransportWrapOrder(tt.order),
+			)
+			resp, err := c.Get(ts.URL("/"))
+			require.Nil(t, err)
+			resp.Body.Close()
+			require.Equal(t, []string{"outer", "inner"}, calls)
+		})
+	}
+
+	// The wrappers work without tracing.
+	var wrapped bool
+	c := NewClient(WithRoundTripperWrapper(func(rt http.RoundTripper) http.RoundTripper {
+		return testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			wrapped = true
+			return rt.RoundTrip(req)
+		})
+	}))
+	resp, err := c.Get(ts.URL("/"))
+	require.Nil(t, err)
+	resp.Body.Close()
+	require.True(t, wrapped)
+}